@@ -0,0 +1,104 @@
+package tcore
+
+import (
+	"errors"
+	"math"
+)
+
+var ErrUnknownAggregate = errors.New("unknown aggregate function")
+
+// ==========================================
+// 📊 降采样聚合
+// ==========================================
+
+// aggregators 把一个窗口内的数值聚合成一个值
+var aggregators = map[string]func(vals []float64) float64{
+	"avg": func(vals []float64) float64 {
+		sum := 0.0
+		for _, v := range vals {
+			sum += v
+		}
+		return sum / float64(len(vals))
+	},
+	"sum": func(vals []float64) float64 {
+		sum := 0.0
+		for _, v := range vals {
+			sum += v
+		}
+		return sum
+	},
+	"min": func(vals []float64) float64 {
+		m := vals[0]
+		for _, v := range vals[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	},
+	"max": func(vals []float64) float64 {
+		m := vals[0]
+		for _, v := range vals[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	},
+	"count": func(vals []float64) float64 { return float64(len(vals)) },
+	"first": func(vals []float64) float64 { return vals[0] },
+	"last":  func(vals []float64) float64 { return vals[len(vals)-1] },
+}
+
+// IsAggregate 判断是否是支持的聚合函数：avg / sum / min / max / count / first / last
+func IsAggregate(name string) bool {
+	_, ok := aggregators[name]
+	return ok
+}
+
+// Aggregate 按 step 宽度切窗口，窗口对齐到 step 的整数倍，时间戳取窗口起点
+// points 必须已经按时间排序，且是 float 或 uint 类型；陈旧标记不参与聚合，没有点的窗口不输出
+func Aggregate(points []TypedPoint, step int64, agg string) ([]TypedPoint, error) {
+	fn, ok := aggregators[agg]
+	if !ok {
+		return nil, ErrUnknownAggregate
+	}
+	if step <= 0 {
+		return nil, ErrInvalidRange
+	}
+
+	var result []TypedPoint
+	var vals []float64
+	var bucket int64
+	for _, p := range points {
+		if p.Value.Type != TypeFloat && p.Value.Type != TypeUint {
+			return nil, ErrTypeMismatch
+		}
+		if isStale(p.Value) {
+			continue
+		}
+		b := floorDiv(p.Time, step) * step
+		if len(vals) > 0 && b != bucket {
+			result = append(result, TypedPoint{Time: bucket, Value: FloatValue(fn(vals))})
+			vals = vals[:0]
+		}
+		bucket = b
+		vals = append(vals, numeric(p.Value))
+	}
+	if len(vals) > 0 {
+		result = append(result, TypedPoint{Time: bucket, Value: FloatValue(fn(vals))})
+	}
+	return result, nil
+}
+
+func numeric(v Value) float64 {
+	if v.Type == TypeUint {
+		return float64(v.Uint)
+	}
+	return v.Float
+}
+
+// floorDiv 向负无穷取整的除法，保证负时间戳也落进正确的窗口
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
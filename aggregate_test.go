@@ -0,0 +1,36 @@
+package tcore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAggregate_NegativeBuckets(t *testing.T) {
+	points := []TypedPoint{
+		{Time: -15, Value: FloatValue(1)},
+		{Time: -5, Value: FloatValue(2)},
+		{Time: -1, Value: FloatValue(4)},
+		{Time: 0, Value: FloatValue(8)},
+	}
+	got, err := Aggregate(points, 10, "max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Time != -20 || got[1].Time != -10 || got[1].Value.Float != 4 || got[2].Time != 0 {
+		t.Fatalf("unexpected buckets %+v", got)
+	}
+}
+
+func TestAggregate_Errors(t *testing.T) {
+	points := []TypedPoint{{Time: 1, Value: UintValue(3)}, {Time: 2, Value: StringValue("x")}}
+	if _, err := Aggregate(points, 10, "median"); !errors.Is(err, ErrUnknownAggregate) {
+		t.Fatalf("expected ErrUnknownAggregate, got %v", err)
+	}
+	if _, err := Aggregate(points, 10, "sum"); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+	got, err := Aggregate(points[:1], 10, "sum")
+	if err != nil || len(got) != 1 || got[0].Value.Float != 3 {
+		t.Fatalf("uint sum: %+v, %v", got, err)
+	}
+}
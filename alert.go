@@ -0,0 +1,659 @@
+package tcore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	alertFileName = "alerts.json"
+
+	// alertTickInterval 检查数据缺失、保存告警状态的周期
+	alertTickInterval = time.Second
+
+	// alertQueueSize 待发送通知的队列长度；通知渠道太慢时新的通知会被丢弃，写入永远不会被它卡住
+	alertQueueSize = 1024
+
+	// alertNotifyTimeout 单次通知的超时
+	alertNotifyTimeout = 10 * time.Second
+)
+
+var (
+	ErrBadAlertRule      = errors.New("invalid alert rule")
+	ErrAlertRuleExists   = errors.New("alert rule already exists")
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+)
+
+// AlertKind 告警条件的种类
+type AlertKind string
+
+const (
+	AlertThreshold AlertKind = "threshold" // 值与阈值比较
+	AlertRate      AlertKind = "rate"      // 相邻两点的变化速度 (每秒变化量的绝对值) 与阈值比较
+	AlertAbsent    AlertKind = "absent"    // 超过 Absent 没有收到数据
+)
+
+// AlertState 告警状态；条件不成立、也没有触发过的告警不会出现在 Alerts() 里
+type AlertState string
+
+const (
+	AlertPending  AlertState = "pending"  // 条件成立，但还没持续满 For
+	AlertFiring   AlertState = "firing"   // 已触发
+	AlertResolved AlertState = "resolved" // 触发过，条件已不再成立
+)
+
+// AlertRule 一条告警规则，对 Series 选中的每条数值型时间线分别求值
+type AlertRule struct {
+	Name      string
+	Series    string        // 时间线选择器，如 temperature{site="plant-3"}，见 ParseSelector
+	Kind      AlertKind     // 默认 threshold
+	Op        string        // 比较符 > >= < <=，默认 >
+	Threshold float64       // threshold 规则比较点的值，rate 规则比较每秒变化量
+	For       time.Duration // 条件持续这么久才触发，按数据的时间戳计；absent 规则在 Absent 之后再等这么久
+	Absent    time.Duration // absent 规则：多久没有数据算缺失，按墙上时钟计
+	TimeUnit  time.Duration // DB 里时间戳的单位，默认纳秒
+}
+
+// Alert 一条时间线在一条规则下的告警
+type Alert struct {
+	Rule       string
+	Series     string
+	State      AlertState
+	Value      float64   // 最近一次求值的值：threshold 为点的值，rate 为每秒变化量，absent 为没有数据的秒数
+	ActiveAt   time.Time // 条件开始成立的时间
+	FiredAt    time.Time // 触发的时间
+	ResolvedAt time.Time // 恢复的时间
+}
+
+// AlertEvent 告警触发或恢复时发给通知渠道的事件
+type AlertEvent struct {
+	Alert
+	Kind      AlertKind
+	Op        string
+	Threshold float64
+}
+
+// AlertNotifier 告警通知渠道；Notify 在后台协程里串行调用，不会阻塞写入
+type AlertNotifier interface {
+	Notify(ctx context.Context, ev AlertEvent) error
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// AddAlertRule 🚨 注册告警规则，保存在数据目录里，重启后继续生效
+// threshold / rate 规则在数据写入时求值，absent 规则由后台每秒检查一次
+func (db *DB) AddAlertRule(rule AlertRule) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	r, err := compileAlertRule(rule)
+	if err != nil {
+		return err
+	}
+	return db.alerts.addRule(r)
+}
+
+// RemoveAlertRule 删除告警规则和它的所有告警
+func (db *DB) RemoveAlertRule(name string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	return db.alerts.removeRule(name)
+}
+
+// AlertRules 所有告警规则，按名字排序
+func (db *DB) AlertRules() []AlertRule {
+	db.alerts.mu.Lock()
+	defer db.alerts.mu.Unlock()
+	rules := make([]AlertRule, 0, len(db.alerts.rules))
+	for _, r := range db.alerts.rules {
+		rules = append(rules, r.AlertRule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Alerts 当前处于 pending / firing / resolved 状态的告警，按规则名和时间线名排序
+func (db *DB) Alerts() []Alert {
+	db.alerts.mu.Lock()
+	defer db.alerts.mu.Unlock()
+	var list []Alert
+	for _, st := range db.alerts.states {
+		if st.State != "" {
+			list = append(list, st.Alert)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Rule != list[j].Rule {
+			return list[i].Rule < list[j].Rule
+		}
+		return list[i].Series < list[j].Series
+	})
+	return list
+}
+
+// AddAlertNotifier 📣 增加一个通知渠道，告警触发和恢复时都会通知
+func (db *DB) AddAlertNotifier(n AlertNotifier) {
+	db.alerts.mu.Lock()
+	defer db.alerts.mu.Unlock()
+	db.alerts.notifiers = append(db.alerts.notifiers, n)
+}
+
+// ==========================================
+// 🔒 规则
+// ==========================================
+
+// alertRule 编译好的规则
+type alertRule struct {
+	AlertRule
+	sel *Selector
+}
+
+func compileAlertRule(rule AlertRule) (*alertRule, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrBadAlertRule)
+	}
+	if rule.Kind == "" {
+		rule.Kind = AlertThreshold
+	}
+	if rule.Op == "" {
+		rule.Op = ">"
+	}
+	if rule.TimeUnit <= 0 {
+		rule.TimeUnit = time.Nanosecond
+	}
+	switch rule.Kind {
+	case AlertThreshold, AlertRate:
+		if math.IsNaN(rule.Threshold) {
+			return nil, fmt.Errorf("%w: threshold is NaN", ErrBadAlertRule)
+		}
+	case AlertAbsent:
+		if rule.Absent <= 0 {
+			return nil, fmt.Errorf("%w: absent rule needs a positive Absent", ErrBadAlertRule)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrBadAlertRule, rule.Kind)
+	}
+	switch rule.Op {
+	case ">", ">=", "<", "<=":
+	default:
+		return nil, fmt.Errorf("%w: unknown operator %q", ErrBadAlertRule, rule.Op)
+	}
+	if rule.For < 0 {
+		return nil, fmt.Errorf("%w: negative For", ErrBadAlertRule)
+	}
+	sel, err := ParseSelector(rule.Series)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadAlertRule, err)
+	}
+	return &alertRule{AlertRule: rule, sel: sel}, nil
+}
+
+func (r *alertRule) compare(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	default:
+		return v <= r.Threshold
+	}
+}
+
+// timeOf 把 DB 的时间戳换成 time.Time
+func (r *alertRule) timeOf(ts int64) time.Time {
+	return time.Unix(0, ts*int64(r.TimeUnit))
+}
+
+// ==========================================
+// 🔒 状态
+// ==========================================
+
+// alertKey 一条规则下的一条时间线
+type alertKey struct {
+	rule, series string
+}
+
+// alertSeries 一条时间线在一条规则下的求值状态
+type alertSeries struct {
+	Alert
+	lastT    int64 // 上一个参与求值的点，乱序到达的旧点不参与求值
+	lastV    float64
+	hasLast  bool
+	lastSeen time.Time // 最近一次收到数据的墙上时间，absent 规则用
+}
+
+// alertManager 告警规则、状态和通知
+type alertManager struct {
+	path string
+
+	mu        sync.Mutex // 保护下面所有字段
+	rules     map[string]*alertRule
+	states    map[alertKey]*alertSeries
+	match     map[string][]*alertRule // 时间线名 -> 适用的规则，规则变化时清空
+	notifiers []AlertNotifier
+	dirty     bool      // 状态有变化，等后台保存
+	started   time.Time // 没收到过数据的时间线，缺失时间从这里算起
+	clock     func() time.Time
+	active    atomic.Bool // 有规则；没有规则时写入路径不用拿锁
+
+	fileMu sync.Mutex // 保护 alerts.json 的读写，快照也要拿它；与 mu 同时持有时先拿 fileMu
+	queue  chan AlertEvent
+}
+
+// alertFile alerts.json 的内容：规则和告警状态
+type alertFile struct {
+	Rules  []alertRuleFile  `json:"rules"`
+	Alerts []alertFileEntry `json:"alerts,omitempty"`
+}
+
+type alertRuleFile struct {
+	Name      string    `json:"name"`
+	Series    string    `json:"series"`
+	Kind      AlertKind `json:"kind"`
+	Op        string    `json:"op"`
+	Threshold float64   `json:"threshold,omitempty"`
+	For       string    `json:"for,omitempty"`
+	Absent    string    `json:"absent,omitempty"`
+	TimeUnit  string    `json:"time_unit"`
+}
+
+type alertFileEntry struct {
+	Rule       string     `json:"rule"`
+	Series     string     `json:"series"`
+	State      AlertState `json:"state"`
+	Value      float64    `json:"value"`
+	ActiveAt   time.Time  `json:"active_at"`
+	FiredAt    time.Time  `json:"fired_at"`
+	ResolvedAt time.Time  `json:"resolved_at"`
+}
+
+// openAlerts 加载规则和告警状态；文件不存在表示没有规则
+func openAlerts(dir string) (*alertManager, error) {
+	am := &alertManager{
+		path:    filepath.Join(dir, alertFileName),
+		rules:   make(map[string]*alertRule),
+		states:  make(map[alertKey]*alertSeries),
+		match:   make(map[string][]*alertRule),
+		started: time.Now(),
+		clock:   time.Now,
+		queue:   make(chan AlertEvent, alertQueueSize),
+	}
+	data, err := os.ReadFile(am.path)
+	if os.IsNotExist(err) {
+		return am, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f alertFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", alertFileName, err)
+	}
+	for _, fr := range f.Rules {
+		rule := AlertRule{Name: fr.Name, Series: fr.Series, Kind: fr.Kind, Op: fr.Op, Threshold: fr.Threshold}
+		for _, d := range []struct {
+			s string
+			d *time.Duration
+		}{{fr.For, &rule.For}, {fr.Absent, &rule.Absent}, {fr.TimeUnit, &rule.TimeUnit}} {
+			if d.s == "" {
+				continue
+			}
+			if *d.d, err = ParseRollupDuration(d.s); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", alertFileName, fr.Name, err)
+			}
+		}
+		r, err := compileAlertRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", alertFileName, err)
+		}
+		am.rules[r.Name] = r
+	}
+	am.active.Store(len(am.rules) > 0)
+	for _, fa := range f.Alerts {
+		if am.rules[fa.Rule] == nil {
+			continue
+		}
+		am.states[alertKey{fa.Rule, fa.Series}] = &alertSeries{Alert: Alert{
+			Rule: fa.Rule, Series: fa.Series, State: fa.State, Value: fa.Value,
+			ActiveAt: fa.ActiveAt, FiredAt: fa.FiredAt, ResolvedAt: fa.ResolvedAt,
+		}}
+	}
+	return am, nil
+}
+
+func (am *alertManager) addRule(r *alertRule) error {
+	am.mu.Lock()
+	if _, ok := am.rules[r.Name]; ok {
+		am.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrAlertRuleExists, r.Name)
+	}
+	am.rules[r.Name] = r
+	am.match = make(map[string][]*alertRule)
+	am.active.Store(true)
+	am.mu.Unlock()
+	return am.save()
+}
+
+func (am *alertManager) removeRule(name string) error {
+	am.mu.Lock()
+	if _, ok := am.rules[name]; !ok {
+		am.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrAlertRuleNotFound, name)
+	}
+	delete(am.rules, name)
+	for key := range am.states {
+		if key.rule == name {
+			delete(am.states, key)
+		}
+	}
+	am.match = make(map[string][]*alertRule)
+	am.active.Store(len(am.rules) > 0)
+	am.mu.Unlock()
+	return am.save()
+}
+
+// renameSeries 时间线改名：两个名字的匹配缓存作废，规则仍选中新名字的告警状态跟过去，其余丢弃
+func (am *alertManager) renameSeries(oldName, newName string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	delete(am.match, oldName)
+	delete(am.match, newName)
+	for key, st := range am.states {
+		if key.series != oldName {
+			continue
+		}
+		delete(am.states, key)
+		if r := am.rules[key.rule]; r != nil && r.sel.Match(newName) {
+			st.Series = newName
+			am.states[alertKey{key.rule, newName}] = st
+		}
+		am.dirty = true
+	}
+}
+
+// save 把规则和告警状态写进 alerts.json
+// 先拿 fileMu 再取状态：并发的两次保存按取状态的先后依次落盘，旧的状态不会盖掉新的
+func (am *alertManager) save() error {
+	am.fileMu.Lock()
+	defer am.fileMu.Unlock()
+
+	am.mu.Lock()
+	var f alertFile
+	for _, r := range am.rules {
+		fr := alertRuleFile{Name: r.Name, Series: r.Series, Kind: r.Kind, Op: r.Op, Threshold: r.Threshold, TimeUnit: formatRollupDuration(r.TimeUnit)}
+		if r.For > 0 {
+			fr.For = formatRollupDuration(r.For)
+		}
+		if r.Absent > 0 {
+			fr.Absent = formatRollupDuration(r.Absent)
+		}
+		f.Rules = append(f.Rules, fr)
+	}
+	for _, st := range am.states {
+		if st.State == "" {
+			continue
+		}
+		f.Alerts = append(f.Alerts, alertFileEntry{
+			Rule: st.Rule, Series: st.Series, State: st.State, Value: st.Value,
+			ActiveAt: st.ActiveAt, FiredAt: st.FiredAt, ResolvedAt: st.ResolvedAt,
+		})
+	}
+	am.dirty = false
+	am.mu.Unlock()
+
+	sort.Slice(f.Rules, func(i, j int) bool { return f.Rules[i].Name < f.Rules[j].Name })
+	sort.Slice(f.Alerts, func(i, j int) bool {
+		if f.Alerts[i].Rule != f.Alerts[j].Rule {
+			return f.Alerts[i].Rule < f.Alerts[j].Rule
+		}
+		return f.Alerts[i].Series < f.Alerts[j].Series
+	})
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(am.path, data); err != nil {
+		am.mu.Lock()
+		am.dirty = true // 下一轮再试
+		am.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// snapshotFile 快照用：alerts.json 的当前内容，没有规则时返回 nil
+func (am *alertManager) snapshotFile() ([]byte, error) {
+	am.fileMu.Lock()
+	defer am.fileMu.Unlock()
+	data, err := os.ReadFile(am.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// ==========================================
+// 🔒 求值
+// ==========================================
+
+// rulesFor 适用于这条时间线的规则；调用方持有 am.mu
+func (am *alertManager) rulesFor(name string) []*alertRule {
+	rules, ok := am.match[name]
+	if !ok {
+		for _, r := range am.rules {
+			if r.sel.Match(name) {
+				rules = append(rules, r)
+			}
+		}
+		am.match[name] = rules
+	}
+	return rules
+}
+
+// stateFor 取出 (必要时新建) 求值状态；调用方持有 am.mu
+func (am *alertManager) stateFor(rule, series string) *alertSeries {
+	key := alertKey{rule, series}
+	st := am.states[key]
+	if st == nil {
+		st = &alertSeries{Alert: Alert{Rule: rule, Series: series}, lastSeen: am.started}
+		am.states[key] = st
+	}
+	return st
+}
+
+// observe 写入路径上调用：用新到的点对这条时间线的规则求值
+func (am *alertManager) observe(name string, ts int64, v float64) {
+	if !am.active.Load() {
+		return
+	}
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	rules := am.rulesFor(name)
+	if len(rules) == 0 {
+		return
+	}
+	now := am.clock()
+	for _, r := range rules {
+		st := am.stateFor(r.Name, name)
+		st.lastSeen = now
+		switch r.Kind {
+		case AlertAbsent:
+			am.evaluate(r, st, false, 0, now)
+		case AlertThreshold, AlertRate:
+			if st.hasLast && ts <= st.lastT {
+				continue // 乱序或重复的点
+			}
+			prevT, prevV, hadLast := st.lastT, st.lastV, st.hasLast
+			st.lastT, st.lastV, st.hasLast = ts, v, true
+			val := v
+			if r.Kind == AlertRate {
+				if !hadLast {
+					continue
+				}
+				seconds := float64(ts-prevT) * float64(r.TimeUnit) / float64(time.Second)
+				val = math.Abs(v-prevV) / seconds
+			}
+			am.evaluate(r, st, r.compare(val), val, r.timeOf(ts))
+		}
+	}
+}
+
+// checkAbsent 后台调用：检查 absent 规则下每条时间线多久没有数据了
+func (am *alertManager) checkAbsent(keys []string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	now := am.clock()
+	live := make(map[string]bool, len(keys))
+	for _, name := range keys {
+		live[name] = true
+		for _, r := range am.rulesFor(name) {
+			if r.Kind != AlertAbsent {
+				continue
+			}
+			st := am.stateFor(r.Name, name)
+			silent := now.Sub(st.lastSeen)
+			am.evaluate(r, st, silent >= r.Absent, silent.Seconds(), now)
+		}
+	}
+	// 时间线被删掉了：它的告警一并清掉
+	for key := range am.states {
+		if !live[key.series] {
+			delete(am.states, key)
+			am.dirty = true
+		}
+	}
+}
+
+// evaluate 推进状态机：条件成立 -> pending -> (满 For) firing -> 条件不成立 -> resolved
+// 调用方持有 am.mu
+func (am *alertManager) evaluate(r *alertRule, st *alertSeries, cond bool, val float64, at time.Time) {
+	if cond {
+		if st.State == "" || st.State == AlertResolved {
+			st.State, st.ActiveAt = AlertPending, at
+			st.FiredAt, st.ResolvedAt = time.Time{}, time.Time{}
+			am.dirty = true
+		}
+		st.Value = val
+		if st.State == AlertPending && at.Sub(st.ActiveAt) >= r.For {
+			st.State, st.FiredAt = AlertFiring, at
+			am.dirty = true
+			am.emit(r, st)
+		}
+		return
+	}
+	switch st.State {
+	case AlertPending:
+		st.State = "" // 没持续满 For，不算触发过
+		am.dirty = true
+	case AlertFiring:
+		st.State, st.ResolvedAt, st.Value = AlertResolved, at, val
+		am.dirty = true
+		am.emit(r, st)
+	}
+}
+
+// emit 把事件放进通知队列；队列满了就丢弃，不阻塞写入。调用方持有 am.mu
+func (am *alertManager) emit(r *alertRule, st *alertSeries) {
+	if len(am.notifiers) == 0 {
+		return
+	}
+	ev := AlertEvent{Alert: st.Alert, Kind: r.Kind, Op: r.Op, Threshold: r.Threshold}
+	select {
+	case am.queue <- ev:
+	default:
+		fmt.Printf("⚠️ 告警通知队列已满，丢弃 %s %s 的 %s 通知\n", ev.Rule, ev.Series, ev.State)
+	}
+}
+
+// ==========================================
+// 🔒 后台任务
+// ==========================================
+
+// startAlerts 两个后台协程：一个每秒检查缺失并保存状态，一个发送通知
+func (db *DB) startAlerts() {
+	am := db.alerts
+	db.wg.Add(2)
+	go func() {
+		defer db.wg.Done()
+		ticker := time.NewTicker(alertTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.stopCh:
+				am.saveIfDirty()
+				return
+			case <-ticker.C:
+			}
+			am.mu.Lock()
+			hasAbsent := false
+			for _, r := range am.rules {
+				hasAbsent = hasAbsent || r.Kind == AlertAbsent
+			}
+			am.mu.Unlock()
+			if hasAbsent {
+				am.checkAbsent(db.Keys())
+			}
+			am.saveIfDirty()
+		}
+	}()
+
+	go func() {
+		defer db.wg.Done()
+		for {
+			select {
+			case ev := <-am.queue:
+				am.deliver(ev)
+			case <-db.stopCh:
+				// 关闭前把已经排队的通知发完
+				for {
+					select {
+					case ev := <-am.queue:
+						am.deliver(ev)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (am *alertManager) saveIfDirty() {
+	am.mu.Lock()
+	dirty := am.dirty
+	am.mu.Unlock()
+	if !dirty {
+		return
+	}
+	if err := am.save(); err != nil {
+		fmt.Printf("Error saving alerts: %v\n", err)
+	}
+}
+
+// deliver 依次交给每个通知渠道，失败只记日志
+func (am *alertManager) deliver(ev AlertEvent) {
+	am.mu.Lock()
+	notifiers := append([]AlertNotifier(nil), am.notifiers...)
+	am.mu.Unlock()
+	for _, n := range notifiers {
+		ctx, cancel := context.WithTimeout(context.Background(), alertNotifyTimeout)
+		if err := n.Notify(ctx, ev); err != nil {
+			fmt.Printf("Error sending alert %s %s: %v\n", ev.Rule, ev.Series, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,107 @@
+package tcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ==========================================
+// 📝 日志通知
+// ==========================================
+
+// LogNotifier 把告警写成一行日志
+type LogNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogNotifier w 为 nil 时写到标准输出
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &LogNotifier{w: w}
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	icon, at := "🚨", ev.FiredAt
+	if ev.State == AlertResolved {
+		icon, at = "✅", ev.ResolvedAt
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, err := fmt.Fprintf(n.w, "%s [%s] %s %s: value=%g (%s %s %g) at %s\n",
+		icon, ev.State, ev.Rule, ev.Series, ev.Value, ev.Kind, ev.Op, ev.Threshold, at.UTC().Format(time.RFC3339))
+	return err
+}
+
+// ==========================================
+// 🌐 Webhook 通知
+// ==========================================
+
+// WebhookNotifier 把告警以 JSON POST 到一个 URL，非 2xx 响应算失败
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // 默认 http.DefaultClient，超时由 ctx 控制
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url}
+}
+
+// webhookPayload POST 的请求体
+type webhookPayload struct {
+	Rule       string     `json:"rule"`
+	Series     string     `json:"series"`
+	State      AlertState `json:"state"`
+	Kind       AlertKind  `json:"kind"`
+	Op         string     `json:"op"`
+	Threshold  float64    `json:"threshold"`
+	Value      float64    `json:"value"`
+	ActiveAt   string     `json:"active_at"`
+	FiredAt    string     `json:"fired_at,omitempty"`
+	ResolvedAt string     `json:"resolved_at,omitempty"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	body, err := json.Marshal(webhookPayload{
+		Rule: ev.Rule, Series: ev.Series, State: ev.State, Kind: ev.Kind, Op: ev.Op, Threshold: ev.Threshold, Value: ev.Value,
+		ActiveAt: format(ev.ActiveAt), FiredAt: format(ev.FiredAt), ResolvedAt: format(ev.ResolvedAt),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) // 读完才能复用连接
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", n.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package tcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 通知在后台协程里写，测试协程读
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAlerts(t *testing.T) {
+	dir := t.TempDir()
+
+	// 本地的 Webhook 接收端
+	events := make(chan webhookPayload, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&p) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		events <- p
+	}))
+	defer srv.Close()
+	next := func() webhookPayload {
+		t.Helper()
+		select {
+		case p := <-events:
+			return p
+		case <-time.After(5 * time.Second):
+			t.Fatal("no webhook delivered")
+		}
+		return webhookPayload{}
+	}
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &syncBuffer{}
+	db.AddAlertNotifier(NewLogNotifier(logs))
+	db.AddAlertNotifier(NewWebhookNotifier(srv.URL))
+
+	rules := []AlertRule{
+		{Name: "overheat", Series: `temperature{site="plant-3"}`, Threshold: 85, For: 30 * time.Second, TimeUnit: time.Second},
+		{Name: "spike", Series: "pressure", Kind: AlertRate, Op: ">=", Threshold: 2, TimeUnit: time.Second},
+		{Name: "silent", Series: `temperature{site="plant-3"}`, Kind: AlertAbsent, Absent: 5 * time.Minute},
+	}
+	for _, r := range rules {
+		if err := db.AddAlertRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AddAlertRule(rules[0]); !errors.Is(err, ErrAlertRuleExists) {
+		t.Fatalf("expected ErrAlertRuleExists, got %v", err)
+	}
+	if err := db.AddAlertRule(AlertRule{Name: "x", Series: "a", Op: "=="}); !errors.Is(err, ErrBadAlertRule) {
+		t.Fatalf("expected ErrBadAlertRule, got %v", err)
+	}
+
+	// 超过阈值但没持续满 30 秒：只是 pending，回落后消失，不通知
+	const temp = `temperature{site="plant-3"}`
+	db.Write(temp, 100, 90)
+	db.Write(temp, 110, 91)
+	if a := db.Alerts(); len(a) != 1 || a[0].State != AlertPending || a[0].Rule != "overheat" {
+		t.Fatalf("pending: %+v", a)
+	}
+	db.Write(temp, 120, 80)
+	if a := db.Alerts(); len(a) != 0 {
+		t.Fatalf("expected no alerts, got %+v", a)
+	}
+
+	// 持续 30 秒：触发
+	db.Write(temp, 200, 86)
+	db.Write(temp, 215, 87)
+	db.Write(temp, 230, 88)
+	p := next()
+	if p.Rule != "overheat" || p.Series != temp || p.State != AlertFiring || p.Value != 88 || p.ActiveAt != time.Unix(200, 0).UTC().Format(time.RFC3339Nano) {
+		t.Fatalf("firing: %+v", p)
+	}
+	db.Write(temp, 225, 10) // 乱序的旧点不参与求值
+	db.Write(temp, 240, 70)
+	if p := next(); p.State != AlertResolved || p.ResolvedAt == "" || p.Value != 70 {
+		t.Fatalf("resolved: %+v", p)
+	}
+
+	// 变化速度：10 秒涨了 45，每秒 4.5
+	db.WriteBatch("pressure", []TypedPoint{{Time: 20, Value: FloatValue(60)}, {Time: 0, Value: FloatValue(10)}, {Time: 10, Value: FloatValue(15)}})
+	if p := next(); p.Rule != "spike" || p.State != AlertFiring || p.Value != 4.5 || p.Kind != AlertRate {
+		t.Fatalf("rate: %+v", p)
+	}
+
+	// 5 分钟没有数据
+	t0 := time.Now()
+	db.alerts.mu.Lock()
+	db.alerts.clock = func() time.Time { return t0 }
+	db.alerts.mu.Unlock()
+	db.Write(temp, 300, 20)
+	db.alerts.mu.Lock()
+	db.alerts.clock = func() time.Time { return t0.Add(6 * time.Minute) }
+	db.alerts.mu.Unlock()
+	db.alerts.checkAbsent(db.Keys())
+	if p := next(); p.Rule != "silent" || p.State != AlertFiring || p.Value != 360 {
+		t.Fatalf("absent: %+v", p)
+	}
+	db.Write(temp, 310, 20)
+	if p := next(); p.Rule != "silent" || p.State != AlertResolved {
+		t.Fatalf("absent resolved: %+v", p)
+	}
+	if out := logs.String(); strings.Count(out, "\n") != 5 || !strings.Contains(out, "🚨 [firing] overheat") || !strings.Contains(out, "✅ [resolved] silent") {
+		t.Fatalf("log notifier:\n%s", out)
+	}
+	db.Close()
+
+	// 重启：规则和告警状态都还在
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if r := db.AlertRules(); len(r) != 3 || r[0].Name != "overheat" || r[0].For != 30*time.Second || r[1].Kind != AlertAbsent {
+		t.Fatalf("rules after reopen: %+v", r)
+	}
+	a := db.Alerts()
+	if len(a) != 3 || a[0].State != AlertResolved || a[1].State != AlertResolved || a[2].Rule != "spike" || a[2].State != AlertFiring {
+		t.Fatalf("alerts after reopen: %+v", a)
+	}
+
+	// 没有通知渠道也照常求值；重启后第一个点只用来算下一次的变化速度
+	db.Write("pressure", 30, 60)
+	db.Write("pressure", 40, 61)
+	if a := db.Alerts(); a[2].State != AlertResolved {
+		t.Fatalf("spike after drop: %+v", a[2])
+	}
+	// 删掉规则，它的告警一并消失
+	if err := db.RemoveAlertRule("spike"); err != nil || len(db.Alerts()) != 2 {
+		t.Fatalf("remove: %v %+v", err, db.Alerts())
+	}
+	if err := db.RemoveAlertRule("spike"); !errors.Is(err, ErrAlertRuleNotFound) {
+		t.Fatalf("expected ErrAlertRuleNotFound, got %v", err)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	err := NewWebhookNotifier(srv.URL).Notify(context.Background(), AlertEvent{Alert: Alert{Rule: "r", State: AlertFiring}})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected a 503 error, got %v", err)
+	}
+}
+
+func TestAlertsSaveAfterWaitingForFile(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 别的保存正在写文件：这次保存在等 fileMu
+	db.alerts.fileMu.Lock()
+	saved := make(chan error)
+	go func() { saved <- db.AddAlertRule(AlertRule{Name: "first", Series: "boiler", Threshold: 1}) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// 等待期间状态又变了：这次保存写下的必须包含这个变化，不能是开始等待之前的旧状态
+	r, _ := compileAlertRule(AlertRule{Name: "second", Series: "boiler", Threshold: 2})
+	db.alerts.mu.Lock()
+	db.alerts.rules[r.Name] = r
+	db.alerts.mu.Unlock()
+	db.alerts.fileMu.Unlock()
+	if err := <-saved; err != nil {
+		t.Fatal(err)
+	}
+
+	am, err := openAlerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(am.rules) != 2 {
+		t.Fatalf("expected both rules in %s, got %v", alertFileName, am.rules)
+	}
+}
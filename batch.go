@@ -0,0 +1,75 @@
+package tcore
+
+// WriteBatch 📦 批量写入一条时间线 (导入、补数据用)
+// 不经过热数据缓冲：按时间排序、去重 (同一时间戳保留最后一个) 后直接切成大 Block 落盘，
+// 避免几千次小刷盘留下一地碎片。时间线不存在时按第一个点的类型注册；
+// 所有点的类型必须一致，且与已注册的类型相同，否则返回 ErrTypeMismatch
+func (db *DB) WriteBatch(name string, points []TypedPoint) error {
+	if db.pipeline.active.Load() {
+		in := make([]IngestPoint, len(points))
+		for i, p := range points {
+			in[i] = IngestPoint{Series: name, Time: p.Time, Value: p.Value}
+		}
+		return db.ingest(in, true)
+	}
+	return db.writeBatch(name, points)
+}
+
+// writeBatch 不经过写入流水线的 WriteBatch (降采样、连续查询的结果已经是处理过的数据)
+func (db *DB) writeBatch(name string, points []TypedPoint) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	typ := points[0].Value.Type
+	if !typ.valid() {
+		return ErrUnknownType
+	}
+	for _, p := range points {
+		if p.Value.Type != typ {
+			return ErrTypeMismatch
+		}
+	}
+
+	series := db.idx.getOrCreateTypedSeries(name, typ)
+	if series.Type != typ {
+		return ErrTypeMismatch
+	}
+
+	// 排序会改动切片，不能动调用方的数据；字节负载也要复制，调用方之后可能复用它们
+	own := make([]TypedPoint, len(points))
+	for i, p := range points {
+		own[i] = TypedPoint{Time: p.Time, Value: p.Value.clone()}
+	}
+	sorted := sortAndDedupTyped(own)
+	db.rollups.noteWrite(name, sorted[0].Time, sorted[len(sorted)-1].Time)
+	series.noteArrival(sorted[len(sorted)-1])
+	if typ == TypeFloat || typ == TypeUint {
+		for _, p := range sorted {
+			db.alerts.observe(name, p.Time, numeric(p.Value))
+		}
+	}
+	db.subs.publish(name, sorted...)
+	for len(sorted) > 0 {
+		n := min(len(sorted), compactBlockMaxPoints)
+		if err := db.flushBatch(series, sorted[:n]); err != nil {
+			return err
+		}
+		sorted = sorted[n:]
+	}
+	return nil
+}
+
+// flushBatch 把一段已排好序的点写成一个 Block
+func (db *DB) flushBatch(series *Series, points []TypedPoint) error {
+	if series.Type != TypeFloat {
+		return db.flushTypedSeriesData(series, points)
+	}
+	floats := make([]Point, len(points))
+	for i, p := range points {
+		floats[i] = Point{Time: p.Time, Value: p.Value.Float}
+	}
+	return db.flushSeriesData(series, floats)
+}
@@ -0,0 +1,70 @@
+package tcore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWriteBatchAndScan(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 倒序、带重复时间戳，超过一个大 Block 的容量
+	n := compactBlockMaxPoints + 100
+	points := make([]TypedPoint, 0, n+1)
+	for i := n - 1; i >= 0; i-- {
+		points = append(points, TypedPoint{Time: int64(i), Value: FloatValue(float64(i))})
+	}
+	points = append(points, TypedPoint{Time: 5, Value: FloatValue(-5)})
+	if err := db.WriteBatch("boiler", points); err != nil {
+		t.Fatal(err)
+	}
+	if points[0].Time != int64(n-1) {
+		t.Fatal("WriteBatch reordered the caller's slice")
+	}
+	st, _ := db.Stats("boiler")
+	if st.Blocks != 2 || st.Points != int64(n) || st.HotPoints != 0 {
+		t.Fatalf("stats: %+v", st)
+	}
+
+	db.DeleteRange("boiler", 10, 19)
+	db.Write("boiler", int64(n), 1) // 热数据排在最后
+
+	var got []TypedPoint
+	err = db.ScanValues("boiler", 0, int64(n), func(p TypedPoint) error {
+		got = append(got, p)
+		return nil
+	})
+	if err != nil || len(got) != n-10+1 {
+		t.Fatalf("scan: %d points, %v", len(got), err)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].Time <= got[i-1].Time {
+			t.Fatalf("out of order at %d: %+v %+v", i, got[i-1], got[i])
+		}
+	}
+	if got[5].Value.Float != -5 || got[10].Time != 20 || got[len(got)-1].Time != int64(n) {
+		t.Fatalf("unexpected points %+v %+v %+v", got[5], got[10], got[len(got)-1])
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := db.ScanValues("boiler", 0, 100, func(TypedPoint) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Fatalf("fn error: %v after %d calls", err, calls)
+	}
+	if err := db.ScanValues("nope", 0, 1, nil); !errors.Is(err, ErrSeriesNotFound) {
+		t.Fatalf("expected ErrSeriesNotFound, got %v", err)
+	}
+
+	if err := db.WriteBatch("boiler", []TypedPoint{{Time: 1, Value: UintValue(1)}}); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+	if err := db.WriteBatch("mixed", []TypedPoint{{Time: 1, Value: UintValue(1)}, {Time: 2, Value: BoolValue(true)}}); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch for mixed types, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package tcore
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var ErrBlockCorrupted = errors.New("block is corrupted")
+
+// float64 时间线的 Block 编码（其它类型见 typed_block.go）
+//
+//	[SensorID: 4字节] [Count: 4字节] [Count × (Time: 8字节, Value: 8字节 IEEE754)]
+//
+// 全部 BigEndian；长度必须与 Count 严格相符，fsck 靠这一点区分两种编码
+const (
+	blockHeaderSize = 8
+	blockPointSize  = 16
+)
+
+// Block 一次刷盘写出的一段数据：同一条时间线的若干个点
+type Block struct {
+	SensorID uint32
+	Points   []Point
+}
+
+// BlockMeta Block 在磁盘上的位置和时间范围，常驻内存作为冷数据索引
+type BlockMeta struct {
+	FileID  uint32 // 所在 Segment 的 ID
+	MinTime int64
+	MaxTime int64
+	Offset  int64  // Block 数据在 .vlog 里的起点 (长度前缀之后)
+	Size    uint32 // Block 数据的字节数 (不含长度前缀)
+	Count   uint16
+}
+
+// NewBlock 打包一段点
+func NewBlock(sensorID uint32, points []Point) *Block {
+	return &Block{SensorID: sensorID, Points: points}
+}
+
+// encode 序列化为字节
+func (b *Block) encode() ([]byte, error) {
+	buf := make([]byte, blockHeaderSize+blockPointSize*len(b.Points))
+	binary.BigEndian.PutUint32(buf[0:4], b.SensorID)
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(b.Points)))
+	for i, p := range b.Points {
+		pos := blockHeaderSize + blockPointSize*i
+		binary.BigEndian.PutUint64(buf[pos:pos+8], uint64(p.Time))
+		binary.BigEndian.PutUint64(buf[pos+8:pos+16], math.Float64bits(p.Value))
+	}
+	return buf, nil
+}
+
+// decodeBlock 是 encode 的逆过程
+func decodeBlock(data []byte) (*Block, error) {
+	if len(data) < blockHeaderSize {
+		return nil, ErrBlockCorrupted
+	}
+	n := binary.BigEndian.Uint32(data[4:8])
+	if uint64(len(data)) != blockHeaderSize+blockPointSize*uint64(n) {
+		return nil, ErrBlockCorrupted
+	}
+	b := &Block{SensorID: binary.BigEndian.Uint32(data[0:4]), Points: make([]Point, n)}
+	for i := range b.Points {
+		pos := blockHeaderSize + blockPointSize*i
+		b.Points[i] = Point{
+			Time:  int64(binary.BigEndian.Uint64(data[pos : pos+8])),
+			Value: math.Float64frombits(binary.BigEndian.Uint64(data[pos+8 : pos+16])),
+		}
+	}
+	return b, nil
+}
+
+// toMeta 写盘成功后生成元数据
+func (b *Block) toMeta(fileID uint32, offset int64, size uint32) *BlockMeta {
+	meta := &BlockMeta{FileID: fileID, Offset: offset, Size: size, Count: uint16(len(b.Points))}
+	for i, p := range b.Points {
+		if i == 0 || p.Time < meta.MinTime {
+			meta.MinTime = p.Time
+		}
+		if i == 0 || p.Time > meta.MaxTime {
+			meta.MaxTime = p.Time
+		}
+	}
+	return meta
+}
@@ -2,37 +2,327 @@
 package tcore
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"math"
+	"os"
+	"path/filepath"
 )
 
-// WriteCatalogRecord 记录新生儿诞生：[ID:4字节] + [名字长度:2字节] + [名字内容]
-func WriteCatalogRecord(w io.Writer, id uint32, name string) error {
+const (
+	// catalogFileName 字典文件：SensorID <-> 名字 的映射
+	catalogFileName = "catalog.idx"
+
+	// catalogBackupSuffix 整体重写前留下的原文件副本
+	catalogBackupSuffix = ".bak"
+
+	// 文件头：[Magic: 4字节 "TCAT"] + [Version: 2字节]
+	// 记录：[ID] + [类型] + [名字长度] + [名字] + [CRC]，类型在注册时确定且不可更改
+	//
+	// 没有文件头的是两种旧格式，加载后整体升级：
+	//   - 最早期：[ID] + [名字长度] + [名字]，没有 CRC
+	//   - 加了 CRC 之后：[ID] + [名字长度] + [名字] + [CRC]，还没有类型字段
+	catalogMagic      = "TCAT"
+	catalogVersion    = 1
+	catalogHeaderSize = 6
+
+	// catalogMinRecordSize 最短的记录：没有类型字段、空名字 = 4(ID) + 2(名字长度) + 4(CRC)
+	catalogMinRecordSize = 10
+)
+
+var (
+	ErrCatalogCorrupted = errors.New("catalog record is corrupted")
+	ErrCatalogVersion   = errors.New("unsupported catalog version")
+	ErrNameTooLong      = errors.New("series name is too long")
+)
+
+// catalogRecord 字典中的一条记录
+type catalogRecord struct {
+	ID   uint32
+	Type ValueType
+	Name string
+}
+
+// CatalogReport 记录开机加载字典时发现的问题
+type CatalogReport struct {
+	Records   int     // 成功恢复的记录数
+	Damaged   []int64 // 被跳过的损坏区域的起始偏移
+	Truncated int64   // 末尾被截掉的半截记录字节数，0 表示文件干净地结束
+	Migrated  bool    // 是否从旧格式升级而来
+}
+
+// Clean 字典是否完好无损
+func (r *CatalogReport) Clean() bool {
+	return len(r.Damaged) == 0 && r.Truncated == 0
+}
+
+// WriteCatalogHeader 写入文件头
+func WriteCatalogHeader(w io.Writer) error {
+	buf := make([]byte, catalogHeaderSize)
+	copy(buf[0:4], catalogMagic)
+	binary.BigEndian.PutUint16(buf[4:6], catalogVersion)
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteCatalogRecord 记录新生儿诞生：[ID:4字节] + [类型:1字节] + [名字长度:2字节] + [名字内容] + [CRC:4字节]
+// 同一个 ID 出现多次时以最后一条为准（改名就是追加一条新记录）
+func WriteCatalogRecord(w io.Writer, id uint32, typ ValueType, name string) error {
 	nameLen := len(name)
-	buf := make([]byte, 6+nameLen)
+	if nameLen > math.MaxUint16 {
+		return ErrNameTooLong
+	}
+	buf := make([]byte, 7+nameLen+4)
 
 	binary.BigEndian.PutUint32(buf[0:4], id)
-	binary.BigEndian.PutUint16(buf[4:6], uint16(nameLen))
-	copy(buf[6:], name)
+	buf[4] = byte(typ)
+	binary.BigEndian.PutUint16(buf[5:7], uint16(nameLen))
+	copy(buf[7:], name)
+	binary.BigEndian.PutUint32(buf[7+nameLen:], crc32.ChecksumIEEE(buf[:7+nameLen]))
 
 	_, err := w.Write(buf)
 	return err
 }
 
-// DecodeCatalog 开机扫盘专用：恢复字典映射
-func DecodeCatalog(r io.Reader) (uint32, string, error) {
-	header := make([]byte, 6)
+// DecodeCatalog 逐条解析一条当前版本的记录（调用方需要自己跳过文件头）
+func DecodeCatalog(r io.Reader) (uint32, ValueType, string, error) {
+	header := make([]byte, 7)
 	if _, err := io.ReadFull(r, header); err != nil {
-		return 0, "", err // 包含 io.EOF
+		return 0, 0, "", err // 包含 io.EOF
 	}
 
 	id := binary.BigEndian.Uint32(header[0:4])
-	nameLen := binary.BigEndian.Uint16(header[4:6])
+	typ := ValueType(header[4])
+	nameLen := binary.BigEndian.Uint16(header[5:7])
 
-	nameBuf := make([]byte, nameLen)
-	if _, err := io.ReadFull(r, nameBuf); err != nil {
-		return 0, "", err
+	body := make([]byte, int(nameLen)+4)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, "", err
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write(header)
+	crc.Write(body[:nameLen])
+	if crc.Sum32() != binary.BigEndian.Uint32(body[nameLen:]) {
+		return 0, 0, "", ErrCatalogCorrupted
+	}
+
+	return id, typ, string(body[:nameLen]), nil
+}
+
+// ReadCatalog 开机扫盘专用：解析整个字典文件，跳过损坏的记录
+// 返回的 validEnd 是最后一条完好记录的结束位置，调用方可以据此截掉末尾的半截记录
+func ReadCatalog(data []byte) (records []catalogRecord, report *CatalogReport, validEnd int64, err error) {
+	report = &CatalogReport{}
+
+	if len(data) == 0 {
+		return nil, report, 0, nil
+	}
+
+	pos, typed := catalogHeaderSize, true
+	if len(data) < catalogHeaderSize || string(data[0:4]) != catalogMagic {
+		_, _, checksummed := decodeCatalogAt(data, 0, false)
+		_, _, headerDamaged := decodeCatalogAt(data, catalogHeaderSize, true)
+		switch {
+		case checksummed:
+			// 带 CRC 但没有文件头和类型字段：全部视为 float64，加载后整体升级
+			pos, typed = 0, false
+			report.Migrated = true
+		case headerDamaged:
+			// 文件头坏了，但后面是当前格式的记录：照常恢复，文件头记为损坏区域
+			report.Damaged = append(report.Damaged, 0)
+		default:
+			// 最早期的格式没有 CRC，只有从头到尾严丝合缝地解析下来才认；否则宁可报错，也不拿乱码去覆盖原文件
+			legacy, ok := readLegacyCatalog(data)
+			if !ok {
+				return nil, report, 0, fmt.Errorf("%w: unrecognized catalog header", ErrCatalogCorrupted)
+			}
+			report.Records = len(legacy)
+			report.Migrated = true
+			return legacy, report, int64(len(data)), nil
+		}
+	} else if version := binary.BigEndian.Uint16(data[4:6]); version != catalogVersion {
+		return nil, report, 0, fmt.Errorf("%w: %d", ErrCatalogVersion, version)
+	}
+
+	for pos < len(data) {
+		if rec, size, ok := decodeCatalogAt(data, pos, typed); ok {
+			records = append(records, rec)
+			pos += size
+			continue
+		}
+
+		// 当前位置坏了：向后逐字节寻找下一条能通过 CRC 校验的记录
+		next := -1
+		for q := pos + 1; q+catalogMinRecordSize <= len(data); q++ {
+			if _, _, ok := decodeCatalogAt(data, q, typed); ok {
+				next = q
+				break
+			}
+		}
+		if next < 0 {
+			// 后面再也没有完好的记录：这是一条写了一半的尾巴
+			report.Truncated = int64(len(data) - pos)
+			break
+		}
+		report.Damaged = append(report.Damaged, int64(pos))
+		pos = next
+	}
+
+	report.Records = len(records)
+	return records, report, int64(pos), nil
+}
+
+// decodeCatalogAt 尝试在 pos 处解析一条完整且 CRC 正确的记录，typed 为 false 时是没有类型字段的旧记录
+func decodeCatalogAt(data []byte, pos int, typed bool) (catalogRecord, int, bool) {
+	fixed := 7 // [ID] + [类型] + [名字长度]
+	if !typed {
+		fixed = 6
+	}
+	if pos+fixed > len(data) {
+		return catalogRecord{}, 0, false
+	}
+	nameLen := int(binary.BigEndian.Uint16(data[pos+fixed-2 : pos+fixed]))
+	size := fixed + nameLen + 4
+	if pos+size > len(data) {
+		return catalogRecord{}, 0, false
+	}
+
+	body := data[pos : pos+fixed+nameLen]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[pos+fixed+nameLen:pos+size]) {
+		return catalogRecord{}, 0, false
+	}
+	rec := catalogRecord{
+		ID:   binary.BigEndian.Uint32(body[0:4]),
+		Type: TypeFloat,
+		Name: string(body[fixed:]),
+	}
+	if typed {
+		rec.Type = ValueType(body[4])
+	}
+	return rec, size, true
+}
+
+// readLegacyCatalog 解析没有文件头和 CRC 的旧格式：[ID:4] + [名字长度:2] + [名字]
+// 旧格式无法校验：出现空名字，或者最后一条记录没有恰好落在文件末尾，就不是这种格式 (ok 为 false)
+func readLegacyCatalog(data []byte) (records []catalogRecord, ok bool) {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		header := make([]byte, 6)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, false
+		}
+		name := make([]byte, binary.BigEndian.Uint16(header[4:6]))
+		if len(name) == 0 {
+			return nil, false
+		}
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, false
+		}
+		records = append(records, catalogRecord{ID: binary.BigEndian.Uint32(header[0:4]), Name: string(name)})
+	}
+	return records, true
+}
+
+// openCatalog 打开字典文件并恢复出所有记录
+// 新文件写入文件头；旧格式整体升级；末尾的半截记录被截掉，保证后续追加写在干净的边界上
+func openCatalog(path string) (*os.File, []catalogRecord, *CatalogReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, nil, err
+	}
+
+	records, report, validEnd, err := ReadCatalog(data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if report.Migrated {
+		if err := backupCatalog(path, data); err != nil {
+			return nil, nil, nil, err
+		}
+		fd, err := rewriteCatalog(path, records)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return fd, records, report, nil
+	}
+
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(data) == 0 {
+		if err := WriteCatalogHeader(fd); err != nil {
+			fd.Close()
+			return nil, nil, nil, err
+		}
+	} else if report.Truncated > 0 {
+		if err := fd.Truncate(validEnd); err != nil {
+			fd.Close()
+			return nil, nil, nil, err
+		}
+	}
+	return fd, records, report, nil
+}
+
+// backupCatalog 整体重写 (升级、fsck 丢弃损坏区域) 之前把原文件留一份到 .bak，判断错了还能找回来
+func backupCatalog(path string, data []byte) error {
+	bak, err := os.OpenFile(path+catalogBackupSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := bak.Write(data); err != nil {
+		bak.Close()
+		return err
+	}
+	if err := bak.Sync(); err != nil {
+		bak.Close()
+		return err
+	}
+	return bak.Close()
+}
+
+// rewriteCatalog 用给定的记录原子替换字典文件：写临时文件 -> fsync -> rename -> fsync 目录
+// 返回以追加模式重新打开的新文件句柄
+func rewriteCatalog(path string, records []catalogRecord) (*os.File, error) {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := WriteCatalogHeader(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	for _, rec := range records {
+		if err := WriteCatalogRecord(tmp, rec.ID, rec.Type, rec.Name); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return nil, err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return nil, err
 	}
 
-	return id, string(nameBuf), nil
+	return os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
 }
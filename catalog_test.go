@@ -0,0 +1,278 @@
+package tcore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_RenameSeries(t *testing.T) {
+	dir := t.TempDir()
+
+	db, _ := NewDB(dir)
+	db.flushSeriesData(db.idx.getOrCreateSeries("tmp_sensr"), []Point{{Time: 1, Value: 21.5}})
+	db.Write("other", 1, 1)
+
+	if err := db.RenameSeries("tmp_sensr", "other"); err != ErrSeriesExists {
+		t.Errorf("expected ErrSeriesExists, got %v", err)
+	}
+	if err := db.RenameSeries("tmp_sensr", "temp_sensor"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重启后新名字依然能查到旧数据，旧名字消失
+	db.Close()
+	db, _ = NewDB(dir)
+	defer db.Close()
+
+	points, _ := db.Query("temp_sensor", 0, 10)
+	if len(points) != 1 || points[0].Value != 21.5 {
+		t.Fatalf("expected renamed series to keep its data, got %v", points)
+	}
+	if db.idx.getSeries("tmp_sensr") != nil {
+		t.Error("expected old name to be gone after reload")
+	}
+}
+
+func TestDB_RenameSeriesMigratesState(t *testing.T) {
+	dir := t.TempDir()
+	db, _ := NewDB(dir)
+
+	// 降采样：一小时的数据算出 60 个分钟窗口
+	db.SetRollupConfig(rollupTestConfig())
+	db.rollups.clock = func() time.Time { return time.Unix(3600+30, 0) }
+	var raw []TypedPoint
+	for ts := int64(0); ts < 3600; ts += 10 {
+		raw = append(raw, TypedPoint{Time: ts, Value: FloatValue(float64(ts / 10))})
+	}
+	db.WriteBatch("boiler", raw)
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 告警：模式规则在改名后仍然选中，精确规则不再选中
+	db.alerts.clock = func() time.Time { return time.Unix(3600, 0) }
+	db.AddAlertRule(AlertRule{Name: "hot", Series: "boiler*", Threshold: 100})
+	db.AddAlertRule(AlertRule{Name: "exact", Series: "boiler", Threshold: 100})
+	db.Write("boiler", 3600, 500)
+
+	// 连续查询：Source 和 Target 都按名字引用
+	setCQClock(db, 3600)
+	db.AddContinuousQuery(ContinuousQuery{Name: "avg", Source: "boiler", Step: time.Minute, TimeUnit: time.Second, Target: "boiler_avg", Start: 1})
+	db.Write("boiler_avg", 0, 1)
+
+	if err := db.RenameSeries("boiler", "boiler2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RenameSeries("boiler_avg", "plant_avg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if st, err := db.Stats(RollupSeriesName("boiler2", time.Minute, "count")); err != nil || st.Points+int64(st.HotPoints) != 60 {
+		t.Fatalf("expected rollup series to follow the rename, got %+v (%v)", st, err)
+	}
+	if db.rollups.state["boiler2"] == nil || db.rollups.state["boiler"] != nil {
+		t.Fatalf("expected rollup state to move, got %v", db.rollups.state)
+	}
+	// 接着跑一轮不会重复写已有的窗口
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := db.Stats(RollupSeriesName("boiler2", time.Minute, "count")); st.Points+int64(st.HotPoints) != 60 {
+		t.Fatalf("expected no recomputation after rename, got %+v", st)
+	}
+	if counts, err := db.QueryAggregate("boiler2", 0, 3599, 60, "count"); err != nil || len(counts) != 60 || counts[0].Value.Float != 6 {
+		t.Fatalf("expected rollups to serve the new name, got %v (%v)", counts, err)
+	}
+
+	alerts := db.Alerts()
+	if len(alerts) != 1 || alerts[0].Rule != "hot" || alerts[0].Series != "boiler2" || alerts[0].State != AlertFiring {
+		t.Fatalf("expected the firing alert to follow the rename, got %+v", alerts)
+	}
+	db.Write("boiler2", 3601, 1)
+	if alerts := db.Alerts(); len(alerts) != 1 || alerts[0].State != AlertResolved {
+		t.Fatalf("expected renamed series to resolve its alert, got %+v", alerts)
+	}
+
+	cqs := db.ContinuousQueries()
+	if cqs[0].Source != "boiler2" || cqs[0].Target != "plant_avg" {
+		t.Fatalf("expected continuous query to follow the renames, got %+v", cqs[0])
+	}
+
+	// 重启后依然生效
+	db.Close()
+	db, _ = NewDB(dir)
+	defer db.Close()
+	if db.rollups.state["boiler2"] == nil {
+		t.Error("expected migrated rollup state to be saved")
+	}
+	if cqs := db.ContinuousQueries(); cqs[0].Source != "boiler2" || cqs[0].Target != "plant_avg" {
+		t.Errorf("expected renamed continuous query to be saved, got %+v", cqs[0])
+	}
+}
+
+func TestDB_CompactCatalog(t *testing.T) {
+	dir := t.TempDir()
+
+	db, _ := NewDB(dir)
+	db.Write("typo_sensro", 1, 1)
+	db.Write("sensor", 1, 1)
+	db.DeleteSeries("typo_sensro")
+	db.Write("typo_sensro", 2, 2) // 名字复用，拿到新的 ID
+
+	if err := db.CompactCatalog(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.tombs.deletedSeries()) != 0 {
+		t.Error("expected series tombstone to be pruned with the catalog record")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, catalogFileName))
+	records, _, _, err := ReadCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected 2 live records after compaction, got %d", len(records))
+	}
+
+	// 追加写在新文件上继续生效
+	db.Write("late", 1, 1)
+	db.Close()
+	db, _ = NewDB(dir)
+	defer db.Close()
+	if len(db.Keys()) != 3 {
+		t.Errorf("expected 3 series after reload, got %v", db.Keys())
+	}
+}
+
+func TestOpenCatalog_Recovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, catalogFileName)
+
+	f, _ := os.Create(path)
+	WriteCatalogHeader(f)
+	WriteCatalogRecord(f, 1, TypeFloat, "a")
+	WriteCatalogRecord(f, 2, TypeFloat, "bb") // 稍后把它中间的一个字节改坏
+	WriteCatalogRecord(f, 3, TypeFloat, "ccc")
+	f.Write([]byte{0, 0, 0, 4, 0, 9, 'd'}) // 写了一半的尾巴
+	f.Close()
+
+	data, _ := os.ReadFile(path)
+	data[catalogHeaderSize+12+8] ^= 0xFF // 第二条记录名字里的一个字节
+	os.WriteFile(path, data, 0644)
+
+	fd, records, report, err := openCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+
+	if len(records) != 2 || records[0].ID != 1 || records[1].ID != 3 {
+		t.Errorf("expected records 1 and 3 to survive, got %v", records)
+	}
+	if len(report.Damaged) != 1 || report.Truncated != 7 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if st, _ := fd.Stat(); st.Size() != int64(len(data)-7) {
+		t.Errorf("expected truncated tail to be removed, size %d", st.Size())
+	}
+}
+
+func TestOpenCatalog_MigrateLegacy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, catalogFileName)
+
+	// 旧格式：[ID:4] + [名字长度:2] + [名字]，没有文件头和 CRC
+	os.WriteFile(path, []byte{0, 0, 0, 7, 0, 4, 't', 'e', 'm', 'p'}, 0644)
+
+	fd, records, report, err := openCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+	if !report.Migrated || len(records) != 1 || records[0].Name != "temp" {
+		t.Fatalf("expected legacy record to be migrated, got %v %+v", records, report)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data[:4]) != catalogMagic {
+		t.Error("expected migrated catalog to start with the magic header")
+	}
+}
+
+func TestOpenCatalog_MigrateChecksummedWithoutHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), catalogFileName)
+
+	// 带 CRC 但没有文件头和类型字段：[ID:4] + [名字长度:2] + [名字] + [CRC:4]
+	record := func(id uint32, name string) []byte {
+		buf := binary.BigEndian.AppendUint32(nil, id)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+		buf = append(buf, name...)
+		return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	}
+	data := append(record(7, "temp"), record(8, "humidity")...)
+	os.WriteFile(path, append(data, 0, 0, 0), 0644) // 末尾带一截没写完的记录
+
+	fd, records, report, err := openCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+	if !report.Migrated || report.Truncated != 3 || len(records) != 2 {
+		t.Fatalf("expected 2 migrated records, got %v %+v", records, report)
+	}
+	if records[0] != (catalogRecord{ID: 7, Type: TypeFloat, Name: "temp"}) || records[1].Name != "humidity" {
+		t.Errorf("unexpected records: %v", records)
+	}
+
+	data, _ = os.ReadFile(path)
+	if string(data[:4]) != catalogMagic {
+		t.Error("expected migrated catalog to start with the magic header")
+	}
+}
+
+func TestOpenCatalog_DamagedMagic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), catalogFileName)
+
+	f, _ := os.Create(path)
+	WriteCatalogHeader(f)
+	for i, name := range []string{"a", "bb", "ccc"} {
+		WriteCatalogRecord(f, uint32(i+1), TypeFloat, name)
+	}
+	f.Close()
+	data, _ := os.ReadFile(path)
+	data[0] ^= 0x01 // "TCAT" -> "UCAT"
+	os.WriteFile(path, data, 0644)
+
+	// 记录本身完好：照常恢复，不当成旧格式，也不重写文件
+	fd, records, report, err := openCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Close()
+	if len(records) != 3 || records[2].Name != "ccc" {
+		t.Fatalf("expected all 3 records to survive, got %v", records)
+	}
+	if report.Migrated || len(report.Damaged) != 1 || report.Damaged[0] != 0 {
+		t.Errorf("expected the header to be reported as damaged, got %+v", report)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+		t.Error("catalog must not be rewritten after a damaged header")
+	}
+
+	// 文件头和第一条记录都坏了：既不是任何一种旧格式，也认不出当前格式，报错而不是猜
+	data[catalogHeaderSize+8] ^= 0xFF
+	os.WriteFile(path, data, 0644)
+	if _, _, _, err := openCatalog(path); !errors.Is(err, ErrCatalogCorrupted) {
+		t.Fatalf("expected ErrCatalogCorrupted, got %v", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+		t.Error("catalog must be left untouched when its format is not recognized")
+	}
+}
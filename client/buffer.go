@@ -0,0 +1,261 @@
+package client
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"sync"
+
+	"github.com/Lwxjjr/tcore/protocol"
+)
+
+// buffer 本地写缓冲区：点按写入顺序排队，确认送达后从队头出队
+//
+// 配置了文件路径时，每个点入队的同时追加到磁盘日志，客户端重启后从日志恢复。
+// 日志记录格式：[Length: 4字节] [Write 帧的 Value] [CRC32: 4字节]
+//
+// 出队时并不立刻改写文件：队列清空时整个文件截断为 0，
+// 已确认的部分超过文件一半时才重写一次剩余部分。
+// 因此崩溃重启后可能把一部分已经送达的点再发一遍 (至少一次语义)，
+// 重复的时间戳会在服务端 Compaction 时去重。
+type buffer struct {
+	mu      sync.Mutex
+	samples []protocol.Sample
+	max     int
+	drained chan struct{} // 每次出队后关闭并换新，唤醒等待空间的写入者
+
+	path      string
+	fd        *os.File
+	fileSize  int64 // 日志文件的有效长度
+	ackedSize int64 // 文件头部已经送达、但还没从文件里抹掉的字节数
+}
+
+// openBuffer 创建缓冲区；path 为空时只在内存里缓冲
+func openBuffer(path string, max int) (*buffer, error) {
+	b := &buffer{max: max, path: path, drained: make(chan struct{})}
+	if path == "" {
+		return b, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	samples, valid := decodeBufferLog(data)
+
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// 截掉崩溃时写了一半的尾巴
+	if valid < int64(len(data)) {
+		if err := fd.Truncate(valid); err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+
+	b.samples = samples
+	b.fd = fd
+	b.fileSize = valid
+	return b, nil
+}
+
+// add 入队一个点，返回入队后的长度；缓冲区已满时 ok 为 false
+func (b *buffer) add(s protocol.Sample) (n int, ok bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.samples) >= b.max {
+		return len(b.samples), false, nil
+	}
+	if b.fd != nil {
+		rec, err := encodeBufferRecord(s)
+		if err != nil {
+			return len(b.samples), false, err
+		}
+		if _, err := b.fd.Write(rec); err != nil {
+			b.fd.Truncate(b.fileSize) // 不留半条记录，否则恢复时会在这里停下
+			return len(b.samples), false, err
+		}
+		b.fileSize += int64(len(rec))
+	}
+	b.samples = append(b.samples, s)
+	return len(b.samples), true, nil
+}
+
+// peek 复制队头最多 n 个点，不出队
+func (b *buffer) peek(n int) []protocol.Sample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > len(b.samples) {
+		n = len(b.samples)
+	}
+	return append([]protocol.Sample(nil), b.samples[:n]...)
+}
+
+// drop 队头 n 个点已经送达，出队
+func (b *buffer) drop(n int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.fd != nil {
+		for _, s := range b.samples[:n] {
+			b.ackedSize += bufferRecordSize(s)
+		}
+	}
+	b.samples = append([]protocol.Sample(nil), b.samples[n:]...)
+	close(b.drained)
+	b.drained = make(chan struct{})
+
+	if b.fd == nil {
+		return nil
+	}
+	if len(b.samples) == 0 {
+		if err := b.fd.Truncate(0); err != nil {
+			return err
+		}
+		b.fileSize, b.ackedSize = 0, 0
+		return nil
+	}
+	if b.ackedSize*2 > b.fileSize {
+		return b.rewriteLocked()
+	}
+	return nil
+}
+
+// release 队头 n 个点处理完毕：keep 是其中没有送达、需要重发的点，按原顺序放回队头，其余出队
+func (b *buffer) release(n int, keep []protocol.Sample) error {
+	if len(keep) == 0 {
+		return b.drop(n)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.samples = append(append([]protocol.Sample(nil), keep...), b.samples[n:]...)
+	close(b.drained)
+	b.drained = make(chan struct{})
+	if b.fd == nil {
+		return nil
+	}
+	// 放回的点在日志里散落在已送达的记录之间，直接重写一遍 (只有服务端出错时才走到这里)
+	return b.rewriteLocked()
+}
+
+// rewriteLocked 只保留还没送达的点：写临时文件、fsync、rename
+func (b *buffer) rewriteLocked() error {
+	tmpPath := b.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, s := range b.samples {
+		rec, err := encodeBufferRecord(s)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := tmp.Write(rec); err != nil {
+			tmp.Close()
+			return err
+		}
+		size += int64(len(rec))
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, b.path); err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(b.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	b.fd.Close()
+	b.fd = fd
+	b.fileSize, b.ackedSize = size, 0
+	return nil
+}
+
+// wait 返回一个在下次出队时关闭的 channel
+func (b *buffer) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.drained
+}
+
+func (b *buffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.samples)
+}
+
+// sync 把日志刷到磁盘，由后台协程定期调用
+func (b *buffer) sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fd == nil {
+		return nil
+	}
+	return b.fd.Sync()
+}
+
+func (b *buffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fd == nil {
+		return nil
+	}
+	b.fd.Sync()
+	err := b.fd.Close()
+	b.fd = nil
+	return err
+}
+
+// ==========================================
+// 日志记录编解码
+// ==========================================
+
+func encodeBufferRecord(s protocol.Sample) ([]byte, error) {
+	body, err := protocol.EncodeWrite(s)
+	if err != nil {
+		return nil, err
+	}
+	rec := make([]byte, 0, len(body)+8)
+	rec = binary.BigEndian.AppendUint32(rec, uint32(len(body)))
+	rec = append(rec, body...)
+	return binary.BigEndian.AppendUint32(rec, crc32.ChecksumIEEE(body)), nil
+}
+
+// bufferRecordSize 与 len(encodeBufferRecord(s)) 相同，不需要真的编码
+func bufferRecordSize(s protocol.Sample) int64 {
+	return int64(4 + 2 + len(s.Series) + 16 + 4)
+}
+
+// decodeBufferLog 解析日志，遇到第一条不完整或校验失败的记录就停下
+// 返回解析出的点和有效数据的长度
+func decodeBufferLog(data []byte) ([]protocol.Sample, int64) {
+	var samples []protocol.Sample
+	pos := 0
+	for pos+8 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if n > protocol.MaxFrameSize || pos+8+n > len(data) {
+			break
+		}
+		body := data[pos+4 : pos+4+n]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[pos+4+n:pos+8+n]) {
+			break
+		}
+		s, err := protocol.DecodeWrite(body)
+		if err != nil {
+			break
+		}
+		samples = append(samples, s)
+		pos += 8 + n
+	}
+	return samples, int64(pos)
+}
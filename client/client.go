@@ -0,0 +1,537 @@
+// Package client 是 tcore TCP 服务的 Go 客户端，API 与 tcore.DB 的 Write / Query / Keys 一一对应
+//
+// 读操作 (Query / Keys) 同步执行；写操作先进入本地缓冲区，由后台协程攒批，
+// 以 pipelining 的方式发给服务端 (一条连接上连续发出多帧，再按顺序读回应答)。
+// 网络出错时连接被丢弃，按指数退避重连重试，缓冲区里的点不会丢；
+// 配置了 WithBufferFile 时缓冲区同时落盘，客户端进程重启后继续补发。
+//
+// 写入重试是"至少一次"语义：应答在路上丢了的批次会被重发，
+// 同一个点可能写入两次，服务端在 Compaction 时按时间戳去重。
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/protocol"
+)
+
+const (
+	DefaultPoolSize      = 4
+	DefaultBatchSize     = 1000        // 每个 BatchWrite 帧最多多少个点
+	DefaultPipeline      = 8           // 一次 flush 在同一条连接上最多连发多少帧
+	DefaultFlushInterval = time.Second // 后台 flush 的间隔
+	DefaultMaxBuffered   = 100000      // 本地缓冲区最多积压多少个点
+	DefaultMaxRetries    = 5           // 单次调用最多重试几次
+	DefaultBackoffBase   = 50 * time.Millisecond
+	DefaultBackoffMax    = 5 * time.Second
+	DefaultDialTimeout   = 3 * time.Second
+
+	// closeFlushTimeout Close 时尽力把缓冲区发完的最长等待时间
+	closeFlushTimeout = 5 * time.Second
+)
+
+var (
+	ErrClosed             = errors.New("client: closed")
+	ErrUnexpectedResponse = errors.New("client: unexpected response type")
+)
+
+// Options 客户端配置
+type Options struct {
+	PoolSize      int
+	BatchSize     int
+	Pipeline      int
+	FlushInterval time.Duration
+	MaxBuffered   int
+	MaxRetries    int
+	BackoffBase   time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	BackoffMax    time.Duration // 退避等待的上限
+	DialTimeout   time.Duration
+	BufferFile    string      // 非空时缓冲区持久化到这个文件
+	OnError       func(error) // 后台 flush 出错时的回调 (出错的点留在缓冲区里，下次再发)
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithPoolSize 设置连接池大小
+func WithPoolSize(n int) Option {
+	return func(opts *Options) {
+		opts.PoolSize = n
+	}
+}
+
+// WithBatchSize 设置每个批量写入帧的点数
+func WithBatchSize(n int) Option {
+	return func(opts *Options) {
+		opts.BatchSize = n
+	}
+}
+
+// WithPipeline 设置一次 flush 最多连发的帧数
+func WithPipeline(n int) Option {
+	return func(opts *Options) {
+		opts.Pipeline = n
+	}
+}
+
+// WithFlushInterval 设置后台 flush 间隔
+func WithFlushInterval(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.FlushInterval = d
+	}
+}
+
+// WithMaxBuffered 设置本地缓冲区上限，满了之后 Write 会阻塞直到有空间或 ctx 到期
+func WithMaxBuffered(n int) Option {
+	return func(opts *Options) {
+		opts.MaxBuffered = n
+	}
+}
+
+// WithRetry 设置重试次数和退避时间
+func WithRetry(maxRetries int, base, max time.Duration) Option {
+	return func(opts *Options) {
+		opts.MaxRetries = maxRetries
+		opts.BackoffBase = base
+		opts.BackoffMax = max
+	}
+}
+
+// WithDialTimeout 设置建连超时
+func WithDialTimeout(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.DialTimeout = d
+	}
+}
+
+// WithBufferFile 把缓冲区持久化到文件，服务端短暂不可用期间客户端重启也不丢点
+func WithBufferFile(path string) Option {
+	return func(opts *Options) {
+		opts.BufferFile = path
+	}
+}
+
+// WithErrorHandler 设置后台 flush 出错时的回调
+func WithErrorHandler(fn func(error)) Option {
+	return func(opts *Options) {
+		opts.OnError = fn
+	}
+}
+
+// Client tcore 客户端，可以被多个协程同时使用
+type Client struct {
+	opts Options
+	pool *pool
+	buf  *buffer
+
+	flushMu sync.Mutex    // 同一时刻只有一个 flush 在出队，保证队头稳定
+	kick    chan struct{} // 缓冲区攒够一批时叫醒后台协程
+
+	mu     sync.Mutex
+	closed bool
+
+	ctx    context.Context // Close 时取消，打断后台协程里的退避等待
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New 创建客户端。连接是懒建立的，服务端此时不可用也不会报错
+func New(addr string, options ...Option) (*Client, error) {
+	opts := Options{
+		PoolSize:      DefaultPoolSize,
+		BatchSize:     DefaultBatchSize,
+		Pipeline:      DefaultPipeline,
+		FlushInterval: DefaultFlushInterval,
+		MaxBuffered:   DefaultMaxBuffered,
+		MaxRetries:    DefaultMaxRetries,
+		BackoffBase:   DefaultBackoffBase,
+		BackoffMax:    DefaultBackoffMax,
+		DialTimeout:   DefaultDialTimeout,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	buf, err := openBuffer(opts.BufferFile, opts.MaxBuffered)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		opts:   opts,
+		pool:   newPool(addr, opts.PoolSize, opts.DialTimeout),
+		buf:    buf,
+		kick:   make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	c.wg.Add(1)
+	go c.flushLoop()
+	return c, nil
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Ping 检查服务端是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, protocol.Frame{Type: protocol.TypePing}, protocol.TypePong)
+	return err
+}
+
+// Write ✍️ 写入一个点
+// 点先进入本地缓冲区，由后台协程批量发送；缓冲区满时阻塞，直到有空间或 ctx 到期。
+// 返回 nil 只代表点已经进入缓冲区，需要确认送达时调用 Flush
+func (c *Client) Write(ctx context.Context, sensorID string, timestamp int64, value float64) error {
+	// 协议编不下的名字在入队前拒绝，否则它会卡在队头，整批都发不出去
+	if len(sensorID) > protocol.MaxNameSize {
+		return protocol.ErrNameTooLong
+	}
+	s := protocol.Sample{Series: sensorID, Time: timestamp, Value: value}
+	for {
+		if c.isClosed() {
+			return ErrClosed
+		}
+		// 先拿等待 channel 再尝试入队，避免错过两者之间发生的出队
+		wait := c.buf.wait()
+		n, ok, err := c.buf.add(s)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if n >= c.opts.BatchSize {
+				c.wakeFlusher()
+			}
+			return nil
+		}
+
+		c.wakeFlusher()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Query 🔍 查询数据，不包含仍在本地缓冲区里的点
+func (c *Client) Query(ctx context.Context, sensorID string, start, end int64) ([]tcore.Point, error) {
+	value, err := protocol.EncodeQuery(sensorID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, protocol.Frame{Type: protocol.TypeQuery, Value: value}, protocol.TypePoints)
+	if err != nil {
+		return nil, err
+	}
+	points, err := protocol.DecodePoints(resp.Value)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]tcore.Point, len(points))
+	for i, p := range points {
+		result[i] = tcore.Point{Time: p.Time, Value: p.Value}
+	}
+	return result, nil
+}
+
+// Keys 列出服务端所有的 Series
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, protocol.Frame{Type: protocol.TypeKeys}, protocol.TypeKeyset)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.DecodeKeys(resp.Value)
+}
+
+// Stats 查看一条 Series 的概况；Name 和 ID 不在协议里，ID 为 0
+func (c *Client) Stats(ctx context.Context, series string) (tcore.SeriesStats, error) {
+	value, err := protocol.EncodeStatsQuery(series)
+	if err != nil {
+		return tcore.SeriesStats{}, err
+	}
+	resp, err := c.do(ctx, protocol.Frame{Type: protocol.TypeStats, Value: value}, protocol.TypeStatsResult)
+	if err != nil {
+		return tcore.SeriesStats{}, err
+	}
+	st, err := protocol.DecodeStats(resp.Value)
+	if err != nil {
+		return tcore.SeriesStats{}, err
+	}
+	return tcore.SeriesStats{
+		Name:      series,
+		Type:      tcore.ValueType(st.Type),
+		Blocks:    int(st.Blocks),
+		Segments:  int(st.Segments),
+		Points:    st.Points,
+		HotPoints: int(st.HotPoints),
+		MinTime:   st.MinTime,
+		MaxTime:   st.MaxTime,
+	}, nil
+}
+
+// Flush 把调用时缓冲区里已有的点全部发给服务端，发送失败的点留在缓冲区里
+// 服务端拒绝的点 (例如类型不匹配) 重发也不会成功，会被丢弃并返回对应的错误；同一批里的其他点照常写入
+func (c *Client) Flush(ctx context.Context) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+	return c.flush(ctx)
+}
+
+func (c *Client) flush(ctx context.Context) error {
+	var firstErr error
+	for pending := c.buf.len(); pending > 0; {
+		n, kept, err := c.flushOnce(ctx)
+		if n == 0 && err != nil {
+			return err // 网络层失败或整批都没写进去：点都还在缓冲区里
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if n == 0 || kept > 0 {
+			break // 服务端暂时写不进去，放回队头的点留给下一轮
+		}
+		pending -= n
+	}
+	return firstErr
+}
+
+// Buffered 缓冲区里还没送达的点数
+func (c *Client) Buffered() int {
+	return c.buf.len()
+}
+
+// Close 停止后台协程，尽力把缓冲区发完，然后关闭所有连接
+// 没能发出去的点：配置了 WithBufferFile 时留在文件里等下次启动，否则丢失并返回错误
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.cancel()
+	c.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+	err := c.flush(ctx)
+	cancel()
+
+	c.pool.close()
+	if cerr := c.buf.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ==========================================
+// 🔒 内部逻辑 (Internal)
+// ==========================================
+
+// flushLoop 后台协程：定时或攒够一批时 flush，顺便把缓冲日志刷盘
+func (c *Client) flushLoop() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.kick:
+		}
+
+		if err := c.flush(c.ctx); err != nil && c.ctx.Err() == nil && c.opts.OnError != nil {
+			c.opts.OnError(err)
+		}
+		if err := c.buf.sync(); err != nil && c.opts.OnError != nil {
+			c.opts.OnError(err)
+		}
+	}
+}
+
+func (c *Client) wakeFlusher() {
+	select {
+	case c.kick <- struct{}{}:
+	default:
+	}
+}
+
+// flushOnce 从队头取最多 Pipeline 批点，在一条连接上连发出去，逐帧确认
+// 返回处理掉的点数 n (送达或被服务端明确拒绝) 和放回队头的点数 kept；网络失败时 n 为 0，点留在队里
+func (c *Client) flushOnce(ctx context.Context) (n, kept int, err error) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	samples := c.buf.peek(c.opts.BatchSize * c.opts.Pipeline)
+	if len(samples) == 0 {
+		return 0, 0, nil
+	}
+
+	var reqs []protocol.Frame
+	var batches [][]protocol.Sample
+	for rest := samples; len(rest) > 0; {
+		n := min(len(rest), c.opts.BatchSize)
+		value, err := protocol.EncodeBatch(rest[:n])
+		if err != nil {
+			return 0, 0, err
+		}
+		reqs = append(reqs, protocol.Frame{Type: protocol.TypeBatchWrite, Value: value})
+		batches = append(batches, rest[:n])
+		rest = rest[n:]
+	}
+
+	resps, err := c.call(ctx, reqs)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 服务端暂时写不进去的批次整批放回队头，下次重发 (已经写进去的点重复写一遍，由 Compaction 去重)；
+	// 明确拒绝的点 (类型不匹配、请求有误) 重发也不会成功，只丢弃这些点
+	var keep []protocol.Sample
+	var batchErr error
+	for i, resp := range resps {
+		if resp.Type != protocol.TypeError && resp.Type != protocol.TypeRejected {
+			continue
+		}
+		if batchErr == nil {
+			batchErr = serverError(resp)
+		}
+		if isTransient(resp) {
+			keep = append(keep, batches[i]...)
+		}
+	}
+	if err := c.buf.release(len(samples), keep); err != nil {
+		return len(samples) - len(keep), len(keep), err
+	}
+	return len(samples) - len(keep), len(keep), batchErr
+}
+
+// do 发一个请求，期望得到 want 类型的响应
+func (c *Client) do(ctx context.Context, req protocol.Frame, want protocol.MsgType) (protocol.Frame, error) {
+	if c.isClosed() {
+		return protocol.Frame{}, ErrClosed
+	}
+	resps, err := c.call(ctx, []protocol.Frame{req})
+	if err != nil {
+		return protocol.Frame{}, err
+	}
+	resp := resps[0]
+	if resp.Type == protocol.TypeError {
+		return protocol.Frame{}, serverError(resp)
+	}
+	if resp.Type != want {
+		return protocol.Frame{}, ErrUnexpectedResponse
+	}
+	return resp, nil
+}
+
+// call 带重试地完成一次请求-应答交换
+// 只有网络错误和服务端繁忙会重试；业务错误作为响应帧正常返回
+func (c *Client) call(ctx context.Context, reqs []protocol.Frame) ([]protocol.Frame, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(c.backoff(attempt)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		resps, err := c.exchange(ctx, reqs)
+		if err == nil {
+			return resps, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // 是调用方放弃了，而不是网络故障
+		}
+		if attempt >= c.opts.MaxRetries || !retryable(err) {
+			return nil, err
+		}
+	}
+}
+
+// exchange 借一条连接完成交换；出错的连接丢弃，下次重试会新建连接 (即自动重连)
+func (c *Client) exchange(ctx context.Context, reqs []protocol.Frame) ([]protocol.Frame, error) {
+	cn, err := c.pool.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resps, err := cn.exchange(ctx, reqs)
+	if err != nil {
+		c.pool.discard(cn)
+		return nil, err
+	}
+	c.pool.put(cn)
+	return resps, nil
+}
+
+// backoff 第 attempt 次重试前的等待时间：指数增长，带一半的随机抖动，
+// 避免服务端恢复的瞬间所有客户端一起重连
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.BackoffBase << (attempt - 1)
+	if d <= 0 || d > c.opts.BackoffMax {
+		d = c.opts.BackoffMax
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// retryable 服务端繁忙和连接层面的错误 (建连失败、中途断开、超时) 值得换一条连接重试，
+// 其他服务端错误重试也没用
+func retryable(err error) bool {
+	var se *protocol.ServerError
+	if errors.As(err, &se) {
+		return se.Code == protocol.CodeUnavailable
+	}
+	return !errors.Is(err, protocol.ErrFrameTooLarge)
+}
+
+// isTransient 批次因为服务端内部错误 (磁盘、只读) 没有写完，过一会儿重发可能成功；
+// 其他错误码和 Rejected 是服务端明确拒绝的点
+func isTransient(f protocol.Frame) bool {
+	return f.Type == protocol.TypeError && protocol.DecodeError(f.Value).Code == protocol.CodeInternal
+}
+
+func isUnavailable(f protocol.Frame) bool {
+	return f.Type == protocol.TypeError && len(f.Value) > 0 && f.Value[0] == protocol.CodeUnavailable
+}
+
+// serverError 把错误帧还原成 tcore 的错误，使 errors.Is 在本地和远程调用下表现一致
+func serverError(f protocol.Frame) error {
+	se := protocol.DecodeError(f.Value)
+	if f.Type == protocol.TypeRejected {
+		rej, err := protocol.DecodeRejected(f.Value)
+		if err != nil {
+			return err
+		}
+		se = &protocol.ServerError{Code: rej.Code, Message: fmt.Sprintf("%d points rejected: %s", len(rej.Indices), rej.Message)}
+	}
+	switch se.Code {
+	case protocol.CodeNotFound:
+		return fmt.Errorf("%w (remote: %s)", tcore.ErrSeriesNotFound, se.Message)
+	case protocol.CodeTypeMismatch:
+		return fmt.Errorf("%w (remote: %s)", tcore.ErrTypeMismatch, se.Message)
+	case protocol.CodeInvalidRange:
+		return fmt.Errorf("%w (remote: %s)", tcore.ErrInvalidRange, se.Message)
+	}
+	return se
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/protocol"
+	"github.com/Lwxjjr/tcore/tcp"
+)
+
+func newTestDB(t *testing.T) *tcore.DB {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// serve 在 addr 上启动服务端 (addr 为空时随机端口)，返回实际地址和关闭函数
+func serve(t *testing.T, db *tcore.DB, addr string) (string, func()) {
+	t.Helper()
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := tcp.NewServer(db)
+	go srv.Serve(l)
+	stop := func() { srv.Shutdown(context.Background()) }
+	t.Cleanup(stop)
+	return l.Addr().String(), stop
+}
+
+func TestClient_WriteQueryKeys(t *testing.T) {
+	addr, _ := serve(t, newTestDB(t), "")
+	c, err := New(addr, WithBatchSize(2), WithPipeline(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := int64(1); i <= 5; i++ {
+		if err := c.Write(ctx, "boiler", i, float64(i)*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Write(ctx, "pump", 1, 1)
+	if err := c.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Buffered() != 0 {
+		t.Fatalf("expected empty buffer after flush, got %d", c.Buffered())
+	}
+
+	points, err := c.Query(ctx, "boiler", 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 || points[0].Value != 20 || points[2].Value != 40 {
+		t.Fatalf("unexpected query result: %v", points)
+	}
+
+	keys, err := c.Keys(ctx)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %v (%v)", keys, err)
+	}
+
+	st, err := c.Stats(ctx, "boiler")
+	if err != nil || st.HotPoints != 5 || st.MinTime != 1 || st.MaxTime != 5 || st.Type != tcore.TypeFloat {
+		t.Fatalf("unexpected stats %+v (%v)", st, err)
+	}
+	if _, err := c.Stats(ctx, "missing"); !errors.Is(err, tcore.ErrSeriesNotFound) {
+		t.Errorf("expected ErrSeriesNotFound, got %v", err)
+	}
+
+	// 服务端错误还原成 tcore 的错误
+	if _, err := c.Query(ctx, "boiler", 5, 1); !errors.Is(err, tcore.ErrInvalidRange) {
+		t.Errorf("expected ErrInvalidRange, got %v", err)
+	}
+}
+
+func TestClient_ReconnectAfterServerRestart(t *testing.T) {
+	db := newTestDB(t)
+	addr, stop := serve(t, db, "")
+	c, _ := New(addr, WithRetry(10, 10*time.Millisecond, 100*time.Millisecond))
+	defer c.Close()
+
+	ctx := context.Background()
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务端重启：池里的旧连接全部失效，客户端应丢弃它们并重新建连
+	stop()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		serve(t, db, addr)
+	}()
+
+	c.Write(ctx, "s", 1, 42)
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("flush after restart failed: %v", err)
+	}
+	points, err := c.Query(ctx, "s", 0, 10)
+	if err != nil || len(points) != 1 || points[0].Value != 42 {
+		t.Fatalf("unexpected query result: %v (%v)", points, err)
+	}
+}
+
+func TestClient_PersistedBufferSurvivesOutage(t *testing.T) {
+	dir := t.TempDir()
+	bufPath := filepath.Join(dir, "pending.buf")
+
+	// 先占一个端口再释放，得到一个当前没人监听的地址
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	l.Close()
+
+	c, _ := New(addr, WithBufferFile(bufPath), WithRetry(0, time.Millisecond, time.Millisecond))
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		if err := c.Write(ctx, "s", i, float64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err == nil {
+		t.Fatal("expected close to report undelivered points")
+	}
+
+	// 服务端恢复，新的客户端进程从缓冲文件里补发
+	db := newTestDB(t)
+	serve(t, db, addr)
+	c2, err := New(addr, WithBufferFile(bufPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if c2.Buffered() != 3 {
+		t.Fatalf("expected 3 recovered points, got %d", c2.Buffered())
+	}
+	if err := c2.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	points, _ := db.Query("s", 0, 10)
+	if len(points) != 3 {
+		t.Fatalf("expected 3 delivered points, got %v", points)
+	}
+	if info, _ := os.Stat(bufPath); info.Size() != 0 {
+		t.Errorf("expected buffer file to be truncated, size=%d", info.Size())
+	}
+}
+
+func TestClient_ContextDeadline(t *testing.T) {
+	// 一个只接受连接、从不应答的服务端
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, _ := New(l.Addr().String())
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.Keys(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call did not respect deadline, took %v", elapsed)
+	}
+}
+
+func TestClient_RejectsOversizedName(t *testing.T) {
+	addr, _ := serve(t, newTestDB(t), "")
+	c, err := New(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	long := strings.Repeat("x", protocol.MaxNameSize+1)
+	if err := c.Write(ctx, long, 1, 1); !errors.Is(err, protocol.ErrNameTooLong) {
+		t.Fatalf("expected ErrNameTooLong on write, got %v", err)
+	}
+	if c.Buffered() != 0 {
+		t.Fatalf("oversized name must not enter the buffer, buffered=%d", c.Buffered())
+	}
+	if _, err := c.Query(ctx, long, 0, 10); !errors.Is(err, protocol.ErrNameTooLong) {
+		t.Fatalf("expected ErrNameTooLong on query, got %v", err)
+	}
+
+	// 后面的正常写入不受影响
+	if err := c.Write(ctx, "boiler", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingStore 对 fail 这条时间线的写入返回存储层错误，直到 fail 被清空
+type failingStore struct {
+	*tcore.DB
+	mu   sync.Mutex
+	fail string
+}
+
+func (s *failingStore) Write(sensorID string, timestamp int64, value float64) error {
+	s.mu.Lock()
+	fail := s.fail
+	s.mu.Unlock()
+	if sensorID == fail {
+		return errors.New("disk full")
+	}
+	return s.DB.Write(sensorID, timestamp, value)
+}
+
+func TestClient_FlushRequeuesUnwrittenBatches(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.WriteBatch("valve", []tcore.TypedPoint{{Time: 1, Value: tcore.BoolValue(true)}}); err != nil {
+		t.Fatal(err)
+	}
+	store := &failingStore{DB: db, fail: "disk"}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := tcp.NewServer(store)
+	go srv.Serve(l)
+	defer srv.Shutdown(context.Background())
+
+	path := filepath.Join(t.TempDir(), "pending.buf")
+	c, err := New(l.Addr().String(), WithBatchSize(2), WithPipeline(2), WithBufferFile(path), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 第一批：valve 类型不匹配被拒绝，boiler 照常写入；第二批：disk 写不进去，整批留下重发
+	ctx := context.Background()
+	c.Write(ctx, "boiler", 1, 1)
+	c.Write(ctx, "valve", 2, 0)
+	c.Write(ctx, "disk", 1, 1)
+	c.Write(ctx, "boiler", 2, 2)
+	if err := c.Flush(ctx); !errors.Is(err, tcore.ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+	if c.Buffered() != 2 {
+		t.Fatalf("expected the unwritten batch to stay buffered, got %d", c.Buffered())
+	}
+	data, _ := os.ReadFile(path)
+	if kept, _ := decodeBufferLog(data); len(kept) != 2 || kept[0].Series != "disk" || kept[1].Series != "boiler" {
+		t.Fatalf("buffer file after requeue: %v", kept)
+	}
+
+	store.mu.Lock()
+	store.fail = ""
+	store.mu.Unlock()
+	if err := c.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.Buffered() != 0 {
+		t.Fatalf("expected empty buffer, got %d", c.Buffered())
+	}
+	if points, _ := db.Query("boiler", 0, 10); len(points) != 2 {
+		t.Fatalf("boiler: %v", points)
+	}
+	if points, _ := db.Query("disk", 0, 10); len(points) != 1 {
+		t.Fatalf("disk: %v", points)
+	}
+}
+
+func TestBuffer_TornTail(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pending.buf")
+
+	b, _ := openBuffer(path, 10)
+	b.add(sampleOf("a", 1))
+	b.add(sampleOf("b", 2))
+	b.close()
+
+	// 模拟崩溃时第二条记录只写了一半
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-3)
+
+	b, err := openBuffer(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.close()
+	if got := b.peek(10); len(got) != 1 || got[0].Series != "a" {
+		t.Fatalf("expected only the intact record, got %v", got)
+	}
+}
+
+func sampleOf(series string, ts int64) protocol.Sample {
+	return protocol.Sample{Series: series, Time: ts, Value: float64(ts)}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Lwxjjr/tcore/protocol"
+)
+
+// conn 池里的一条连接，读写都带缓冲，方便 pipelining 时一次 Flush 发出多帧
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// exchange 连续发出 reqs，再按顺序读回同样数量的响应
+// ctx 的截止时间映射成连接的 deadline；ctx 被取消时立刻打断阻塞中的读写
+func (c *conn) exchange(ctx context.Context, reqs []protocol.Frame) ([]protocol.Frame, error) {
+	deadline, _ := ctx.Deadline() // 没有截止时间时为零值，即不超时
+	c.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { c.SetDeadline(time.Now()) })
+	defer stop()
+
+	for _, req := range reqs {
+		if err := protocol.WriteFrame(c.w, req); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	resps := make([]protocol.Frame, 0, len(reqs))
+	for range reqs {
+		resp, err := protocol.ReadFrame(c.r)
+		if err != nil {
+			return nil, err
+		}
+		resps = append(resps, resp)
+		// 服务端拒绝连接时只会发一个错误帧然后断开，后面不会再有响应
+		if isUnavailable(resp) {
+			return nil, protocol.DecodeError(resp.Value)
+		}
+	}
+	return resps, nil
+}
+
+// pool 固定上限的连接池：空闲连接复用，不够时新建，出错的连接直接丢弃
+type pool struct {
+	addr        string
+	dialTimeout time.Duration
+
+	mu     sync.Mutex
+	closed bool
+
+	idle chan *conn
+	sem  chan struct{} // 限制连接总数 (空闲 + 借出)
+}
+
+func newPool(addr string, size int, dialTimeout time.Duration) *pool {
+	return &pool{
+		addr:        addr,
+		dialTimeout: dialTimeout,
+		idle:        make(chan *conn, size),
+		sem:         make(chan struct{}, size),
+	}
+}
+
+// get 借一条连接：优先复用空闲连接，其次在上限内新建，否则等待别人归还
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	select {
+	case c := <-p.idle:
+		return c, nil
+	case p.sem <- struct{}{}:
+		d := net.Dialer{Timeout: p.dialTimeout}
+		nc, err := d.DialContext(ctx, "tcp", p.addr)
+		if err != nil {
+			<-p.sem
+			return nil, err
+		}
+		return &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put 归还一条健康的连接
+func (p *pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		c.Close()
+		<-p.sem
+		return
+	}
+	p.idle <- c // 容量等于连接上限，不会阻塞
+}
+
+// discard 丢弃一条出过错的连接：流里可能残留半帧，不能再复用
+func (p *pool) discard(c *conn) {
+	c.Close()
+	<-p.sem
+}
+
+// close 关闭所有空闲连接；借出去的连接在归还时关闭
+func (p *pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for {
+		select {
+		case c := <-p.idle:
+			c.Close()
+			<-p.sem
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/client"
+)
+
+// backend CLI 能操作的数据源：本地数据目录或运行中的服务
+type backend interface {
+	Keys(ctx context.Context) ([]string, error)
+	Query(ctx context.Context, series string, start, end int64) ([]tcore.TypedPoint, error)
+	Stats(ctx context.Context, series string) (tcore.SeriesStats, error)
+	Write(ctx context.Context, series string, ts int64, value float64) error
+	Close() error
+}
+
+// localBackend 直接打开数据目录；默认只读，不会和正在运行的服务抢文件
+type localBackend struct {
+	db *tcore.DB
+}
+
+func openLocal(dir string, writable bool) (*localBackend, error) {
+	open := tcore.OpenReadOnly
+	if writable {
+		open = tcore.NewDB
+	}
+	db, err := open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &localBackend{db: db}, nil
+}
+
+func (b *localBackend) Keys(ctx context.Context) ([]string, error) {
+	return b.db.Keys(), nil
+}
+
+func (b *localBackend) Query(ctx context.Context, series string, start, end int64) ([]tcore.TypedPoint, error) {
+	if _, err := b.db.SeriesType(series); err != nil {
+		return nil, err
+	}
+	return b.db.QueryValues(series, start, end)
+}
+
+// QueryAggregate 配置了 Rollup 时直接读汇总层
+func (b *localBackend) QueryAggregate(ctx context.Context, series string, start, end, step int64, agg string) ([]tcore.TypedPoint, error) {
+	if _, err := b.db.SeriesType(series); err != nil {
+		return nil, err
+	}
+	return b.db.QueryAggregate(series, start, end, step, agg)
+}
+
+func (b *localBackend) Stats(ctx context.Context, series string) (tcore.SeriesStats, error) {
+	return b.db.Stats(series)
+}
+
+// Write 立即落盘：CLI 进程很快就退出，等不到后台刷盘
+func (b *localBackend) Write(ctx context.Context, series string, ts int64, value float64) error {
+	if err := b.db.Write(series, ts, value); err != nil {
+		return err
+	}
+	return b.db.Flush()
+}
+
+func (b *localBackend) SeriesType(name string) (tcore.ValueType, error) {
+	return b.db.SeriesType(name)
+}
+
+func (b *localBackend) ScanValues(name string, start, end int64, fn func(tcore.TypedPoint) error) error {
+	return b.db.ScanValues(name, start, end, fn)
+}
+
+// WriteBatch 直接写成 Block，不需要再 Flush
+func (b *localBackend) WriteBatch(name string, points []tcore.TypedPoint) error {
+	return b.db.WriteBatch(name, points)
+}
+
+func (b *localBackend) Close() error {
+	return b.db.Close()
+}
+
+// remoteBackend 通过 TCP 协议访问运行中的服务
+type remoteBackend struct {
+	c *client.Client
+}
+
+func openRemote(addr string) (*remoteBackend, error) {
+	c, err := client.New(addr, client.WithPoolSize(1), client.WithRetry(1, 50*time.Millisecond, 200*time.Millisecond), client.WithDialTimeout(5*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &remoteBackend{c: c}, nil
+}
+
+func (b *remoteBackend) Keys(ctx context.Context) ([]string, error) {
+	return b.c.Keys(ctx)
+}
+
+func (b *remoteBackend) Query(ctx context.Context, series string, start, end int64) ([]tcore.TypedPoint, error) {
+	if _, err := b.c.Stats(ctx, series); err != nil {
+		return nil, err // 区分"没有这条时间线"和"这段时间没有数据"
+	}
+	points, err := b.c.Query(ctx, series, start, end)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]tcore.TypedPoint, len(points))
+	for i, p := range points {
+		result[i] = tcore.TypedPoint{Time: p.Time, Value: tcore.FloatValue(p.Value)}
+	}
+	return result, nil
+}
+
+func (b *remoteBackend) Stats(ctx context.Context, series string) (tcore.SeriesStats, error) {
+	return b.c.Stats(ctx, series)
+}
+
+func (b *remoteBackend) Write(ctx context.Context, series string, ts int64, value float64) error {
+	if err := b.c.Write(ctx, series, ts, value); err != nil {
+		return err
+	}
+	return b.c.Flush(ctx)
+}
+
+func (b *remoteBackend) Close() error {
+	return b.c.Close()
+}
+
+// sortedKeys Keys 的结果没有顺序，输出前排一下
+func sortedKeys(ctx context.Context, b backend) ([]string, error) {
+	keys, err := b.Keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/tcp"
+)
+
+// seedDir 准备一个已经落盘的数据目录
+func seedDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 6; i++ {
+		db.Write("boiler", i*10, float64(i))
+	}
+	db.Write("pump", 5, 1)
+	db.WriteValue("state", 7, tcore.StringValue("RUN"))
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	return dir
+}
+
+func runCLI(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func TestCLI_LocalOneShot(t *testing.T) {
+	dir := seedDir(t)
+
+	out, _, code := runCLI(t, "", "-data", dir, "keys")
+	if code != 0 || out != "SERIES\nboiler\npump\nstate\n(3 rows)\n" {
+		t.Fatalf("keys: %d %q", code, out)
+	}
+
+	out, _, code = runCLI(t, "", "-data", dir, "-format", "csv", "query", "boiler", "-start", "10", "-end", "40", "-step", "20", "-agg", "max")
+	if code != 0 || out != "time,value\n0,1\n20,3\n40,4\n" {
+		t.Fatalf("query: %d %q", code, out)
+	}
+
+	out, _, code = runCLI(t, "", "-data", dir, "-format", "json", "query", "state")
+	var points []map[string]any
+	if code != 0 || json.Unmarshal([]byte(out), &points) != nil || len(points) != 1 || points[0]["value"] != "RUN" {
+		t.Fatalf("typed query: %d %q", code, out)
+	}
+
+	out, _, code = runCLI(t, "", "-data", dir, "-format", "json", "stats", "boiler")
+	var stats []map[string]any
+	if code != 0 || json.Unmarshal([]byte(out), &stats) != nil || stats[0]["blocks"] != 1.0 || stats[0]["points"] != 6.0 || stats[0]["max_time"] != 50.0 {
+		t.Fatalf("stats: %d %q", code, out)
+	}
+
+	// 默认只读
+	if _, errOut, code := runCLI(t, "", "-data", dir, "write", "boiler", "60", "1"); code != 1 || !strings.Contains(errOut, "read-only") {
+		t.Fatalf("write on read-only: %d %q", code, errOut)
+	}
+	if _, _, code := runCLI(t, "", "-data", dir, "-rw", "write", "boiler", "60", "6"); code != 0 {
+		t.Fatalf("write with -rw: %d", code)
+	}
+	out, _, _ = runCLI(t, "", "-data", dir, "-format", "csv", "query", "boiler", "-limit", "1")
+	if out != "time,value\n60,6\n" {
+		t.Fatalf("write was not persisted: %q", out)
+	}
+
+	if _, errOut, code := runCLI(t, "", "-data", dir, "stats", "nope"); code != 1 || !strings.Contains(errOut, "not found") {
+		t.Fatalf("missing series: %d %q", code, errOut)
+	}
+	if _, _, code := runCLI(t, "", "-data", dir, "query"); code != 2 {
+		t.Fatalf("usage error: %d", code)
+	}
+}
+
+func TestCLI_ExportImport(t *testing.T) {
+	dir := seedDir(t)
+	file := filepath.Join(dir, "boiler.ndjson")
+
+	out, errOut, code := runCLI(t, "", "-data", dir, "export", "-format", "ndjson", "-start", "10", "-end", "30", "-o", file, "boiler", "state")
+	if code != 0 || out != "exported 3 points to "+file+"\n" {
+		t.Fatalf("export: %d %q %q", code, out, errOut)
+	}
+	out, _, code = runCLI(t, "", "-data", dir, "-precision", "ms", "export", "-time-format", "s", "state")
+	if code != 0 || out != "sensor,time,value,type\nstate,0,RUN,string\n" {
+		t.Fatalf("export to stdout: %q", out)
+	}
+
+	other := seedDir(t)
+	if _, errOut, code := runCLI(t, "", "-data", other, "import", "-format", "ndjson", file); code != 1 || !strings.Contains(errOut, "read-only") {
+		t.Fatalf("import on read-only: %d %q", code, errOut)
+	}
+	csvFile := filepath.Join(dir, "wide.csv")
+	os.WriteFile(csvFile, []byte("ts,a,b\n100,1,\n200,2,true\n"), 0644)
+	out, errOut, code = runCLI(t, "", "-data", other, "-rw", "import", "-columns", "time=ts", "-wide", "a=wide.a", csvFile)
+	if code != 0 || out != "imported 2 points into 1 series (2 records, 0 empty cells skipped)\n" {
+		t.Fatalf("wide import: %d %q %q", code, out, errOut)
+	}
+	out, _, _ = runCLI(t, "", "-data", other, "-format", "csv", "query", "wide.a")
+	if out != "time,value\n100,1\n200,2\n" {
+		t.Fatalf("imported data: %q", out)
+	}
+
+	lake := filepath.Join(dir, "lake")
+	out, errOut, code = runCLI(t, "", "-data", dir, "parquet", "-o", lake, "-compression", "gzip")
+	if code != 0 || out != "wrote 8 rows to 1 files under "+lake+"\n" {
+		t.Fatalf("parquet: %d %q %q", code, out, errOut)
+	}
+	if _, err := os.Stat(filepath.Join(lake, "date=1970-01-01", "part.parquet")); err != nil {
+		t.Fatal(err)
+	}
+	// 只有一个 .vlog，只读打开时它可能还在被写，不算已封存
+	out, _, _ = runCLI(t, "", "-data", dir, "parquet", "-o", lake, "-sealed")
+	if out != "wrote 0 rows to 0 files under "+lake+"\n" {
+		t.Fatalf("parquet -sealed: %q", out)
+	}
+
+	if _, errOut, code := runCLI(t, "", "-addr", "127.0.0.1:1", "export", "boiler"); code != 1 || errOut == "" {
+		t.Fatalf("export needs a local directory: %d %q", code, errOut)
+	}
+}
+
+func TestCLI_RemoteShell(t *testing.T) {
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := tcp.NewServer(db)
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	now := time.Now()
+	script := strings.Join([]string{
+		"write 'temp{site=\"a\"}' 100 21.5",
+		"write 'temp{site=\"a\"}' now 22",
+		"format csv",
+		"keys temp",
+		"query 'temp{site=\"a\"}' -end 200",
+		"stats nope",
+		"bogus",
+		"exit",
+		"keys", // exit 之后不再执行
+	}, "\n")
+	out, errOut, code := runCLI(t, script, "-addr", ln.Addr().String())
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	want := []string{
+		"ok temp{site=\"a\"} 100 21.5",
+		"series\n\"temp{site=\"\"a\"\"}\"\n", // CSV 转义双引号
+		"time,value\n100,21.5\n",
+		"error: nope: series not found",
+		"error: unknown command \"bogus\"",
+	}
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("output missing %q:\n%s", w, out)
+		}
+	}
+	if strings.Count(out, "series\n") != 1 {
+		t.Errorf("commands after exit were executed:\n%s", out)
+	}
+
+	points, _ := db.Query("temp{site=\"a\"}", now.UnixNano(), now.Add(time.Minute).UnixNano())
+	if len(points) != 1 || points[0].Value != 22 {
+		t.Fatalf("now was not resolved: %+v", points)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`query  'a b{x="1"}'  -start now-1h`)
+	if err != nil || len(args) != 4 || args[1] != `a b{x="1"}` || args[3] != "now-1h" {
+		t.Fatalf("got %q, %v", args, err)
+	}
+	if _, err := splitArgs("query 'open"); err == nil {
+		t.Fatal("expected an unterminated quote error")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+var errUsage = errors.New("usage")
+
+const usage = `commands:
+  keys [prefix]                         list series
+  query <series> [-start T] [-end T] [-step D] [-agg F] [-limit N]
+                                        query a range; T is an integer, RFC 3339, now or now-1h;
+                                        D is an integer or a duration like 1m; F is avg/sum/min/max/count/first/last
+  stats <series>...                     block count, point count and time range
+  write <series> <time> <value>         write one float point
+  export [-start T] [-end T] [-format csv|ndjson] [-time-format F] [-o FILE] <series>...
+                                        export points; F is ns/us/ms/s, rfc3339 or a Go time layout
+  import [-format csv|ndjson] [-time-format F] [-columns series=C,time=C,value=C,type=C]
+         [-wide COL=SERIES,...] [-series NAME] [-type T] [-no-header] <file>
+                                        bulk import (needs -rw); C is a header name or #N for the Nth column
+  parquet -o DIR [-start T] [-end T] [-sealed] [-segments ID,...] [-compression C] [-tz ZONE] [series]...
+                                        write day-partitioned Parquet files (DIR/date=YYYY-MM-DD/*.parquet);
+                                        -sealed only exports sealed segments, C is none/snappy/gzip/zstd/lz4
+  format [table|csv|json]               show or change the output format
+  help                                  show this help
+  exit                                  leave the shell
+series names containing spaces or quotes can be wrapped in single quotes`
+
+// session 一次 CLI 会话：数据源 + 输出设置
+type session struct {
+	b      backend
+	out    io.Writer
+	format string
+	unit   time.Duration // DB 里时间戳的单位
+	now    func() time.Time
+}
+
+// exec 执行一条命令
+func (s *session) exec(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "keys", "series":
+		return s.keys(ctx, rest)
+	case "query":
+		return s.query(ctx, rest)
+	case "stats":
+		return s.stats(ctx, rest)
+	case "write":
+		return s.write(ctx, rest)
+	case "export":
+		return s.export(rest)
+	case "import":
+		return s.importFile(rest)
+	case "parquet":
+		return s.parquet(rest)
+	case "format":
+		if len(rest) == 0 {
+			fmt.Fprintln(s.out, s.format)
+			return nil
+		}
+		if !validFormat(rest[0]) {
+			return fmt.Errorf("unknown format %q", rest[0])
+		}
+		s.format = rest[0]
+		return nil
+	case "help":
+		fmt.Fprintln(s.out, usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q, try help", args[0])
+}
+
+// shell 交互模式：一行一条命令，出错只打印不退出
+func (s *session) shell(ctx context.Context, in io.Reader, prompt bool) error {
+	sc := bufio.NewScanner(in)
+	for {
+		if prompt {
+			fmt.Fprint(s.out, "tcore> ")
+		}
+		if !sc.Scan() {
+			return sc.Err()
+		}
+		args, err := splitArgs(sc.Text())
+		if err == nil && len(args) > 0 && (args[0] == "exit" || args[0] == "quit") {
+			return nil
+		}
+		if err == nil {
+			err = s.exec(ctx, args)
+		}
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(s.out, usage)
+		} else if err != nil {
+			fmt.Fprintln(s.out, "error:", err)
+		}
+	}
+}
+
+func (s *session) keys(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	keys, err := sortedKeys(ctx, s.b)
+	if err != nil {
+		return err
+	}
+	t := &table{header: []string{"series"}}
+	for _, k := range keys {
+		if len(args) == 0 || strings.HasPrefix(k, args[0]) {
+			t.add(k)
+		}
+	}
+	return t.print(s.out, s.format)
+}
+
+func (s *session) query(ctx context.Context, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errUsage
+	}
+	series := args[0]
+
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	start := fs.String("start", "", "")
+	end := fs.String("end", "", "")
+	step := fs.String("step", "", "")
+	agg := fs.String("agg", "avg", "")
+	limit := fs.Int("limit", 0, "")
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() > 0 {
+		return errUsage
+	}
+
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	var err error
+	if *start != "" {
+		if from, err = s.parseTime(*start); err != nil {
+			return err
+		}
+	}
+	if *end != "" {
+		if to, err = s.parseTime(*end); err != nil {
+			return err
+		}
+	}
+	if from > to {
+		return tcore.ErrInvalidRange
+	}
+
+	var points []tcore.TypedPoint
+	if *step != "" {
+		width, err := s.parseStep(*step)
+		if err != nil {
+			return err
+		}
+		if points, err = s.aggregate(ctx, series, from, to, width, *agg); err != nil {
+			return err
+		}
+	} else {
+		if points, err = s.b.Query(ctx, series, from, to); err != nil {
+			return err
+		}
+		// 冷数据和热数据拼接而成，不保证有序
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	}
+	if *limit > 0 && len(points) > *limit {
+		points = points[len(points)-*limit:] // 保留最新的 N 个
+	}
+
+	t := &table{header: []string{"time", "value"}}
+	for _, p := range points {
+		t.add(p.Time, p.Value)
+	}
+	return t.print(s.out, s.format)
+}
+
+// aggregator 本地数据目录能直接从 Rollup 汇总层取聚合结果
+type aggregator interface {
+	QueryAggregate(ctx context.Context, series string, start, end, step int64, agg string) ([]tcore.TypedPoint, error)
+}
+
+// aggregate 优先走 Rollup 汇总层，远端服务读原始点现算
+func (s *session) aggregate(ctx context.Context, series string, start, end, step int64, agg string) ([]tcore.TypedPoint, error) {
+	if a, ok := s.b.(aggregator); ok {
+		return a.QueryAggregate(ctx, series, start, end, step, agg)
+	}
+	points, err := s.b.Query(ctx, series, start, end)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return tcore.Aggregate(points, step, agg)
+}
+
+func (s *session) stats(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	t := &table{header: []string{"series", "type", "blocks", "segments", "points", "hot_points", "min_time", "max_time"}}
+	for _, name := range args {
+		st, err := s.b.Stats(ctx, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		t.add(name, st.Type.String(), st.Blocks, st.Segments, st.Points, st.HotPoints, st.MinTime, st.MaxTime)
+	}
+	return t.print(s.out, s.format)
+}
+
+func (s *session) write(ctx context.Context, args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	ts, err := s.parseTime(args[1])
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return fmt.Errorf("bad value %q", args[2])
+	}
+	if err := s.b.Write(ctx, args[0], ts, v); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "ok %s %d %s\n", args[0], ts, args[2])
+	return nil
+}
+
+// parseTime 整数原样使用 (DB 的时间单位)，也接受 RFC 3339、now、now-1h / now+5m
+func (s *session) parseTime(raw string) (int64, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n, nil
+	}
+	if strings.HasPrefix(raw, "now") {
+		t := s.now()
+		if rest := raw[len("now"):]; rest != "" {
+			d, err := time.ParseDuration(rest)
+			if err != nil {
+				return 0, fmt.Errorf("bad time %q", raw)
+			}
+			t = t.Add(d)
+		}
+		return t.UnixNano() / int64(s.unit), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q", raw)
+	}
+	return t.UnixNano() / int64(s.unit), nil
+}
+
+// parseStep 整数原样使用，也接受 1m、15s 这样的时长
+func (s *session) parseStep(raw string) (int64, error) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil && n > 0 {
+		return n, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < s.unit {
+		return 0, fmt.Errorf("bad step %q", raw)
+	}
+	return int64(d / s.unit), nil
+}
+
+// splitArgs 按空白切分命令行，单引号里的内容原样保留
+// 不处理双引号：temp{site="a"} 这种 Prometheus 风格的名字里本来就带双引号
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inToken, quoted := false, false
+	for _, r := range line {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			inToken = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if inToken {
+				args = append(args, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if inToken {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,87 @@
+// Command cli 是 tcore 的调试工具
+//
+// 既可以直接打开本地数据目录 (默认只读)，也可以连接运行中的服务：
+//
+//	cli -data /var/lib/tcore keys
+//	cli -addr 127.0.0.1:9000 query boiler -start now-1h -step 1m -agg max
+//	cli -data /var/lib/tcore -format json stats boiler
+//	cli -addr 127.0.0.1:9000            # 不带命令时进入交互式 Shell
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Lwxjjr/tcore/lineproto"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run 解析参数并执行，返回进程退出码
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("cli", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dataDir := fs.String("data", "", "local data directory (opened read-only unless -rw)")
+	addr := fs.String("addr", "", "address of a running server")
+	writable := fs.Bool("rw", false, "open the local data directory for writing (the server must not be running)")
+	format := fs.String("format", formatTable, "output format: table, csv or json")
+	precision := fs.String("precision", "ns", "timestamp unit of the database: ns, us, ms or s")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: cli (-data DIR | -addr HOST:PORT) [flags] [command [args]]")
+		fs.PrintDefaults()
+		fmt.Fprintln(stderr, usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*dataDir == "") == (*addr == "") || !validFormat(*format) {
+		fs.Usage()
+		return 2
+	}
+	unit, err := lineproto.ParsePrecision(*precision)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	var b backend
+	if *dataDir != "" {
+		b, err = openLocal(*dataDir, *writable)
+	} else {
+		b, err = openRemote(*addr)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "open:", err)
+		return 1
+	}
+	defer b.Close()
+
+	s := &session{b: b, out: stdout, format: *format, unit: time.Duration(unit), now: time.Now}
+	ctx := context.Background()
+
+	if fs.NArg() == 0 {
+		_, interactive := stdin.(*os.File)
+		if err := s.shell(ctx, stdin, interactive); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	if err := s.exec(ctx, fs.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(stderr, usage)
+			return 2
+		}
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
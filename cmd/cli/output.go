@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// 输出格式
+const (
+	formatTable = "table"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+)
+
+func validFormat(f string) bool {
+	return f == formatTable || f == formatCSV || f == formatJSON
+}
+
+// table 一张结果表；JSON 输出时每一行变成一个对象，cells 里的原始值决定 JSON 类型
+type table struct {
+	header []string
+	rows   [][]any
+}
+
+func (t *table) add(cells ...any) {
+	t.rows = append(t.rows, cells)
+}
+
+func (t *table) print(w io.Writer, format string) error {
+	switch format {
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(t.header)
+		for _, row := range t.rows {
+			cw.Write(textCells(row))
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case formatJSON:
+		objs := make([]map[string]any, len(t.rows))
+		for i, row := range t.rows {
+			obj := make(map[string]any, len(row))
+			for j, cell := range row {
+				obj[t.header[j]] = jsonCell(cell)
+			}
+			objs[i] = obj
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objs)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(t.header, "\t")))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(textCells(row), "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(t.rows) != 1 {
+		fmt.Fprintf(w, "(%d rows)\n", len(t.rows))
+	}
+	return nil
+}
+
+func textCells(row []any) []string {
+	cells := make([]string, len(row))
+	for i, cell := range row {
+		switch v := cell.(type) {
+		case string:
+			cells[i] = v
+		case tcore.Value:
+			if v.Type == tcore.TypeFloat {
+				cells[i] = strconv.FormatFloat(v.Float, 'g', -1, 64)
+			} else {
+				cells[i] = v.String()
+			}
+		default:
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+	return cells
+}
+
+// jsonCell 把 tcore.Value 展开成对应的 JSON 值；NaN 和 ±Inf 输出 null
+func jsonCell(cell any) any {
+	v, ok := cell.(tcore.Value)
+	if !ok {
+		return cell
+	}
+	switch v.Type {
+	case tcore.TypeFloat:
+		if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+			return nil
+		}
+		return v.Float
+	case tcore.TypeUint:
+		return v.Uint
+	case tcore.TypeBool:
+		return v.Bool
+	case tcore.TypeString:
+		return v.Str
+	}
+	return v.Bytes // base64
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/parquetexport"
+	"github.com/Lwxjjr/tcore/transfer"
+)
+
+var errNeedLocal = errors.New("export, import and parquet need a local data directory (-data)")
+
+// bulkBackend 能做导入导出的数据源：只有本地数据目录支持
+type bulkBackend interface {
+	transfer.Source
+	transfer.Sink
+}
+
+func (s *session) bulk() (bulkBackend, error) {
+	b, ok := s.b.(bulkBackend)
+	if !ok {
+		return nil, errNeedLocal
+	}
+	return b, nil
+}
+
+func (s *session) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	start := fs.String("start", "", "")
+	end := fs.String("end", "", "")
+	format := fs.String("format", "csv", "")
+	timeFormat := fs.String("time-format", "ns", "")
+	output := fs.String("o", "", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	b, err := s.bulk()
+	if err != nil {
+		return err
+	}
+	f, err := transfer.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	from, to, err := s.parseRange(*start, *end)
+	if err != nil {
+		return err
+	}
+
+	w := s.out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	n, err := transfer.Export(w, b, fs.Args(),
+		transfer.WithFormat(f),
+		transfer.WithTimeFormat(*timeFormat),
+		transfer.WithTimeUnit(s.unit),
+		transfer.WithRange(from, to))
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(s.out, "exported %d points to %s\n", n, *output)
+	}
+	return nil
+}
+
+func (s *session) importFile(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	format := fs.String("format", "csv", "")
+	timeFormat := fs.String("time-format", "ns", "")
+	columns := fs.String("columns", "", "")
+	wide := fs.String("wide", "", "")
+	series := fs.String("series", "", "")
+	typ := fs.String("type", "float", "")
+	noHeader := fs.Bool("no-header", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	b, err := s.bulk()
+	if err != nil {
+		return err
+	}
+	f, err := transfer.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+	vt, err := tcore.ParseValueType(*typ)
+	if err != nil {
+		return err
+	}
+
+	opts := []transfer.Option{
+		transfer.WithFormat(f),
+		transfer.WithTimeFormat(*timeFormat),
+		transfer.WithTimeUnit(s.unit),
+		transfer.WithSeries(*series),
+		transfer.WithType(vt),
+	}
+	if *columns != "" {
+		m, err := parseMapping(*columns)
+		if err != nil {
+			return err
+		}
+		var c transfer.Columns
+		for k, v := range m {
+			switch k {
+			case "series", "sensor":
+				c.Series = v
+			case "time":
+				c.Time = v
+			case "value":
+				c.Value = v
+			case "type":
+				c.Type = v
+			default:
+				return fmt.Errorf("unknown column role %q", k)
+			}
+		}
+		opts = append(opts, transfer.WithColumns(c))
+	}
+	if *wide != "" {
+		m, err := parseMapping(*wide)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, transfer.WithValueColumns(m))
+	}
+	if *noHeader {
+		opts = append(opts, transfer.WithNoHeader())
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	res, err := transfer.Import(file, b, opts...)
+	fmt.Fprintf(s.out, "imported %d points into %d series (%d records, %d empty cells skipped)\n", res.Points, res.Series, res.Records, res.Skipped)
+	return err
+}
+
+// parquet 导出按天分区的 Parquet 文件，只读打开也能用
+func (s *session) parquet(args []string) error {
+	fs := flag.NewFlagSet("parquet", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	start := fs.String("start", "", "")
+	end := fs.String("end", "", "")
+	output := fs.String("o", "", "")
+	sealed := fs.Bool("sealed", false, "")
+	segments := fs.String("segments", "", "")
+	compression := fs.String("compression", "snappy", "")
+	tz := fs.String("tz", "UTC", "")
+	if err := fs.Parse(args); err != nil || *output == "" {
+		return errUsage
+	}
+	local, ok := s.b.(*localBackend)
+	if !ok {
+		return errNeedLocal
+	}
+	from, to, err := s.parseRange(*start, *end)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return err
+	}
+
+	opts := []parquetexport.Option{
+		parquetexport.WithRange(from, to),
+		parquetexport.WithTimeUnit(s.unit),
+		parquetexport.WithLocation(loc),
+		parquetexport.WithCompression(*compression),
+	}
+	if fs.NArg() > 0 {
+		opts = append(opts, parquetexport.WithSeries(fs.Args()...))
+	}
+	if *sealed || *segments != "" {
+		var ids []uint32
+		if *segments != "" {
+			for _, raw := range strings.Split(*segments, ",") {
+				id, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+				if err != nil {
+					return fmt.Errorf("bad segment id %q", raw)
+				}
+				ids = append(ids, uint32(id))
+			}
+		}
+		opts = append(opts, parquetexport.WithSealedSegments(ids...))
+	}
+
+	res, err := parquetexport.Export(local.db, *output, opts...)
+	if res != nil {
+		fmt.Fprintf(s.out, "wrote %d rows to %d files under %s\n", res.Rows, len(res.Files), *output)
+		if len(res.Segments) > 0 {
+			fmt.Fprintf(s.out, "segments: %s\n", strings.Trim(fmt.Sprint(res.Segments), "[]"))
+		}
+	}
+	return err
+}
+
+// parseRange 解析 -start/-end，留空表示不限
+func (s *session) parseRange(start, end string) (int64, int64, error) {
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	var err error
+	if start != "" {
+		if from, err = s.parseTime(start); err != nil {
+			return 0, 0, err
+		}
+	}
+	if end != "" {
+		if to, err = s.parseTime(end); err != nil {
+			return 0, 0, err
+		}
+	}
+	if from > to {
+		return 0, 0, tcore.ErrInvalidRange
+	}
+	return from, to, nil
+}
+
+// parseMapping 解析 a=b,c=d
+func parseMapping(raw string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("bad mapping %q, want key=value", pair)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
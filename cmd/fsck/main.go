@@ -0,0 +1,138 @@
+// Command fsck 离线检查 (和修复) tcore 的数据目录
+//
+// 解析 .vlog / .hint / catalog.idx，核对 Hint 与 Block 的位置和统计信息，
+// 找出字典里不存在的 SensorID。必须在服务停止时运行：
+//
+//	fsck -data /var/lib/tcore                 # 只检查
+//	fsck -data /var/lib/tcore -dump           # 同时列出每个 Block 的头部信息
+//	fsck -data /var/lib/tcore -dump -points   # 再把 Block 解码出来
+//	fsck -data /var/lib/tcore -repair         # 重建 .hint 和字典
+//
+// 退出码沿用 fsck(8) 的约定：0 没有问题，1 问题已修复，4 还有未修复的问题，8 运行出错，16 用法错误
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+const (
+	exitClean    = 0
+	exitRepaired = 1
+	exitProblems = 4
+	exitFailure  = 8
+	exitUsage    = 16
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 解析参数并执行，返回进程退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dataDir := fs.String("data", "", "data directory to check (the server must not be running)")
+	repair := fs.Bool("repair", false, "rebuild .hint files and the catalog, truncate torn .vlog tails")
+	dump := fs.Bool("dump", false, "list every block header")
+	points := fs.Bool("points", false, "with -dump, also print the decoded points")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fsck -data DIR [-dump [-points]] [-repair]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *dataDir == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	report, err := tcore.Fsck(*dataDir, tcore.FsckOptions{KeepPoints: *dump && *points})
+	if err != nil {
+		fmt.Fprintln(stderr, "fsck:", err)
+		return exitFailure
+	}
+	if *dump {
+		printDump(stdout, report)
+	}
+	printSummary(stdout, report)
+	for _, issue := range report.Issues {
+		fmt.Fprintln(stdout, issue)
+	}
+	if report.Clean() {
+		fmt.Fprintln(stdout, "no problems found")
+		return exitClean
+	}
+	if !*repair {
+		fmt.Fprintf(stdout, "%d problems found, run with -repair to fix\n", len(report.Issues))
+		return exitProblems
+	}
+
+	repaired, err := tcore.Fsck(*dataDir, tcore.FsckOptions{Repair: true})
+	if repaired != nil {
+		for _, r := range repaired.Repairs {
+			fmt.Fprintln(stdout, "repair:", r)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "repair:", err)
+		return exitFailure
+	}
+
+	// 修复后再查一遍：无法解码的 Block 还留在 .vlog 里，只是不再被 Hint 引用
+	after, err := tcore.Fsck(*dataDir, tcore.FsckOptions{})
+	if err != nil {
+		fmt.Fprintln(stderr, "fsck:", err)
+		return exitFailure
+	}
+	if !after.Clean() {
+		fmt.Fprintf(stdout, "%d problems remain after repair:\n", len(after.Issues))
+		for _, issue := range after.Issues {
+			fmt.Fprintln(stdout, issue)
+		}
+		return exitProblems
+	}
+	fmt.Fprintln(stdout, "repaired, no problems remain")
+	return exitRepaired
+}
+
+func printSummary(w io.Writer, r *tcore.FsckReport) {
+	blocks, hints := 0, 0
+	for _, seg := range r.Segments {
+		blocks += len(seg.Blocks)
+		hints += seg.Hints
+	}
+	fmt.Fprintf(w, "catalog: %d records, %d series\n", r.Catalog.Records, len(r.Names))
+	fmt.Fprintf(w, "segments: %d, blocks: %d, hint records: %d, orphan sensors: %d\n", len(r.Segments), blocks, hints, len(r.Orphans))
+}
+
+func printDump(w io.Writer, r *tcore.FsckReport) {
+	for _, seg := range r.Segments {
+		fmt.Fprintf(w, "segment %d: %d bytes, %d blocks, %d hint records", seg.ID, seg.Size, len(seg.Blocks), seg.Hints)
+		if seg.TornTail > 0 {
+			fmt.Fprintf(w, ", %d torn bytes", seg.TornTail)
+		}
+		fmt.Fprintln(w)
+
+		for _, b := range seg.Blocks {
+			if b.Err != nil {
+				fmt.Fprintf(w, "  @%d size=%d error: %v\n", b.Offset, b.Size, b.Err)
+				continue
+			}
+			name, ok := r.Names[b.SensorID]
+			if !ok {
+				name = "<orphan>"
+			}
+			fmt.Fprintf(w, "  @%d size=%d sensor=%d (%s) type=%s count=%d time=[%d, %d]\n",
+				b.Offset, b.Size, b.SensorID, name, b.Type, b.Count, b.MinTime, b.MaxTime)
+			for _, p := range b.Points {
+				fmt.Fprintf(w, "    %d %s\n", p.Time, p.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package tcore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// CompactionInterval 后台 Compaction 的巡检间隔
+	CompactionInterval = 10 * time.Minute
+
+	// compactBlockMaxPoints 合并后单个 Block 的最大点数 (受 BlockMeta.Count 的 uint16 限制)
+	compactBlockMaxPoints = 16 * 1024
+
+	// compactTmpDir Compaction 产物的临时目录，写完并 fsync 之后才会 rename 进数据目录
+	compactTmpDir = "compact.tmp"
+)
+
+// Compact 🧹 6. 整理碎片
+// 把已封存 Segment 里每个 Series 相邻的小 Block 合并成有序的大 Block（同时去掉重复时间戳），
+// 写入全新的 .vlog/.hint，原子替换 Series 的冷索引，等旧文件没有读者后再删除
+func (db *DB) Compact() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+	db.scanMu.Lock()
+	defer db.scanMu.Unlock()
+
+	// 1. 选出碎片化的只读段
+	inputs, gen := db.pickCompactionInputs()
+	if len(inputs) == 0 {
+		return nil
+	}
+	fileIDs := make(map[uint32]bool, len(inputs))
+	for _, id := range inputs {
+		fileIDs[id] = true
+	}
+
+	// 2. 在临时目录里逐个 Series 重写
+	tmpDir := filepath.Join(db.manager.dirPath, compactTmpDir)
+	os.RemoveAll(tmpDir) // 清理上次崩溃留下的半成品
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	w := &compactWriter{mgr: db.manager, dir: tmpDir, gen: gen}
+	merged := make(map[*Series][]*BlockMeta)
+	for _, series := range db.idx.getAllSeries() {
+		metas := series.blocksIn(fileIDs)
+		if len(metas) == 0 {
+			continue
+		}
+		newMetas, err := db.rewriteSeries(w, series, metas)
+		if err != nil {
+			w.abort()
+			return err
+		}
+		merged[series] = newMetas
+	}
+
+	// 3. 刷盘并把新文件搬进数据目录
+	// 如果在这之后、删除旧文件之前崩溃，重启后新旧文件里会有重复的点，下一轮 Compaction 会把它们去重
+	outputs, err := w.publish()
+	if err != nil {
+		return err
+	}
+
+	// 4. 先挂载新段，再切换索引：任何时刻查询拿到的 BlockMeta 都能找到对应的文件
+	for _, seg := range outputs {
+		db.manager.installSegment(seg)
+	}
+	for series, metas := range merged {
+		series.replaceBlocks(fileIDs, metas)
+	}
+
+	// 5. 读屏障：等待还拿着旧 BlockMeta 的查询全部结束
+	db.readMu.Lock()
+	db.readMu.Unlock()
+
+	// 6. 物理删除旧文件 (已删除 Series 留下的孤儿 Block 也随之消失)
+	if err := db.manager.removeSegments(inputs); err != nil {
+		return err
+	}
+	db.tombs.clean(inputs)
+
+	// 7. 数据已经物理消失的墓碑可以丢掉了；墓地里清空的 Series 连字典记录一起回收
+	purged := false
+	for _, series := range db.idx.getDeadSeries() {
+		series.replaceBlocks(fileIDs, nil)
+		if series.blockCount() == 0 {
+			purged = true
+		}
+	}
+	if purged {
+		if err := db.CompactCatalog(); err != nil {
+			return err
+		}
+	}
+	return db.pruneTombstones()
+}
+
+// pickCompactionInputs 找出值得整理的只读段，以及产物的代数
+// 判定标准：段内 Block 数量多于"每个 Series 用最少的大 Block 装下"所需的数量，
+// 或者段内残留着被墓碑删除的数据。
+// 选中的段按代数排开后，中间夹着的段也一起整理：产物继承输入里最大的代数，
+// 如果跳过中间某一段，产物里更旧的点就会盖过那一段里更新的点
+func (db *DB) pickCompactionInputs() ([]uint32, uint32) {
+	segs := db.manager.sealedSegments()
+	if len(segs) == 0 {
+		return nil, 0
+	}
+	sort.SliceStable(segs, func(i, j int) bool { return segs[i].Gen < segs[j].Gen })
+	sealed := make(map[uint32]bool, len(segs))
+	for _, seg := range segs {
+		sealed[seg.ID] = true
+	}
+
+	blocks := make(map[uint32]int) // FileID -> 实际 Block 数
+	needed := make(map[uint32]int) // FileID -> 理想 Block 数
+	for _, series := range db.idx.getAllSeries() {
+		points := make(map[uint32]int)
+		for _, meta := range series.blocksIn(sealed) {
+			blocks[meta.FileID]++
+			points[meta.FileID] += int(meta.Count)
+		}
+		for id, n := range points {
+			needed[id] += (n + compactBlockMaxPoints - 1) / compactBlockMaxPoints
+		}
+	}
+
+	first, last := -1, -1
+	for i, seg := range segs {
+		if blocks[seg.ID] > needed[seg.ID] || db.tombs.isDirty(seg.ID) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return nil, 0
+	}
+	ids := make([]uint32, 0, last-first+1)
+	for _, seg := range segs[first : last+1] {
+		ids = append(ids, seg.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, segs[last].Gen
+}
+
+// rewriteSeries 读出一个 Series 在旧段里的全部点，剔除已删除的点、排序去重后重新切块写入
+func (db *DB) rewriteSeries(w *compactWriter, series *Series, metas []*BlockMeta) ([]*BlockMeta, error) {
+	if series.Type != TypeFloat {
+		return db.rewriteTypedSeries(w, series, metas)
+	}
+	tombs := db.tombs.rangesFor(series.ID)
+	db.manager.sortByWriteOrder(metas) // 去重时保留后写入的点
+
+	var points []Point
+	for _, meta := range metas {
+		block, err := db.manager.readBlock(meta)
+		if err != nil {
+			return nil, fmt.Errorf("read block failed: %v", err)
+		}
+		// 被墓碑遮盖的点在这里被物理剔除
+		for _, p := range block.Points {
+			if !isDeleted(tombs, meta.FileID, p.Time) {
+				points = append(points, p)
+			}
+		}
+	}
+
+	points = sortAndDedup(points)
+
+	var result []*BlockMeta
+	for len(points) > 0 {
+		n := len(points)
+		if n > compactBlockMaxPoints {
+			n = compactBlockMaxPoints
+		}
+		meta, err := w.writeBlock(NewBlock(series.ID, points[:n]))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, meta)
+		points = points[n:]
+	}
+	return result, nil
+}
+
+// rewriteTypedSeries 与 rewriteSeries 相同，作用于非 float64 时间线
+func (db *DB) rewriteTypedSeries(w *compactWriter, series *Series, metas []*BlockMeta) ([]*BlockMeta, error) {
+	tombs := db.tombs.rangesFor(series.ID)
+	db.manager.sortByWriteOrder(metas) // 去重时保留后写入的点
+
+	var points []TypedPoint
+	for _, meta := range metas {
+		block, err := db.readTypedBlock(meta)
+		if err != nil {
+			return nil, fmt.Errorf("read block failed: %v", err)
+		}
+		for _, p := range block {
+			if !isDeleted(tombs, meta.FileID, p.Time) {
+				points = append(points, p)
+			}
+		}
+	}
+
+	points = sortAndDedupTyped(points)
+
+	var result []*BlockMeta
+	for len(points) > 0 {
+		n := len(points)
+		if n > compactBlockMaxPoints {
+			n = compactBlockMaxPoints
+		}
+		data, err := encodeTypedBlock(series.ID, series.Type, points[:n])
+		if err != nil {
+			return nil, err
+		}
+		meta, err := w.writeRaw(series.ID, data, typedMeta(points[:n]))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, meta)
+		points = points[n:]
+	}
+	return result, nil
+}
+
+// sortAndDedup 按时间稳定排序，时间戳重复时保留排在最后的那个点
+// 调用方负责让输入按写入先后排列 (Compaction 用 Manager.sortByWriteOrder)
+func sortAndDedup(points []Point) []Point {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+
+	out := points[:0]
+	for _, p := range points {
+		if len(out) > 0 && out[len(out)-1].Time == p.Time {
+			out[len(out)-1] = p
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// ==========================================
+// ✍️ Compaction 产物写入器
+// ==========================================
+
+// compactWriter 把合并后的 Block 顺序写进临时目录里的新 Segment，写满就换下一个
+type compactWriter struct {
+	mgr  *Manager
+	dir  string
+	gen  uint32 // 产物的代数
+	cur  *Segment
+	done []*Segment
+}
+
+func (w *compactWriter) writeBlock(block *Block) (*BlockMeta, error) {
+	data, err := block.encode()
+	if err != nil {
+		return nil, err
+	}
+	return w.writeRaw(block.SensorID, data, block.toMeta)
+}
+
+// writeRaw 写入已经编码好的字节（typed Block 走这条路）
+func (w *compactWriter) writeRaw(sensorID uint32, data []byte, toMeta func(fileID uint32, offset int64, size uint32) *BlockMeta) (*BlockMeta, error) {
+	dataSize := int64(len(data))
+
+	if w.cur == nil || w.cur.size()+dataSize > w.mgr.maxSize {
+		if w.cur != nil {
+			w.done = append(w.done, w.cur)
+		}
+		// 新段的 ID 从 Manager 统一分配，保证和活跃段的轮转不冲突
+		seg, err := newSegment(w.dir, w.mgr.allocSegmentID())
+		if err != nil {
+			return nil, err
+		}
+		w.cur = seg
+		seg.Gen = w.gen
+		if err := writeGenRecord(seg.HintFile, w.gen); err != nil {
+			return nil, err
+		}
+	}
+
+	offset, err := w.cur.write(data)
+	if err != nil {
+		return nil, err
+	}
+	meta := toMeta(w.cur.ID, offset, uint32(dataSize))
+	if err := WriteHintRecord(w.cur.HintFile, sensorID, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// publish 刷盘、关闭临时段，rename 进数据目录后重新打开
+// 先搬 .vlog 再搬 .hint：中途崩溃最多留下一个没有 Hint 的数据文件，不会留下指向空文件的 Hint
+func (w *compactWriter) publish() ([]*Segment, error) {
+	if w.cur != nil {
+		w.done = append(w.done, w.cur)
+		w.cur = nil
+	}
+
+	var outputs []*Segment
+	for _, seg := range w.done {
+		if err := seg.Sync(); err != nil {
+			return nil, err
+		}
+		if err := seg.close(); err != nil {
+			return nil, err
+		}
+		for _, suffix := range []string{SegmentFileNameSuffix, hintFileNameSuffix} {
+			if err := os.Rename(segmentPath(w.dir, seg.ID, suffix), segmentPath(w.mgr.dirPath, seg.ID, suffix)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := syncDir(w.mgr.dirPath); err != nil {
+		return nil, err
+	}
+
+	for _, seg := range w.done {
+		reopened, err := newSegment(w.mgr.dirPath, seg.ID)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, reopened)
+	}
+	return outputs, nil
+}
+
+// abort 放弃本轮产物，临时目录由调用方整体删除
+func (w *compactWriter) abort() {
+	if w.cur != nil {
+		w.done = append(w.done, w.cur)
+	}
+	for _, seg := range w.done {
+		seg.close()
+	}
+}
@@ -0,0 +1,226 @@
+package tcore
+
+import (
+	"os"
+	"testing"
+)
+
+// sealActive 测试辅助：强制轮转，把当前活跃段变成只读段
+func sealActive(t *testing.T, db *DB) {
+	t.Helper()
+	db.manager.mu.Lock()
+	defer db.manager.mu.Unlock()
+	if err := db.manager.rotate(db.manager.nextID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDB_CompactMergesSmallBlocks(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个传感器交错写入大量只有 2 个点的小块，其中 1 个时间戳重复
+	a := db.idx.getOrCreateSeries("sensor_a")
+	b := db.idx.getOrCreateSeries("sensor_b")
+	for i := int64(0); i < 50; i++ {
+		if err := db.flushSeriesData(a, []Point{{Time: i * 2, Value: 1}, {Time: i*2 + 1, Value: 1}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.flushSeriesData(b, []Point{{Time: i, Value: 2}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.flushSeriesData(a, []Point{{Time: 0, Value: 9}})
+	sealActive(t, db)
+	oldIDs := db.manager.sealedSegments()
+
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(a.blocksIn(map[uint32]bool{oldIDs[0].ID: true})); n != 0 {
+		t.Errorf("expected old blocks to be replaced, %d left", n)
+	}
+	if len(a.blocks) != 1 || a.blocks[0].Count != 100 {
+		t.Errorf("expected 1 merged block with 100 points, got %d blocks", len(a.blocks))
+	}
+	if _, err := os.Stat(segmentPath(dir, oldIDs[0].ID, SegmentFileNameSuffix)); !os.IsNotExist(err) {
+		t.Error("expected compacted segment file to be removed")
+	}
+
+	points, err := db.Query("sensor_a", 0, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 100 || points[0].Value != 9 {
+		t.Errorf("expected 100 deduplicated points starting with 9, got %d", len(points))
+	}
+
+	// 重启后依然能从新的 .hint 恢复
+	db.Close()
+	db2, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+
+	points, err = db2.Query("sensor_b", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 50 {
+		t.Errorf("expected 50 points after reload, got %d", len(points))
+	}
+}
+
+func TestDB_CompactKeepsLatestWriteAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := db.idx.getOrCreateSeries("sensor_a")
+	// 后写的 Block MinTime 更小，重启后冷索引按 MinTime 排序会把它排到前面
+	if err := db.flushSeriesData(a, []Point{{Time: 50, Value: 1}, {Time: 60, Value: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.flushSeriesData(a, []Point{{Time: 10, Value: 2}, {Time: 50, Value: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	sealActive(t, db)
+	db.Close()
+
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	points, err := db.Query("sensor_a", 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Value != 2 {
+		t.Errorf("expected [{50 2}], got %v", points)
+	}
+}
+
+func TestDB_CompactIncludesSegmentsInBetween(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := db.idx.getOrCreateSeries("sensor_a")
+	flush := func(points ...Point) {
+		t.Helper()
+		if err := db.flushSeriesData(a, points); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第 1、3 段碎片化，第 2 段只有一个 Block，本身不需要整理，但夹在中间
+	flush(Point{Time: 50, Value: 1})
+	flush(Point{Time: 60, Value: 1})
+	sealActive(t, db)
+	flush(Point{Time: 50, Value: 2})
+	sealActive(t, db)
+	flush(Point{Time: 70, Value: 3})
+	flush(Point{Time: 80, Value: 3})
+	sealActive(t, db)
+
+	for i := 0; i < 2; i++ {
+		if err := db.Compact(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	points, err := db.Query("sensor_a", 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Value != 2 {
+		t.Errorf("expected [{50 2}], got %v", points)
+	}
+
+	// 产物的代数在重启后依然有效：它比之后写入的段更旧
+	flush(Point{Time: 50, Value: 4})
+	sealActive(t, db)
+	db.Close()
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if a = db.idx.getSeries("sensor_a"); a == nil {
+		t.Fatal("series lost after reopen")
+	}
+	metas := a.findBlocks(50, 50)
+	db.manager.sortByWriteOrder(metas)
+	if len(metas) != 2 {
+		t.Fatalf("expected 2 blocks covering t=50, got %d", len(metas))
+	}
+	block, err := db.manager.readBlock(metas[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Points[0].Value != 4 {
+		t.Errorf("expected the block written after compaction to sort last, got %v", block.Points)
+	}
+}
+
+func TestDB_WritesAfterReopenDoNotInheritCompactedGen(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := db.idx.getOrCreateSeries("sensor_a")
+	flush := func(points ...Point) {
+		t.Helper()
+		if err := db.flushSeriesData(a, points); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flush(Point{Time: 1, Value: 50})
+	flush(Point{Time: 2, Value: 50})
+	sealActive(t, db)
+	flush(Point{Time: 1, Value: 60}) // 留在活跃段里，不参与这一轮 Compaction
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// 重启后 ID 最大的是 Compaction 产物，新写入不能落进这个旧代数的段
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if a = db.idx.getSeries("sensor_a"); a == nil {
+		t.Fatal("series lost after reopen")
+	}
+	flush(Point{Time: 1, Value: 99})
+	flush(Point{Time: 3, Value: 99})
+	sealActive(t, db)
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compaction 去重时按写入先后取最后一个：t=1 最新的必须是 99
+	metas := a.findBlocks(1, 1)
+	db.manager.sortByWriteOrder(metas)
+	block, err := db.manager.readBlock(metas[len(metas)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range block.Points {
+		if p.Time == 1 && p.Value != 99 {
+			t.Errorf("expected the latest write of t=1 to be 99, got %v", p.Value)
+		}
+	}
+}
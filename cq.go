@@ -0,0 +1,443 @@
+package tcore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	cqFileName = "continuous_queries.json"
+
+	// cqTickInterval 调度器检查有没有到期窗口的周期；到期判断只是比较时间戳，很便宜
+	cqTickInterval = time.Second
+
+	// cqMaxWindows 一次最多处理多少个窗口：落后很多时 (比如回填) 分批读，控制内存
+	cqMaxWindows = 1024
+)
+
+var (
+	ErrBadContinuousQuery      = errors.New("invalid continuous query")
+	ErrContinuousQueryExists   = errors.New("continuous query already exists")
+	ErrContinuousQueryNotFound = errors.New("continuous query not found")
+)
+
+// ContinuousQuery 连续查询：每个窗口结束后，把 Source 选中的所有数值型时间线在窗口内的点
+// 聚合成一个值，写进普通时间线 Target，时间戳是窗口起点
+type ContinuousQuery struct {
+	Name     string        // 唯一名字
+	Source   string        // 时间线选择器，如 temperature{site="plant-3"}，见 ParseSelector
+	Agg      string        // avg / min / max / sum / count / first / last
+	Step     time.Duration // 窗口宽度，窗口对齐到 Step 的整数倍
+	Delay    time.Duration // 窗口结束后再等这么久才计算，给迟到的数据留时间；之后到的数据不再计入
+	TimeUnit time.Duration // DB 里时间戳的单位，默认纳秒
+	Target   string        // 结果写入的时间线，只应由这个连续查询写入
+	Start    int64         // 从包含 Start 的窗口开始 (DB 的时间单位)，可用于回填；0 表示从注册时的当前窗口开始
+}
+
+// ContinuousQueryStatus 连续查询及其进度
+type ContinuousQueryStatus struct {
+	ContinuousQuery
+	Watermark int64     // 之前的窗口都已处理过，下一个窗口从这里开始
+	LastRun   time.Time // 最近一次处理窗口的时间
+	LastError string    // 最近一次失败的原因，成功后清空
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// AddContinuousQuery ➕ 注册连续查询，保存在数据目录里，重启后继续从上次的进度执行
+func (db *DB) AddContinuousQuery(cq ContinuousQuery) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	sel, err := cq.normalize()
+	if err != nil {
+		return err
+	}
+	return db.cqs.add(cq, sel)
+}
+
+// RemoveContinuousQuery ➖ 删除连续查询；已经写入 Target 的结果保留
+func (db *DB) RemoveContinuousQuery(name string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	return db.cqs.remove(name)
+}
+
+// ContinuousQueries 所有连续查询及其进度，按名字排序
+func (db *DB) ContinuousQueries() []ContinuousQueryStatus {
+	db.cqs.mu.Lock()
+	defer db.cqs.mu.Unlock()
+	list := make([]ContinuousQueryStatus, 0, len(db.cqs.queries))
+	for _, e := range db.cqs.queries {
+		list = append(list, e.ContinuousQueryStatus)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// RunContinuousQueries ⏱️ 立即处理所有已经结束的窗口；后台调度器每秒调用一次
+func (db *DB) RunContinuousQueries() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	return db.cqs.run(db)
+}
+
+// ==========================================
+// 🔒 配置
+// ==========================================
+
+// normalize 校验并补全默认值
+func (cq *ContinuousQuery) normalize() (*Selector, error) {
+	if cq.Name == "" || cq.Target == "" {
+		return nil, fmt.Errorf("%w: name and target are required", ErrBadContinuousQuery)
+	}
+	if cq.Agg == "" {
+		cq.Agg = "avg"
+	}
+	if !IsAggregate(cq.Agg) {
+		return nil, fmt.Errorf("%w: %w: %s", ErrBadContinuousQuery, ErrUnknownAggregate, cq.Agg)
+	}
+	if cq.TimeUnit <= 0 {
+		cq.TimeUnit = time.Nanosecond
+	}
+	if cq.Step < cq.TimeUnit || cq.Step%cq.TimeUnit != 0 {
+		return nil, fmt.Errorf("%w: step %v is not a multiple of the time unit %v", ErrBadContinuousQuery, cq.Step, cq.TimeUnit)
+	}
+	if cq.Delay < 0 {
+		return nil, fmt.Errorf("%w: negative delay", ErrBadContinuousQuery)
+	}
+	sel, err := ParseSelector(cq.Source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadContinuousQuery, err)
+	}
+	if sel.Match(cq.Target) {
+		return nil, fmt.Errorf("%w: target %q matches its own source", ErrBadContinuousQuery, cq.Target)
+	}
+	return sel, nil
+}
+
+// cqFileEntry continuous_queries.json 里的一项，时长写成 "1m" 这样便于阅读
+type cqFileEntry struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	Agg       string    `json:"agg"`
+	Step      string    `json:"step"`
+	Delay     string    `json:"delay,omitempty"`
+	TimeUnit  string    `json:"time_unit"`
+	Target    string    `json:"target"`
+	Start     int64     `json:"start,omitempty"`
+	Watermark int64     `json:"watermark"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func (e *cqFileEntry) decode() (ContinuousQueryStatus, error) {
+	st := ContinuousQueryStatus{
+		ContinuousQuery: ContinuousQuery{Name: e.Name, Source: e.Source, Agg: e.Agg, Target: e.Target, Start: e.Start},
+		Watermark:       e.Watermark,
+		LastRun:         e.LastRun,
+		LastError:       e.LastError,
+	}
+	var err error
+	for _, f := range []struct {
+		s string
+		d *time.Duration
+	}{{e.Step, &st.Step}, {e.Delay, &st.Delay}, {e.TimeUnit, &st.TimeUnit}} {
+		if f.s == "" {
+			continue
+		}
+		if *f.d, err = ParseRollupDuration(f.s); err != nil {
+			return st, err
+		}
+	}
+	return st, nil
+}
+
+// ==========================================
+// 🔒 调度
+// ==========================================
+
+// cqEntry 一个已注册的连续查询
+type cqEntry struct {
+	ContinuousQueryStatus
+	sel     *Selector
+	checked bool // 已经和 Target 里现存的结果对过进度
+}
+
+// cqManager 连续查询的注册表、进度和调度
+type cqManager struct {
+	path string
+
+	mu      sync.Mutex // 保护 queries，写文件时也持有，快照读到的一定是完整的文件
+	queries map[string]*cqEntry
+
+	runMu sync.Mutex       // 同一时刻只跑一轮
+	clock func() time.Time // 在 mu 下读取
+}
+
+// openContinuousQueries 加载注册表；文件不存在表示没有连续查询
+func openContinuousQueries(dir string) (*cqManager, error) {
+	m := &cqManager{path: filepath.Join(dir, cqFileName), queries: make(map[string]*cqEntry), clock: time.Now}
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []cqFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", cqFileName, err)
+	}
+	for _, fe := range entries {
+		st, err := fe.decode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", cqFileName, fe.Name, err)
+		}
+		sel, err := st.ContinuousQuery.normalize()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cqFileName, err)
+		}
+		m.queries[st.Name] = &cqEntry{ContinuousQueryStatus: st, sel: sel}
+	}
+	return m, nil
+}
+
+func (m *cqManager) add(cq ContinuousQuery, sel *Selector) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.queries[cq.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrContinuousQueryExists, cq.Name)
+	}
+	step := int64(cq.Step / cq.TimeUnit)
+	start := cq.Start
+	if start == 0 {
+		start = m.clock().UnixNano() / int64(cq.TimeUnit)
+	}
+	m.queries[cq.Name] = &cqEntry{
+		ContinuousQueryStatus: ContinuousQueryStatus{ContinuousQuery: cq, Watermark: floorAlign(start, step)},
+		sel:                   sel,
+	}
+	if err := m.saveLocked(); err != nil {
+		delete(m.queries, cq.Name)
+		return err
+	}
+	return nil
+}
+
+func (m *cqManager) remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.queries[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrContinuousQueryNotFound, name)
+	}
+	delete(m.queries, name)
+	if err := m.saveLocked(); err != nil {
+		m.queries[name] = e
+		return err
+	}
+	return nil
+}
+
+// renameSeries 时间线改名：Source 或 Target 正好是旧名字的连续查询改用新名字并落盘
+// 调用方持有 m.runMu，改名不会撞上正在进行的一轮
+func (m *cqManager) renameSeries(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for _, e := range m.queries {
+		if e.Target == oldName {
+			e.Target = newName
+			changed = true
+		}
+		if e.Source == oldName {
+			sel, err := ParseSelector(newName)
+			if err != nil || sel.Match(e.Target) {
+				continue // 新名字当不了这个查询的选择器，只能按原来的模式重新匹配
+			}
+			e.Source, e.sel = newName, sel
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return m.saveLocked()
+}
+
+// saveLocked 整个注册表写成一个文件；调用方持有 m.mu
+func (m *cqManager) saveLocked() error {
+	entries := make([]cqFileEntry, 0, len(m.queries))
+	for _, e := range m.queries {
+		fe := cqFileEntry{
+			Name:      e.Name,
+			Source:    e.Source,
+			Agg:       e.Agg,
+			Step:      formatRollupDuration(e.Step),
+			TimeUnit:  formatRollupDuration(e.TimeUnit),
+			Target:    e.Target,
+			Start:     e.Start,
+			Watermark: e.Watermark,
+			LastRun:   e.LastRun,
+			LastError: e.LastError,
+		}
+		if e.Delay > 0 {
+			fe.Delay = formatRollupDuration(e.Delay)
+		}
+		entries = append(entries, fe)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(m.path, data)
+}
+
+// snapshotFile 快照用：注册表文件的当前内容，没有连续查询时返回 nil
+func (m *cqManager) snapshotFile() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// startContinuousQueries 后台调度：每秒检查一次，有窗口到期就处理
+func (db *DB) startContinuousQueries() {
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		ticker := time.NewTicker(cqTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-db.stopCh:
+				return
+			case <-ticker.C:
+			}
+			if err := db.RunContinuousQueries(); err != nil {
+				fmt.Printf("Error running continuous queries: %v\n", err)
+			}
+		}
+	}()
+}
+
+func (m *cqManager) run(db *DB) error {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	m.mu.Lock()
+	now := m.clock()
+	entries := make([]*cqEntry, 0, len(m.queries))
+	for _, e := range m.queries {
+		entries = append(entries, e)
+	}
+	m.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	var keys []string
+	var firstErr error
+	for _, e := range entries {
+		if keys == nil && e.due(now) {
+			keys = db.Keys()
+		}
+		if err := m.runOne(db, e, keys, now); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	return firstErr
+}
+
+// due 是否有已经结束的窗口；Watermark 只在 runMu 下修改，这里读不需要 m.mu
+func (e *cqEntry) due(now time.Time) bool {
+	unit := int64(e.TimeUnit)
+	closed := (now.UnixNano() - int64(e.Delay)) / unit
+	return e.Watermark+int64(e.Step)/unit <= closed
+}
+
+// runOne 处理一个连续查询所有已结束的窗口，每批写完立即保存进度
+func (m *cqManager) runOne(db *DB, e *cqEntry, keys []string, now time.Time) error {
+	unit := int64(e.TimeUnit)
+	step := int64(e.Step) / unit
+
+	// 写完结果、还没保存进度就崩溃时，重启后 Target 里已经有这些窗口：跳到其后，保证每个窗口只写一次
+	if !e.checked {
+		if st, err := db.Stats(e.Target); err == nil && st.Points > 0 && st.MaxTime >= e.Watermark {
+			if _, err := m.setProgress(e, floorAlign(st.MaxTime, step)+step, now, nil); err != nil {
+				return err
+			}
+		}
+		e.checked = true
+	}
+
+	for e.due(now) {
+		closed := (now.UnixNano() - int64(e.Delay)) / unit
+		lo := e.Watermark
+		hi := min(floorAlign(closed, step), lo+cqMaxWindows*step) // 不含
+
+		points, err := e.collect(db, keys, lo, hi-1)
+		if err == nil && len(points) > 0 {
+			err = db.writeBatch(e.Target, points)
+		}
+		if err != nil {
+			m.setProgress(e, lo, now, err)
+			return err
+		}
+		if ok, err := m.setProgress(e, hi, now, nil); !ok || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collect 读出 [lo, hi] 内所有来源时间线的点，按窗口聚合
+func (e *cqEntry) collect(db *DB, keys []string, lo, hi int64) ([]TypedPoint, error) {
+	var points []TypedPoint
+	for _, name := range keys {
+		if name == e.Target || !e.sel.Match(name) {
+			continue
+		}
+		if typ, err := db.SeriesType(name); err != nil || typ != TypeFloat && typ != TypeUint {
+			continue
+		}
+		err := db.ScanValues(name, lo, hi, func(p TypedPoint) error {
+			points = append(points, p)
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrSeriesNotFound) {
+			return nil, err
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return Aggregate(points, int64(e.Step/e.TimeUnit), e.Agg)
+}
+
+// setProgress 记录进度并落盘；查询在此期间被删掉时什么也不做，返回 false
+func (m *cqManager) setProgress(e *cqEntry, watermark int64, now time.Time, runErr error) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.queries[e.Name] != e {
+		return false, nil
+	}
+	e.Watermark = watermark
+	e.LastRun = now
+	e.LastError = ""
+	if runErr != nil {
+		e.LastError = runErr.Error()
+	}
+	return true, m.saveLocked()
+}
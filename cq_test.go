@@ -0,0 +1,134 @@
+package tcore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setCQClock(db *DB, sec int64) {
+	db.cqs.mu.Lock()
+	db.cqs.clock = func() time.Time { return time.Unix(sec, 0) }
+	db.cqs.mu.Unlock()
+}
+
+func targetPoints(t *testing.T, db *DB) map[int64]float64 {
+	t.Helper()
+	points, err := db.QueryValues("plant3_avg_temp", 0, 1<<40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[int64]float64)
+	for _, p := range points {
+		if _, dup := m[p.Time]; dup {
+			t.Fatalf("window %d written twice", p.Time)
+		}
+		m[p.Time] = p.Value.Float
+	}
+	return m
+}
+
+func TestContinuousQuery(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCQClock(db, 150)
+
+	cq := ContinuousQuery{
+		Name:     "plant3",
+		Source:   `temperature{site="plant-3"}`,
+		Step:     time.Minute,
+		Delay:    10 * time.Second,
+		TimeUnit: time.Second,
+		Target:   "plant3_avg_temp",
+		Start:    1,
+	}
+	if err := db.AddContinuousQuery(cq); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddContinuousQuery(cq); !errors.Is(err, ErrContinuousQueryExists) {
+		t.Fatalf("expected ErrContinuousQueryExists, got %v", err)
+	}
+	bad := cq
+	bad.Name, bad.Target = "self", `temperature{site="plant-3",kind="avg"}`
+	if err := db.AddContinuousQuery(bad); !errors.Is(err, ErrBadContinuousQuery) {
+		t.Fatalf("expected ErrBadContinuousQuery, got %v", err)
+	}
+
+	db.Write(`temperature{room="a",site="plant-3"}`, 10, 10)
+	db.Write(`temperature{room="a",site="plant-3"}`, 70, 30)
+	db.WriteBatch(`temperature{room="b",site="plant-3"}`, []TypedPoint{{Time: 20, Value: UintValue(20)}, {Time: 130, Value: UintValue(50)}})
+	db.Write(`temperature{site="plant-1"}`, 15, 1000)
+	db.WriteValue(`temperature{site="plant-3",room="c"}`, 15, StringValue("n/a")) // 非数值，跳过
+
+	// 150 - 10 秒延迟：[0, 60) 和 [60, 120) 已结束，[120, 180) 还没有
+	if err := db.RunContinuousQueries(); err != nil {
+		t.Fatal(err)
+	}
+	if got := targetPoints(t, db); len(got) != 2 || got[0] != 15 || got[60] != 30 {
+		t.Fatalf("first run: %v", got)
+	}
+
+	// 已经处理过的窗口不再处理：迟到的数据不计入，也不会重复写入
+	db.Write(`temperature{room="a",site="plant-3"}`, 30, 100)
+	if err := db.RunContinuousQueries(); err != nil {
+		t.Fatal(err)
+	}
+	if got := targetPoints(t, db); len(got) != 2 || got[0] != 15 {
+		t.Fatalf("second run: %v", got)
+	}
+	st := db.ContinuousQueries()
+	if len(st) != 1 || st[0].Watermark != 120 || st[0].Agg != "avg" || st[0].LastError != "" {
+		t.Fatalf("status: %+v", st)
+	}
+
+	setCQClock(db, 200)
+	if err := db.RunContinuousQueries(); err != nil {
+		t.Fatal(err)
+	}
+	if got := targetPoints(t, db); len(got) != 3 || got[120] != 50 {
+		t.Fatalf("third run: %v", got)
+	}
+	db.Close()
+
+	// 模拟写完结果、没来得及保存进度就崩溃：进度退回到 60
+	path := filepath.Join(dir, cqFileName)
+	data, _ := os.ReadFile(path)
+	var entries []cqFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil || len(entries) != 1 || entries[0].Step != "1m" {
+		t.Fatalf("%s: %s", cqFileName, data)
+	}
+	entries[0].Watermark = 60
+	data, _ = json.Marshal(entries)
+	os.WriteFile(path, data, 0644)
+
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	setCQClock(db, 250)
+	db.Write(`temperature{room="a",site="plant-3"}`, 185, 7)
+	if err := db.RunContinuousQueries(); err != nil {
+		t.Fatal(err)
+	}
+	if got := targetPoints(t, db); len(got) != 4 || got[60] != 30 || got[180] != 7 {
+		t.Fatalf("after restart: %v", got)
+	}
+	if st := db.ContinuousQueries(); st[0].Watermark != 240 || st[0].Delay != 10*time.Second {
+		t.Fatalf("status after restart: %+v", st[0])
+	}
+
+	if err := db.RemoveContinuousQuery("nope"); !errors.Is(err, ErrContinuousQueryNotFound) {
+		t.Fatalf("expected ErrContinuousQueryNotFound, got %v", err)
+	}
+	if err := db.RemoveContinuousQuery("plant3"); err != nil || len(db.ContinuousQueries()) != 0 {
+		t.Fatalf("remove: %v", err)
+	}
+}
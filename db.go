@@ -1,6 +1,7 @@
 package tcore
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,13 +11,34 @@ import (
 	"time"
 )
 
+var (
+	ErrSeriesNotFound = errors.New("series not found")
+	ErrInvalidRange   = errors.New("invalid time range: start is after end")
+)
+
 // ------------------------------------------------------------
 
 // DB 是数据库的对外门面
 // 它负责协调：Index (内存大脑) <-> Series (数据缓冲) <-> Storage (磁盘肌肉)
 type DB struct {
-	manager *Manager // 磁盘管理器
-	idx     *Index   // 内存索引
+	manager *Manager       // 磁盘管理器
+	idx     *Index         // 内存索引
+	tombs   *tombstoneSet  // 删除墓碑
+	rollups *rollupManager // 降采样规则和进度
+	cqs     *cqManager     // 连续查询
+	alerts  *alertManager  // 告警规则和状态
+	subs    *subHub        // 实时订阅
+
+	pipeline *pipeline // 写入流水线：落盘前的标定、换算、过滤
+
+	staleness *stalenessTracker // 陈旧标记的设置、最近写入记录的保存
+
+	catalogReport *CatalogReport // 开机加载字典时发现的问题
+	readOnly      bool           // OpenReadOnly 打开：拒绝一切写操作
+
+	readMu    sync.RWMutex // 读屏障：Compaction 删除旧文件前，等待进行中的查询全部退出
+	compactMu sync.Mutex   // 保证同一时刻只有一个 Compaction 在跑，删除也要拿它
+	scanMu    sync.RWMutex // 流式查询期间持读锁，Compaction 开始前等它们结束
 
 	stopCh chan struct{}  // 关闭信号
 	wg     sync.WaitGroup // 等待组 (确保后台任务安全退出)
@@ -29,42 +51,105 @@ func NewDB(dirPath string) (*DB, error) {
 	idx := NewIndex()
 
 	// 🌟 1. 打开字典文件，并挂载到 Index 上，准备接收未来的新设备注册
-	catalogPath := filepath.Join(dirPath, "catalog.idx")
-	catalogFd, _ := os.OpenFile(catalogPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	// 损坏的记录会被跳过，写了一半的尾巴会被截掉，问题汇总在 report 里
+	catalogPath := filepath.Join(dirPath, catalogFileName)
+	catalogFd, records, report, err := openCatalog(catalogPath)
+	if err != nil {
+		return nil, err
+	}
 	idx.catalogFd = catalogFd
+	if !report.Clean() {
+		fmt.Printf("⚠️ catalog.idx 已恢复：跳过 %d 处损坏，截掉末尾 %d 字节\n", len(report.Damaged), report.Truncated)
+	}
 
-	// 🌟 2. 【开机第一步】：扫描 catalog.idx，恢复内存字典和 nextID 最大值！
-	loadCatalog(catalogFd, idx)
+	// 🌟 2. 【开机第一步】：用 catalog.idx 的记录恢复内存字典和 nextID 最大值！
+	loadCatalog(records, idx)
 
 	// 🌟 3. 【开机第二步】：扫描所有 .hint 文件。
 	// 此时读出来的 Hint 只有 uint32，但你的大脑已经可以通过 idx.idToName 认识它们了！
 	loadHintsFromDir(dirPath, idx)
 
+	// 🌟 4. 【开机第三步】：加载墓碑，让删除操作在重启后依然生效
+	tombs, err := openTombstones(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 🌟 5. 降采样规则和进度
+	rollups, err := openRollups(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 🌟 6. 连续查询的注册表和进度
+	cqs, err := openContinuousQueries(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 🌟 7. 告警规则和状态
+	alerts, err := openAlerts(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 🌟 8. 每条时间线最近一次写入的时间和值，沉默检测用
+	staleness := loadLastWrites(dirPath, idx)
+
 	db := &DB{
-		manager: mgr,
-		idx:     idx,
-		stopCh:  make(chan struct{}),
+		manager:       mgr,
+		idx:           idx,
+		tombs:         tombs,
+		rollups:       rollups,
+		cqs:           cqs,
+		alerts:        alerts,
+		staleness:     staleness,
+		subs:          newSubHub(),
+		pipeline:      &pipeline{},
+		catalogReport: report,
+		stopCh:        make(chan struct{}),
 	}
+	db.applyTombstones()
+	// 🌟 9. 每条时间线的最新值缓存：必须在墓碑生效之后，被删的点不能成为最新值
+	db.rebuildLatest()
 
 	// 负责定期把长时间未写入的数据强制刷盘
 	db.startWorker()
+	db.startRollups()
+	db.startContinuousQueries()
+	db.startAlerts()
 
 	return db, nil
 }
 
 // ➕ 补全极其简单的加载字典逻辑
-func loadCatalog(file *os.File, idx *Index) {
-	file.Seek(0, io.SeekStart) // 确保从头开始读
+func loadCatalog(records []catalogRecord, idx *Index) {
 	maxID := uint32(0)
+	byID := make(map[uint32]*Series)
 
-	for {
-		id, name, err := DecodeCatalog(file)
-		if err != nil {
-			break // 读到 EOF 跳出
+	for _, rec := range records {
+		id, name := rec.ID, rec.Name
+
+		s, ok := byID[id]
+		if !ok {
+			s = newSeries(id, rec.Type)
+			byID[id] = s
+		}
+
+		// 同一个 ID 再次出现说明改过名：以最后一条为准，摘掉旧名字
+		if old, ok := idx.idToName[id]; ok && old != name {
+			if cur := idx.seriesMap[old]; cur != nil && cur.ID == id {
+				delete(idx.seriesMap, old)
+			}
+		}
+		// 名字被另一个 ID 占着：说明旧 Series 已被删除、名字被复用，旧的送进墓地
+		if prev := idx.seriesMap[name]; prev != nil && prev.ID != id {
+			delete(idx.idToName, prev.ID)
+			idx.graveyard[prev.ID] = deadSeries{name: name, series: prev}
 		}
 
 		// 恢复正向和反向映射
-		idx.seriesMap[name] = newSeries(id)
+		idx.seriesMap[name] = s
 		idx.idToName[id] = name
 		if id > maxID {
 			maxID = id
@@ -79,7 +164,7 @@ func loadCatalog(file *os.File, idx *Index) {
 
 // loadHintsFromDir 扫描数据目录，按字典序加载所有伴生索引文件
 func loadHintsFromDir(dirPath string, idx *Index) error {
-	pattern := filepath.Join(dirPath, "*.hint")
+	pattern := filepath.Join(dirPath, "*"+hintFileNameSuffix)
 	files, err := filepath.Glob(pattern)
 	if err != nil {
 		return err
@@ -97,6 +182,13 @@ func loadHintsFromDir(dirPath string, idx *Index) error {
 			return err
 		}
 	}
+
+	// Compaction 会把旧数据写进 ID 更大的新文件，这里统一按时间重新排一次
+	for _, s := range idx.getAllSeries() {
+		s.mu.Lock()
+		s.sortBlocksLocked()
+		s.mu.Unlock()
+	}
 	return nil
 }
 
@@ -117,22 +209,20 @@ func processSingleHintFile(filePath string, idx *Index) error {
 			}
 			return fmt.Errorf("Hint文件 %s 损坏: %v", filePath, err)
 		}
+		if sensorID == genSensorID {
+			continue // 代数记录，Manager 打开 Segment 时已经读过
+		}
 
-		// 🌟 2. 核心联动：靠第一步读出来的 Catalog 字典，把 uint32 翻译回名字！
-		idx.mu.RLock()
-		name, ok := idx.idToName[sensorID]
-		idx.mu.RUnlock()
-
-		if !ok {
-			// 极端容错防线：如果 Hint 里有数据，但字典里找不到对应的名字
+		// 🌟 2. 核心联动：靠第一步读出来的 Catalog 字典，按 ID 找到对应的设备
+		// (已删除但数据还没清除的设备在墓地里，同样能找到)
+		s := idx.seriesOf(sensorID)
+		if s == nil {
+			// 极端容错防线：如果 Hint 里有数据，但字典里找不到对应的 ID
 			// 说明这批数据成了“孤儿”，直接跳过，防止引发恐慌 (Panic)
-			// fmt.Printf("⚠️ 警告：发现孤儿区块，未知 SensorID: %d\n", sensorID)
+			// (cmd/fsck 可以把它们找出来，并以 orphan-<ID> 的名字重新登记)
 			continue
 		}
 
-		// 🌟 3. 获取对应的设备 (因为前面 loadCatalog 已经把它放进内存了，这里绝对能拿到)
-		s := idx.getOrCreateSeries(name)
-
 		// 🌟 4. 把藏宝图挂载到设备的肚子里
 		s.mu.Lock()
 		s.blocks = append(s.blocks, meta)
@@ -149,6 +239,17 @@ func processSingleHintFile(filePath string, idx *Index) error {
 // Write ✍️ 2. 写入数据
 // 也就是 "存"：告诉我是谁、什么时候、多少度
 func (db *DB) Write(sensorID string, timestamp int64, value float64) error {
+	if db.pipeline.active.Load() {
+		return db.ingest([]IngestPoint{{Series: sensorID, Time: timestamp, Value: FloatValue(value)}}, false)
+	}
+	return db.write(sensorID, timestamp, value)
+}
+
+// write 不经过写入流水线的 Write
+func (db *DB) write(sensorID string, timestamp int64, value float64) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
 	// 1. 封装成内部 Point
 	point := Point{
 		Time:  timestamp,
@@ -157,10 +258,16 @@ func (db *DB) Write(sensorID string, timestamp int64, value float64) error {
 
 	// 2. 获取或创建 Series (内存中的专属通道)
 	series := db.idx.getOrCreateSeries(sensorID)
+	if series.Type != TypeFloat {
+		return ErrTypeMismatch // 其它类型的时间线请用 WriteValue
+	}
 
 	// 3. 尝试追加到内存 Buffer
 	// ⚡️ 核心黑科技：如果 Buffer 满了，Series 会"窃取"满的那部分数据并返回给我们
 	pointsToFlush := series.append(point)
+	db.rollups.noteWrite(sensorID, timestamp, timestamp)
+	db.alerts.observe(sensorID, timestamp, value)
+	db.subs.publish(sensorID, TypedPoint{Time: timestamp, Value: FloatValue(value)})
 
 	// 4. 如果发生了窃取，说明需要落盘了
 	if len(pointsToFlush) > 0 {
@@ -173,13 +280,21 @@ func (db *DB) Write(sensorID string, timestamp int64, value float64) error {
 // Query 🔍 3. 查询数据
 // 也就是 "取"：查出一段时间内的所有点
 func (db *DB) Query(sensorID string, start, end int64) ([]Point, error) {
+	// 持有读屏障，保证拿到的 BlockMeta 在读完之前不会被 Compaction 删掉
+	db.readMu.RLock()
+	defer db.readMu.RUnlock()
+
 	// 1. 找设备
-	series := db.idx.getOrCreateSeries(sensorID)
+	series := db.idx.getSeries(sensorID)
 	if series == nil {
 		return nil, nil // 没这个设备，直接返回空
 	}
+	if series.Type != TypeFloat {
+		return nil, ErrTypeMismatch // 其它类型的时间线请用 QueryValues
+	}
 
 	var result []Point
+	tombs := db.tombs.rangesFor(series.ID) // 已删除的时间范围
 
 	// 2. 查磁盘 (冷数据 Cold Data)
 	// 从 Series 里拿出符合时间范围的"藏宝图坐标" (BlockMeta)
@@ -194,7 +309,7 @@ func (db *DB) Query(sensorID string, start, end int64) ([]Point, error) {
 
 		// Block 只是粗略的块，需要过滤出精确符合时间范围的点
 		for _, p := range block.Points {
-			if p.Time >= start && p.Time <= end {
+			if p.Time >= start && p.Time <= end && !isDeleted(tombs, meta.FileID, p.Time) {
 				result = append(result, p)
 			}
 		}
@@ -217,16 +332,101 @@ func (db *DB) Keys() []string {
 	return db.idx.getAllKeys()
 }
 
+// RenameSeries ✏️ 给传感器改名
+// ID 保持不变，所以已有的 Hint 记录和磁盘上的 Block 依然能对上号。
+// 按名字记账的状态一并迁移：汇总时间线和降采样进度跟着改名，告警状态在规则仍选中新名字时保留；
+// 连续查询的 Source / Target 正好是旧名字时改成新名字，其余选择器按新名字重新匹配
+func (db *DB) RenameSeries(oldName, newName string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	// 降采样和连续查询都按名字读写，让它们停在两轮之间，不会在一轮里同时看到新旧名字
+	db.rollups.runMu.Lock()
+	defer db.rollups.runMu.Unlock()
+	db.cqs.runMu.Lock()
+	defer db.cqs.runMu.Unlock()
+
+	derived := rollupRenames(db.Keys(), oldName, newName)
+	for _, r := range derived {
+		if db.idx.getSeries(r[1]) != nil {
+			return fmt.Errorf("%w: %s", ErrSeriesExists, r[1])
+		}
+	}
+	if err := db.idx.renameSeries(oldName, newName); err != nil {
+		return err
+	}
+	for _, r := range derived {
+		if err := db.idx.renameSeries(r[0], r[1]); err != nil {
+			return fmt.Errorf("rename %s: %w", r[0], err)
+		}
+	}
+	db.alerts.renameSeries(oldName, newName)
+	db.subs.forget(oldName, newName)
+	if err := db.rollups.renameState(oldName, newName); err != nil {
+		return err
+	}
+	return db.cqs.renameSeries(oldName, newName)
+}
+
+// CompactCatalog 🧹 重写 catalog.idx，只保留活着的 Series
+// 已删除且数据已被物理清除的 Series 会从字典里彻底消失，对应的墓碑一并回收
+func (db *DB) CompactCatalog() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	forgotten, err := db.idx.compactCatalog(filepath.Join(db.manager.dirPath, catalogFileName))
+	if err != nil {
+		return err
+	}
+	// 字典先落盘、墓碑后回收：中途崩溃最多留下一条找不到主人的墓碑，无害
+	return db.tombs.pruneSeries(forgotten)
+}
+
+// Flush 💾 把所有 Series 的热数据立即落盘
+// 不等数量阈值和强制刷盘间隔，适合短命的工具进程在退出前调用
+func (db *DB) Flush() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	var firstErr error
+	for _, series := range db.idx.getAllSeries() {
+		points, typed := series.drain()
+		if len(points) > 0 {
+			if err := db.flushSeriesData(series, points); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		if len(typed) > 0 {
+			if err := db.flushTypedSeriesData(series, typed); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// CatalogReport 返回开机加载 catalog.idx 时的恢复报告
+func (db *DB) CatalogReport() CatalogReport {
+	return *db.catalogReport
+}
+
 // Close 🔴 5. 关闭数据库
 // 安全退出，防止数据丢失
 func (db *DB) Close() error {
 	// 1. 通知后台协程停手
 	close(db.stopCh)
 	db.wg.Wait()
+	db.subs.close()
 
 	// 2. (可选) 这里可以遍历所有 Series 执行一次强制 ForceFlush，确保内存不丢数据
+	if !db.readOnly {
+		if err := db.saveLastWrites(); err != nil {
+			fmt.Printf("Error saving last writes: %v\n", err)
+		}
+	}
 
 	// 3. 关闭底层文件句柄
+	db.tombs.close()
 	return db.manager.close()
 }
 
@@ -266,12 +466,29 @@ func (db *DB) startWorker() {
 		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 
+		// 定期整理碎片化的旧 Segment
+		compactTicker := time.NewTicker(CompactionInterval)
+		defer compactTicker.Stop()
+
+		// 定期保存每条时间线的最近写入
+		lastWriteTicker := time.NewTicker(lastWriteSaveInterval)
+		defer lastWriteTicker.Stop()
+
 		for {
 			select {
 			case <-db.stopCh:
 				return
 			case <-ticker.C:
+				db.checkStale()
 				db.checkForceFlush()
+			case <-lastWriteTicker.C:
+				if err := db.saveLastWrites(); err != nil {
+					fmt.Printf("Error saving last writes: %v\n", err)
+				}
+			case <-compactTicker.C:
+				if err := db.Compact(); err != nil {
+					fmt.Printf("Error compacting segments: %v\n", err)
+				}
 			}
 		}
 	}()
@@ -288,5 +505,10 @@ func (db *DB) checkForceFlush() {
 				fmt.Printf("Error flushing series %d: %v\n", series.ID, err)
 			}
 		}
+		if points := series.checkTypedForTicker(); len(points) > 0 {
+			if err := db.flushTypedSeriesData(series, points); err != nil {
+				fmt.Printf("Error flushing series %d: %v\n", series.ID, err)
+			}
+		}
 	}
 }
@@ -0,0 +1,553 @@
+package tcore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// 离线体检 (fsck)：直接解析 .vlog / .hint / catalog.idx，不依赖 DB 的内存索引
+//
+// 文件格式见 segment.go 和 hint.go
+//
+// 只能在服务停止时运行：Repair 会改写 .hint、字典并截断 .vlog 的残缺尾巴
+
+// 体检发现的问题类型
+const (
+	IssueCatalog        = "catalog"         // 字典有损坏或半截记录
+	IssueTornTail       = "torn-tail"       // .vlog 末尾有写了一半的 Block
+	IssueUndecodable    = "undecodable"     // Block 无法解码
+	IssueTypeMismatch   = "type-mismatch"   // Block 的类型与字典登记的类型不符
+	IssueOrphan         = "orphan"          // SensorID 在字典里找不到，开机时会被静默跳过
+	IssueHintCorrupted  = "hint-corrupted"  // .hint 末尾有半截记录
+	IssueHintDangling   = "hint-dangling"   // Hint 指向的位置没有 Block
+	IssueHintMismatch   = "hint-mismatch"   // Hint 与 Block 的 SensorID / Size / FileID 对不上
+	IssueHintStats      = "hint-stats"      // Hint 的 MinTime / MaxTime / Count 与 Block 实际内容不符
+	IssueHintDuplicate  = "hint-duplicate"  // 同一个 Block 被登记了多次
+	IssueHintMissing    = "hint-missing"    // Block 没有对应的 Hint，开机后查不到
+	IssueMissingSegment = "missing-segment" // 有 .hint 但没有对应的 .vlog
+)
+
+// orphanNamePrefix 修复时给孤儿数据起的占位名字，之后可以用 RenameSeries 改回真名
+const orphanNamePrefix = "orphan-"
+
+// FsckOptions 体检选项
+type FsckOptions struct {
+	Repair     bool // 重建 .hint 和字典，截掉 .vlog 的残缺尾巴
+	KeepPoints bool // 在 BlockInfo.Points 里保留解码出的数据点 (dump 用)
+}
+
+// FsckIssue 一个具体问题
+type FsckIssue struct {
+	Kind   string
+	File   string // 文件名，不含目录
+	Offset int64  // 问题所在的位置；整个文件的问题为 -1
+	Detail string
+}
+
+func (i FsckIssue) String() string {
+	if i.Offset < 0 {
+		return fmt.Sprintf("%s: %s: %s", i.File, i.Kind, i.Detail)
+	}
+	return fmt.Sprintf("%s@%d: %s: %s", i.File, i.Offset, i.Kind, i.Detail)
+}
+
+// BlockInfo 从 .vlog 扫出来的一个 Block
+type BlockInfo struct {
+	Offset   int64 // 数据起点 (长度前缀之后)，与 BlockMeta.Offset 含义相同
+	Size     uint32
+	SensorID uint32
+	Type     ValueType
+	Count    int
+	MinTime  int64
+	MaxTime  int64
+	Err      error        // 解码失败或类型不符时非空，此时其它字段不可信
+	Points   []TypedPoint // 仅 KeepPoints 时填充
+}
+
+// SegmentInfo 一个 .vlog 文件的扫描结果
+type SegmentInfo struct {
+	ID       uint32
+	Size     int64 // 文件大小
+	Blocks   []BlockInfo
+	TornTail int64  // 末尾残缺记录的字节数
+	Hints    int    // .hint 里完整记录的条数 (不含代数记录)
+	Gen      uint32 // .hint 里记录的代数，普通段为 0
+}
+
+// OrphanInfo 字典里找不到的 SensorID
+type OrphanInfo struct {
+	SensorID uint32
+	Type     ValueType
+	Blocks   int
+	Points   int
+}
+
+// FsckReport 体检报告
+type FsckReport struct {
+	Catalog  *CatalogReport
+	Names    map[uint32]string // 字典里的 SensorID -> 名字 (同一 ID 以最后一条为准)
+	Segments []SegmentInfo     // 按 ID 升序
+	Orphans  []OrphanInfo      // 按 SensorID 升序
+	Issues   []FsckIssue
+	Repairs  []string // Repair 模式下实际执行的修复动作
+}
+
+// Clean 没有发现任何问题
+func (r *FsckReport) Clean() bool {
+	return len(r.Issues) == 0
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Fsck 🩺 离线检查数据目录
+// 扫描每个 .vlog 的 Block，解码并统计 MinTime / MaxTime / Count，与 .hint 逐条核对，
+// 找出字典里不存在的 SensorID。opts.Repair 为 true 时据此重建 .hint 和字典：
+// 孤儿数据以 "orphan-<SensorID>" 的名字登记进字典，重新变得可查
+func Fsck(dirPath string, opts FsckOptions) (*FsckReport, error) {
+	if _, err := os.Stat(dirPath); err != nil {
+		return nil, err
+	}
+	c := &fsckChecker{
+		dir:     dirPath,
+		opts:    opts,
+		report:  &FsckReport{Names: make(map[uint32]string)},
+		types:   make(map[uint32]ValueType),
+		orphans: make(map[uint32]*OrphanInfo),
+	}
+
+	if err := c.checkCatalog(); err != nil {
+		return nil, err
+	}
+	if err := c.checkSegments(); err != nil {
+		return nil, err
+	}
+	c.collectOrphans()
+
+	if opts.Repair {
+		if err := c.repair(); err != nil {
+			return c.report, err
+		}
+	}
+	return c.report, nil
+}
+
+// ==========================================
+// 🔒 检查
+// ==========================================
+
+type fsckChecker struct {
+	dir     string
+	opts    FsckOptions
+	report  *FsckReport
+	records []catalogRecord
+	types   map[uint32]ValueType // 字典登记的类型
+	orphans map[uint32]*OrphanInfo
+
+	catalogDirty bool            // 字典需要重写
+	hintDirty    map[uint32]bool // 需要重建 .hint 的 Segment
+	strayHints   []string        // 没有 .vlog 的 .hint
+}
+
+func (c *fsckChecker) addIssue(kind, file string, offset int64, format string, args ...any) {
+	c.report.Issues = append(c.report.Issues, FsckIssue{Kind: kind, File: file, Offset: offset, Detail: fmt.Sprintf(format, args...)})
+}
+
+// checkCatalog 解析字典，损坏的记录跳过并记下来
+func (c *fsckChecker) checkCatalog() error {
+	data, err := os.ReadFile(filepath.Join(c.dir, catalogFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	records, report, _, err := ReadCatalog(data)
+	if err != nil {
+		return err // 版本不认识：不敢乱修
+	}
+	c.records = records
+	c.report.Catalog = report
+	for _, off := range report.Damaged {
+		c.addIssue(IssueCatalog, catalogFileName, off, "damaged record skipped")
+	}
+	if report.Truncated > 0 {
+		c.addIssue(IssueCatalog, catalogFileName, int64(len(data))-report.Truncated, "%d trailing bytes of a partial record", report.Truncated)
+	}
+	c.catalogDirty = !report.Clean() || report.Migrated
+
+	for _, rec := range records {
+		c.types[rec.ID] = rec.Type
+		c.report.Names[rec.ID] = rec.Name
+	}
+	return nil
+}
+
+// checkSegments 扫描所有 .vlog，再逐个核对对应的 .hint
+func (c *fsckChecker) checkSegments() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	vlogs := make(map[uint32]bool)
+	var hints []uint32
+	for _, e := range entries {
+		if id, ok := segmentIDFromName(e.Name(), SegmentFileNameSuffix); ok {
+			vlogs[id] = true
+		} else if id, ok := segmentIDFromName(e.Name(), hintFileNameSuffix); ok {
+			hints = append(hints, id)
+		}
+	}
+
+	ids := make([]uint32, 0, len(vlogs))
+	for id := range vlogs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	c.hintDirty = make(map[uint32]bool)
+	for _, id := range ids {
+		seg, err := c.scanSegment(id)
+		if err != nil {
+			return err
+		}
+		if err := c.checkHints(seg); err != nil {
+			return err
+		}
+		c.report.Segments = append(c.report.Segments, *seg)
+	}
+
+	for _, id := range hints {
+		if !vlogs[id] {
+			name := filepath.Base(segmentPath(c.dir, id, hintFileNameSuffix))
+			c.addIssue(IssueMissingSegment, name, -1, "no matching %s file", SegmentFileNameSuffix)
+			c.strayHints = append(c.strayHints, name)
+		}
+	}
+	return nil
+}
+
+// scanSegment 按长度前缀逐条切出 Block 并解码
+func (c *fsckChecker) scanSegment(id uint32) (*SegmentInfo, error) {
+	path := segmentPath(c.dir, id, SegmentFileNameSuffix)
+	name := filepath.Base(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seg := &SegmentInfo{ID: id, Size: int64(len(data))}
+
+	pos := 0
+	for {
+		start, end, ok := nextBlock(data, pos)
+		if !ok {
+			break
+		}
+		block := c.decode(data[start:end])
+		block.Offset = int64(start)
+		block.Size = uint32(end - start)
+		if block.Err != nil {
+			kind := IssueUndecodable
+			if errors.Is(block.Err, ErrTypeMismatch) {
+				kind = IssueTypeMismatch
+			}
+			c.addIssue(kind, name, block.Offset, "%v", block.Err)
+		}
+		seg.Blocks = append(seg.Blocks, block)
+		pos = end
+	}
+
+	if seg.TornTail = int64(len(data) - pos); seg.TornTail > 0 {
+		c.addIssue(IssueTornTail, name, int64(pos), "%d trailing bytes of a partial block", seg.TornTail)
+	}
+	return seg, nil
+}
+
+// decode 识别 Block 的编码并解码
+// 两种编码的头部都带 SensorID，用字典登记的类型消歧：先按字典能对上的方式解，再退而求其次
+func (c *fsckChecker) decode(data []byte) BlockInfo {
+	tid, typ, tpoints, terr := decodeTypedBlock(data)
+	if terr == nil && typ != TypeFloat {
+		if known, ok := c.types[tid]; ok && known == typ {
+			return c.blockInfo(tid, typ, tpoints)
+		}
+	}
+	block, ferr := decodeBlock(data)
+	if ferr == nil {
+		known, ok := c.types[block.SensorID]
+		if !ok || known == TypeFloat {
+			points := make([]TypedPoint, len(block.Points))
+			for i, p := range block.Points {
+				points[i] = TypedPoint{Time: p.Time, Value: FloatValue(p.Value)}
+			}
+			return c.blockInfo(block.SensorID, TypeFloat, points)
+		}
+	}
+	if terr == nil {
+		info := c.blockInfo(tid, typ, tpoints)
+		if known, ok := c.types[tid]; ok {
+			info.Err = fmt.Errorf("%w: block is %s, series %d is %s", ErrTypeMismatch, typ, tid, known)
+		}
+		return info
+	}
+	if ferr == nil {
+		return BlockInfo{SensorID: block.SensorID, Err: fmt.Errorf("%w: block is %s, series %d is %s", ErrTypeMismatch, TypeFloat, block.SensorID, c.types[block.SensorID])}
+	}
+	return BlockInfo{Err: fmt.Errorf("neither encoding matches: %v; %v", ferr, terr)}
+}
+
+func (c *fsckChecker) blockInfo(id uint32, typ ValueType, points []TypedPoint) BlockInfo {
+	info := BlockInfo{SensorID: id, Type: typ, Count: len(points)}
+	for i, p := range points {
+		if i == 0 || p.Time < info.MinTime {
+			info.MinTime = p.Time
+		}
+		if i == 0 || p.Time > info.MaxTime {
+			info.MaxTime = p.Time
+		}
+	}
+	if c.opts.KeepPoints {
+		info.Points = points
+	}
+	return info
+}
+
+// checkHints 逐条核对 .hint 和扫出来的 Block
+func (c *fsckChecker) checkHints(seg *SegmentInfo) error {
+	path := segmentPath(c.dir, seg.ID, hintFileNameSuffix)
+	name := filepath.Base(path)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	byOffset := make(map[int64]*BlockInfo, len(seg.Blocks))
+	for i := range seg.Blocks {
+		byOffset[seg.Blocks[i].Offset] = &seg.Blocks[i]
+	}
+	seen := make(map[int64]bool, len(seg.Blocks))
+	dirty := seg.TornTail > 0
+
+	r := bytes.NewReader(data)
+	for pos := int64(0); ; pos += hintRecordSize {
+		sensorID, meta, err := DecodeHint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.addIssue(IssueHintCorrupted, name, pos, "%d trailing bytes of a partial record", int64(len(data))-pos)
+			dirty = true
+			break
+		}
+		if sensorID == genSensorID {
+			if pos != 0 {
+				c.addIssue(IssueHintMismatch, name, pos, "generation record %d is not the first record", meta.FileID)
+				dirty = true
+			} else {
+				seg.Gen = meta.FileID
+			}
+			continue
+		}
+		seg.Hints++
+
+		if _, ok := c.types[sensorID]; !ok {
+			c.orphan(sensorID, TypeFloat) // 只在 Hint 里出现的孤儿也要报出来
+		}
+		block := byOffset[meta.Offset]
+		switch {
+		case block == nil:
+			c.addIssue(IssueHintDangling, name, pos, "sensor %d: no block at offset %d", sensorID, meta.Offset)
+			dirty = true
+			continue
+		case seen[meta.Offset]:
+			c.addIssue(IssueHintDuplicate, name, pos, "sensor %d: block at offset %d listed again", sensorID, meta.Offset)
+			dirty = true
+			continue
+		}
+		seen[meta.Offset] = true
+
+		if block.Err != nil {
+			dirty = true // 已经在扫描 .vlog 时报过
+			continue
+		}
+		if sensorID != block.SensorID || meta.Size != block.Size || meta.FileID != seg.ID {
+			c.addIssue(IssueHintMismatch, name, pos, "hint says sensor %d, file %d, size %d; block has sensor %d, file %d, size %d",
+				sensorID, meta.FileID, meta.Size, block.SensorID, seg.ID, block.Size)
+			dirty = true
+			continue
+		}
+		if meta.MinTime != block.MinTime || meta.MaxTime != block.MaxTime || int(meta.Count) != block.Count {
+			c.addIssue(IssueHintStats, name, pos, "sensor %d: hint says [%d, %d] x%d; block has [%d, %d] x%d",
+				sensorID, meta.MinTime, meta.MaxTime, meta.Count, block.MinTime, block.MaxTime, block.Count)
+			dirty = true
+		}
+	}
+
+	for i := range seg.Blocks {
+		b := &seg.Blocks[i]
+		if b.Err == nil && !seen[b.Offset] {
+			c.addIssue(IssueHintMissing, name, b.Offset, "sensor %d: block of %d points is not listed", b.SensorID, b.Count)
+			dirty = true
+		}
+	}
+	c.hintDirty[seg.ID] = dirty
+	return nil
+}
+
+func (c *fsckChecker) orphan(id uint32, typ ValueType) *OrphanInfo {
+	o := c.orphans[id]
+	if o == nil {
+		o = &OrphanInfo{SensorID: id, Type: typ}
+		c.orphans[id] = o
+	}
+	return o
+}
+
+// collectOrphans 汇总字典里找不到的 SensorID，类型以 Block 实际的编码为准
+func (c *fsckChecker) collectOrphans() {
+	for _, seg := range c.report.Segments {
+		for _, b := range seg.Blocks {
+			if _, ok := c.types[b.SensorID]; ok || b.Err != nil {
+				continue
+			}
+			o := c.orphan(b.SensorID, b.Type)
+			o.Type = b.Type
+			o.Blocks++
+			o.Points += b.Count
+		}
+	}
+	for _, o := range c.orphans {
+		c.report.Orphans = append(c.report.Orphans, *o)
+		c.addIssue(IssueOrphan, catalogFileName, -1, "sensor %d (%s) is not registered: %d blocks, %d points", o.SensorID, o.Type, o.Blocks, o.Points)
+	}
+	sort.Slice(c.report.Orphans, func(i, j int) bool { return c.report.Orphans[i].SensorID < c.report.Orphans[j].SensorID })
+}
+
+// ==========================================
+// 🔧 修复
+// ==========================================
+
+// repair 先修字典 (孤儿有了名字，重建的 Hint 才有意义)，再截断 .vlog、重建 .hint
+func (c *fsckChecker) repair() error {
+	if len(c.report.Orphans) > 0 || c.catalogDirty {
+		if err := c.repairCatalog(); err != nil {
+			return err
+		}
+	}
+	for _, seg := range c.report.Segments {
+		if seg.TornTail > 0 {
+			path := segmentPath(c.dir, seg.ID, SegmentFileNameSuffix)
+			if err := os.Truncate(path, seg.Size-seg.TornTail); err != nil {
+				return err
+			}
+			c.repaired("truncated %d bytes from %s", seg.TornTail, filepath.Base(path))
+		}
+		if c.hintDirty[seg.ID] {
+			if err := c.rebuildHint(seg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range c.strayHints {
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.repaired("removed %s", name)
+	}
+	return syncDir(c.dir)
+}
+
+func (c *fsckChecker) repaired(format string, args ...any) {
+	c.report.Repairs = append(c.report.Repairs, fmt.Sprintf(format, args...))
+}
+
+// repairCatalog 用完好的记录加上孤儿的占位名字原子重写字典
+func (c *fsckChecker) repairCatalog() error {
+	names := make(map[string]bool, len(c.records))
+	for _, rec := range c.records {
+		names[rec.Name] = true
+	}
+	records := c.records
+	for _, o := range c.report.Orphans {
+		if o.Blocks == 0 {
+			continue // 只在 Hint 里出现：数据已经没了，重建 Hint 时一并丢掉
+		}
+		name := orphanNamePrefix + strconv.FormatUint(uint64(o.SensorID), 10)
+		for names[name] {
+			name += "_"
+		}
+		names[name] = true
+		records = append(records, catalogRecord{ID: o.SensorID, Type: o.Type, Name: name})
+		c.types[o.SensorID] = o.Type
+		c.report.Names[o.SensorID] = name
+		c.repaired("registered sensor %d as %q", o.SensorID, name)
+	}
+
+	path := filepath.Join(c.dir, catalogFileName)
+	if c.catalogDirty {
+		// 损坏区域和旧格式的原始字节在重写后就没了，先留一份
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := backupCatalog(path, data); err != nil {
+			return err
+		}
+		c.repaired("saved the original %s as %s", catalogFileName, catalogFileName+catalogBackupSuffix)
+	}
+	fd, err := rewriteCatalog(path, records)
+	if err != nil {
+		return err
+	}
+	c.repaired("rewrote %s with %d records", catalogFileName, len(records))
+	return fd.Close()
+}
+
+// rebuildHint 只用能正常解码的 Block 重新生成 .hint：写临时文件 -> fsync -> rename
+func (c *fsckChecker) rebuildHint(seg SegmentInfo) error {
+	path := segmentPath(c.dir, seg.ID, hintFileNameSuffix)
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	// 代数记录原样保留，否则 Compaction 产物会被当成最新的数据
+	if seg.Gen != 0 {
+		if err := writeGenRecord(tmp, seg.Gen); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+	written := 0
+	for _, b := range seg.Blocks {
+		if _, ok := c.types[b.SensorID]; !ok || b.Err != nil {
+			continue
+		}
+		meta := &BlockMeta{FileID: seg.ID, MinTime: b.MinTime, MaxTime: b.MaxTime, Offset: b.Offset, Size: b.Size, Count: uint16(b.Count)}
+		if err := WriteHintRecord(tmp, b.SensorID, meta); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		written++
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	c.repaired("rebuilt %s with %d records", filepath.Base(path), written)
+	return nil
+}
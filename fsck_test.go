@@ -0,0 +1,134 @@
+package tcore
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendRecord 模拟 Segment.write：[长度][数据]，返回数据的偏移
+func appendRecord(t *testing.T, path string, data []byte) int64 {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	st, _ := f.Stat()
+	hdr := make([]byte, 4)
+	binary.BigEndian.PutUint32(hdr, uint32(len(data)))
+	if _, err := f.Write(append(hdr, data...)); err != nil {
+		t.Fatal(err)
+	}
+	return st.Size() + 4
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFsck(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := db.idx.getOrCreateSeries("boiler")
+	db.flushSeriesData(s, []Point{{Time: 10, Value: 1}, {Time: 20, Value: 2}})
+	if err := db.WriteValue("state", 5, StringValue("RUN")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	boilerID := s.ID
+	db.Close()
+
+	report, err := Fsck(dir, FsckOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Clean() || len(report.Segments) != 1 || len(report.Segments[0].Blocks) != 2 {
+		t.Fatalf("fresh directory: %+v", report)
+	}
+
+	// 制造各种损坏
+	seg := report.Segments[0]
+	vlog := segmentPath(dir, seg.ID, SegmentFileNameSuffix)
+	hint := segmentPath(dir, seg.ID, hintFileNameSuffix)
+
+	// 1. 孤儿：数据和 Hint 都在，字典里没有 99 号
+	orphan, _ := encodeTypedBlock(99, TypeUint, []TypedPoint{{Time: 1, Value: UintValue(7)}, {Time: 2, Value: UintValue(8)}})
+	off := appendRecord(t, vlog, orphan)
+	meta := typedMeta([]TypedPoint{{Time: 1}, {Time: 2}})(seg.ID, off, uint32(len(orphan)))
+	appendBytes(t, hint, EncodeHint(99, meta))
+
+	// 2. Block 写进去了，Hint 没写成功
+	lost, _ := NewBlock(boilerID, []Point{{Time: 30, Value: 3}}).encode()
+	appendRecord(t, vlog, lost)
+
+	// 3. 第一条 Hint 的 Count 被改坏
+	data, _ := os.ReadFile(hint)
+	binary.BigEndian.PutUint16(data[36:38], 9)
+	os.WriteFile(hint, data, 0644)
+
+	// 4. .vlog 和字典末尾都有半截记录
+	appendBytes(t, vlog, []byte{0, 0, 1})
+	appendBytes(t, filepath.Join(dir, catalogFileName), []byte{0, 0, 0, 42, 0})
+
+	report, err = Fsck(dir, FsckOptions{KeepPoints: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]int)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+	}
+	for _, kind := range []string{IssueOrphan, IssueHintMissing, IssueHintStats, IssueTornTail, IssueCatalog} {
+		if kinds[kind] != 1 {
+			t.Errorf("expected one %s issue, got %v", kind, report.Issues)
+		}
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0] != (OrphanInfo{SensorID: 99, Type: TypeUint, Blocks: 1, Points: 2}) {
+		t.Fatalf("orphans: %+v", report.Orphans)
+	}
+	if b := report.Segments[0].Blocks[2]; b.SensorID != 99 || len(b.Points) != 2 || b.Points[1].Value.Uint != 8 {
+		t.Fatalf("orphan block: %+v", b)
+	}
+
+	report, err = Fsck(dir, FsckOptions{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Repairs) == 0 {
+		t.Fatal("nothing was repaired")
+	}
+	if report, err = Fsck(dir, FsckOptions{}); err != nil || !report.Clean() {
+		t.Fatalf("after repair: %v %v", report.Issues, err)
+	}
+
+	// 修复后：丢失 Hint 的 Block 和孤儿数据都能查到了
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	points, _ := db.Query("boiler", 0, 100)
+	if len(points) != 3 {
+		t.Fatalf("boiler: %+v", points)
+	}
+	values, err := db.QueryValues("orphan-99", 0, 100)
+	if err != nil || len(values) != 2 || values[0].Value.Uint != 7 {
+		t.Fatalf("orphan-99: %+v %v", values, err)
+	}
+}
@@ -3,3 +3,21 @@ module github.com/Lwxjjr/tcore
 go 1.23.0
 
 toolchain go1.24.12
+
+require (
+	github.com/eclipse/paho.mqtt.golang v1.4.3
+	github.com/golang/snappy v1.0.0
+	github.com/gopcua/opcua v0.8.0
+	github.com/parquet-go/parquet-go v0.25.1
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/websocket v1.5.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	golang.org/x/net v0.8.0 // indirect
+	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+)
@@ -14,6 +14,12 @@ const (
 
 var ErrHintCorrupted = errors.New("hint file is corrupted or truncated")
 
+// genSensorID 保留的 SensorID (Index 从 1 开始分配)，标记代数记录
+//
+// Compaction 产物的 ID 比活跃段还大，但里面装的是旧数据；产物的 .hint 第一条记录写明它的代数
+// (FileID 字段存代数，其余字段为 0)，重复时间戳按代数判断谁是后写的。普通段没有这条记录，代数就是 ID
+const genSensorID = 0
+
 // ==========================================
 // 1. 核心读写动作封装 (面向 Interface 编程，完美解耦)
 // ==========================================
@@ -25,6 +31,11 @@ func WriteHintRecord(w io.Writer, sensorID uint32, meta *BlockMeta) error {
 	return err
 }
 
+// writeGenRecord 写入代数记录
+func writeGenRecord(w io.Writer, gen uint32) error {
+	return WriteHintRecord(w, genSensorID, &BlockMeta{FileID: gen})
+}
+
 // DecodeHint 供 DB 开机扫盘时调用。每次严格切出 38 字节，绝不多读或少读
 func DecodeHint(r io.Reader) (uint32, *BlockMeta, error) {
 	buf := make([]byte, hintRecordSize)
@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Lwxjjr/tcore/lineproto"
+)
+
+// maxReportedLineErrors 响应里最多列出多少个坏行，避免一个全是坏行的大请求换来更大的响应
+const maxReportedLineErrors = 100
+
+// influxError InfluxDB v2 风格的错误体，Telegraf 等客户端会把 message 打进日志
+type influxError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Lines   []lineReport `json:"lines,omitempty"`
+}
+
+type lineReport struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// handleInfluxWrite POST /api/v2/write?precision=ns|us|ms|s
+// org / bucket 参数被忽略 (tcore 只有一个库)。全部成功返回 204；
+// 有坏行时其余行照常写入，返回 400 并逐行列出错误，与 InfluxDB 的 partial write 行为一致
+func (s *Server) handleInfluxWrite(w http.ResponseWriter, r *http.Request) {
+	precision, err := lineproto.ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		writeInfluxError(w, http.StatusBadRequest, influxError{Code: "invalid", Message: err.Error()})
+		return
+	}
+
+	body, err := s.requestBody(w, r)
+	if err != nil {
+		writeInfluxError(w, statusOf(err), influxError{Code: "invalid", Message: err.Error()})
+		return
+	}
+	defer body.Close()
+
+	res, err := lineproto.Ingest(s.db, body,
+		lineproto.WithPrecision(precision),
+		lineproto.WithStorePrecision(s.opts.StorePrecision),
+	)
+	if err != nil {
+		code := statusOf(err)
+		if code == http.StatusInternalServerError {
+			code = http.StatusBadRequest // 读请求体失败，例如单行过长
+		}
+		writeInfluxError(w, code, influxError{Code: "invalid", Message: err.Error()})
+		return
+	}
+	if len(res.Errors) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := influxError{
+		Code:    "invalid",
+		Message: fmt.Sprintf("partial write: %d of %d lines rejected, first: %v", len(res.Errors), res.Lines, res.Errors[0]),
+	}
+	for i, le := range res.Errors {
+		if i == maxReportedLineErrors {
+			break
+		}
+		resp.Lines = append(resp.Lines, lineReport{Line: le.Line, Error: le.Err.Error()})
+	}
+	writeInfluxError(w, http.StatusBadRequest, resp)
+}
+
+func writeInfluxError(w http.ResponseWriter, code int, body influxError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,258 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// streamFlushEvery 流式输出时每写多少个点冲刷一次，让客户端边收边解析
+const streamFlushEvery = 1024
+
+// queryParams GET /query 的参数
+type queryParams struct {
+	sensor string
+	start  int64
+	end    int64
+	step   int64  // 聚合窗口宽度，0 表示返回原始点
+	agg    string // avg / min / max / sum / count / first / last
+}
+
+// ==========================================
+// 🔍 GET /query
+// ==========================================
+
+// handleQuery 聚合结果的大小由 step 决定，算好再输出；原始点边从 ScanValues 读边写，
+// 内存里同时只有一个 Block，顺序与 ScanValues 一致 (乱序写入造成 Block 重叠时不保证严格有序)
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	typ, err := s.db.SeriesType(q.sensor)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if q.step > 0 {
+		if typ != tcore.TypeFloat && typ != tcore.TypeUint {
+			writeError(w, badRequest(fmt.Errorf("cannot aggregate %s series", typ)))
+			return
+		}
+		points, err := s.aggregate(q)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		ps := newPointStream(w, r, q.sensor, tcore.TypeFloat)
+		defer ps.done()
+		for _, p := range points {
+			ps.write(p)
+		}
+		ps.close()
+		return
+	}
+
+	// 拿到第一个点才发响应头：在那之前出错还能回正常的错误响应
+	var ps *pointStream
+	defer func() {
+		if ps != nil {
+			ps.done()
+		}
+	}()
+	err = s.db.ScanValues(q.sensor, q.start, q.end, func(p tcore.TypedPoint) error {
+		if ps == nil {
+			ps = newPointStream(w, r, q.sensor, typ)
+		}
+		ps.write(p)
+		return nil
+	})
+	switch {
+	case err == nil:
+		if ps == nil {
+			ps = newPointStream(w, r, q.sensor, typ)
+		}
+		ps.close()
+	case ps == nil:
+		writeError(w, err)
+	default:
+		// 响应头已经发出，状态码改不了：掐断连接，别让客户端把半截结果当成完整结果
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// aggregator 配置了 Rollup 的存储 (*tcore.DB) 能直接从汇总层取聚合结果
+type aggregator interface {
+	QueryAggregate(name string, start, end, step int64, agg string) ([]tcore.TypedPoint, error)
+}
+
+// aggregate 优先走 Rollup 汇总层，否则读原始点现算
+func (s *Server) aggregate(q queryParams) ([]tcore.TypedPoint, error) {
+	if a, ok := s.db.(aggregator); ok {
+		return a.QueryAggregate(q.sensor, q.start, q.end, q.step, q.agg)
+	}
+	points, err := s.db.QueryValues(q.sensor, q.start, q.end)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return tcore.Aggregate(points, q.step, q.agg)
+}
+
+func parseQuery(r *http.Request) (queryParams, error) {
+	v := r.URL.Query()
+	q := queryParams{
+		sensor: v.Get("sensor"),
+		start:  math.MinInt64,
+		end:    math.MaxInt64,
+		agg:    v.Get("agg"),
+	}
+	if q.sensor == "" {
+		return q, badRequest(errors.New("missing sensor"))
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"start", &q.start}, {"end", &q.end}, {"step", &q.step}} {
+		raw := v.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return q, badRequest(fmt.Errorf("bad %s %q", p.name, raw))
+		}
+		*p.dst = n
+	}
+
+	if q.start > q.end {
+		return q, tcore.ErrInvalidRange
+	}
+	if q.step < 0 {
+		return q, badRequest(fmt.Errorf("bad step %d", q.step))
+	}
+	if q.agg != "" && q.step == 0 {
+		return q, badRequest(errors.New("agg requires step"))
+	}
+	if q.step > 0 {
+		if q.agg == "" {
+			q.agg = "avg"
+		}
+		if !tcore.IsAggregate(q.agg) {
+			return q, badRequest(fmt.Errorf("unknown agg %q", q.agg))
+		}
+	}
+	return q, nil
+}
+
+// ==========================================
+// 🌊 流式输出
+// ==========================================
+
+// pointStream 边编码边写，每 streamFlushEvery 个点冲刷一次，不在内存里拼出完整的响应体
+//
+// JSON：{"sensor":"...","type":"float","points":[{"time":1,"value":2},...]}
+// CSV：表头 time,value，之后每行一个点
+type pointStream struct {
+	w    http.ResponseWriter
+	bw   *bufio.Writer
+	cw   *csv.Writer // 为 nil 时输出 JSON
+	n    int
+	done func() // 关闭 gzip 压缩
+}
+
+// newPointStream 协商压缩并写出 JSON 开头或 CSV 表头，之后响应头就改不了了
+func newPointStream(w http.ResponseWriter, r *http.Request, sensor string, typ tcore.ValueType) *pointStream {
+	out, done := negotiate(w, r)
+	ps := &pointStream{w: out, bw: bufio.NewWriter(out), done: done}
+	if wantsCSV(r) {
+		out.Header().Set("Content-Type", "text/csv")
+		ps.cw = csv.NewWriter(ps.bw)
+		ps.cw.Write([]string{"time", "value"})
+		return ps
+	}
+	out.Header().Set("Content-Type", "application/json")
+	name, _ := json.Marshal(sensor)
+	fmt.Fprintf(ps.bw, `{"sensor":%s,"type":%q,"points":[`, name, typ.String())
+	return ps
+}
+
+func (ps *pointStream) write(p tcore.TypedPoint) {
+	if ps.cw != nil {
+		ps.cw.Write([]string{strconv.FormatInt(p.Time, 10), csvValue(p.Value)})
+	} else {
+		if ps.n > 0 {
+			ps.bw.WriteByte(',')
+		}
+		ps.bw.WriteString(`{"time":`)
+		ps.bw.WriteString(strconv.FormatInt(p.Time, 10))
+		ps.bw.WriteString(`,"value":`)
+		ps.bw.Write(jsonValue(p.Value))
+		ps.bw.WriteByte('}')
+	}
+	ps.n++
+	if ps.n%streamFlushEvery == 0 {
+		ps.flush()
+	}
+}
+
+// close 写出结尾并冲刷；done 仍需调用
+func (ps *pointStream) close() {
+	if ps.cw == nil {
+		ps.bw.WriteString("]}\n")
+	}
+	ps.flush()
+}
+
+func (ps *pointStream) flush() {
+	if ps.cw != nil {
+		ps.cw.Flush()
+	}
+	flush(ps.w, ps.bw)
+}
+
+func flush(w http.ResponseWriter, bw *bufio.Writer) {
+	bw.Flush()
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// jsonValue 按类型输出 JSON 值；NaN 和 ±Inf 在 JSON 里不合法，输出 null
+func jsonValue(v tcore.Value) []byte {
+	switch v.Type {
+	case tcore.TypeFloat:
+		if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+			return []byte("null")
+		}
+		return strconv.AppendFloat(nil, v.Float, 'g', -1, 64)
+	case tcore.TypeUint:
+		return strconv.AppendUint(nil, v.Uint, 10)
+	case tcore.TypeBool:
+		return strconv.AppendBool(nil, v.Bool)
+	case tcore.TypeString:
+		b, _ := json.Marshal(v.Str)
+		return b
+	default:
+		b, _ := json.Marshal(v.Bytes) // base64，与写入时的格式对称
+		return b
+	}
+}
+
+func csvValue(v tcore.Value) string {
+	if v.Type == tcore.TypeFloat {
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	}
+	return v.String()
+}
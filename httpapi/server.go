@@ -0,0 +1,568 @@
+// Package httpapi 把 tcore.DB 包装成 HTTP/JSON 接口，供看板和脚本使用
+//
+//	POST /write                                   写入 (JSON 或 CSV，可 gzip 压缩)
+//	GET  /query?sensor=&start=&end=&step=&agg=    查询 (JSON 或 CSV，流式输出)
+//	GET  /series                                  列出所有时间线
+//	GET  /silent?threshold=                       列出沉默的时间线
+//	GET  /last?selector=                          选择器匹配的时间线各自的最新读数
+//	GET  /subscribe?selector=&buffer=&policy=     实时订阅新写入的点 (Server-Sent Events)
+//	GET  /health                                  健康检查
+//	POST /api/v2/write?precision=                 InfluxDB 行协议写入 (兼容 Telegraf)
+//	POST /api/v1/write, POST /api/v1/read         Prometheus remote_write / remote_read
+//
+// 引擎错误映射为对应的 HTTP 状态码，错误体统一为 {"error": "..."}。
+package httpapi
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/lineproto"
+	"github.com/Lwxjjr/tcore/prom"
+)
+
+// DefaultMaxBodyBytes 写入请求体 (解压后) 的默认上限
+const DefaultMaxBodyBytes = 32 * 1024 * 1024
+
+var (
+	errUnsupportedMedia = errors.New("unsupported content type")
+	errBodyTooLarge     = errors.New("request body too large")
+)
+
+// Store 是 HTTP 层依赖的存储能力，*tcore.DB 天然满足
+type Store interface {
+	Write(sensorID string, timestamp int64, value float64) error
+	WriteValue(sensorID string, timestamp int64, v tcore.Value) error
+	Query(sensorID string, start, end int64) ([]tcore.Point, error)
+	QueryValues(sensorID string, start, end int64) ([]tcore.TypedPoint, error)
+	ScanValues(name string, start, end int64, fn func(tcore.TypedPoint) error) error
+	SeriesType(name string) (tcore.ValueType, error)
+	Keys() []string
+}
+
+// Options HTTP 服务配置
+type Options struct {
+	MaxBodyBytes   int64               // 写入请求体的最大字节数
+	StorePrecision lineproto.Precision // DB 里时间戳的单位，行协议写入时按此换算
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithMaxBodyBytes 设置写入请求体的最大字节数
+func WithMaxBodyBytes(n int64) Option {
+	return func(opts *Options) {
+		opts.MaxBodyBytes = n
+	}
+}
+
+// WithStorePrecision 设置 DB 里时间戳的单位
+func WithStorePrecision(p lineproto.Precision) Option {
+	return func(opts *Options) {
+		opts.StorePrecision = p
+	}
+}
+
+// Server HTTP 服务端
+type Server struct {
+	db   Store
+	opts Options
+	mux  *http.ServeMux
+	srv  *http.Server
+
+	stop     chan struct{} // Shutdown 时关闭：通知订阅流结束，否则 Shutdown 会一直等它们
+	stopOnce sync.Once
+}
+
+// NewServer 创建 HTTP 服务端
+func NewServer(db Store, options ...Option) *Server {
+	opts := Options{MaxBodyBytes: DefaultMaxBodyBytes, StorePrecision: lineproto.Nanosecond}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	s := &Server{db: db, opts: opts, mux: http.NewServeMux(), stop: make(chan struct{})}
+	s.mux.HandleFunc("POST /write", s.handleWrite)
+	s.mux.HandleFunc("GET /query", s.handleQuery)
+	s.mux.HandleFunc("GET /series", s.handleSeries)
+	s.mux.HandleFunc("GET /silent", s.handleSilent)
+	s.mux.HandleFunc("GET /last", s.handleLast)
+	s.mux.HandleFunc("GET /subscribe", s.handleSubscribe)
+	s.mux.HandleFunc("GET /health", s.handleHealth)
+	s.mux.HandleFunc("POST /api/v2/write", s.handleInfluxWrite)
+
+	remote := prom.NewHandler(db, time.Duration(opts.StorePrecision))
+	s.mux.HandleFunc("POST /api/v1/write", remote.ServeWrite)
+	s.mux.HandleFunc("POST /api/v1/read", remote.ServeRead)
+	s.srv = &http.Server{Handler: s.mux}
+	s.srv.RegisterOnShutdown(func() { s.stopOnce.Do(func() { close(s.stop) }) })
+	return s
+}
+
+// Handler 返回路由，方便挂到已有的 http.Server 或 httptest 上
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// ListenAndServe 监听地址并开始服务，直到 Shutdown 被调用
+func (s *Server) ListenAndServe(addr string) error {
+	s.srv.Addr = addr
+	return s.srv.ListenAndServe()
+}
+
+// Serve 在给定的 Listener 上服务
+func (s *Server) Serve(l net.Listener) error {
+	return s.srv.Serve(l)
+}
+
+// Shutdown 优雅关闭：等正在处理的请求 (包括流式查询) 结束，订阅流会被立即结束
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// ==========================================
+// ✍️ POST /write
+// ==========================================
+
+// writeRequest JSON 写入格式；请求体可以是单个对象，也可以是对象数组
+// value 按 JSON 类型推断：数字 -> float，true/false -> bool，字符串 -> string；
+// 需要 uint / bytes (base64) 时用 type 字段显式指定
+type writeRequest struct {
+	Sensor string          `json:"sensor"`
+	Time   int64           `json:"time"`
+	Value  json.RawMessage `json:"value"`
+	Type   string          `json:"type,omitempty"`
+}
+
+func (s *Server) handleWrite(w http.ResponseWriter, r *http.Request) {
+	body, err := s.requestBody(w, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer body.Close()
+
+	var written int
+	switch mediaType(r.Header.Get("Content-Type")) {
+	case "", "application/json":
+		written, err = s.writeJSON(body)
+	case "text/csv":
+		written, err = s.writeCSV(body)
+	default:
+		err = fmt.Errorf("%w: %s", errUnsupportedMedia, r.Header.Get("Content-Type"))
+	}
+
+	if err != nil {
+		// 出错之前已经写入的点不会回滚，告诉调用方写到了哪里
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusOf(err))
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "written": written})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestBody 按 Content-Encoding 解压，并限制解压后的大小
+func (s *Server) requestBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	body := http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes)
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		// 限制解压后的大小，防止压缩炸弹
+		return struct {
+			io.Reader
+			io.Closer
+		}{&maxReader{r: zr, n: s.opts.MaxBodyBytes + 1}, body}, nil
+	}
+	return nil, fmt.Errorf("%w: Content-Encoding %s", errUnsupportedMedia, r.Header.Get("Content-Encoding"))
+}
+
+func (s *Server) writeJSON(body io.Reader) (int, error) {
+	br := bufio.NewReader(body)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return 0, badRequest(err)
+	}
+
+	var reqs []writeRequest
+	if first == '[' {
+		err = decodeStrict(br, &reqs)
+	} else {
+		var one writeRequest
+		err = decodeStrict(br, &one)
+		reqs = []writeRequest{one}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for i, req := range reqs {
+		if req.Sensor == "" {
+			return i, badRequest(errors.New("missing sensor"))
+		}
+		v, err := parseValue(req.Value, req.Type)
+		if err != nil {
+			return i, badRequest(err)
+		}
+		if err := s.db.WriteValue(req.Sensor, req.Time, v); err != nil {
+			return i, err
+		}
+	}
+	return len(reqs), nil
+}
+
+// writeCSV 每行 sensor,time,value；第一行是表头 (以 sensor 开头) 时跳过
+func (s *Server) writeCSV(body io.Reader) (int, error) {
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = 3
+	cr.ReuseRecord = true
+
+	written := 0
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, badRequest(err)
+		}
+		if line == 1 && rec[0] == "sensor" {
+			continue
+		}
+		ts, err := strconv.ParseInt(rec[1], 10, 64)
+		if err != nil {
+			return written, badRequest(fmt.Errorf("line %d: bad time %q", line, rec[1]))
+		}
+		val, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return written, badRequest(fmt.Errorf("line %d: bad value %q", line, rec[2]))
+		}
+		if err := s.db.Write(rec[0], ts, val); err != nil {
+			return written, err
+		}
+		written++
+	}
+}
+
+// ==========================================
+// 📋 GET /series, GET /health
+// ==========================================
+
+type seriesInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (s *Server) handleSeries(w http.ResponseWriter, r *http.Request) {
+	keys := s.db.Keys()
+	sort.Strings(keys)
+
+	infos := make([]seriesInfo, 0, len(keys))
+	for _, k := range keys {
+		typ, err := s.db.SeriesType(k)
+		if err != nil {
+			continue // 列举期间被删掉了
+		}
+		infos = append(infos, seriesInfo{Name: k, Type: typ.String()})
+	}
+
+	out, done := negotiate(w, r)
+	defer done()
+	if wantsCSV(r) {
+		out.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(out)
+		cw.Write([]string{"name", "type"})
+		for _, info := range infos {
+			cw.Write([]string{info.Name, info.Type})
+		}
+		cw.Flush()
+		return
+	}
+	out.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(out).Encode(map[string]any{"series": infos})
+}
+
+// silentLister 能列出沉默时间线的存储 (*tcore.DB)
+type silentLister interface {
+	SilentSeries(threshold time.Duration) []tcore.LastWrite
+}
+
+// silentInfo GET /silent 的一项
+type silentInfo struct {
+	Name          string  `json:"name"`
+	LastArrival   string  `json:"last_arrival,omitempty"` // RFC 3339，从没记录到写入时省略
+	SilentSeconds float64 `json:"silent_seconds,omitempty"`
+	Time          int64   `json:"time"`
+	Value         string  `json:"value"`
+	Stale         bool    `json:"stale,omitempty"`
+}
+
+// handleSilent GET /silent?threshold=5m 列出超过 threshold 没有收到写入的时间线，沉默最久的在前
+// 不给 threshold 时列出全部时间线的最近写入
+func (s *Server) handleSilent(w http.ResponseWriter, r *http.Request) {
+	lister, ok := s.db.(silentLister)
+	if !ok {
+		http.Error(w, "silent series are not supported by this store", http.StatusNotImplemented)
+		return
+	}
+	var threshold time.Duration
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, badRequest(fmt.Errorf("bad threshold %q", v)))
+			return
+		}
+		threshold = d
+	}
+
+	now := time.Now()
+	list := lister.SilentSeries(threshold)
+	infos := make([]silentInfo, len(list))
+	for i, lw := range list {
+		infos[i] = silentInfo{Name: lw.Name, Time: lw.Time, Value: lw.Value.String(), Stale: lw.Stale}
+		if !lw.Arrived.IsZero() {
+			infos[i].LastArrival = lw.Arrived.UTC().Format(time.RFC3339Nano)
+			infos[i].SilentSeconds = now.Sub(lw.Arrived).Seconds()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"series": infos})
+}
+
+// lastPointer 能直接给出最新读数的存储 (*tcore.DB)
+type lastPointer interface {
+	LastPoints(selector string) (map[string]tcore.TypedPoint, error)
+}
+
+// lastInfo GET /last 的一项
+type lastInfo struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Time  int64  `json:"time"`
+	Value string `json:"value"`
+}
+
+// handleLast GET /last?selector=temperature{site="plant-3"} 选择器匹配的时间线各自的最新一个点，按名字排序
+// 不给 selector 时返回全部时间线
+func (s *Server) handleLast(w http.ResponseWriter, r *http.Request) {
+	lp, ok := s.db.(lastPointer)
+	if !ok {
+		http.Error(w, "last points are not supported by this store", http.StatusNotImplemented)
+		return
+	}
+	selector := r.URL.Query().Get("selector")
+	if selector == "" {
+		selector = "*"
+	}
+	points, err := lp.LastPoints(selector)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	infos := make([]lastInfo, 0, len(points))
+	for name, p := range points {
+		infos = append(infos, lastInfo{Name: name, Type: p.Value.Type.String(), Time: p.Time, Value: p.Value.String()})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"series": infos})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ==========================================
+// ⚠️ 错误处理
+// ==========================================
+
+// requestError 请求本身有问题 (参数缺失、格式错误)
+type requestError struct{ err error }
+
+func (e *requestError) Error() string { return e.err.Error() }
+func (e *requestError) Unwrap() error { return e.err }
+
+func badRequest(err error) error {
+	return &requestError{err: err}
+}
+
+// statusOf 把引擎错误映射为 HTTP 状态码
+func statusOf(err error) int {
+	var re *requestError
+	var mbe *http.MaxBytesError
+	switch {
+	case errors.As(err, &mbe), errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &re), errors.Is(err, tcore.ErrInvalidRange), errors.Is(err, tcore.ErrUnknownType),
+		errors.Is(err, tcore.ErrBadSelector):
+		return http.StatusBadRequest
+	case errors.Is(err, errUnsupportedMedia):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, tcore.ErrSeriesNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, tcore.ErrTypeMismatch), errors.Is(err, tcore.ErrSeriesExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusOf(err))
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// ==========================================
+// 🔧 小工具
+// ==========================================
+
+// decodeStrict 解码 JSON，不认识的字段视为请求错误
+// 请求体超限的错误被包在里面，statusOf 仍然能识别成 413
+func decodeStrict(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return badRequest(err)
+	}
+	return nil
+}
+
+// maxReader 限制解压后的字节数，超过 n 时返回 errBodyTooLarge
+type maxReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxReader) Read(p []byte) (int, error) {
+	if m.n <= 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > m.n {
+		p = p[:m.n]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	return n, err
+}
+
+// parseValue 把 JSON 值按 typ (为空时按 JSON 类型推断) 转换成 tcore.Value
+func parseValue(raw json.RawMessage, typ string) (tcore.Value, error) {
+	if len(raw) == 0 {
+		return tcore.Value{}, errors.New("missing value")
+	}
+	if typ == "" {
+		switch raw[0] {
+		case 't', 'f':
+			typ = "bool"
+		case '"':
+			typ = "string"
+		default:
+			typ = "float"
+		}
+	}
+
+	vt, err := tcore.ParseValueType(typ)
+	if err != nil {
+		return tcore.Value{}, err
+	}
+	switch vt {
+	case tcore.TypeFloat:
+		var f float64
+		err = json.Unmarshal(raw, &f)
+		return tcore.FloatValue(f), err
+	case tcore.TypeUint:
+		var u uint64
+		err = json.Unmarshal(raw, &u)
+		return tcore.UintValue(u), err
+	case tcore.TypeBool:
+		var b bool
+		err = json.Unmarshal(raw, &b)
+		return tcore.BoolValue(b), err
+	case tcore.TypeString:
+		var str string
+		err = json.Unmarshal(raw, &str)
+		return tcore.StringValue(str), err
+	default:
+		var b []byte // encoding/json 把 []byte 当作 base64 字符串
+		err = json.Unmarshal(raw, &b)
+		return tcore.BytesValue(b), err
+	}
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// mediaType 去掉 Content-Type 里的参数部分，例如 "; charset=utf-8"
+func mediaType(ct string) string {
+	if i := strings.IndexByte(ct, ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// wantsCSV format=csv 或 Accept 里要求 text/csv
+func wantsCSV(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "csv"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// gzipResponseWriter 透明压缩响应体，Flush 时先冲刷 gzip 再冲刷连接，保证流式输出不被攒住
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	zw *gzip.Writer
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	return g.zw.Write(p)
+}
+
+func (g *gzipResponseWriter) Flush() {
+	g.zw.Flush()
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// negotiate 客户端接受 gzip 时返回压缩的 ResponseWriter；done 必须在写完后调用
+func negotiate(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		return w, func() {}
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	zw := gzip.NewWriter(w)
+	return &gzipResponseWriter{ResponseWriter: w, zw: zw}, func() { zw.Close() }
+}
@@ -0,0 +1,371 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/lineproto"
+)
+
+func newTestServer(t *testing.T, options ...Option) (*httptest.Server, *tcore.DB) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ts := httptest.NewServer(NewServer(db, options...).Handler())
+	t.Cleanup(ts.Close)
+	return ts, db
+}
+
+func post(t *testing.T, url, contentType string, body io.Reader) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestHTTP_WriteAndQuery(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	resp := post(t, ts.URL+"/write", "application/json", strings.NewReader(
+		`[{"sensor":"boiler","time":1,"value":10},{"sensor":"boiler","time":2,"value":20},
+		  {"sensor":"boiler","time":11,"value":30},{"sensor":"door","time":1,"value":true}]`))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("write: expected 204, got %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Type   string
+		Points []struct {
+			Time  int64
+			Value any
+		}
+	}
+	get := func(path string) int {
+		r, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		json.NewDecoder(r.Body).Decode(&result)
+		return r.StatusCode
+	}
+
+	if code := get("/query?sensor=boiler&start=0&end=100"); code != 200 || len(result.Points) != 3 {
+		t.Fatalf("raw query: code=%d points=%v", code, result.Points)
+	}
+	if code := get("/query?sensor=boiler&step=10&agg=sum"); code != 200 || len(result.Points) != 2 || result.Points[0].Value != 30.0 {
+		t.Fatalf("agg query: code=%d points=%v", code, result.Points)
+	}
+	if code := get("/query?sensor=door"); code != 200 || result.Type != "bool" || result.Points[0].Value != true {
+		t.Fatalf("typed query: code=%d result=%+v", code, result)
+	}
+
+	// 引擎错误映射为状态码
+	for path, want := range map[string]int{
+		"/query?sensor=missing":              http.StatusNotFound,
+		"/query?sensor=boiler&start=5&end=1": http.StatusBadRequest,
+		"/query?sensor=boiler&agg=avg":       http.StatusBadRequest,
+		"/query?sensor=door&step=10":         http.StatusBadRequest,
+	} {
+		if code := get(path); code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, code)
+		}
+	}
+	if resp := post(t, ts.URL+"/write", "application/json", strings.NewReader(`{"sensor":"door","time":2,"value":1}`)); resp.StatusCode != http.StatusConflict {
+		t.Errorf("type mismatch: expected 409, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_CSVAndGzip(t *testing.T) {
+	ts, db := newTestServer(t)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("sensor,time,value\npump,1,1.5\npump,2,2.5\n"))
+	zw.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/write", &gz)
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if points, _ := db.Query("pump", 0, 10); len(points) != 2 {
+		t.Fatalf("expected 2 points, got %v", points)
+	}
+
+	// 显式要 gzip 时 Transport 不会自动解压，可以验证响应确实被压缩了
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/query?sensor=pump&format=csv", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got headers %v", resp.Header)
+	}
+	zr, _ := gzip.NewReader(resp.Body)
+	body, _ := io.ReadAll(zr)
+	if string(body) != "time,value\n1,1.5\n2,2.5\n" {
+		t.Fatalf("unexpected csv body %q", body)
+	}
+}
+
+func TestHTTP_BodyLimitsAndSeries(t *testing.T) {
+	ts, _ := newTestServer(t, WithMaxBodyBytes(64))
+
+	big := `[` + strings.Repeat(`{"sensor":"s","time":1,"value":1},`, 10) + `{"sensor":"s","time":1,"value":1}]`
+	if resp := post(t, ts.URL+"/write", "application/json", strings.NewReader(big)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d", resp.StatusCode)
+	}
+	if resp := post(t, ts.URL+"/write", "application/xml", strings.NewReader("<x/>")); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415, got %d", resp.StatusCode)
+	}
+	post(t, ts.URL+"/write", "", strings.NewReader(`{"sensor":"s","time":1,"value":1}`))
+
+	resp, err := http.Get(ts.URL + "/series")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out struct{ Series []seriesInfo }
+	json.NewDecoder(resp.Body).Decode(&out)
+	if len(out.Series) != 1 || out.Series[0] != (seriesInfo{Name: "s", Type: "float"}) {
+		t.Fatalf("unexpected series list %+v", out)
+	}
+
+	// 刚写入的时间线不算沉默；threshold=0 列出全部
+	var silent struct{ Series []silentInfo }
+	for _, c := range []struct {
+		threshold string
+		want      int
+	}{{"1h", 0}, {"0s", 1}} {
+		resp, err := http.Get(ts.URL + "/silent?threshold=" + c.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewDecoder(resp.Body).Decode(&silent)
+		resp.Body.Close()
+		if len(silent.Series) != c.want {
+			t.Fatalf("silent %s: %+v", c.threshold, silent)
+		}
+	}
+	if s := silent.Series[0]; s.Name != "s" || s.Value != "1" || s.LastArrival == "" {
+		t.Fatalf("silent entry: %+v", s)
+	}
+	if resp, _ := http.Get(ts.URL + "/silent?threshold=soon"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad threshold: expected 400, got %d", resp.StatusCode)
+	}
+
+	// 最新读数：不给 selector 时返回全部时间线
+	var last struct{ Series []lastInfo }
+	resp, err = http.Get(ts.URL + "/last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(resp.Body).Decode(&last)
+	resp.Body.Close()
+	if len(last.Series) != 1 || last.Series[0] != (lastInfo{Name: "s", Type: "float", Time: 1, Value: "1"}) {
+		t.Fatalf("last: %+v", last)
+	}
+	if resp, _ := http.Get(ts.URL + "/last?selector=" + url.QueryEscape(`s{a="`)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad selector: expected 400, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := http.Get(ts.URL + "/health"); resp.StatusCode != http.StatusOK {
+		t.Errorf("health: expected 200, got %d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(ts.URL + "/write"); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /write: expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_InfluxWrite(t *testing.T) {
+	ts, db := newTestServer(t, WithStorePrecision(lineproto.Millisecond))
+
+	resp := post(t, ts.URL+"/api/v2/write?org=o&bucket=b&precision=s", "text/plain",
+		strings.NewReader("mem,host=a used=10i,free=5 1700000000\nmem,host=a used=11i 1700000001\n"))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if points, _ := db.Query("mem.used{host=a}", 0, 1<<62); len(points) != 2 || points[1].Time != 1700000001000 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+
+	resp = post(t, ts.URL+"/api/v2/write", "text/plain", strings.NewReader("mem,host=a used=1i\nbroken\n"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for partial write, got %d", resp.StatusCode)
+	}
+	var body influxError
+	json.NewDecoder(resp.Body).Decode(&body)
+	if len(body.Lines) != 1 || body.Lines[0].Line != 2 {
+		t.Fatalf("expected line 2 to be reported, got %+v", body)
+	}
+
+	if resp := post(t, ts.URL+"/api/v2/write?precision=h", "text/plain", strings.NewReader("m v=1")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad precision: expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestHTTP_Subscribe(t *testing.T) {
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 用真实的 Serve，才能验证 Shutdown 会结束订阅流
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(db)
+	go srv.Serve(l)
+	base := "http://" + l.Addr().String()
+
+	if resp, _ := http.Get(base + "/subscribe?policy=later"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad policy: expected 400, got %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(base + "/subscribe?selector=" + url.QueryEscape(`temp{room="a"}`) + "&buffer=16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("subscribe: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": subscribed" {
+		t.Fatalf("first line: %q", lines.Text())
+	}
+
+	db.Write(`temp{room="b"}`, 1, 19)
+	db.Write(`temp{room="a"}`, 2, 21.5)
+	db.Write(`temp{room="a"}`, 3, math.NaN())
+	var events []string
+	for len(events) < 2 && lines.Scan() {
+		if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	want := []string{
+		`{"series":"temp{room=\"a\"}","type":"float","time":2,"value":21.5}`,
+		`{"series":"temp{room=\"a\"}","type":"float","time":3,"value":null}`,
+	}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("events:\n%s", strings.Join(events, "\n"))
+	}
+
+	// Shutdown 不会被一直挂着的订阅流卡住
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	for lines.Scan() {
+	}
+}
+
+// scanFailStore 在 ScanValues 交出 failAfter 个点之后报错
+type scanFailStore struct {
+	*tcore.DB
+	failAfter int
+}
+
+func (s scanFailStore) ScanValues(name string, start, end int64, fn func(tcore.TypedPoint) error) error {
+	n := 0
+	return s.DB.ScanValues(name, start, end, func(p tcore.TypedPoint) error {
+		if n == s.failAfter {
+			return errors.New("disk on fire")
+		}
+		n++
+		return fn(p)
+	})
+}
+
+func TestHTTP_QueryStreamsRawPoints(t *testing.T) {
+	ts, db := newTestServer(t)
+	const total = 3*streamFlushEvery + 7
+	for i := 0; i < total; i++ {
+		db.Write("boiler", int64(i), float64(i))
+	}
+
+	resp, err := http.Get(ts.URL + "/query?sensor=boiler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Points []struct {
+			Time  int64
+			Value float64
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err != nil || len(result.Points) != total {
+		t.Fatalf("expected %d points, got %d (err=%v)", total, len(result.Points), err)
+	}
+	for i, p := range result.Points {
+		if p.Time != int64(i) || p.Value != float64(i) {
+			t.Fatalf("point %d: %+v", i, p)
+		}
+	}
+
+	// 还没输出就失败：正常的错误响应
+	broken := httptest.NewServer(NewServer(scanFailStore{DB: db}).Handler())
+	defer broken.Close()
+	resp, err = http.Get(broken.URL + "/query?sensor=boiler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", resp.StatusCode)
+	}
+
+	// 输出到一半失败：连接被掐断，客户端读不到完整的响应
+	broken = httptest.NewServer(NewServer(scanFailStore{DB: db, failAfter: 2 * streamFlushEvery}).Handler())
+	defer broken.Close()
+	resp, err = http.Get(broken.URL + "/query?sensor=boiler&format=csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected streaming to have started, got %d", resp.StatusCode)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("expected truncated response to fail")
+	}
+}
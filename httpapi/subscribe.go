@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// sseHeartbeat 没有数据时多久发一行注释，让代理和客户端知道连接还活着
+const sseHeartbeat = 15 * time.Second
+
+// subscriber 能实时订阅新写入数据的存储 (*tcore.DB)
+type subscriber interface {
+	Subscribe(selector string, options ...tcore.SubscribeOption) (*tcore.Subscription, error)
+}
+
+// ==========================================
+// 📡 GET /subscribe
+// ==========================================
+
+// handleSubscribe 以 Server-Sent Events 推送选择器匹配的时间线上新写入的点，每个点一个事件：
+//
+//	data: {"series":"cpu{host=a}","type":"float","time":1700000000,"value":0.5}
+//
+// buffer 是服务端为这个连接积压的点数；policy=drop (默认) 时积压满了丢点，
+// policy=disconnect 时发送一个 error 事件后断开。不给 selector 时订阅全部时间线
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	sb, ok := s.db.(subscriber)
+	if !ok {
+		http.Error(w, "subscriptions are not supported by this store", http.StatusNotImplemented)
+		return
+	}
+	if _, ok := w.(http.Flusher); !ok {
+		http.Error(w, "streaming is not supported by this connection", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	selector := q.Get("selector")
+	if selector == "" {
+		selector = "*"
+	}
+	var opts []tcore.SubscribeOption
+	if v := q.Get("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, badRequest(fmt.Errorf("bad buffer %q", v)))
+			return
+		}
+		opts = append(opts, tcore.WithSubscribeBuffer(n))
+	}
+	switch v := q.Get("policy"); v {
+	case "", "drop":
+	case "disconnect":
+		opts = append(opts, tcore.WithSlowConsumerPolicy(tcore.SlowConsumerDisconnect))
+	default:
+		writeError(w, badRequest(fmt.Errorf("bad policy %q", v)))
+		return
+	}
+
+	sub, err := sb.Subscribe(selector, opts...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	bw := bufio.NewWriter(w)
+	bw.WriteString(": subscribed\n\n")
+	flush(w, bw)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case p, ok := <-sub.C:
+			if !ok {
+				// 被 DB 结束 (慢消费者、DB 关闭)：告诉客户端原因
+				msg, _ := json.Marshal(map[string]string{"error": sub.Err().Error()})
+				fmt.Fprintf(bw, "event: error\ndata: %s\n\n", msg)
+				flush(w, bw)
+				return
+			}
+			writeEvent(bw, p)
+			// 积压的点一并写完再冲刷，突发写入时不必每个点一次系统调用
+			if len(sub.C) == 0 {
+				flush(w, bw)
+			}
+		case <-heartbeat.C:
+			bw.WriteString(": ping\n\n")
+			flush(w, bw)
+		case <-r.Context().Done():
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// writeEvent 一个点写成一个 SSE 事件
+func writeEvent(bw *bufio.Writer, p tcore.LivePoint) {
+	name, _ := json.Marshal(p.Series)
+	bw.WriteString(`data: {"series":`)
+	bw.Write(name)
+	fmt.Fprintf(bw, `,"type":%q,"time":%d,"value":`, p.Value.Type.String(), p.Time)
+	bw.Write(jsonValue(p.Value))
+	bw.WriteString("}\n\n")
+}
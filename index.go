@@ -1,11 +1,14 @@
 package tcore
 
 import (
-	"encoding/binary"
+	"errors"
 	"os"
+	"sort"
 	"sync"
 )
 
+var ErrSeriesExists = errors.New("series already exists")
+
 type Index struct {
 	mu sync.RWMutex
 	// 核心映射表：SensorName (string) -> Series对象 (指针)
@@ -14,6 +17,15 @@ type Index struct {
 	nextID    uint32
 	// ➕ 新增：字典日志文件句柄
 	catalogFd *os.File
+	// 墓地：已删除、但磁盘上的 Block 还没被 Compaction 清除的 Series
+	// 在数据物理消失之前，字典里要一直保留它的记录，重启后才能找到这些残留数据
+	graveyard map[uint32]deadSeries
+}
+
+// deadSeries 墓地里的一条记录
+type deadSeries struct {
+	name   string
+	series *Series
 }
 
 func NewIndex() *Index {
@@ -21,12 +33,19 @@ func NewIndex() *Index {
 		seriesMap: make(map[string]*Series),
 		idToName:  make(map[uint32]string),
 		nextID:    1,
+		graveyard: make(map[uint32]deadSeries),
 	}
 }
 
 // GetOrCreateSeries 是对外暴露的核心方法
-// 逻辑：有就直接返回，没有就创建新的
+// 逻辑：有就直接返回，没有就创建新的 (新建的是 float64 时间线)
 func (idx *Index) getOrCreateSeries(name string) *Series {
+	return idx.getOrCreateTypedSeries(name, TypeFloat)
+}
+
+// getOrCreateTypedSeries 同上，新建时使用指定的数值类型
+// 已存在的 Series 原样返回，类型是否匹配由调用方检查
+func (idx *Index) getOrCreateTypedSeries(name string, typ ValueType) *Series {
 	// 1. 【快速路径】：先用读锁查一下有没有
 	// 99.9% 的请求都会走这里，性能极高
 	idx.mu.RLock()
@@ -49,33 +68,165 @@ func (idx *Index) getOrCreateSeries(name string) *Series {
 	idx.nextID++
 
 	// 🌟 4. 【核心新增】：立刻把 "ID -> Name" 追加到字典文件中！
-	// 格式极其简单：[ID: 4字节] + [Name长度: 2字节] + [Name内容]
-	if err := idx.appendCatalog(id, name); err != nil {
+	// 格式极其简单：[ID: 4字节] + [类型: 1字节] + [Name长度: 2字节] + [Name内容] + [CRC: 4字节]
+	if err := idx.appendCatalog(id, typ, name); err != nil {
 		// 记录严重错误，注册失败！
 	}
 
 	// 5. 创建新 Series 并存入 Map
-	newSeries := newSeries(id)
+	newSeries := newSeries(id, typ)
 	idx.seriesMap[name] = newSeries
 	idx.idToName[id] = name // 顺手记下反向映射
 
 	return newSeries
 }
 
+// getSeries 只查不建：找不到返回 nil
+func (idx *Index) getSeries(name string) *Series {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.seriesMap[name]
+}
+
+// nameOf 通过 ID 反查名字
+func (idx *Index) nameOf(id uint32) (string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	name, ok := idx.idToName[id]
+	return name, ok
+}
+
+// seriesOf 通过 ID 找 Series（包括墓地里的），开机挂载 Hint 时使用
+// 不能先反查名字再按名字找：名字可能已经被删除后新建的同名 Series 占用
+func (idx *Index) seriesOf(id uint32) *Series {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if name, ok := idx.idToName[id]; ok {
+		if s := idx.seriesMap[name]; s != nil && s.ID == id {
+			return s
+		}
+	}
+	if dead, ok := idx.graveyard[id]; ok {
+		return dead.series
+	}
+	return nil
+}
+
+// removeSeries 让 Index 彻底忘掉一个名字，Series 本身移进墓地
+// ID 不会被回收：nextID 只增不减，磁盘上残留的旧 Block 等待 Compaction 清理
+func (idx *Index) removeSeries(name string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if s, ok := idx.seriesMap[name]; ok {
+		idx.buryLocked(name, s)
+	}
+}
+
+// removeSeriesByID 按 ID 删除（开机重放墓碑时使用）
+func (idx *Index) removeSeriesByID(id uint32) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	name, ok := idx.idToName[id]
+	if !ok {
+		return
+	}
+	if s := idx.seriesMap[name]; s != nil && s.ID == id {
+		idx.buryLocked(name, s)
+	}
+}
+
+func (idx *Index) buryLocked(name string, s *Series) {
+	delete(idx.idToName, s.ID)
+	delete(idx.seriesMap, name)
+	idx.graveyard[s.ID] = deadSeries{name: name, series: s}
+}
+
+// getDeadSeries 获取墓地快照
+func (idx *Index) getDeadSeries() []*Series {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	list := make([]*Series, 0, len(idx.graveyard))
+	for _, dead := range idx.graveyard {
+		list = append(list, dead.series)
+	}
+	return list
+}
+
+// renameSeries 改名但保留 ID：先追加一条字典记录，再切换内存映射
+// 磁盘上的 Hint 只认 ID，所以旧数据无需任何改动
+func (idx *Index) renameSeries(oldName, newName string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	s, ok := idx.seriesMap[oldName]
+	if !ok {
+		return ErrSeriesNotFound
+	}
+	if _, exists := idx.seriesMap[newName]; exists {
+		return ErrSeriesExists
+	}
+
+	if err := idx.appendCatalog(s.ID, s.Type, newName); err != nil {
+		return err
+	}
+
+	delete(idx.seriesMap, oldName)
+	idx.seriesMap[newName] = s
+	idx.idToName[s.ID] = newName
+	return nil
+}
+
+// compactCatalog 重写字典文件，只保留活着的 Series 和数据尚未清除的墓地记录
+// 返回被彻底遗忘的 ID（它们的墓碑也可以一并回收）
+func (idx *Index) compactCatalog(path string) ([]uint32, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var records []catalogRecord
+	var forgotten []uint32
+
+	// 墓地记录写在前面：如果名字被新 Series 复用，重启时后写的活记录会覆盖它
+	for id, dead := range idx.graveyard {
+		if dead.series.blockCount() == 0 {
+			forgotten = append(forgotten, id)
+			continue
+		}
+		records = append(records, catalogRecord{ID: id, Type: dead.series.Type, Name: dead.name})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	live := make([]catalogRecord, 0, len(idx.seriesMap))
+	for name, s := range idx.seriesMap {
+		live = append(live, catalogRecord{ID: s.ID, Type: s.Type, Name: name})
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].ID < live[j].ID })
+	records = append(records, live...)
+
+	fd, err := rewriteCatalog(path, records)
+	if err != nil {
+		return nil, err
+	}
+	if idx.catalogFd != nil {
+		idx.catalogFd.Close()
+	}
+	idx.catalogFd = fd
+
+	for _, id := range forgotten {
+		delete(idx.graveyard, id)
+	}
+	return forgotten, nil
+}
+
 // 追加写字典文件
-func (idx *Index) appendCatalog(id uint32, name string) error {
+func (idx *Index) appendCatalog(id uint32, typ ValueType, name string) error {
 	if idx.catalogFd == nil {
 		return nil // 防御性逻辑
 	}
-
-	nameLen := len(name)
-	buf := make([]byte, 4+2+nameLen)
-	binary.BigEndian.PutUint32(buf[0:4], id)
-	binary.BigEndian.PutUint16(buf[4:6], uint16(nameLen))
-	copy(buf[6:], name)
-
-	_, err := idx.catalogFd.Write(buf)
-	return err
+	return WriteCatalogRecord(idx.catalogFd, id, typ, name)
 }
 
 // GetAllSeries 获取所有 Series 的快照列表
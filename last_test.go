@@ -0,0 +1,87 @@
+package tcore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLastPoint(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const temp, hum = `temperature{site="plant-3"}`, `humidity{site="plant-3"}`
+	db.Write(temp, 100, 20)
+	db.Write(temp, 90, 19) // 迟到的旧点不是最新值
+	db.WriteBatch(hum, []TypedPoint{{Time: 300, Value: FloatValue(55)}, {Time: 200, Value: FloatValue(50)}})
+	db.WriteValue("door", 5, StringValue("open"))
+	db.CreateSeries("empty", TypeFloat)
+
+	if p, err := db.LastPoint(temp); err != nil || p.Time != 100 || p.Value.Float != 20 {
+		t.Fatalf("temp: %+v %v", p, err)
+	}
+	if p, _ := db.LastPoint(hum); p.Time != 300 || p.Value.Float != 55 {
+		t.Fatalf("humidity: %+v", p)
+	}
+	if p, _ := db.LastPoint("door"); p.Value.Str != "open" {
+		t.Fatalf("door: %+v", p)
+	}
+	if _, err := db.LastPoint("nope"); !errors.Is(err, ErrSeriesNotFound) {
+		t.Fatalf("expected ErrSeriesNotFound, got %v", err)
+	}
+	if _, err := db.LastPoint("empty"); !errors.Is(err, ErrNoPoints) {
+		t.Fatalf("expected ErrNoPoints, got %v", err)
+	}
+
+	// 刷盘后缓存照旧，陈旧标记不算读数
+	db.Flush()
+	db.Write(temp, 110, StaleNaN)
+	if p, _ := db.LastPoint(temp); p.Time != 100 {
+		t.Fatalf("temp after marker: %+v", p)
+	}
+	points, err := db.LastPoints(`{site="plant-3"}`)
+	if err != nil || len(points) != 2 || points[hum].Time != 300 || points[temp].Time != 100 {
+		t.Fatalf("last points: %+v %v", points, err)
+	}
+	if _, err := db.LastPoints(`{site=`); !errors.Is(err, ErrBadSelector) {
+		t.Fatalf("expected ErrBadSelector, got %v", err)
+	}
+
+	// 删掉最新的点：回退到前一个落盘的点
+	if err := db.DeleteRange(hum, 250, 350); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := db.LastPoint(hum); p.Time != 200 || p.Value.Float != 50 {
+		t.Fatalf("humidity after delete: %+v", p)
+	}
+	db.Write(hum, 400, 60)
+	db.Flush()
+	db.Close()
+
+	// 重启：从最新的 Block 重建
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	series := db.idx.getSeries(hum)
+	series.mu.RLock()
+	dirty := series.latestDirty
+	series.mu.RUnlock()
+	if dirty {
+		t.Fatal("cache should be rebuilt at startup")
+	}
+	for name, want := range map[string]int64{temp: 100, hum: 400, "door": 5} {
+		if p, err := db.LastPoint(name); err != nil || p.Time != want {
+			t.Fatalf("%s after reopen: %+v %v", name, p, err)
+		}
+	}
+	if err := db.DeleteRange("door", 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LastPoint("door"); !errors.Is(err, ErrNoPoints) {
+		t.Fatalf("door after delete: %v", err)
+	}
+}
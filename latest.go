@@ -0,0 +1,155 @@
+package tcore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var ErrNoPoints = errors.New("series has no points")
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// LastPoint 📍 一条时间线当前的读数：时间戳最大的点 (陈旧标记除外)
+// 直接取内存里的缓存，不用猜查询范围，热数据刚刷盘也不用读盘；
+// 只有删除过数据、缓存作废后第一次被问到时，才会从最新的 Block 往前读到为止
+func (db *DB) LastPoint(name string) (TypedPoint, error) {
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return TypedPoint{}, ErrSeriesNotFound
+	}
+	p, ok, err := db.latestOf(series)
+	if err != nil {
+		return TypedPoint{}, err
+	}
+	if !ok {
+		return TypedPoint{}, ErrNoPoints
+	}
+	return p, nil
+}
+
+// LastPoints 📍 选择器匹配的所有时间线的当前读数，没有数据的时间线不出现在结果里
+func (db *DB) LastPoints(selector string) (map[string]TypedPoint, error) {
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]TypedPoint)
+	for _, name := range db.Keys() {
+		if !sel.Match(name) {
+			continue
+		}
+		series := db.idx.getSeries(name)
+		if series == nil {
+			continue
+		}
+		p, ok, err := db.latestOf(series)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if ok {
+			result[name] = p
+		}
+	}
+	return result, nil
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+// rebuildLatest 开机时从每条时间线最新的 Block 重建缓存
+// 读失败的时间线保持待重算，第一次 LastPoint 时再试
+func (db *DB) rebuildLatest() {
+	for _, series := range db.idx.getAllSeries() {
+		if _, _, err := db.latestOf(series); err != nil {
+			fmt.Printf("⚠️ 重建时间线 %d 的最新值失败: %v\n", series.ID, err)
+		}
+	}
+}
+
+// latestOf 返回缓存；缓存作废时先从磁盘和热数据重算
+func (db *DB) latestOf(series *Series) (TypedPoint, bool, error) {
+	for {
+		series.mu.RLock()
+		p, ok, dirty, epoch := series.latest, series.hasLatest, series.latestDirty, series.latestEpoch
+		series.mu.RUnlock()
+		if !dirty {
+			return p, ok, nil
+		}
+
+		p, ok, err := db.scanLatest(series)
+		if err != nil {
+			return TypedPoint{}, false, err
+		}
+		// 重算期间又删了数据：结果可能包含被删的点，重来
+		if p, ok, stored := series.storeLatest(p, ok, epoch); stored {
+			return p, ok, nil
+		}
+	}
+}
+
+// scanLatest 找出时间线上时间戳最大的点：Block 按 MaxTime 从新到旧读，
+// 剩下的 Block 都比已找到的点旧时停止；最后看热数据
+func (db *DB) scanLatest(series *Series) (TypedPoint, bool, error) {
+	// 挡住 Compaction：它会删除我们还没读到的 Block 所在的文件
+	db.scanMu.RLock()
+	defer db.scanMu.RUnlock()
+
+	var best TypedPoint
+	found := false
+	consider := func(p TypedPoint) error {
+		if !isStale(p.Value) && (!found || p.Time >= best.Time) {
+			best, found = p, true
+		}
+		return nil
+	}
+
+	metas := series.findBlocks(math.MinInt64, math.MaxInt64)
+	sort.SliceStable(metas, func(i, j int) bool { return metas[i].MaxTime > metas[j].MaxTime })
+	for _, meta := range metas {
+		if found && meta.MaxTime < best.Time {
+			break
+		}
+		// Block 里的点可能全被删了或全是陈旧标记，这时继续读更旧的
+		if err := db.scanBlocks(series, []*BlockMeta{meta}, math.MinInt64, math.MaxInt64, consider); err != nil {
+			return TypedPoint{}, false, err
+		}
+	}
+
+	if series.Type == TypeFloat {
+		for _, p := range series.getHotData() {
+			consider(TypedPoint{Time: p.Time, Value: FloatValue(p.Value)})
+		}
+	} else {
+		for _, p := range series.getTypedHotData() {
+			consider(p)
+		}
+	}
+	return best, found, nil
+}
+
+// storeLatest 保存重算结果；重算期间写入的点已经记在 latest 里，两者取较新的
+// 期间缓存又被作废过 (epoch 变了) 时不保存，返回 false
+func (s *Series) storeLatest(p TypedPoint, ok bool, epoch uint64) (TypedPoint, bool, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latestEpoch != epoch {
+		return TypedPoint{}, false, false
+	}
+	if s.hasLatest && (!ok || s.latest.Time >= p.Time) {
+		p, ok = s.latest, true
+	}
+	s.latest, s.hasLatest, s.latestDirty = p, ok, false
+	return p, ok, true
+}
+
+// invalidateLatestLocked 作废缓存，下次 LastPoint 时重算（调用方必须持有写锁）
+func (s *Series) invalidateLatestLocked() {
+	s.latest, s.hasLatest, s.latestDirty = TypedPoint{}, false, true
+	s.latestEpoch++
+}
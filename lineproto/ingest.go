@@ -0,0 +1,149 @@
+package lineproto
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// MaxLineBytes 单行的最大长度，超过时整个请求失败
+const MaxLineBytes = 1024 * 1024
+
+// Precision 时间戳单位，数值为该单位对应的纳秒数
+type Precision int64
+
+const (
+	Nanosecond  Precision = 1
+	Microsecond Precision = 1000
+	Millisecond Precision = 1000 * 1000
+	Second      Precision = 1000 * 1000 * 1000
+)
+
+// ParsePrecision 解析 precision 参数，同时接受 v2 (ns/us/ms/s) 和 v1 (n/u/ms/s) 的写法
+func ParsePrecision(s string) (Precision, error) {
+	switch s {
+	case "", "ns", "n":
+		return Nanosecond, nil
+	case "us", "u", "µ":
+		return Microsecond, nil
+	case "ms":
+		return Millisecond, nil
+	case "s":
+		return Second, nil
+	}
+	return 0, fmt.Errorf("unknown precision %q", s)
+}
+
+// convert 把 ts 从 from 单位换算到 to 单位
+func convert(ts int64, from, to Precision) int64 {
+	if from >= to {
+		return ts * int64(from/to)
+	}
+	return ts / int64(to/from)
+}
+
+// Writer 是写入路径依赖的存储能力，*tcore.DB 天然满足
+type Writer interface {
+	Write(sensorID string, timestamp int64, value float64) error
+	WriteValue(sensorID string, timestamp int64, v tcore.Value) error
+}
+
+// Options 写入配置
+type Options struct {
+	Precision      Precision        // 请求里时间戳的单位
+	StorePrecision Precision        // DB 里时间戳的单位
+	Now            func() time.Time // 行里没有时间戳时使用
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithPrecision 设置请求里时间戳的单位
+func WithPrecision(p Precision) Option {
+	return func(opts *Options) {
+		opts.Precision = p
+	}
+}
+
+// WithStorePrecision 设置 DB 里时间戳的单位，写入时换算
+func WithStorePrecision(p Precision) Option {
+	return func(opts *Options) {
+		opts.StorePrecision = p
+	}
+}
+
+// WithNow 设置缺省时间戳的时钟 (测试用)
+func WithNow(now func() time.Time) Option {
+	return func(opts *Options) {
+		opts.Now = now
+	}
+}
+
+// LineError 某一行写入失败
+type LineError struct {
+	Line int    // 行号，从 1 开始
+	Text string // 原始内容
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// Result 一次写入的统计
+type Result struct {
+	Lines  int          // 处理的有效行数 (不含空行和注释)
+	Points int          // 写入成功的点数 (每个 field 一个点)
+	Errors []*LineError // 失败的行，其他行照常写入
+}
+
+// Ingest 📥 逐行解析并写入
+// 坏行和写入失败的行记在 Result.Errors 里，不影响其他行；只有读取请求体失败时才返回 error
+func Ingest(db Writer, r io.Reader, options ...Option) (Result, error) {
+	opts := Options{Precision: Nanosecond, StorePrecision: Nanosecond, Now: time.Now}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	var res Result
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), MaxLineBytes)
+
+	// 同一个请求里没有时间戳的行共用一个时间，和 InfluxDB 的行为一致
+	now := convert(opts.Now().UnixNano(), Nanosecond, opts.StorePrecision)
+
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		res.Lines++
+
+		line, err := ParseLine(text)
+		if err != nil {
+			res.Errors = append(res.Errors, &LineError{Line: n, Text: text, Err: err})
+			continue
+		}
+
+		ts := now
+		if line.HasTime {
+			ts = convert(line.Time, opts.Precision, opts.StorePrecision)
+		}
+		for _, f := range line.Fields {
+			if err = db.WriteValue(SeriesKey(line.Measurement, line.Tags, f.Key), ts, f.Value); err != nil {
+				break
+			}
+			res.Points++
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, &LineError{Line: n, Text: text, Err: err})
+		}
+	}
+	return res, sc.Err()
+}
@@ -0,0 +1,234 @@
+// Package lineproto 解析 InfluxDB 行协议，把 measurement / tag / field 映射成 tcore 的时间线
+//
+//	weather,location=us-midwest,season=summer temperature=82,humidity=71i 1465839830100400200
+//	└──┬──┘ └──────────────┬──────────────┘ └───────────┬───────────┘ └────────┬────────┘
+//	measurement          tag set                     field set             timestamp (可选)
+//
+// 每个 field 是一条独立的时间线，名字由 SeriesKey 生成。
+package lineproto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+var (
+	ErrMissingMeasurement = errors.New("missing measurement")
+	ErrMissingFields      = errors.New("missing fields")
+	ErrBadTag             = errors.New("bad tag")
+	ErrBadField           = errors.New("bad field")
+	ErrBadTimestamp       = errors.New("bad timestamp")
+)
+
+// Tag 一个标签
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Field 一个字段。类型映射：
+//   - 浮点数 (默认)      -> float
+//   - 整数 (后缀 i)      -> float (tcore 没有有符号整数类型，与浮点字段共用一条时间线也不会冲突)
+//   - 无符号整数 (后缀 u) -> uint
+//   - true / false       -> bool
+//   - "字符串"           -> string
+type Field struct {
+	Key   string
+	Value tcore.Value
+}
+
+// Line 解析后的一行
+type Line struct {
+	Measurement string
+	Tags        []Tag // 按 Key 排序
+	Fields      []Field
+	Time        int64 // 原始时间戳，单位由请求的 precision 决定
+	HasTime     bool
+}
+
+// ParseLine 解析一行行协议 (不含换行符)
+func ParseLine(s string) (Line, error) {
+	var line Line
+
+	// 1. 第一个未转义的空格之前是 measurement 和 tag set
+	keyEnd := indexUnescaped(s, ' ', false)
+	if keyEnd < 0 {
+		return line, ErrMissingFields
+	}
+	key, rest := s[:keyEnd], strings.TrimLeft(s[keyEnd:], " ")
+
+	parts := splitUnescaped(key, ',', false)
+	line.Measurement = unescape(parts[0], ", ")
+	if line.Measurement == "" {
+		return line, ErrMissingMeasurement
+	}
+	for _, p := range parts[1:] {
+		eq := indexUnescaped(p, '=', false)
+		if eq <= 0 || eq == len(p)-1 {
+			return line, fmt.Errorf("%w: %q", ErrBadTag, p)
+		}
+		line.Tags = append(line.Tags, Tag{Key: unescape(p[:eq], ",= "), Value: unescape(p[eq+1:], ",= ")})
+	}
+	sort.Slice(line.Tags, func(i, j int) bool { return line.Tags[i].Key < line.Tags[j].Key })
+
+	// 2. 下一个不在引号内的空格之前是 field set，之后是时间戳
+	fieldEnd := indexUnescaped(rest, ' ', true)
+	fieldSet, ts := rest, ""
+	if fieldEnd >= 0 {
+		fieldSet, ts = rest[:fieldEnd], strings.TrimSpace(rest[fieldEnd:])
+	}
+	if fieldSet == "" {
+		return line, ErrMissingFields
+	}
+	for _, p := range splitUnescaped(fieldSet, ',', true) {
+		f, err := parseField(p)
+		if err != nil {
+			return line, err
+		}
+		line.Fields = append(line.Fields, f)
+	}
+
+	// 3. 时间戳
+	if ts != "" {
+		t, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return line, fmt.Errorf("%w: %q", ErrBadTimestamp, ts)
+		}
+		line.Time, line.HasTime = t, true
+	}
+	return line, nil
+}
+
+// SeriesKey 生成一个 field 对应的时间线名字：measurement.field{tagA=x,tagB=y}
+// tag 按 Key 排序，tag 的顺序不影响结果；名字里的 \ , = { } 会被转义，不同的 tag 组合不会撞名
+func SeriesKey(measurement string, tags []Tag, field string) string {
+	var b strings.Builder
+	b.WriteString(escapeKey(measurement))
+	b.WriteByte('.')
+	b.WriteString(escapeKey(field))
+	if len(tags) == 0 {
+		return b.String()
+	}
+
+	sorted := append([]Tag(nil), tags...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	b.WriteByte('{')
+	for i, t := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(escapeKey(t.Key))
+		b.WriteByte('=')
+		b.WriteString(escapeKey(t.Value))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ==========================================
+// 🔧 内部解析
+// ==========================================
+
+func parseField(p string) (Field, error) {
+	eq := indexUnescaped(p, '=', false)
+	if eq <= 0 || eq == len(p)-1 {
+		return Field{}, fmt.Errorf("%w: %q", ErrBadField, p)
+	}
+	key, raw := unescape(p[:eq], ",= "), p[eq+1:]
+
+	v, err := parseFieldValue(raw)
+	if err != nil {
+		return Field{}, fmt.Errorf("%w: %s=%s", ErrBadField, key, raw)
+	}
+	return Field{Key: key, Value: v}, nil
+}
+
+func parseFieldValue(raw string) (tcore.Value, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return tcore.BoolValue(true), nil
+	case "f", "F", "false", "False", "FALSE":
+		return tcore.BoolValue(false), nil
+	}
+
+	last := raw[len(raw)-1]
+	switch {
+	case raw[0] == '"':
+		if len(raw) < 2 || last != '"' {
+			return tcore.Value{}, ErrBadField
+		}
+		return tcore.StringValue(unescape(raw[1:len(raw)-1], `"\`)), nil
+	case last == 'i':
+		n, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		return tcore.FloatValue(float64(n)), err
+	case last == 'u':
+		n, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		return tcore.UintValue(n), err
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return tcore.Value{}, err
+	}
+	// 行协议不允许 NaN 和 Inf，ParseFloat 却认识它们
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return tcore.Value{}, ErrBadField
+	}
+	return tcore.FloatValue(f), nil
+}
+
+// indexUnescaped 找第一个未被反斜杠转义的 sep；quotes 为 true 时跳过双引号里的内容
+func indexUnescaped(s string, sep byte, quotes bool) int {
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++ // 跳过被转义的字符
+		case quotes && c == '"':
+			inQuote = !inQuote
+		case c == sep && !inQuote:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnescaped 按未转义 (且不在引号内) 的 sep 切分
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, sep, quotes)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// unescape 把 \c 还原成 c (c 属于 chars)；其他反斜杠按原样保留
+func unescape(s string, chars string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(chars, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`, `{`, `\{`, `}`, `\}`)
+
+func escapeKey(s string) string {
+	return keyEscaper.Replace(s)
+}
@@ -0,0 +1,106 @@
+package lineproto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+func TestParseLine(t *testing.T) {
+	line, err := ParseLine(`weather\,x,season=summer,location=us\ midwest temp=82,hum=71i,on=t,note="a \"b\", c",cnt=5u 1465839830100400200`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Measurement != "weather,x" {
+		t.Errorf("measurement: %q", line.Measurement)
+	}
+	if len(line.Tags) != 2 || line.Tags[0] != (Tag{"location", "us midwest"}) || line.Tags[1] != (Tag{"season", "summer"}) {
+		t.Errorf("tags: %+v", line.Tags)
+	}
+	want := []tcore.Value{
+		tcore.FloatValue(82), tcore.FloatValue(71), tcore.BoolValue(true),
+		tcore.StringValue(`a "b", c`), tcore.UintValue(5),
+	}
+	if len(line.Fields) != len(want) {
+		t.Fatalf("fields: %+v", line.Fields)
+	}
+	for i, f := range line.Fields {
+		if f.Value.String() != want[i].String() || f.Value.Type != want[i].Type {
+			t.Errorf("field %s: got %v, want %v", f.Key, f.Value, want[i])
+		}
+	}
+	if !line.HasTime || line.Time != 1465839830100400200 {
+		t.Errorf("time: %d", line.Time)
+	}
+
+	for _, bad := range []string{
+		"cpu",
+		",t=1 v=1",
+		"cpu,t v=1",
+		"cpu v=",
+		"cpu v=NaN",
+		`cpu v="open`,
+		"cpu v=1 abc",
+	} {
+		if _, err := ParseLine(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := SeriesKey("cpu", []Tag{{"host", "a"}, {"dc", "x"}}, "usage")
+	b := SeriesKey("cpu", []Tag{{"dc", "x"}, {"host", "a"}}, "usage")
+	if a != b || a != "cpu.usage{dc=x,host=a}" {
+		t.Errorf("unexpected keys %q / %q", a, b)
+	}
+	// 转义保证 tag 值里的逗号不会伪造出另一个 tag
+	if SeriesKey("m", []Tag{{"a", "1,b=2"}}, "f") == SeriesKey("m", []Tag{{"a", "1"}, {"b", "2"}}, "f") {
+		t.Error("escaped tag value collides with a different tag set")
+	}
+}
+
+func TestIngest(t *testing.T) {
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	body := strings.Join([]string{
+		"# comment",
+		"cpu,host=a usage=1.5,idle=98 1700000000000",
+		"cpu,host=a usage=oops 1700000001000",
+		"",
+		"cpu,host=a usage=2.5",
+		"cpu,host=a usage=true 1700000002000", // 类型与已有时间线冲突
+	}, "\n")
+
+	now := time.UnixMilli(1700000009000)
+	res, err := Ingest(db, strings.NewReader(body),
+		WithPrecision(Millisecond),
+		WithStorePrecision(Second),
+		WithNow(func() time.Time { return now }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lines != 4 || res.Points != 3 || len(res.Errors) != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res.Errors[0].Line != 3 || !errors.Is(res.Errors[0], ErrBadField) {
+		t.Errorf("first error: %v", res.Errors[0])
+	}
+	if res.Errors[1].Line != 6 || !errors.Is(res.Errors[1], tcore.ErrTypeMismatch) {
+		t.Errorf("second error: %v", res.Errors[1])
+	}
+
+	points, _ := db.Query("cpu.usage{host=a}", 0, 1<<62)
+	if len(points) != 2 || points[0].Time != 1700000000 || points[1].Time != 1700000009 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+}
@@ -2,23 +2,31 @@ package tcore
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
 )
 
 // defaultSegmentMaxSize 单个 Segment 的默认最大大小（256MB）
 const defaultSegmentMaxSize = 256 * 1024 * 1024
 
+// noSeal sealActive 的 since：没有可以沿用的封存
+const noSeal = math.MaxUint32
+
 // Manager 负责管理多个数据段文件
 type Manager struct {
 	mu            sync.RWMutex
 	dirPath       string
 	activeSegment *Segment
 	olderSegments map[uint32]*Segment
-	maxSize       int64 // 单个 Segment 的最大大小，超过则轮转
+	maxSize       int64  // 单个 Segment 的最大大小，超过则轮转
+	nextID        uint32 // 下一个可分配的 Segment ID (轮转与 Compaction 共用)
+
+	// writeMu 写入 (数据 + Hint) 时持读锁；快照持写锁，记下的活跃段长度和 Hint 长度才能一一对应
+	writeMu sync.RWMutex
+
+	readOnlyFiles map[uint32]*os.File // 只读打开时的 .vlog 句柄，见 OpenReadOnly
 }
 
 // NewManager 初始化并加载现有的段文件
@@ -56,12 +64,8 @@ func (m *Manager) loadSegments() error {
 	var ids []uint32
 	for _, f := range files {
 		// 🌟 巧妙之处：只认 .vlog 文件来提取 ID 即可
-		if strings.HasPrefix(f.Name(), SegmentFileNamePrefix) && strings.HasSuffix(f.Name(), SegmentFileNameSuffix) {
-			idStr := strings.TrimPrefix(strings.TrimSuffix(f.Name(), SegmentFileNameSuffix), SegmentFileNamePrefix)
-			id, err := strconv.ParseUint(idStr, 10, 32)
-			if err == nil {
-				ids = append(ids, uint32(id))
-			}
+		if id, ok := segmentIDFromName(f.Name(), SegmentFileNameSuffix); ok {
+			ids = append(ids, id)
 		}
 	}
 
@@ -88,6 +92,12 @@ func (m *Manager) loadSegments() error {
 	if err != nil {
 		return err
 	}
+	m.nextID = lastID + 1
+	if seg.Gen != seg.ID {
+		// ID 最大的是 Compaction 产物 (带着输入的旧代数)：新写入落进去会被当成旧数据，另开一个活跃段
+		m.olderSegments[lastID] = seg
+		return m.rotate(m.nextID)
+	}
 	m.activeSegment = seg
 
 	return nil
@@ -100,8 +110,16 @@ func (m *Manager) writeBlock(block *Block) (*BlockMeta, error) {
 	if err != nil {
 		return nil, err
 	}
+	return m.writeRaw(block.SensorID, data, block.toMeta)
+}
+
+// writeRaw 写入已经编码好的字节，由 toMeta 生成元数据（typed Block 走这条路）
+func (m *Manager) writeRaw(sensorID uint32, data []byte, toMeta func(fileID uint32, offset int64, size uint32) *BlockMeta) (*BlockMeta, error) {
 	dataSize := int64(len(data))
 
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
+
 	// 2. ⚡️ 获取当前活跃分片的指针
 	m.mu.RLock()
 	activeSeg := m.activeSegment
@@ -112,7 +130,7 @@ func (m *Manager) writeBlock(block *Block) (*BlockMeta, error) {
 		m.mu.Lock()
 		// Double-Check：防止其他并发协程已经完成了轮转
 		if m.activeSegment == activeSeg {
-			if err := m.rotate(activeSeg.ID + 1); err != nil {
+			if err := m.rotate(m.nextID); err != nil {
 				m.mu.Unlock()
 				return nil, err
 			}
@@ -129,9 +147,9 @@ func (m *Manager) writeBlock(block *Block) (*BlockMeta, error) {
 	}
 
 	// 5. 🧾 组装元数据返回给上层
-	meta := block.toMeta(activeSeg.ID, offset, uint32(dataSize))
+	meta := toMeta(activeSeg.ID, offset, uint32(dataSize))
 
-	if err := WriteHintRecord(activeSeg.HintFile, block.SensorID, meta); err != nil {
+	if err := WriteHintRecord(activeSeg.HintFile, sensorID, meta); err != nil {
 		// 这里只打印错误不 return，因为真实数据已经落盘了，避免上层收到假报错
 		// logger.Errorf("写入 Hint 伴生文件失败: %v", err)
 	}
@@ -141,6 +159,17 @@ func (m *Manager) writeBlock(block *Block) (*BlockMeta, error) {
 
 // ReadBlock 根据 FileID 找到对应的 Segment 并读取解包
 func (m *Manager) readBlock(meta *BlockMeta) (*Block, error) {
+	data, err := m.readRaw(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// 锁外执行反序列化 (依赖 block.go 中的 DecodeBlock)
+	return decodeBlock(data)
+}
+
+// readRaw 根据 FileID 找到对应的 Segment，读出原始字节
+func (m *Manager) readRaw(meta *BlockMeta) ([]byte, error) {
 	m.mu.RLock()
 	var seg *Segment
 	if m.activeSegment != nil && m.activeSegment.ID == meta.FileID {
@@ -148,20 +177,18 @@ func (m *Manager) readBlock(meta *BlockMeta) (*Block, error) {
 	} else {
 		seg = m.olderSegments[meta.FileID]
 	}
+	ro := m.readOnlyFiles[meta.FileID]
 	m.mu.RUnlock()
 
+	if ro != nil {
+		return readBlockAt(ro, meta.FileID, meta.Size, meta.Offset)
+	}
 	if seg == nil {
 		return nil, fmt.Errorf("segment %d not found", meta.FileID)
 	}
 
 	// 调用底层物理读取
-	data, err := seg.readAt(meta.Size, meta.Offset)
-	if err != nil {
-		return nil, err
-	}
-
-	// 锁外执行反序列化 (依赖 block.go 中的 DecodeBlock)
-	return decodeBlock(data)
+	return seg.readAt(meta.Size, meta.Offset)
 }
 
 // rotate 封存当前活跃段，开启一个新段
@@ -183,9 +210,145 @@ func (m *Manager) rotate(nextID uint32) error {
 	}
 
 	m.activeSegment = seg
+	m.nextID = nextID + 1
 	return nil
 }
 
+// allocSegmentID 预留一个全新的 Segment ID
+// Compaction 的产物必须使用新 ID，否则持有旧 BlockMeta 的查询会读到错位的数据
+func (m *Manager) allocSegmentID() uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextID
+	m.nextID++
+	return id
+}
+
+// sealedSegments 返回所有已封存（只读）Segment 的快照，按 ID 升序
+func (m *Manager) sealedSegments() []*Segment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Segment, 0, len(m.olderSegments))
+	for _, seg := range m.olderSegments {
+		list = append(list, seg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// sortByWriteOrder 把 Block 按写入先后排序：先比所在 Segment 的代数，同一代里比 ID 和偏移
+// 同一次 Compaction 的产物代数相同，但它们已经去过重，同一条时间线的时间戳不会重叠
+func (m *Manager) sortByWriteOrder(metas []*BlockMeta) {
+	m.mu.RLock()
+	gens := make(map[uint32]uint32, len(m.olderSegments)+1)
+	for id, seg := range m.olderSegments {
+		gens[id] = seg.Gen
+	}
+	if m.activeSegment != nil {
+		gens[m.activeSegment.ID] = m.activeSegment.Gen
+	}
+	m.mu.RUnlock()
+
+	sort.SliceStable(metas, func(i, j int) bool {
+		a, b := metas[i], metas[j]
+		if gens[a.FileID] != gens[b.FileID] {
+			return gens[a.FileID] < gens[b.FileID]
+		}
+		if a.FileID != b.FileID {
+			return a.FileID < b.FileID
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// sealedIDs 返回已封存 Segment 的 ID，按升序
+// 只读打开时没有活跃段，ID 最大的那个可能还在被写进程追加，其余的视为已封存
+func (m *Manager) sealedIDs() []uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uint32
+	if m.readOnlyFiles != nil {
+		for id := range m.readOnlyFiles {
+			ids = append(ids, id)
+		}
+	} else {
+		for id := range m.olderSegments {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if m.readOnlyFiles != nil && len(ids) > 0 {
+		ids = ids[:len(ids)-1]
+	}
+	return ids
+}
+
+// sealActive 立即封存活跃段，之后的写入进入新段，返回可以作为墓碑 Seal 的 ID：
+// 现有的段 (包括 ID 比活跃段大的 Compaction 产物) 都不大于它，之后写入的段都大于它
+//
+// 活跃段里没有要删的数据、之后也没有分配过 ID 时不必轮转，避免连续删除留下一串空文件：
+// 活跃段是空的，或者活跃段是 since (上一次封存返回的 ID) 之后才开的
+// (调用方保证要删的数据都写在那次封存之前，比如一轮降采样里要替换的旧汇总值)；
+// 没有可以沿用的封存时传 noSeal
+func (m *Manager) sealActive(since uint32) (uint32, error) {
+	m.writeMu.RLock()
+	defer m.writeMu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clean := m.activeSegment.size() == 0 || m.activeSegment.ID > since
+	if !clean || m.activeSegment.ID+1 != m.nextID {
+		if err := m.rotate(m.nextID); err != nil {
+			return 0, err
+		}
+	}
+	return m.activeSegment.ID - 1, nil
+}
+
+// installSegment 将一个已写完的 Segment 挂载为只读段
+func (m *Manager) installSegment(seg *Segment) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.olderSegments[seg.ID] = seg
+}
+
+// removeSegments 卸载并物理删除指定的只读段
+// 调用方必须保证已经没有任何读者持有指向这些段的 BlockMeta
+func (m *Manager) removeSegments(ids []uint32) error {
+	m.mu.Lock()
+	var victims []*Segment
+	for _, id := range ids {
+		if seg, ok := m.olderSegments[id]; ok {
+			victims = append(victims, seg)
+			delete(m.olderSegments, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, seg := range victims {
+		if err := seg.close(); err != nil {
+			return err
+		}
+		for _, suffix := range []string{SegmentFileNameSuffix, hintFileNameSuffix} {
+			if err := os.Remove(segmentPath(m.dirPath, seg.ID, suffix)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncDir 对目录执行 fsync，确保 rename / 删除操作本身也已落盘
+func syncDir(dirPath string) error {
+	d, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
 // Close 关闭所有段文件
 func (m *Manager) close() error {
 	m.mu.Lock()
@@ -204,5 +367,8 @@ func (m *Manager) close() error {
 			return err
 		}
 	}
+	for _, f := range m.readOnlyFiles {
+		f.Close()
+	}
 	return nil
 }
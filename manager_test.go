@@ -7,8 +7,7 @@ import (
 )
 
 func TestManager_Rotate(t *testing.T) {
-	dir, _ := os.MkdirTemp("", "segment-mgr-test")
-	defer os.RemoveAll(dir)
+	dir := t.TempDir()
 
 	// 设置极小的 maxSize 以触发轮转 (100 字节)
 	mgr, err := newManager(dir, 100)
@@ -53,8 +52,7 @@ func TestManager_Rotate(t *testing.T) {
 }
 
 func TestManager_Reload(t *testing.T) {
-	dir, _ := os.MkdirTemp("", "segment-mgr-reload")
-	defer os.RemoveAll(dir)
+	dir := t.TempDir()
 
 	// 1. 第一轮写入
 	mgr1, _ := newManager(dir, 1024*1024)
@@ -82,8 +80,7 @@ func TestManager_Reload(t *testing.T) {
 
 func TestNewManager_CreateDir(t *testing.T) {
 	// 定义一个不存在的临时子目录
-	baseDir, _ := os.MkdirTemp("", "mgr-create-dir")
-	defer os.RemoveAll(baseDir)
+	baseDir := t.TempDir()
 
 	targetDir := filepath.Join(baseDir, "nested/tsdb_data")
 
@@ -0,0 +1,103 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Modbus TCP 帧格式 (ADU)：
+//
+//	[Transaction ID: 2] [Protocol ID: 2 = 0] [Length: 2] [Unit ID: 1] [PDU]
+//
+// Length 计算 Unit ID + PDU 的长度。读寄存器的 PDU：
+//
+//	请求  [Function: 1] [Start Address: 2] [Quantity: 2]
+//	响应  [Function: 1] [Byte Count: 1] [Register Values: 2 * Quantity]
+//	异常  [Function | 0x80: 1] [Exception Code: 1]
+const (
+	funcReadHolding = 0x03
+	funcReadInput   = 0x04
+
+	mbapHeaderSize = 7
+
+	// maxReadQuantity 一次最多读 125 个寄存器 (协议规定)
+	maxReadQuantity = 125
+)
+
+var ErrBadResponse = errors.New("modbus: malformed response")
+
+// ExceptionError 设备返回的异常响应
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus: exception %d for function 0x%02x", e.Code, e.Function)
+}
+
+// conn 一条 Modbus TCP 连接；同一时刻只有一个请求在途，不需要加锁 (由设备协程独占)
+type conn struct {
+	net.Conn
+	tid uint16
+}
+
+func dial(addr string, timeout time.Duration) (*conn, error) {
+	c, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c}, nil
+}
+
+// readRegisters 读 quantity 个连续寄存器，整个请求-响应过程受 timeout 限制
+func (c *conn) readRegisters(unit, function byte, addr, quantity uint16, timeout time.Duration) ([]uint16, error) {
+	if quantity == 0 || quantity > maxReadQuantity {
+		return nil, fmt.Errorf("modbus: bad quantity %d", quantity)
+	}
+	c.tid++
+	c.SetDeadline(time.Now().Add(timeout))
+
+	req := make([]byte, mbapHeaderSize+5)
+	binary.BigEndian.PutUint16(req[0:2], c.tid)
+	binary.BigEndian.PutUint16(req[2:4], 0)
+	binary.BigEndian.PutUint16(req[4:6], 6) // Unit ID + 5 字节 PDU
+	req[6] = unit
+	req[7] = function
+	binary.BigEndian.PutUint16(req[8:10], addr)
+	binary.BigEndian.PutUint16(req[10:12], quantity)
+	if _, err := c.Write(req); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, mbapHeaderSize)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:6])
+	if binary.BigEndian.Uint16(header[0:2]) != c.tid || binary.BigEndian.Uint16(header[2:4]) != 0 ||
+		length < 3 || length > 256 {
+		return nil, ErrBadResponse
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(c, pdu); err != nil {
+		return nil, err
+	}
+
+	if pdu[0] == function|0x80 {
+		return nil, &ExceptionError{Function: function, Code: pdu[1]}
+	}
+	if pdu[0] != function || int(pdu[1]) != int(quantity)*2 || len(pdu) != 2+int(quantity)*2 {
+		return nil, ErrBadResponse
+	}
+
+	regs := make([]uint16, quantity)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(pdu[2+i*2:])
+	}
+	return regs, nil
+}
@@ -0,0 +1,473 @@
+// Package modbus 是内置的 Modbus TCP 轮询采集器
+//
+// 每台设备一个协程，按间隔读取配置好的保持寄存器 / 输入寄存器，
+// 按数据类型、字节序、字序解码并缩放后写进 DB。相邻的寄存器会合并成一次请求。
+// 某个寄存器超过 StaleAfter 没有读成功时判定为陈旧；值不变但一直读得到的寄存器不算陈旧。
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RegisterKind 寄存器类型
+type RegisterKind uint8
+
+const (
+	Holding RegisterKind = iota // 保持寄存器，功能码 0x03
+	Input                       // 输入寄存器，功能码 0x04
+)
+
+// DataType 寄存器里的数据类型
+type DataType uint8
+
+const (
+	Uint16 DataType = iota
+	Int16
+	Uint32
+	Int32
+	Float32
+	Uint64
+	Int64
+	Float64
+)
+
+// words 占用的寄存器个数
+func (t DataType) words() uint16 {
+	switch t {
+	case Uint16, Int16:
+		return 1
+	case Uint32, Int32, Float32:
+		return 2
+	}
+	return 4
+}
+
+// ByteOrder 一个寄存器 (16 位) 内的字节序
+type ByteOrder uint8
+
+const (
+	BigEndian    ByteOrder = iota // 协议标准：高字节在前
+	LittleEndian                  // 个别设备会交换字节
+)
+
+// WordOrder 多寄存器数值的字序
+type WordOrder uint8
+
+const (
+	HighWordFirst WordOrder = iota // ABCD
+	LowWordFirst                   // CDAB，很多 PLC 的 32 位浮点是这样存的
+)
+
+const (
+	DefaultInterval = time.Second
+	DefaultTimeout  = time.Second
+
+	// mergeGap 两段寄存器之间空隙不超过这个数时合并成一次读取，多读几个寄存器比多一次往返便宜
+	mergeGap = 8
+)
+
+var ErrBadConfig = errors.New("modbus: bad config")
+
+// Register 一个采集点
+type Register struct {
+	Series    string
+	Kind      RegisterKind
+	Address   uint16
+	Type      DataType
+	ByteOrder ByteOrder
+	WordOrder WordOrder
+	Scale     float64 // 工程值 = 原始值 * Scale + Offset；Scale 为 0 时视为 1
+	Offset    float64
+}
+
+// Device 一台 PLC
+type Device struct {
+	Name       string
+	Addr       string // host:port
+	UnitID     byte
+	Interval   time.Duration // 轮询间隔
+	Timeout    time.Duration // 建连和单次请求的超时
+	StaleAfter time.Duration // 超过这么久没有读成功就判定陈旧，0 表示不检测
+	Registers  []Register
+}
+
+// Writer 是采集器依赖的存储能力，*tcore.DB 天然满足
+type Writer interface {
+	Write(sensorID string, timestamp int64, value float64) error
+}
+
+// Options 采集器配置
+type Options struct {
+	TimeUnit time.Duration                                   // DB 里时间戳的单位
+	Now      func() time.Time                                // 时钟 (测试用)
+	OnError  func(device string, err error)                  // 轮询失败时回调
+	OnStale  func(device, series string, lastRead time.Time) // 寄存器变陈旧时回调一次，恢复后可再次触发
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithTimeUnit 设置时间戳单位，默认纳秒
+func WithTimeUnit(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.TimeUnit = d
+	}
+}
+
+// WithNow 设置时钟
+func WithNow(now func() time.Time) Option {
+	return func(opts *Options) {
+		opts.Now = now
+	}
+}
+
+// WithErrorHandler 设置轮询失败回调
+func WithErrorHandler(fn func(device string, err error)) Option {
+	return func(opts *Options) {
+		opts.OnError = fn
+	}
+}
+
+// WithStaleHandler 设置陈旧回调
+func WithStaleHandler(fn func(device, series string, lastRead time.Time)) Option {
+	return func(opts *Options) {
+		opts.OnStale = fn
+	}
+}
+
+// RegisterStatus 一个采集点的状态
+type RegisterStatus struct {
+	Series     string
+	Value      float64
+	LastRead   time.Time // 最后一次读成功
+	LastChange time.Time // 最后一次读到与上次不同的值
+	Stale      bool
+}
+
+// DeviceStatus 一台设备的状态
+type DeviceStatus struct {
+	Name        string
+	LastSuccess time.Time
+	LastError   error
+	Registers   []RegisterStatus
+}
+
+// Collector 采集器
+type Collector struct {
+	db      Writer
+	devices []*device
+	opts    Options
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// device 运行时的设备状态
+type device struct {
+	Device
+	reads []readRange
+
+	mu          sync.Mutex
+	conn        *conn
+	lastSuccess time.Time
+	lastErr     error
+	regs        []RegisterStatus // 与 Registers 一一对应
+}
+
+// readRange 合并后的一次读请求
+type readRange struct {
+	kind     RegisterKind
+	start    uint16
+	quantity uint16
+	regs     []int // 落在这段里的 Register 下标
+}
+
+// NewCollector 校验配置并规划每台设备的读请求
+func NewCollector(db Writer, devices []Device, options ...Option) (*Collector, error) {
+	opts := Options{TimeUnit: time.Nanosecond, Now: time.Now}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	c := &Collector{db: db, opts: opts, stop: make(chan struct{})}
+	for _, d := range devices {
+		if d.Name == "" || d.Addr == "" || len(d.Registers) == 0 {
+			return nil, fmt.Errorf("%w: device %q needs name, addr and registers", ErrBadConfig, d.Name)
+		}
+		if d.Interval <= 0 {
+			d.Interval = DefaultInterval
+		}
+		if d.Timeout <= 0 {
+			d.Timeout = DefaultTimeout
+		}
+		dev := &device{Device: d, regs: make([]RegisterStatus, len(d.Registers))}
+		for i, r := range d.Registers {
+			if r.Series == "" || r.Type > Float64 || r.Kind > Input {
+				return nil, fmt.Errorf("%w: device %q register %d", ErrBadConfig, d.Name, r.Address)
+			}
+			if uint32(r.Address)+uint32(r.Type.words()) > 1<<16 {
+				return nil, fmt.Errorf("%w: device %q register %d out of range", ErrBadConfig, d.Name, r.Address)
+			}
+			dev.regs[i].Series = r.Series
+		}
+		dev.reads = planReads(d.Registers)
+		c.devices = append(c.devices, dev)
+	}
+	return c, nil
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Start 每台设备启动一个轮询协程
+func (c *Collector) Start() {
+	for _, d := range c.devices {
+		c.wg.Add(1)
+		go c.run(d)
+	}
+}
+
+// Stop 停止轮询并关闭所有连接，可以重复调用
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.wg.Wait()
+	for _, d := range c.devices {
+		d.mu.Lock()
+		d.closeConnLocked()
+		d.mu.Unlock()
+	}
+}
+
+// Status 所有设备的当前状态 (快照)
+func (c *Collector) Status() []DeviceStatus {
+	now := c.opts.Now()
+	result := make([]DeviceStatus, 0, len(c.devices))
+	for _, d := range c.devices {
+		d.mu.Lock()
+		st := DeviceStatus{
+			Name:        d.Name,
+			LastSuccess: d.lastSuccess,
+			LastError:   d.lastErr,
+			Registers:   append([]RegisterStatus(nil), d.regs...),
+		}
+		d.mu.Unlock()
+		for i := range st.Registers {
+			st.Registers[i].Stale = d.isStale(st.Registers[i], now)
+		}
+		result = append(result, st)
+	}
+	return result
+}
+
+// ==========================================
+// 🔒 轮询
+// ==========================================
+
+func (c *Collector) run(d *device) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.poll(d); err != nil && c.opts.OnError != nil {
+			c.opts.OnError(d.Name, err)
+		}
+		c.checkStale(d)
+
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll 读一轮并写入 DB；某一段读失败不影响其他段
+func (c *Collector) poll(d *device) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, rr := range d.reads {
+		if d.conn == nil {
+			cn, err := dial(d.Addr, d.Timeout)
+			if err != nil {
+				fail(err)
+				break // 连不上，本轮剩下的段也不用试了
+			}
+			d.conn = cn
+		}
+
+		function := byte(funcReadHolding)
+		if rr.kind == Input {
+			function = funcReadInput
+		}
+		words, err := d.conn.readRegisters(d.UnitID, function, rr.start, rr.quantity, d.Timeout)
+		if err != nil {
+			var exc *ExceptionError
+			if !errors.As(err, &exc) {
+				d.closeConnLocked() // 超时或断开：流里可能残留半帧，下次重连
+			}
+			fail(fmt.Errorf("read %d@%d: %w", rr.quantity, rr.start, err))
+			continue
+		}
+
+		now := c.opts.Now()
+		ts := now.UnixNano() / int64(c.opts.TimeUnit)
+		for _, i := range rr.regs {
+			r := d.Registers[i]
+			off := r.Address - rr.start
+			v := decode(words[off:off+r.Type.words()], r)
+			if err := c.db.Write(r.Series, ts, v); err != nil {
+				fail(fmt.Errorf("write %s: %w", r.Series, err))
+				continue
+			}
+			st := &d.regs[i]
+			if st.LastRead.IsZero() || st.Value != v {
+				st.LastChange = now
+			}
+			st.Value, st.LastRead = v, now
+		}
+	}
+
+	if firstErr == nil {
+		d.lastSuccess = c.opts.Now()
+	}
+	d.lastErr = firstErr
+	return firstErr
+}
+
+// checkStale 对新变陈旧的寄存器回调一次
+func (c *Collector) checkStale(d *device) {
+	if d.StaleAfter <= 0 || c.opts.OnStale == nil {
+		return
+	}
+	now := c.opts.Now()
+
+	type event struct {
+		series string
+		since  time.Time
+	}
+	var events []event
+
+	d.mu.Lock()
+	for i := range d.regs {
+		st := &d.regs[i]
+		stale := d.isStale(*st, now)
+		if stale && !st.Stale {
+			events = append(events, event{st.Series, st.LastRead})
+		}
+		st.Stale = stale
+	}
+	d.mu.Unlock()
+
+	for _, e := range events {
+		c.opts.OnStale(d.Name, e.series, e.since)
+	}
+}
+
+// isStale 从来没读到过的寄存器不算陈旧，那是连接问题，由 OnError 报告
+func (d *device) isStale(st RegisterStatus, now time.Time) bool {
+	return d.StaleAfter > 0 && !st.LastRead.IsZero() && now.Sub(st.LastRead) > d.StaleAfter
+}
+
+func (d *device) closeConnLocked() {
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+}
+
+// ==========================================
+// 🔧 读请求规划与解码
+// ==========================================
+
+// planReads 同类寄存器按地址排序，相邻或空隙很小的合并成一次读取 (不超过 125 个)
+func planReads(regs []Register) []readRange {
+	idx := make([]int, len(regs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool {
+		ra, rb := regs[idx[a]], regs[idx[b]]
+		if ra.Kind != rb.Kind {
+			return ra.Kind < rb.Kind
+		}
+		return ra.Address < rb.Address
+	})
+
+	var plans []readRange
+	for _, i := range idx {
+		r := regs[i]
+		end := uint32(r.Address) + uint32(r.Type.words()) // 不含
+		if n := len(plans); n > 0 {
+			last := &plans[n-1]
+			lastEnd := uint32(last.start) + uint32(last.quantity)
+			if last.kind == r.Kind && uint32(r.Address) <= lastEnd+mergeGap && end-uint32(last.start) <= maxReadQuantity {
+				if end > lastEnd {
+					last.quantity = uint16(end - uint32(last.start))
+				}
+				last.regs = append(last.regs, i)
+				continue
+			}
+		}
+		plans = append(plans, readRange{kind: r.Kind, start: r.Address, quantity: r.Type.words(), regs: []int{i}})
+	}
+	return plans
+}
+
+// decode 按字节序、字序把寄存器拼成数值，再做线性缩放
+func decode(words []uint16, r Register) float64 {
+	n := len(words)
+	buf := make([]byte, n*2)
+	for i, w := range words {
+		j := i
+		if r.WordOrder == LowWordFirst {
+			j = n - 1 - i
+		}
+		if r.ByteOrder == LittleEndian {
+			w = w<<8 | w>>8
+		}
+		binary.BigEndian.PutUint16(buf[j*2:], w)
+	}
+
+	var raw float64
+	switch r.Type {
+	case Uint16:
+		raw = float64(binary.BigEndian.Uint16(buf))
+	case Int16:
+		raw = float64(int16(binary.BigEndian.Uint16(buf)))
+	case Uint32:
+		raw = float64(binary.BigEndian.Uint32(buf))
+	case Int32:
+		raw = float64(int32(binary.BigEndian.Uint32(buf)))
+	case Float32:
+		raw = float64(math.Float32frombits(binary.BigEndian.Uint32(buf)))
+	case Uint64:
+		raw = float64(binary.BigEndian.Uint64(buf))
+	case Int64:
+		raw = float64(int64(binary.BigEndian.Uint64(buf)))
+	case Float64:
+		raw = math.Float64frombits(binary.BigEndian.Uint64(buf))
+	}
+
+	scale := r.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return raw*scale + r.Offset
+}
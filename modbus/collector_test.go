@@ -0,0 +1,414 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// simServer 进程内的 Modbus TCP 从站：按寄存器表回应 0x03 / 0x04
+type simServer struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	holding map[uint16]uint16
+	input   map[uint16]uint16
+	hang    bool // 收到请求后不回应，用来模拟超时
+	except  byte // 非 0 时回异常码
+
+	requests atomic.Int32
+}
+
+func startSim(t *testing.T) *simServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &simServer{ln: ln, holding: make(map[uint16]uint16), input: make(map[uint16]uint16)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *simServer) addr() string { return s.ln.Addr().String() }
+
+func (s *simServer) set(kind RegisterKind, addr uint16, words ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table := s.holding
+	if kind == Input {
+		table = s.input
+	}
+	for i, w := range words {
+		table[addr+uint16(i)] = w
+	}
+}
+
+func (s *simServer) serve(c net.Conn) {
+	defer c.Close()
+	for {
+		req := make([]byte, mbapHeaderSize+5)
+		if _, err := io.ReadFull(c, req); err != nil {
+			return
+		}
+		s.requests.Add(1)
+		function := req[7]
+		start := binary.BigEndian.Uint16(req[8:10])
+		quantity := binary.BigEndian.Uint16(req[10:12])
+
+		s.mu.Lock()
+		hang, except := s.hang, s.except
+		var pdu []byte
+		switch {
+		case except != 0:
+			pdu = []byte{function | 0x80, except}
+		default:
+			table := s.holding
+			if function == funcReadInput {
+				table = s.input
+			}
+			pdu = []byte{function, byte(quantity * 2)}
+			for i := uint16(0); i < quantity; i++ {
+				pdu = binary.BigEndian.AppendUint16(pdu, table[start+i])
+			}
+		}
+		s.mu.Unlock()
+		if hang {
+			continue
+		}
+
+		resp := make([]byte, mbapHeaderSize, mbapHeaderSize+len(pdu))
+		copy(resp, req[0:4])
+		binary.BigEndian.PutUint16(resp[4:6], uint16(len(pdu)+1))
+		resp[6] = req[6]
+		if _, err := c.Write(append(resp, pdu...)); err != nil {
+			return
+		}
+	}
+}
+
+func newTestDB(t *testing.T) *tcore.DB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestDecode(t *testing.T) {
+	f32 := math.Float32bits(21.5)
+	hi, lo := uint16(f32>>16), uint16(f32)
+	swap := func(w uint16) uint16 { return w<<8 | w>>8 }
+
+	cases := []struct {
+		name  string
+		words []uint16
+		reg   Register
+		want  float64
+	}{
+		{"uint16", []uint16{1234}, Register{Type: Uint16}, 1234},
+		{"int16", []uint16{0xFFFE}, Register{Type: Int16}, -2},
+		{"int16 scaled", []uint16{0xFF38}, Register{Type: Int16, Scale: 0.1, Offset: 100}, 80},
+		{"uint32 ABCD", []uint16{0x0001, 0x0002}, Register{Type: Uint32}, 65538},
+		{"uint32 CDAB", []uint16{0x0002, 0x0001}, Register{Type: Uint32, WordOrder: LowWordFirst}, 65538},
+		{"int32", []uint16{0xFFFF, 0xFFFF}, Register{Type: Int32}, -1},
+		{"float32 ABCD", []uint16{hi, lo}, Register{Type: Float32}, 21.5},
+		{"float32 CDAB", []uint16{lo, hi}, Register{Type: Float32, WordOrder: LowWordFirst}, 21.5},
+		{"float32 BADC", []uint16{swap(hi), swap(lo)}, Register{Type: Float32, ByteOrder: LittleEndian}, 21.5},
+		{"float32 DCBA", []uint16{swap(lo), swap(hi)}, Register{Type: Float32, ByteOrder: LittleEndian, WordOrder: LowWordFirst}, 21.5},
+		{"int64", []uint16{0xFFFF, 0xFFFF, 0xFFFF, 0xFFF6}, Register{Type: Int64}, -10},
+		{"float64", []uint16{0x4059, 0, 0, 0}, Register{Type: Float64, Scale: 2}, 200},
+	}
+	for _, tc := range cases {
+		if got := decode(tc.words, tc.reg); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPlanReads(t *testing.T) {
+	plans := planReads([]Register{
+		{Series: "a", Kind: Holding, Address: 10, Type: Float32},
+		{Series: "b", Kind: Input, Address: 0, Type: Uint16},
+		{Series: "c", Kind: Holding, Address: 0, Type: Uint16},
+		{Series: "d", Kind: Holding, Address: 100, Type: Uint16}, // 空隙太大，单独一次
+		{Series: "e", Kind: Holding, Address: 4, Type: Int32},
+	})
+	want := []readRange{
+		{kind: Holding, start: 0, quantity: 12, regs: []int{2, 4, 0}},
+		{kind: Holding, start: 100, quantity: 1, regs: []int{3}},
+		{kind: Input, start: 0, quantity: 1, regs: []int{1}},
+	}
+	if len(plans) != len(want) {
+		t.Fatalf("plans: %+v", plans)
+	}
+	for i := range want {
+		p, w := plans[i], want[i]
+		if p.kind != w.kind || p.start != w.start || p.quantity != w.quantity || len(p.regs) != len(w.regs) {
+			t.Fatalf("plan %d: got %+v, want %+v", i, p, w)
+		}
+		for j := range w.regs {
+			if p.regs[j] != w.regs[j] {
+				t.Fatalf("plan %d: got %+v, want %+v", i, p, w)
+			}
+		}
+	}
+
+	// 一次最多 125 个寄存器
+	long := planReads([]Register{
+		{Series: "x", Address: 0, Type: Uint16},
+		{Series: "y", Address: 124, Type: Uint32},
+	})
+	if len(long) != 2 {
+		t.Fatalf("expected the read to be split, got %+v", long)
+	}
+}
+
+func TestCollector_PollWritesScaledValues(t *testing.T) {
+	sim := startSim(t)
+	f32 := math.Float32bits(21.5)
+	sim.set(Holding, 0, 215)                          // 温度 * 10
+	sim.set(Holding, 2, uint16(f32), uint16(f32>>16)) // CDAB 浮点
+	sim.set(Input, 7, 0xFF9C)                         // -100
+	db := newTestDB(t)
+
+	now := time.UnixMilli(1000)
+	c, err := NewCollector(db, []Device{{
+		Name: "plc1",
+		Addr: sim.addr(),
+		Registers: []Register{
+			{Series: "line1.temp", Address: 0, Type: Uint16, Scale: 0.1},
+			{Series: "line1.flow", Address: 2, Type: Float32, WordOrder: LowWordFirst},
+			{Series: "line1.pressure", Kind: Input, Address: 7, Type: Int16, Scale: 0.5, Offset: 1},
+		},
+	}}, WithTimeUnit(time.Millisecond), WithNow(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.poll(c.devices[0]); err != nil {
+		t.Fatal(err)
+	}
+	if n := sim.requests.Load(); n != 2 {
+		t.Fatalf("expected holding registers to be read in one request, got %d requests", n)
+	}
+
+	want := map[string]float64{"line1.temp": 21.5, "line1.flow": 21.5, "line1.pressure": -49}
+	for series, v := range want {
+		pts, err := db.Query(series, 0, 2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pts) != 1 || pts[0].Value != v || pts[0].Time != 1000 {
+			t.Fatalf("%s: got %+v, want %v@1000", series, pts, v)
+		}
+	}
+
+	st := c.Status()[0]
+	if st.LastError != nil || !st.LastSuccess.Equal(now) || st.Registers[0].Value != 21.5 {
+		t.Fatalf("status: %+v", st)
+	}
+	c.Stop()
+}
+
+func TestCollector_TimeoutAndException(t *testing.T) {
+	sim := startSim(t)
+	sim.set(Holding, 0, 1)
+	db := newTestDB(t)
+	c, err := NewCollector(db, []Device{{
+		Name:      "plc1",
+		Addr:      sim.addr(),
+		Timeout:   50 * time.Millisecond,
+		Registers: []Register{{Series: "v", Address: 0, Type: Uint16}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	d := c.devices[0]
+
+	sim.mu.Lock()
+	sim.hang = true
+	sim.mu.Unlock()
+	start := time.Now()
+	err = c.poll(d)
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("poll took %v, timeout not honoured", elapsed)
+	}
+	if d.conn != nil {
+		t.Fatal("connection should be dropped after a timeout")
+	}
+
+	sim.mu.Lock()
+	sim.hang, sim.except = false, 2
+	sim.mu.Unlock()
+	err = c.poll(d)
+	var exc *ExceptionError
+	if !errors.As(err, &exc) || exc.Code != 2 || exc.Function != funcReadHolding {
+		t.Fatalf("expected exception 2, got %v", err)
+	}
+	if d.conn == nil {
+		t.Fatal("an exception response should keep the connection")
+	}
+
+	// 设备恢复后自动重连
+	sim.mu.Lock()
+	sim.except = 0
+	sim.mu.Unlock()
+	if err := c.poll(d); err != nil {
+		t.Fatal(err)
+	}
+	if pts, _ := db.Query("v", 0, math.MaxInt64); len(pts) != 1 {
+		t.Fatalf("got %+v", pts)
+	}
+}
+
+func TestCollector_StaleDetection(t *testing.T) {
+	sim := startSim(t)
+	sim.set(Holding, 0, 1)
+	sim.set(Holding, 1, 7)
+	db := newTestDB(t)
+
+	var mu sync.Mutex
+	now := time.Unix(100, 0)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+	var stale []string
+	var since []time.Time
+	c, err := NewCollector(db, []Device{{
+		Name:       "plc1",
+		Addr:       sim.addr(),
+		StaleAfter: 10 * time.Second,
+		Registers: []Register{
+			{Series: "counter", Address: 0, Type: Uint16},
+			{Series: "frozen", Address: 1, Type: Uint16},
+		},
+	}}, WithNow(clock), WithStaleHandler(func(device, series string, lastRead time.Time) {
+		stale = append(stale, device+"/"+series)
+		since = append(since, lastRead)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+	d := c.devices[0]
+
+	tick := func(counter uint16) error {
+		sim.set(Holding, 0, counter)
+		err := c.poll(d)
+		c.checkStale(d)
+		advance(6 * time.Second)
+		return err
+	}
+	for i := uint16(1); i <= 3; i++ {
+		if err := tick(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// frozen 已经 12 秒没变，但一直读得到：不算陈旧
+	if len(stale) != 0 {
+		t.Fatalf("stale events: %v", stale)
+	}
+	lastRead := clock().Add(-6 * time.Second)
+
+	// 从站开始回异常：超过 StaleAfter 没读成功，两个寄存器都陈旧，只报一次
+	sim.mu.Lock()
+	sim.except = 2
+	sim.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if err := tick(4); err == nil {
+			t.Fatal("expected a read error")
+		}
+	}
+	if len(stale) != 2 || !since[0].Equal(lastRead) || !since[1].Equal(lastRead) {
+		t.Fatalf("stale events: %v %v", stale, since)
+	}
+	for _, r := range c.Status()[0].Registers {
+		if !r.Stale {
+			t.Fatalf("%s should be stale", r.Series)
+		}
+	}
+
+	// 恢复读取后解除陈旧，再次失败时重新回调
+	sim.mu.Lock()
+	sim.except = 0
+	sim.mu.Unlock()
+	if err := tick(5); err != nil {
+		t.Fatal(err)
+	}
+	if st := c.Status()[0]; st.Registers[0].Stale || st.Registers[1].Stale {
+		t.Fatalf("status: %+v", st.Registers)
+	}
+	sim.ln.Close()
+	d.mu.Lock()
+	d.closeConnLocked()
+	d.mu.Unlock()
+	advance(10 * time.Second)
+	if err := tick(6); err == nil {
+		t.Fatal("expected a dial error")
+	}
+	if len(stale) != 4 {
+		t.Fatalf("stale events: %v", stale)
+	}
+}
+
+func TestCollector_StartStop(t *testing.T) {
+	sim := startSim(t)
+	sim.set(Holding, 0, 42)
+	db := newTestDB(t)
+	c, err := NewCollector(db, []Device{{
+		Name:      "plc1",
+		Addr:      sim.addr(),
+		Interval:  10 * time.Millisecond,
+		Registers: []Register{{Series: "v", Address: 0, Type: Uint16}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	deadline := time.Now().Add(2 * time.Second)
+	for sim.requests.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Stop()
+	c.Stop() // 重复调用无害
+	if sim.requests.Load() < 3 {
+		t.Fatal("collector did not poll periodically")
+	}
+
+	if _, err := NewCollector(db, []Device{{Name: "x", Addr: sim.addr()}}); !errors.Is(err, ErrBadConfig) {
+		t.Fatalf("expected ErrBadConfig, got %v", err)
+	}
+}
@@ -0,0 +1,407 @@
+// Package mqtt 把 MQTT 上报的读数写进 tcore
+//
+// Bridge 按规则订阅主题，用主题模板从主题里取出变量 (站点、设备、指标……)，
+// 再用名字模板拼出时间线名字，负载可以是裸数字，也可以是 JSON。
+// 只有写入成功之后才 Ack 消息：写入暂时失败时不 Ack，由 broker 重发 (QoS 1/2)。
+//
+// Client / Message 接口与 paho.mqtt.golang 的同名方法一致，PahoClient 是基于 paho 的实现
+// (关闭自动 Ack、重连后重新订阅)；测试或其他客户端库可以自己实现 Client。
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/prom"
+)
+
+var ErrBadPayload = errors.New("bad payload")
+
+// Message 一条收到的 MQTT 消息
+type Message interface {
+	Topic() string
+	Payload() []byte
+	Qos() byte
+	Ack()
+}
+
+// Client Bridge 依赖的 MQTT 客户端能力
+type Client interface {
+	Subscribe(filter string, qos byte, handler func(Message)) error
+	Unsubscribe(filters ...string) error
+}
+
+// Writer 是 Bridge 依赖的存储能力，*tcore.DB 天然满足
+type Writer interface {
+	Write(sensorID string, timestamp int64, value float64) error
+}
+
+// 负载格式
+const (
+	FormatAuto = ""     // 以 { 或 [ 开头按 JSON 解析，否则按裸数字解析
+	FormatJSON = "json" // JSON 数字、布尔或对象
+	FormatRaw  = "raw"  // 裸数字或 true / false
+)
+
+// Rule 一条订阅规则
+//
+//	Rule{
+//		Topic:  "factory/{site}/{device}/{metric}",
+//		Series: "{metric}",
+//		Labels: map[string]string{"site": "{site}", "device": "{device}"},
+//	}
+//
+// 上面的规则把 factory/sh/pump1/temp 写进时间线 temp{device="pump1",site="sh"}，
+// 名字格式与 Prometheus remote_read 使用的一致。
+// 名字模板里除了主题变量，还可以使用 {topic} (完整主题) 和 {field} (AllFields 模式下的字段名)。
+type Rule struct {
+	Topic  string            // 主题模板，见 topicPattern
+	Series string            // 时间线名字模板
+	Labels map[string]string // 标签模板，可选
+	QoS    byte              // 订阅的 QoS；需要写入失败后重发时用 1 或 2
+
+	Format     string // FormatAuto / FormatJSON / FormatRaw
+	ValueField string // JSON 对象里数值字段的名字，默认 "value"
+	TimeField  string // JSON 对象里时间戳字段的名字，默认 "time"；缺失时使用收到消息的时间
+	AllFields  bool   // JSON 对象里每个数值字段各写一条时间线，名字模板里用 {field} 区分
+}
+
+// Options Bridge 配置
+type Options struct {
+	OnError  func(topic string, err error) // 丢弃消息或暂时写入失败时回调
+	Now      func() time.Time              // 负载里没有时间戳时使用
+	TimeUnit time.Duration                 // DB 里时间戳的单位，负载里的时间戳也按这个单位解释
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithErrorHandler 设置出错回调
+func WithErrorHandler(fn func(topic string, err error)) Option {
+	return func(opts *Options) {
+		opts.OnError = fn
+	}
+}
+
+// WithNow 设置时钟 (测试用)
+func WithNow(now func() time.Time) Option {
+	return func(opts *Options) {
+		opts.Now = now
+	}
+}
+
+// WithTimeUnit 设置时间戳单位，默认纳秒
+func WithTimeUnit(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.TimeUnit = d
+	}
+}
+
+// Bridge MQTT -> DB 的桥
+type Bridge struct {
+	db     Writer
+	client Client
+	rules  []*rule
+	opts   Options
+
+	mu         sync.Mutex
+	subscribed []string
+}
+
+// rule 编译后的规则
+type rule struct {
+	Rule
+	topic      *topicPattern
+	series     *nameTemplate
+	labelNames []string // 排序后的标签名
+	labels     map[string]*nameTemplate
+}
+
+// NewBridge 编译规则；模板有误时直接报错，不会等到收到消息才发现
+func NewBridge(db Writer, client Client, rules []Rule, options ...Option) (*Bridge, error) {
+	opts := Options{Now: time.Now, TimeUnit: time.Nanosecond}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	b := &Bridge{db: db, client: client, opts: opts}
+	for _, r := range rules {
+		cr, err := compileRule(r)
+		if err != nil {
+			return nil, err
+		}
+		b.rules = append(b.rules, cr)
+	}
+	return b, nil
+}
+
+func compileRule(r Rule) (*rule, error) {
+	if r.ValueField == "" {
+		r.ValueField = "value"
+	}
+	if r.TimeField == "" {
+		r.TimeField = "time"
+	}
+	switch r.Format {
+	case FormatAuto, FormatJSON, FormatRaw:
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrBadTemplate, r.Format)
+	}
+
+	topic, err := compileTopic(r.Topic)
+	if err != nil {
+		return nil, err
+	}
+	cr := &rule{Rule: r, topic: topic, labels: make(map[string]*nameTemplate)}
+	known := topic.names()
+
+	if cr.series, err = compileName(r.Series, known); err != nil {
+		return nil, err
+	}
+	if r.Series == "" {
+		return nil, fmt.Errorf("%w: empty series template for %q", ErrBadTemplate, r.Topic)
+	}
+	for name, tmpl := range r.Labels {
+		if cr.labels[name], err = compileName(tmpl, known); err != nil {
+			return nil, err
+		}
+		cr.labelNames = append(cr.labelNames, name)
+	}
+	sort.Strings(cr.labelNames)
+
+	// 多个字段写进同一条时间线会互相覆盖
+	if r.AllFields && !cr.series.uses("field") {
+		used := false
+		for _, t := range cr.labels {
+			used = used || t.uses("field")
+		}
+		if !used {
+			return nil, fmt.Errorf("%w: AllFields requires {field} in series or labels of %q", ErrBadTemplate, r.Topic)
+		}
+	}
+	return cr, nil
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Start 订阅所有规则；任何一条失败时撤销已经成功的订阅
+func (b *Bridge) Start() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, r := range b.rules {
+		r := r
+		if err := b.client.Subscribe(r.topic.filter, r.QoS, func(msg Message) { b.handle(r, msg) }); err != nil {
+			if len(b.subscribed) > 0 {
+				b.client.Unsubscribe(b.subscribed...)
+			}
+			b.subscribed = nil
+			return fmt.Errorf("subscribe %s: %w", r.topic.filter, err)
+		}
+		b.subscribed = append(b.subscribed, r.topic.filter)
+	}
+	return nil
+}
+
+// Stop 取消所有订阅
+func (b *Bridge) Stop() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subscribed) == 0 {
+		return nil
+	}
+	err := b.client.Unsubscribe(b.subscribed...)
+	b.subscribed = nil
+	return err
+}
+
+// ==========================================
+// 🔒 消息处理
+// ==========================================
+
+// reading 负载里解析出的一个读数
+type reading struct {
+	field string
+	time  int64
+	value float64
+}
+
+// handle 解析并写入一条消息
+// 坏负载和永久性的写入错误 (类型冲突) 重发也不会成功，Ack 掉并回调；
+// 其他写入错误不 Ack，等 broker 重发 (重发造成的重复点由 Compaction 去重)
+func (b *Bridge) handle(r *rule, msg Message) {
+	vars, ok := r.topic.match(msg.Topic())
+	if !ok {
+		msg.Ack() // 另一条规则的订阅收到的消息，与本规则无关
+		return
+	}
+	vars["topic"] = msg.Topic()
+
+	now := b.opts.Now().UnixNano() / int64(b.opts.TimeUnit)
+	readings, err := r.parse(msg.Payload(), now)
+	if err != nil {
+		b.report(msg.Topic(), err)
+		msg.Ack()
+		return
+	}
+
+	for _, rd := range readings {
+		vars["field"] = rd.field
+		key := r.key(vars)
+		if err := b.db.Write(key, rd.time, rd.value); err != nil {
+			b.report(msg.Topic(), fmt.Errorf("write %s: %w", key, err))
+			if errors.Is(err, tcore.ErrTypeMismatch) {
+				continue
+			}
+			return
+		}
+	}
+	msg.Ack()
+}
+
+func (b *Bridge) report(topic string, err error) {
+	if b.opts.OnError != nil {
+		b.opts.OnError(topic, err)
+	}
+}
+
+// key 展开名字模板；有标签时生成 metric{label="v"} 形式的名字
+func (r *rule) key(vars map[string]string) string {
+	name := r.series.expand(vars)
+	if len(r.labelNames) == 0 {
+		return name
+	}
+	labels := []prom.Label{{Name: "__name__", Value: name}}
+	for _, ln := range r.labelNames {
+		labels = append(labels, prom.Label{Name: ln, Value: r.labels[ln].expand(vars)})
+	}
+	return prom.SeriesKey(labels)
+}
+
+func (r *rule) parse(payload []byte, now int64) ([]reading, error) {
+	trimmed := bytes.TrimSpace(payload)
+	format := r.Format
+	if format == FormatAuto {
+		format = FormatRaw
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			format = FormatJSON
+		}
+	}
+
+	if format == FormatRaw {
+		v, err := parseScalar(string(trimmed))
+		if err != nil {
+			return nil, err
+		}
+		return []reading{{time: now, value: v}}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadPayload, err)
+	}
+
+	obj, isObj := doc.(map[string]any)
+	if !isObj {
+		v, err := jsonNumber(doc)
+		if err != nil {
+			return nil, err
+		}
+		return []reading{{time: now, value: v}}, nil
+	}
+
+	ts := now
+	if raw, ok := obj[r.TimeField]; ok {
+		n, ok := raw.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not a number", ErrBadPayload, r.TimeField)
+		}
+		if ts, ok = jsonInt(n); !ok {
+			return nil, fmt.Errorf("%w: bad %s %s", ErrBadPayload, r.TimeField, n)
+		}
+	}
+
+	if !r.AllFields {
+		raw, ok := obj[r.ValueField]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing field %q", ErrBadPayload, r.ValueField)
+		}
+		v, err := jsonNumber(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []reading{{time: ts, value: v}}, nil
+	}
+
+	// AllFields：按字段名排序，写入顺序稳定；非数值字段 (例如设备型号字符串) 跳过
+	var fields []string
+	for k := range obj {
+		if k != r.TimeField {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	var readings []reading
+	for _, f := range fields {
+		if v, err := jsonNumber(obj[f]); err == nil {
+			readings = append(readings, reading{field: f, time: ts, value: v})
+		}
+	}
+	if len(readings) == 0 {
+		return nil, fmt.Errorf("%w: no numeric fields", ErrBadPayload)
+	}
+	return readings, nil
+}
+
+// parseScalar 裸数字，或 true / false (记为 1 / 0)
+func parseScalar(s string) (float64, error) {
+	switch s {
+	case "true":
+		return 1, nil
+	case "false":
+		return 0, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("%w: %q is not a number", ErrBadPayload, s)
+	}
+	return v, nil
+}
+
+func jsonNumber(v any) (float64, error) {
+	switch x := v.(type) {
+	case json.Number:
+		return x.Float64()
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%w: %v is not a number", ErrBadPayload, v)
+}
+
+// jsonInt 时间戳可能写成 1.7e12 这种浮点形式
+func jsonInt(n json.Number) (int64, bool) {
+	if i, err := n.Int64(); err == nil {
+		return i, true
+	}
+	f, err := n.Float64()
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
@@ -0,0 +1,208 @@
+package mqtt
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// fakeBroker 进程内的 broker 替身：按过滤器把消息同步投递给订阅者，并记录哪些消息被 Ack
+type fakeBroker struct {
+	mu   sync.Mutex
+	subs map[string]func(Message)
+}
+
+type fakeMessage struct {
+	topic   string
+	payload []byte
+	acked   bool
+}
+
+func (m *fakeMessage) Topic() string   { return m.topic }
+func (m *fakeMessage) Payload() []byte { return m.payload }
+func (m *fakeMessage) Qos() byte       { return 1 }
+func (m *fakeMessage) Ack()            { m.acked = true }
+
+func (b *fakeBroker) Subscribe(filter string, qos byte, handler func(Message)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[string]func(Message))
+	}
+	b.subs[filter] = handler
+	return nil
+}
+
+func (b *fakeBroker) Unsubscribe(filters ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, f := range filters {
+		delete(b.subs, f)
+	}
+	return nil
+}
+
+func (b *fakeBroker) publish(topic, payload string) *fakeMessage {
+	msg := &fakeMessage{topic: topic, payload: []byte(payload)}
+	b.mu.Lock()
+	var handlers []func(Message)
+	for filter, h := range b.subs {
+		if filterMatches(filter, topic) {
+			handlers = append(handlers, h)
+		}
+	}
+	b.mu.Unlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+	return msg
+}
+
+func filterMatches(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, seg := range f {
+		if seg == "#" {
+			return true
+		}
+		if i >= len(t) || (seg != "+" && seg != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// flakyWriter 前 n 次写入返回暂时性错误
+type flakyWriter struct {
+	Writer
+	failures int
+}
+
+func (w *flakyWriter) Write(sensorID string, timestamp int64, value float64) error {
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("disk busy")
+	}
+	return w.Writer.Write(sensorID, timestamp, value)
+}
+
+func newTestDB(t *testing.T) *tcore.DB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestBridge_TopicMappingAndPayloads(t *testing.T) {
+	db := newTestDB(t)
+	broker := &fakeBroker{}
+	var errs []error
+	bridge, err := NewBridge(db, broker, []Rule{
+		{
+			Topic:  "factory/{site}/{device}/{metric}",
+			Series: "{metric}",
+			Labels: map[string]string{"site": "{site}", "device": "{device}"},
+			QoS:    1,
+		},
+		{
+			Topic:     "env/{room}/#",
+			Series:    "env_{field}",
+			Labels:    map[string]string{"room": "{room}"},
+			Format:    FormatJSON,
+			AllFields: true,
+		},
+	},
+		WithTimeUnit(time.Millisecond),
+		WithNow(func() time.Time { return time.UnixMilli(5000) }),
+		WithErrorHandler(func(topic string, err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bridge.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer bridge.Stop()
+
+	msgs := []*fakeMessage{
+		broker.publish("factory/sh/pump1/temp", "21.5"),
+		broker.publish("factory/sh/pump1/temp", `{"value": 22, "time": 6000}`),
+		broker.publish("env/lab/sensor/3", `{"temp": 20.5, "hum": 40, "online": true, "model": "x1", "time": 7000}`),
+	}
+	for i, m := range msgs {
+		if !m.acked {
+			t.Errorf("message %d was not acked", i)
+		}
+	}
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	points, _ := db.Query(`temp{device="pump1",site="sh"}`, 0, 10000)
+	if len(points) != 2 || points[0].Time != 5000 || points[1].Time != 6000 || points[1].Value != 22 {
+		t.Fatalf("unexpected pump points %+v", points)
+	}
+	for name, want := range map[string]float64{
+		`env_temp{room="lab"}`:   20.5,
+		`env_hum{room="lab"}`:    40,
+		`env_online{room="lab"}`: 1,
+	} {
+		points, _ := db.Query(name, 0, 10000)
+		if len(points) != 1 || points[0].Value != want || points[0].Time != 7000 {
+			t.Errorf("%s: unexpected points %+v", name, points)
+		}
+	}
+}
+
+func TestBridge_AckOnlyAfterWrite(t *testing.T) {
+	db := newTestDB(t)
+	broker := &fakeBroker{}
+	writer := &flakyWriter{Writer: db, failures: 1}
+	var errs []error
+	bridge, _ := NewBridge(writer, broker, []Rule{{Topic: "s/{id}", Series: "sensor_{id}", QoS: 1}},
+		WithErrorHandler(func(topic string, err error) { errs = append(errs, err) }))
+	bridge.Start()
+
+	// 暂时性写入失败：不 Ack，等 broker 重发
+	if msg := broker.publish("s/1", "1"); msg.acked {
+		t.Fatal("message must not be acked when the write failed")
+	}
+	if msg := broker.publish("s/1", "1"); !msg.acked {
+		t.Fatal("redelivered message should be acked after a successful write")
+	}
+
+	// 坏负载重发也没用：Ack 掉并报告
+	msg := broker.publish("s/1", "not-a-number")
+	if !msg.acked || len(errs) != 2 || !errors.Is(errs[1], ErrBadPayload) {
+		t.Fatalf("bad payload: acked=%v errs=%v", msg.acked, errs)
+	}
+
+	bridge.Stop()
+	if len(broker.subs) != 0 {
+		t.Errorf("expected all subscriptions to be removed, got %v", broker.subs)
+	}
+}
+
+func TestCompileRule_Errors(t *testing.T) {
+	for _, r := range []Rule{
+		{Topic: "a/#/b", Series: "x"},
+		{Topic: "a/{id}", Series: "{nope}"},
+		{Topic: "a/{id}/{id}", Series: "x"},
+		{Topic: "a/b+", Series: "x"},
+		{Topic: "a/{topic}", Series: "x"},
+		{Topic: "a/{id}", Series: ""},
+		{Topic: "a/{id}", Series: "x", AllFields: true},
+		{Topic: "a/{id}", Series: "x", Format: "xml"},
+	} {
+		if _, err := compileRule(r); !errors.Is(err, ErrBadTemplate) {
+			t.Errorf("%+v: expected ErrBadTemplate, got %v", r, err)
+		}
+	}
+}
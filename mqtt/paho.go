@@ -0,0 +1,123 @@
+package mqtt
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+var ErrTimeout = errors.New("mqtt: timed out waiting for broker")
+
+// PahoClient 基于 paho.mqtt.golang 的 Client
+//
+// 自动 Ack 被关闭，由 Bridge 在写入成功后 Ack。
+// 断线后 paho 自动重连，重连成功时把当前所有订阅重新发一遍：
+// CleanSession 为 true (paho 的默认值) 时 broker 不会保留订阅，不重发就再也收不到消息。
+type PahoClient struct {
+	c       paho.Client
+	timeout time.Duration
+	onError func(filter string, err error)
+
+	mu        sync.Mutex
+	subs      map[string]pahoSub // filter -> 订阅
+	connected bool               // 第一次连上之后为 true，之后的 OnConnect 都是重连
+}
+
+type pahoSub struct {
+	qos     byte
+	handler func(Message)
+}
+
+// NewPahoClient 按 opts 连接 broker，opts 里已有的 OnConnect 回调照常调用
+// onError 在重连后重新订阅失败时回调，可以为 nil
+func NewPahoClient(opts *paho.ClientOptions, onError func(filter string, err error)) (*PahoClient, error) {
+	pc := &PahoClient{
+		timeout: opts.ConnectTimeout,
+		onError: onError,
+		subs:    make(map[string]pahoSub),
+	}
+	if pc.timeout <= 0 {
+		pc.timeout = 30 * time.Second
+	}
+
+	userOnConnect := opts.OnConnect
+	opts.SetAutoAckDisabled(true)
+	opts.SetOnConnectHandler(func(c paho.Client) {
+		pc.resubscribe()
+		if userOnConnect != nil {
+			userOnConnect(c)
+		}
+	})
+
+	pc.c = paho.NewClient(opts)
+	if err := pc.wait(pc.c.Connect()); err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
+
+// Subscribe 订阅 filter，broker 确认之后才返回
+func (pc *PahoClient) Subscribe(filter string, qos byte, handler func(Message)) error {
+	pc.mu.Lock()
+	pc.subs[filter] = pahoSub{qos: qos, handler: handler}
+	pc.mu.Unlock()
+
+	if err := pc.wait(pc.c.Subscribe(filter, qos, wrapHandler(handler))); err != nil {
+		pc.mu.Lock()
+		delete(pc.subs, filter)
+		pc.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Unsubscribe 取消订阅；之后重连也不会再订阅它们
+func (pc *PahoClient) Unsubscribe(filters ...string) error {
+	pc.mu.Lock()
+	for _, f := range filters {
+		delete(pc.subs, f)
+	}
+	pc.mu.Unlock()
+	return pc.wait(pc.c.Unsubscribe(filters...))
+}
+
+// Close 断开连接，最多等 quiesce 让正在处理的消息收尾
+func (pc *PahoClient) Close(quiesce time.Duration) {
+	pc.c.Disconnect(uint(quiesce / time.Millisecond))
+}
+
+// resubscribe 重连后重新发送所有订阅 (paho 在自己的协程里调用 OnConnect，这里可以阻塞等待)
+// 第一次连上时跳过：这时的订阅都由 Subscribe 自己发出，再发一遍就重复了
+func (pc *PahoClient) resubscribe() {
+	pc.mu.Lock()
+	if !pc.connected {
+		pc.connected = true
+		pc.mu.Unlock()
+		return
+	}
+	subs := make(map[string]pahoSub, len(pc.subs))
+	for f, s := range pc.subs {
+		subs[f] = s
+	}
+	pc.mu.Unlock()
+
+	for filter, s := range subs {
+		if err := pc.wait(pc.c.Subscribe(filter, s.qos, wrapHandler(s.handler))); err != nil && pc.onError != nil {
+			pc.onError(filter, err)
+		}
+	}
+}
+
+func (pc *PahoClient) wait(tok paho.Token) error {
+	if !tok.WaitTimeout(pc.timeout) {
+		return ErrTimeout
+	}
+	return tok.Error()
+}
+
+// wrapHandler paho.Message 本身就满足 Message
+func wrapHandler(handler func(Message)) paho.MessageHandler {
+	return func(_ paho.Client, msg paho.Message) { handler(msg) }
+}
@@ -0,0 +1,203 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// wireBroker 说 MQTT 3.1.1 线协议的最小 broker：只有一个客户端连接，记录订阅和 PUBACK，可以主动踢掉连接
+type wireBroker struct {
+	l net.Listener
+
+	mu         sync.Mutex
+	conn       net.Conn
+	subscribes int             // 收到的 SUBSCRIBE 次数
+	acked      map[uint16]bool // 收到 PUBACK 的报文 ID
+}
+
+func newWireBroker(t *testing.T) *wireBroker {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &wireBroker{l: l, acked: make(map[uint16]bool)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conn = conn
+			b.mu.Unlock()
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		l.Close()
+		b.kick()
+	})
+	return b
+}
+
+func (b *wireBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		typ, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch typ >> 4 {
+		case 1: // CONNECT -> CONNACK
+			b.send(conn, 0x20, []byte{0, 0})
+		case 4: // PUBACK
+			b.mu.Lock()
+			b.acked[binary.BigEndian.Uint16(body)] = true
+			b.mu.Unlock()
+		case 8: // SUBSCRIBE -> SUBACK，每个过滤器都按请求的 QoS 授予
+			var granted []byte
+			for p := 2; p < len(body); {
+				n := int(binary.BigEndian.Uint16(body[p:]))
+				granted = append(granted, body[p+2+n])
+				p += 2 + n + 1
+			}
+			b.mu.Lock()
+			b.subscribes++
+			b.mu.Unlock()
+			b.send(conn, 0x90, append(body[:2:2], granted...))
+		case 10: // UNSUBSCRIBE -> UNSUBACK
+			b.send(conn, 0xB0, body[:2])
+		case 12: // PINGREQ -> PINGRESP
+			b.send(conn, 0xD0, nil)
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := binary.ReadUvarint(r) // 剩余长度的变长编码与 uvarint 相同
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return typ, body, err
+}
+
+func (b *wireBroker) send(conn net.Conn, typ byte, body []byte) {
+	pkt := binary.AppendUvarint([]byte{typ}, uint64(len(body)))
+	conn.Write(append(pkt, body...))
+}
+
+// publish 以 QoS 1 投递一条消息，dup 表示重发
+func (b *wireBroker) publish(id uint16, topic, payload string, dup bool) {
+	body := binary.BigEndian.AppendUint16(nil, uint16(len(topic)))
+	body = append(body, topic...)
+	body = binary.BigEndian.AppendUint16(body, id)
+	body = append(body, payload...)
+	typ := byte(0x32)
+	if dup {
+		typ |= 0x08
+	}
+	b.mu.Lock()
+	conn := b.conn
+	b.mu.Unlock()
+	b.send(conn, typ, body)
+}
+
+func (b *wireBroker) kick() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+}
+
+func (b *wireBroker) state() (subscribes int, acked map[uint16]bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	acked = make(map[uint16]bool, len(b.acked))
+	for id := range b.acked {
+		acked[id] = true
+	}
+	return b.subscribes, acked
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPahoClient_AckAfterWriteAndResubscribe(t *testing.T) {
+	broker := newWireBroker(t)
+	client, err := NewPahoClient(paho.NewClientOptions().
+		AddBroker("tcp://"+broker.l.Addr().String()).
+		SetClientID("tcore-test").
+		SetMaxReconnectInterval(50*time.Millisecond).
+		SetConnectTimeout(2*time.Second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(0)
+
+	db := newTestDB(t)
+	bridge, err := NewBridge(&flakyWriter{Writer: db, failures: 1}, client, []Rule{
+		{Topic: "plant/{metric}", Series: "{metric}", QoS: 1},
+	}, WithTimeUnit(time.Millisecond), WithNow(func() time.Time { return time.UnixMilli(1000) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bridge.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一次写入失败：不发 PUBACK；broker 重发后写入成功才 Ack
+	broker.publish(1, "plant/temp", "21.5", false)
+	time.Sleep(50 * time.Millisecond)
+	if _, acked := broker.state(); acked[1] {
+		t.Fatal("message must not be acked before it is written")
+	}
+	broker.publish(1, "plant/temp", "21.5", true)
+	waitFor(t, "PUBACK", func() bool { _, acked := broker.state(); return acked[1] })
+
+	// 连接断开：paho 自动重连，订阅被重新发给 broker，之后的消息照常写入
+	before, _ := broker.state()
+	broker.kick()
+	waitFor(t, "resubscription", func() bool { subs, _ := broker.state(); return subs > before })
+	broker.publish(2, "plant/humidity", "40", false)
+	waitFor(t, "PUBACK after reconnect", func() bool { _, acked := broker.state(); return acked[2] })
+
+	pts, _ := db.Query("temp", 0, math.MaxInt64)
+	if len(pts) != 1 || pts[0].Value != 21.5 {
+		t.Fatalf("temp: %+v", pts)
+	}
+	pts, _ = db.Query("humidity", 0, math.MaxInt64)
+	if len(pts) != 1 || pts[0].Value != 40 {
+		t.Fatalf("humidity: %+v", pts)
+	}
+
+	if err := bridge.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
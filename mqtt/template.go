@@ -0,0 +1,147 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrBadTemplate = errors.New("bad template")
+
+// topicPattern 编译后的主题模板
+//
+//	factory/{site}/{device}/+/#
+//
+// {name} 匹配一层并把内容记为变量 name，+ 匹配一层但不记录，# 只能在最后，匹配剩余所有层
+type topicPattern struct {
+	segments []string // 每层：变量名 (带花括号)、"+"、"#" 或字面量
+	filter   string   // 订阅用的 MQTT 过滤器，变量替换成 +
+}
+
+func compileTopic(tmpl string) (*topicPattern, error) {
+	if tmpl == "" {
+		return nil, fmt.Errorf("%w: empty topic", ErrBadTemplate)
+	}
+	p := &topicPattern{segments: strings.Split(tmpl, "/")}
+	filter := make([]string, len(p.segments))
+	seen := make(map[string]bool)
+	for i, seg := range p.segments {
+		switch {
+		case seg == "#":
+			if i != len(p.segments)-1 {
+				return nil, fmt.Errorf("%w: # must be the last level in %q", ErrBadTemplate, tmpl)
+			}
+			filter[i] = "#"
+		case seg == "+":
+			filter[i] = "+"
+		case isVar(seg):
+			name := seg[1 : len(seg)-1]
+			if name == "" || seen[name] || reservedVars[name] {
+				return nil, fmt.Errorf("%w: bad variable %q in %q", ErrBadTemplate, seg, tmpl)
+			}
+			seen[name] = true
+			filter[i] = "+"
+		case strings.ContainsAny(seg, "+#{}"):
+			return nil, fmt.Errorf("%w: wildcard must occupy a whole level in %q", ErrBadTemplate, tmpl)
+		default:
+			filter[i] = seg
+		}
+	}
+	p.filter = strings.Join(filter, "/")
+	return p, nil
+}
+
+// match 匹配主题并取出变量；不匹配时 ok 为 false
+func (p *topicPattern) match(topic string) (vars map[string]string, ok bool) {
+	levels := strings.Split(topic, "/")
+	vars = make(map[string]string)
+	for i, seg := range p.segments {
+		if seg == "#" {
+			return vars, true
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		switch {
+		case seg == "+":
+		case isVar(seg):
+			vars[seg[1:len(seg)-1]] = levels[i]
+		case seg != levels[i]:
+			return nil, false
+		}
+	}
+	return vars, len(levels) == len(p.segments)
+}
+
+// names 模板里声明的变量名
+func (p *topicPattern) names() map[string]bool {
+	names := make(map[string]bool)
+	for _, seg := range p.segments {
+		if isVar(seg) {
+			names[seg[1:len(seg)-1]] = true
+		}
+	}
+	return names
+}
+
+// reservedVars 由 Bridge 自己填充的变量，主题模板里不能重名
+var reservedVars = map[string]bool{
+	"topic": true, // 完整主题
+	"field": true, // JSON 负载里的字段名 (AllFields 模式)
+}
+
+// nameTemplate 编译后的名字模板，例如 "{site}.{device}.temperature"
+type nameTemplate struct {
+	parts []string // 偶数下标是字面量，奇数下标是变量名
+}
+
+// compileName 解析名字模板，known 之外的变量名视为错误
+func compileName(tmpl string, known map[string]bool) (*nameTemplate, error) {
+	t := &nameTemplate{}
+	rest := tmpl
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return nil, fmt.Errorf("%w: unbalanced } in %q", ErrBadTemplate, tmpl)
+			}
+			t.parts = append(t.parts, rest)
+			return t, nil
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unbalanced { in %q", ErrBadTemplate, tmpl)
+		}
+		name := rest[open+1 : open+end]
+		if !known[name] && !reservedVars[name] {
+			return nil, fmt.Errorf("%w: unknown variable {%s} in %q", ErrBadTemplate, name, tmpl)
+		}
+		t.parts = append(t.parts, rest[:open], name)
+		rest = rest[open+end+1:]
+	}
+}
+
+func (t *nameTemplate) uses(name string) bool {
+	for i := 1; i < len(t.parts); i += 2 {
+		if t.parts[i] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *nameTemplate) expand(vars map[string]string) string {
+	var b strings.Builder
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+		} else {
+			b.WriteString(vars[part])
+		}
+	}
+	return b.String()
+}
+
+func isVar(seg string) bool {
+	return len(seg) >= 2 && seg[0] == '{' && seg[len(seg)-1] == '}'
+}
@@ -0,0 +1,432 @@
+// Package opcua 通过 OPC UA 订阅把数据变化写进 tcore
+//
+// Collector 连上服务器后为配置的节点建立订阅 (Monitored Item)，
+// 每条数据变化通知按源时间戳写进节点对应的时间线。连接或订阅断开后按指数退避重连并重新订阅，
+// 每个节点最近一次的状态码 (建立监控项的结果、通知里的数据质量、断线) 都记录在 Status 里。
+//
+// Client / Subscription 接口是 Collector 用到的最小能力集，GopcuaDialer 是基于 gopcua 的实现；
+// 测试或其他客户端库可以自己实现 Dialer。
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBadConfig        = errors.New("opcua: bad config")
+	ErrSubscriptionLost = errors.New("opcua: subscription lost")
+	ErrUnsupportedValue = errors.New("opcua: unsupported value type")
+)
+
+const (
+	DefaultInterval    = time.Second
+	DefaultDialTimeout = 10 * time.Second
+	DefaultMinBackoff  = 500 * time.Millisecond
+	DefaultMaxBackoff  = 30 * time.Second
+)
+
+// DataValue 节点的一个值
+type DataValue struct {
+	Value           any // 数值或布尔
+	Status          StatusCode
+	SourceTimestamp time.Time // 设备产生数据的时间
+	ServerTimestamp time.Time // 服务器收到数据的时间
+}
+
+// Notification 一条数据变化通知
+type Notification struct {
+	NodeID string
+	Value  DataValue
+}
+
+// Client 一条已建立的 OPC UA 会话
+type Client interface {
+	// Subscribe 以 interval 为发布间隔订阅 nodeIDs，返回每个监控项的创建结果 (与 nodeIDs 一一对应)
+	// handler 在客户端自己的协程里被调用；ctx 取消时订阅随之结束
+	Subscribe(ctx context.Context, interval time.Duration, nodeIDs []string, handler func(Notification)) (Subscription, []StatusCode, error)
+	Close(ctx context.Context) error
+}
+
+// Subscription 一个订阅；会话断开或服务器删除订阅时 Done 关闭
+type Subscription interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+// Dialer 连接服务器并建立会话
+type Dialer func(ctx context.Context, endpoint string) (Client, error)
+
+// Writer 是采集器依赖的存储能力，*tcore.DB 天然满足
+type Writer interface {
+	Write(sensorID string, timestamp int64, value float64) error
+}
+
+// Node 一个监控的节点
+type Node struct {
+	NodeID string // 例如 "ns=3;i=1001"
+	Series string
+}
+
+// Config 一台服务器的订阅配置
+type Config struct {
+	Endpoint string        // 例如 "opc.tcp://localhost:53530"
+	Interval time.Duration // 发布间隔
+	Nodes    []Node
+}
+
+// Options 采集器配置
+type Options struct {
+	TimeUnit    time.Duration    // DB 里时间戳的单位
+	Now         func() time.Time // 通知里没有时间戳时使用
+	OnError     func(err error)  // 断线、监控项创建失败、写入失败时回调
+	DialTimeout time.Duration
+	MinBackoff  time.Duration // 重连的初始等待，每失败一次翻倍
+	MaxBackoff  time.Duration
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithTimeUnit 设置时间戳单位，默认纳秒
+func WithTimeUnit(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.TimeUnit = d
+	}
+}
+
+// WithNow 设置时钟 (测试用)
+func WithNow(now func() time.Time) Option {
+	return func(opts *Options) {
+		opts.Now = now
+	}
+}
+
+// WithErrorHandler 设置出错回调
+func WithErrorHandler(fn func(err error)) Option {
+	return func(opts *Options) {
+		opts.OnError = fn
+	}
+}
+
+// WithDialTimeout 设置建立会话和订阅的超时
+func WithDialTimeout(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.DialTimeout = d
+	}
+}
+
+// WithBackoff 设置重连退避的上下限
+func WithBackoff(min, max time.Duration) Option {
+	return func(opts *Options) {
+		opts.MinBackoff = min
+		opts.MaxBackoff = max
+	}
+}
+
+// NodeStatus 一个节点的状态
+type NodeStatus struct {
+	NodeID     string
+	Series     string
+	Status     StatusCode // 最近一次的状态码
+	Value      float64    // 最近一次写入的值
+	SourceTime time.Time
+	Updates    uint64 // 写入的通知数
+	Dropped    uint64 // 因质量不好、类型不支持或写入失败丢弃的通知数
+}
+
+// Status 采集器的状态
+type Status struct {
+	Endpoint   string
+	Connected  bool
+	Reconnects int // 断线后重新订阅成功的次数
+	LastError  error
+	Nodes      []NodeStatus
+}
+
+// Collector 一台 OPC UA 服务器的采集器
+type Collector struct {
+	db   Writer
+	dial Dialer
+	cfg  Config
+	opts Options
+
+	nodeIDs []string
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu         sync.Mutex
+	nodes      map[string]*NodeStatus
+	connected  bool
+	subscribed bool // 曾经订阅成功过，用于统计 Reconnects
+	reconnects int
+	lastErr    error
+}
+
+// NewCollector 校验配置；Start 之后才会连接服务器
+func NewCollector(db Writer, dial Dialer, cfg Config, options ...Option) (*Collector, error) {
+	opts := Options{
+		TimeUnit:    time.Nanosecond,
+		Now:         time.Now,
+		DialTimeout: DefaultDialTimeout,
+		MinBackoff:  DefaultMinBackoff,
+		MaxBackoff:  DefaultMaxBackoff,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if cfg.Endpoint == "" || len(cfg.Nodes) == 0 {
+		return nil, fmt.Errorf("%w: endpoint and nodes are required", ErrBadConfig)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+
+	c := &Collector{db: db, dial: dial, cfg: cfg, opts: opts, nodes: make(map[string]*NodeStatus)}
+	for _, n := range cfg.Nodes {
+		if n.NodeID == "" || n.Series == "" {
+			return nil, fmt.Errorf("%w: node %q needs a node id and a series", ErrBadConfig, n.NodeID)
+		}
+		if _, dup := c.nodes[n.NodeID]; dup {
+			return nil, fmt.Errorf("%w: duplicate node %q", ErrBadConfig, n.NodeID)
+		}
+		c.nodes[n.NodeID] = &NodeStatus{NodeID: n.NodeID, Series: n.Series, Status: StatusBadWaitingForInitialData}
+		c.nodeIDs = append(c.nodeIDs, n.NodeID)
+	}
+	return c, nil
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Start 在后台连接并订阅，断线自动重连
+func (c *Collector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go c.run(ctx)
+}
+
+// Stop 取消订阅并关闭会话
+func (c *Collector) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+	c.cancel = nil
+}
+
+// Status 当前状态 (快照)，节点按配置顺序排列
+func (c *Collector) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := Status{
+		Endpoint:   c.cfg.Endpoint,
+		Connected:  c.connected,
+		Reconnects: c.reconnects,
+		LastError:  c.lastErr,
+		Nodes:      make([]NodeStatus, 0, len(c.nodeIDs)),
+	}
+	for _, id := range c.nodeIDs {
+		st.Nodes = append(st.Nodes, *c.nodes[id])
+	}
+	return st
+}
+
+// ==========================================
+// 🔒 会话管理
+// ==========================================
+
+func (c *Collector) run(ctx context.Context) {
+	defer close(c.done)
+	backoff := c.opts.MinBackoff
+	for {
+		subscribed, err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		c.disconnected(err)
+		if subscribed {
+			backoff = c.opts.MinBackoff // 成功订阅过，说明不是持续性故障，从头退避
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+	}
+}
+
+// session 建立一次会话并订阅，阻塞到订阅断开或 ctx 取消
+func (c *Collector) session(ctx context.Context) (subscribed bool, err error) {
+	dctx, cancel := context.WithTimeout(ctx, c.opts.DialTimeout)
+	defer cancel()
+
+	client, err := c.dial(dctx, c.cfg.Endpoint)
+	if err != nil {
+		return false, fmt.Errorf("dial %s: %w", c.cfg.Endpoint, err)
+	}
+	defer func() {
+		cctx, cancel := context.WithTimeout(context.Background(), c.opts.DialTimeout)
+		defer cancel()
+		client.Close(cctx)
+	}()
+
+	// 订阅要活到会话结束，不能挂在只管建连的 dctx 上
+	sub, codes, err := client.Subscribe(ctx, c.cfg.Interval, c.nodeIDs, c.handle)
+	if err != nil {
+		return false, fmt.Errorf("subscribe %s: %w", c.cfg.Endpoint, err)
+	}
+	c.subscribedOK(codes)
+
+	select {
+	case <-ctx.Done():
+		return true, nil
+	case <-sub.Done():
+		if err := sub.Err(); err != nil {
+			return true, fmt.Errorf("%w: %v", ErrSubscriptionLost, err)
+		}
+		return true, ErrSubscriptionLost
+	}
+}
+
+// subscribedOK 记录每个监控项的创建结果；创建失败的节点 (例如 NodeId 不存在) 逐个回调
+func (c *Collector) subscribedOK(codes []StatusCode) {
+	var errs []error
+	c.mu.Lock()
+	for i, id := range c.nodeIDs {
+		code := StatusGood
+		if i < len(codes) {
+			code = codes[i]
+		}
+		st := c.nodes[id]
+		if code.IsBad() {
+			errs = append(errs, fmt.Errorf("monitor %s: %w", id, code))
+			st.Status = code
+		} else if st.Status == StatusBadNotConnected {
+			st.Status = StatusBadWaitingForInitialData
+		}
+	}
+	if c.subscribed {
+		c.reconnects++
+	}
+	c.subscribed, c.connected, c.lastErr = true, true, nil
+	c.mu.Unlock()
+
+	for _, err := range errs {
+		c.report(err)
+	}
+}
+
+// disconnected 会话断开：所有节点标记为 BadNotConnected，直到重新订阅
+func (c *Collector) disconnected(err error) {
+	c.mu.Lock()
+	c.connected = false
+	c.lastErr = err
+	for _, st := range c.nodes {
+		st.Status = StatusBadNotConnected
+	}
+	c.mu.Unlock()
+	c.report(err)
+}
+
+// handle 写入一条数据变化通知；只写 Good 质量的值，其余只更新状态码
+func (c *Collector) handle(n Notification) {
+	c.mu.Lock()
+	st, ok := c.nodes[n.NodeID]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	st.Status = n.Value.Status
+	if !n.Value.Status.IsGood() {
+		st.Dropped++
+		c.mu.Unlock()
+		return
+	}
+	series := st.Series
+	c.mu.Unlock()
+
+	v, err := toFloat(n.Value.Value)
+	if err == nil {
+		ts := n.Value.SourceTimestamp
+		if ts.IsZero() {
+			ts = n.Value.ServerTimestamp
+		}
+		if ts.IsZero() {
+			ts = c.opts.Now()
+		}
+		if err = c.db.Write(series, ts.UnixNano()/int64(c.opts.TimeUnit), v); err == nil {
+			c.mu.Lock()
+			st.Value, st.SourceTime = v, ts
+			st.Updates++
+			c.mu.Unlock()
+			return
+		}
+		err = fmt.Errorf("write %s: %w", series, err)
+	} else {
+		err = fmt.Errorf("node %s: %w", n.NodeID, err)
+	}
+
+	c.mu.Lock()
+	st.Dropped++
+	c.mu.Unlock()
+	c.report(err)
+}
+
+func (c *Collector) report(err error) {
+	if err != nil && c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+// toFloat 数值类型转成 float64，布尔记为 1 / 0
+func toFloat(v any) (float64, error) {
+	var f float64
+	switch x := v.(type) {
+	case float64:
+		f = x
+	case float32:
+		f = float64(x)
+	case int8:
+		f = float64(x)
+	case int16:
+		f = float64(x)
+	case int32:
+		f = float64(x)
+	case int64:
+		f = float64(x)
+	case int:
+		f = float64(x)
+	case uint8:
+		f = float64(x)
+	case uint16:
+		f = float64(x)
+	case uint32:
+		f = float64(x)
+	case uint64:
+		f = float64(x)
+	case bool:
+		if x {
+			f = 1
+		}
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrUnsupportedValue, v)
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupportedValue, f)
+	}
+	return f, nil
+}
@@ -0,0 +1,294 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// simServer 进程内模拟的 OPC UA 服务器：可以发布数据变化、踢掉所有会话、暂时拒绝连接
+type simServer struct {
+	mu    sync.Mutex
+	nodes map[string]bool // 服务器上存在的节点
+	down  bool
+	subs  []*simSub
+	dials int
+}
+
+type simSub struct {
+	ctx     context.Context
+	nodes   map[string]bool
+	handler func(Notification)
+	done    chan struct{}
+	err     error
+}
+
+func (s *simSub) Done() <-chan struct{} { return s.done }
+func (s *simSub) Err() error            { return s.err }
+
+type simClient struct {
+	srv    *simServer
+	closed bool
+}
+
+func newSimServer(nodes ...string) *simServer {
+	s := &simServer{nodes: make(map[string]bool)}
+	for _, n := range nodes {
+		s.nodes[n] = true
+	}
+	return s
+}
+
+func (s *simServer) dial(ctx context.Context, endpoint string) (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dials++
+	if s.down {
+		return nil, errors.New("connection refused")
+	}
+	return &simClient{srv: s}, nil
+}
+
+func (c *simClient) Subscribe(ctx context.Context, interval time.Duration, nodeIDs []string, handler func(Notification)) (Subscription, []StatusCode, error) {
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := &simSub{ctx: ctx, nodes: make(map[string]bool), handler: handler, done: make(chan struct{})}
+	codes := make([]StatusCode, len(nodeIDs))
+	for i, id := range nodeIDs {
+		if !s.nodes[id] {
+			codes[i] = StatusBadNodeIDUnknown
+			continue
+		}
+		sub.nodes[id] = true
+	}
+	s.subs = append(s.subs, sub)
+	return sub, codes, nil
+}
+
+func (c *simClient) Close(ctx context.Context) error {
+	c.closed = true
+	return nil
+}
+
+// publish 把数据变化同步推给所有订阅了该节点的会话
+func (s *simServer) publish(node string, dv DataValue) {
+	s.mu.Lock()
+	var handlers []func(Notification)
+	for _, sub := range s.subs {
+		if sub.nodes[node] {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	s.mu.Unlock()
+	for _, h := range handlers {
+		h(Notification{NodeID: node, Value: dv})
+	}
+}
+
+// restart 断开所有会话，down 为 true 时之后的连接会被拒绝
+func (s *simServer) restart(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		sub.err = StatusBadCommunicationError
+		close(sub.done)
+	}
+	s.subs = nil
+	s.down = down
+}
+
+func (s *simServer) subscriptions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+func newTestDB(t *testing.T) *tcore.DB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestCollector_WritesDataChanges(t *testing.T) {
+	sim := newSimServer("ns=3;i=1001", "ns=3;i=1002")
+	db := newTestDB(t)
+	var mu sync.Mutex
+	var errs []error
+	c, err := NewCollector(db, sim.dial, Config{
+		Endpoint: "opc.tcp://sim:4840",
+		Nodes: []Node{
+			{NodeID: "ns=3;i=1001", Series: "boiler.temp"},
+			{NodeID: "ns=3;i=1002", Series: "boiler.running"},
+			{NodeID: "ns=3;i=9999", Series: "missing"},
+		},
+	}, WithTimeUnit(time.Millisecond), WithNow(func() time.Time { return time.UnixMilli(9000) }),
+		WithErrorHandler(func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	defer c.Stop()
+	waitFor(t, "subscription", func() bool { return c.Status().Connected })
+
+	sim.publish("ns=3;i=1001", DataValue{Value: float32(71.5), SourceTimestamp: time.UnixMilli(1000), ServerTimestamp: time.UnixMilli(1500)})
+	sim.publish("ns=3;i=1001", DataValue{Value: int16(72), ServerTimestamp: time.UnixMilli(2000)}) // 没有源时间戳，用服务器时间戳
+	sim.publish("ns=3;i=1001", DataValue{Value: 99.0, Status: StatusBadCommunicationError, SourceTimestamp: time.UnixMilli(3000)})
+	sim.publish("ns=3;i=1002", DataValue{Value: true}) // 没有时间戳，用本地时钟
+	sim.publish("ns=3;i=1002", DataValue{Value: "on", SourceTimestamp: time.UnixMilli(4000)})
+
+	pts, _ := db.Query("boiler.temp", 0, math.MaxInt64)
+	if len(pts) != 2 || pts[0].Time != 1000 || pts[0].Value != 71.5 || pts[1].Time != 2000 || pts[1].Value != 72 {
+		t.Fatalf("boiler.temp: %+v", pts)
+	}
+	pts, _ = db.Query("boiler.running", 0, math.MaxInt64)
+	if len(pts) != 1 || pts[0].Time != 9000 || pts[0].Value != 1 {
+		t.Fatalf("boiler.running: %+v", pts)
+	}
+
+	st := c.Status()
+	temp, running, missing := st.Nodes[0], st.Nodes[1], st.Nodes[2]
+	if temp.Status != StatusBadCommunicationError || temp.Updates != 2 || temp.Dropped != 1 || temp.Value != 72 {
+		t.Fatalf("temp status: %+v", temp)
+	}
+	if running.Status != StatusGood || running.Updates != 1 || running.Dropped != 1 {
+		t.Fatalf("running status: %+v", running)
+	}
+	if missing.Status != StatusBadNodeIDUnknown {
+		t.Fatalf("missing status: %+v", missing)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var unknown, unsupported bool
+	for _, err := range errs {
+		unknown = unknown || errors.Is(err, StatusBadNodeIDUnknown)
+		unsupported = unsupported || errors.Is(err, ErrUnsupportedValue)
+	}
+	if !unknown || !unsupported {
+		t.Fatalf("errors: %v", errs)
+	}
+}
+
+func TestCollector_ReconnectAndResubscribe(t *testing.T) {
+	sim := newSimServer("ns=2;s=Pump.Speed")
+	db := newTestDB(t)
+	c, err := NewCollector(db, sim.dial, Config{
+		Endpoint: "opc.tcp://sim:4840",
+		Nodes:    []Node{{NodeID: "ns=2;s=Pump.Speed", Series: "pump.speed"}},
+	}, WithBackoff(time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	defer c.Stop()
+	waitFor(t, "subscription", func() bool { return sim.subscriptions() == 1 })
+	sim.publish("ns=2;s=Pump.Speed", DataValue{Value: 1200.0, SourceTimestamp: time.Unix(0, 100)})
+
+	// 服务器重启期间拒绝连接，采集器持续重试
+	sim.restart(true)
+	waitFor(t, "disconnect", func() bool { return !c.Status().Connected })
+	st := c.Status()
+	if st.Nodes[0].Status != StatusBadNotConnected || st.LastError == nil {
+		t.Fatalf("status after disconnect: %+v", st)
+	}
+	sim.mu.Lock()
+	dialsWhileDown := sim.dials
+	sim.mu.Unlock()
+	waitFor(t, "retries", func() bool {
+		sim.mu.Lock()
+		defer sim.mu.Unlock()
+		return sim.dials >= dialsWhileDown+3
+	})
+
+	sim.mu.Lock()
+	sim.down = false
+	sim.mu.Unlock()
+	waitFor(t, "resubscription", func() bool { return sim.subscriptions() == 1 && c.Status().Connected })
+	sim.publish("ns=2;s=Pump.Speed", DataValue{Value: 1300.0, SourceTimestamp: time.Unix(0, 200)})
+
+	st = c.Status()
+	if st.Reconnects != 1 || st.LastError != nil || st.Nodes[0].Status != StatusGood || st.Nodes[0].Updates != 2 {
+		t.Fatalf("status after reconnect: %+v", st)
+	}
+	pts, _ := db.Query("pump.speed", 0, math.MaxInt64)
+	if len(pts) != 2 {
+		t.Fatalf("got %+v", pts)
+	}
+}
+
+func TestCollector_SubscriptionOutlivesDialTimeout(t *testing.T) {
+	sim := newSimServer("ns=2;s=Pump.Speed")
+	c, err := NewCollector(newTestDB(t), sim.dial, Config{
+		Endpoint: "opc.tcp://sim:4840",
+		Nodes:    []Node{{NodeID: "ns=2;s=Pump.Speed", Series: "pump.speed"}},
+	}, WithDialTimeout(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	defer c.Stop()
+	waitFor(t, "subscription", func() bool { return sim.subscriptions() == 1 })
+
+	// 建连超时早就过了，订阅的 ctx 依然有效，直到 Stop
+	time.Sleep(30 * time.Millisecond)
+	sim.mu.Lock()
+	ctx := sim.subs[0].ctx
+	sim.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("subscription ctx ended with the dial timeout: %v", err)
+	}
+	c.Stop()
+	if ctx.Err() == nil {
+		t.Fatal("expected subscription ctx to be cancelled by Stop")
+	}
+}
+
+func TestNewCollector_BadConfig(t *testing.T) {
+	sim := newSimServer()
+	cases := []Config{
+		{Nodes: []Node{{NodeID: "ns=1;i=1", Series: "a"}}},
+		{Endpoint: "opc.tcp://x"},
+		{Endpoint: "opc.tcp://x", Nodes: []Node{{NodeID: "ns=1;i=1"}}},
+		{Endpoint: "opc.tcp://x", Nodes: []Node{{NodeID: "ns=1;i=1", Series: "a"}, {NodeID: "ns=1;i=1", Series: "b"}}},
+	}
+	for i, cfg := range cases {
+		if _, err := NewCollector(nil, sim.dial, cfg); !errors.Is(err, ErrBadConfig) {
+			t.Errorf("case %d: expected ErrBadConfig, got %v", i, err)
+		}
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	if !StatusGood.IsGood() || StatusGood.IsBad() || !StatusUncertain.IsUncertain() || !StatusBadNotConnected.IsBad() {
+		t.Fatal("severity bits")
+	}
+	if StatusBadNodeIDUnknown.String() != "BadNodeIdUnknown" || StatusCode(0x80AB0000).String() != "0x80AB0000" {
+		t.Fatal("names")
+	}
+}
@@ -0,0 +1,163 @@
+package opcua
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	gopcua "github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/ua"
+)
+
+// GopcuaDialer 基于 gopcua 的 Dialer
+// 默认不加密、匿名登录，opts 可以覆盖 (例如 gopcua.SecurityPolicy、gopcua.AuthUsername)。
+// gopcua 自己的自动重连被关掉：会话一断就让 Subscription 结束，由 Collector 统一退避重连并重新订阅
+func GopcuaDialer(opts ...gopcua.Option) Dialer {
+	return func(ctx context.Context, endpoint string) (Client, error) {
+		states := make(chan gopcua.ConnState, 8)
+		all := append([]gopcua.Option{
+			gopcua.SecurityMode(ua.MessageSecurityModeNone),
+			gopcua.AuthAnonymous(),
+		}, opts...)
+		all = append(all, gopcua.AutoReconnect(false), gopcua.StateChangedCh(states))
+
+		c, err := gopcua.NewClient(endpoint, all...)
+		if err != nil {
+			return nil, err
+		}
+		gc := &gopcuaClient{c: c, lost: make(chan struct{})}
+		go gc.watch(states)
+		if err := c.Connect(ctx); err != nil {
+			c.Close(context.Background())
+			return nil, err
+		}
+		return gc, nil
+	}
+}
+
+// gopcuaClient 把 gopcua.Client 适配成 Client
+type gopcuaClient struct {
+	c *gopcua.Client
+
+	lostOnce sync.Once
+	lost     chan struct{} // 连接断开 (Disconnected / Closed) 时关闭
+}
+
+// watch 消费 gopcua 的状态变化 (不消费的话 gopcua 会阻塞在通知上)
+func (gc *gopcuaClient) watch(states <-chan gopcua.ConnState) {
+	connected := false
+	for s := range states {
+		switch s {
+		case gopcua.Connected:
+			connected = true
+		case gopcua.Disconnected, gopcua.Closed:
+			if connected {
+				gc.lostOnce.Do(func() { close(gc.lost) })
+			}
+		}
+	}
+}
+
+func (gc *gopcuaClient) Close(ctx context.Context) error {
+	return gc.c.Close(ctx)
+}
+
+// Subscribe 建立订阅并为每个节点创建监控项，ClientHandle 是节点在 nodeIDs 里的下标 + 1
+// 订阅一直持续到 ctx 取消、连接断开或服务器报告订阅出错
+func (gc *gopcuaClient) Subscribe(ctx context.Context, interval time.Duration, nodeIDs []string, handler func(Notification)) (Subscription, []StatusCode, error) {
+	codes := make([]StatusCode, len(nodeIDs))
+	var reqs []*ua.MonitoredItemCreateRequest
+	var handles []int // reqs[i] 对应 nodeIDs[handles[i]]
+	for i, id := range nodeIDs {
+		nid, err := ua.ParseNodeID(id)
+		if err != nil {
+			codes[i] = StatusBadNodeIDUnknown
+			continue
+		}
+		reqs = append(reqs, gopcua.NewMonitoredItemCreateRequestWithDefaults(nid, ua.AttributeIDValue, uint32(i+1)))
+		handles = append(handles, i)
+	}
+
+	notifs := make(chan *gopcua.PublishNotificationData, 64)
+	sub, err := gc.c.Subscribe(ctx, &gopcua.SubscriptionParameters{Interval: interval}, notifs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(reqs) > 0 {
+		res, err := sub.Monitor(ctx, ua.TimestampsToReturnBoth, reqs...)
+		if err != nil {
+			sub.Cancel(context.Background())
+			return nil, nil, err
+		}
+		for i, r := range res.Results {
+			if i < len(handles) {
+				codes[handles[i]] = StatusCode(r.StatusCode)
+			}
+		}
+	}
+
+	s := &gopcuaSubscription{done: make(chan struct{})}
+	go s.run(ctx, gc, sub, notifs, nodeIDs, handler)
+	return s, codes, nil
+}
+
+// gopcuaSubscription 实现 Subscription
+type gopcuaSubscription struct {
+	done chan struct{}
+	err  error // done 关闭之后才能读
+}
+
+func (s *gopcuaSubscription) Done() <-chan struct{} { return s.done }
+func (s *gopcuaSubscription) Err() error            { return s.err }
+
+// run 把 DataChangeNotification 按 ClientHandle 找回节点再回调 handler，直到订阅结束
+func (s *gopcuaSubscription) run(ctx context.Context, gc *gopcuaClient, sub *gopcua.Subscription, notifs <-chan *gopcua.PublishNotificationData, nodeIDs []string, handler func(Notification)) {
+	defer close(s.done)
+	defer func() {
+		cctx, cancel := context.WithTimeout(context.Background(), DefaultDialTimeout)
+		defer cancel()
+		sub.Cancel(cctx)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-gc.lost:
+			s.err = errors.New("connection lost")
+			return
+		case n := <-notifs:
+			if n.Error != nil {
+				s.err = n.Error
+				return
+			}
+			switch v := n.Value.(type) {
+			case *ua.DataChangeNotification:
+				for _, item := range v.MonitoredItems {
+					idx := int(item.ClientHandle) - 1
+					if idx < 0 || idx >= len(nodeIDs) || item.Value == nil {
+						continue
+					}
+					handler(Notification{NodeID: nodeIDs[idx], Value: toDataValue(item.Value)})
+				}
+			case *ua.StatusChangeNotification:
+				// 服务器单方面结束了订阅 (例如 BadTimeout)
+				s.err = StatusCode(v.Status)
+				return
+			}
+		}
+	}
+}
+
+func toDataValue(dv *ua.DataValue) DataValue {
+	out := DataValue{
+		Status:          StatusCode(dv.Status),
+		SourceTimestamp: dv.SourceTimestamp,
+		ServerTimestamp: dv.ServerTimestamp,
+	}
+	if dv.Value != nil {
+		out.Value = dv.Value.Value()
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+package opcua
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/server"
+	"github.com/gopcua/opcua/ua"
+)
+
+// startUAServer 在随机端口上起一个 gopcua 的进程内服务器，带一个可写的 float64 节点
+func startUAServer(t *testing.T) (endpoint string, ns *server.NodeNameSpace, node *ua.NodeID) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	srv := server.New(
+		server.EndPoint("127.0.0.1", port),
+		server.EnableSecurity("None", ua.MessageSecurityModeNone),
+		server.EnableAuthMode(ua.UserTokenTypeAnonymous),
+	)
+	ns = server.NewNodeNameSpace(srv, "tcore")
+	srv.AddNamespace(ns)
+	n := ns.AddNewVariableStringNode("temp", 20.5)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return fmt.Sprintf("opc.tcp://127.0.0.1:%d", port), ns, n.ID()
+}
+
+// cutProxy 转发 TCP 连接，cut 之后断开所有连接并拒绝新连接，模拟网络中断
+type cutProxy struct {
+	l     net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newCutProxy(t *testing.T, target string) *cutProxy {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &cutProxy{l: l}
+	go func() {
+		for {
+			in, err := l.Accept()
+			if err != nil {
+				return
+			}
+			out, err := net.Dial("tcp", target)
+			if err != nil {
+				in.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, in, out)
+			p.mu.Unlock()
+			go func() { io.Copy(out, in); out.Close() }()
+			go func() { io.Copy(in, out); in.Close() }()
+		}
+	}()
+	t.Cleanup(p.cut)
+	return p
+}
+
+func (p *cutProxy) addr() string { return p.l.Addr().String() }
+
+func (p *cutProxy) cut() {
+	p.l.Close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func TestGopcuaDialer_Collects(t *testing.T) {
+	endpoint, ns, node := startUAServer(t)
+	proxy := newCutProxy(t, endpoint[len("opc.tcp://"):])
+	db := newTestDB(t)
+	c, err := NewCollector(db, GopcuaDialer(), Config{
+		Endpoint: "opc.tcp://" + proxy.addr(),
+		Interval: 10 * time.Millisecond,
+		Nodes: []Node{
+			{NodeID: node.String(), Series: "boiler.temp"},
+			{NodeID: "ns=1;s=missing", Series: "missing"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	defer c.Stop()
+	waitFor(t, "subscription", func() bool { return c.Status().Connected })
+
+	if st := c.Status().Nodes[1].Status; !st.IsBad() {
+		t.Fatalf("expected unknown node to be reported bad, got %v", st)
+	}
+	// 订阅建立时服务器先推一次当前值，之后每次写入推一次
+	waitFor(t, "initial value", func() bool { return c.Status().Nodes[0].Updates >= 1 })
+	ns.SetAttribute(node, ua.AttributeIDValue, &ua.DataValue{
+		EncodingMask:    ua.DataValueValue | ua.DataValueSourceTimestamp,
+		Value:           ua.MustVariant(21.5),
+		SourceTimestamp: time.Now(),
+	})
+	waitFor(t, "data change", func() bool { return c.Status().Nodes[0].Value == 21.5 })
+
+	pts, _ := db.Query("boiler.temp", 0, math.MaxInt64)
+	if len(pts) < 2 || pts[len(pts)-1].Value != 21.5 {
+		t.Fatalf("boiler.temp: %+v", pts)
+	}
+
+	// 网络中断：订阅结束，采集器标记断线并进入重连
+	proxy.cut()
+	waitFor(t, "disconnect", func() bool { return !c.Status().Connected })
+	if st := c.Status(); st.LastError == nil || st.Nodes[0].Status != StatusBadNotConnected {
+		t.Fatalf("status after server shutdown: %+v", st)
+	}
+}
@@ -0,0 +1,48 @@
+package opcua
+
+import "fmt"
+
+// StatusCode OPC UA 状态码 (Part 4, 7.39)
+// 最高两位是严重程度：00 Good、01 Uncertain、10 Bad
+type StatusCode uint32
+
+const (
+	StatusGood                     StatusCode = 0x00000000
+	StatusUncertain                StatusCode = 0x40000000
+	StatusBad                      StatusCode = 0x80000000
+	StatusBadCommunicationError    StatusCode = 0x80050000
+	StatusBadWaitingForInitialData StatusCode = 0x80320000
+	StatusBadNodeIDUnknown         StatusCode = 0x80340000
+	StatusBadNotConnected          StatusCode = 0x808A0000
+)
+
+var statusNames = map[StatusCode]string{
+	StatusGood:                     "Good",
+	StatusUncertain:                "Uncertain",
+	StatusBad:                      "Bad",
+	StatusBadCommunicationError:    "BadCommunicationError",
+	StatusBadWaitingForInitialData: "BadWaitingForInitialData",
+	StatusBadNodeIDUnknown:         "BadNodeIdUnknown",
+	StatusBadNotConnected:          "BadNotConnected",
+}
+
+// IsGood 严重程度为 Good
+func (s StatusCode) IsGood() bool { return s>>30 == 0 }
+
+// IsUncertain 严重程度为 Uncertain
+func (s StatusCode) IsUncertain() bool { return s>>30 == 1 }
+
+// IsBad 严重程度为 Bad
+func (s StatusCode) IsBad() bool { return s>>31 == 1 }
+
+func (s StatusCode) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08X", uint32(s))
+}
+
+// Error 让 Bad 状态码可以直接当 error 用
+func (s StatusCode) Error() string {
+	return "opcua: " + s.String()
+}
@@ -0,0 +1,409 @@
+package parquetexport
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/prom"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// FileInfo 导出的一个 Parquet 文件
+type FileInfo struct {
+	Path    string // 相对导出目录的路径
+	Day     string // 分区日期 2006-01-02
+	Segment uint32 // 来自哪个 Segment，仅 Sealed 模式有意义
+	Rows    int64
+}
+
+// Result 一次导出的统计
+type Result struct {
+	Files    []FileInfo
+	Rows     int64
+	Segments []uint32 // Sealed 模式下实际导出的 Segment，供调用方记录增量进度
+}
+
+// Export 📦 把数据导出到 dir 下按天分区的 Parquet 文件
+// 文件先写成 .tmp 再改名，同名文件被整体替换：重复导出同一个 Segment 是幂等的；
+// 按时间范围导出时，范围只覆盖一天中的一部分，那一天的文件也只含这一部分。
+// 出错时已经写完的文件保留，Result 里列出它们
+func Export(src Source, dir string, options ...Option) (*Result, error) {
+	opts := DefaultOptions()
+	for _, o := range options {
+		o(opts)
+	}
+	codec, ok := codecs[opts.Compression]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCompression, opts.Compression)
+	}
+	if opts.Start > opts.End {
+		return nil, tcore.ErrInvalidRange
+	}
+
+	names := opts.Series
+	if names == nil {
+		names = src.Keys()
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	ex := &exporter{src: src, dir: dir, opts: opts, result: &Result{}}
+	for _, name := range names {
+		typ, err := src.SeriesType(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		st, err := src.Stats(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		ex.series = append(ex.series, &seriesInfo{name: name, typ: typ, stats: st})
+	}
+	ex.buildSchema(codec)
+
+	if !opts.Sealed {
+		lo, hi, ok := ex.dataRange()
+		if ok {
+			lo, hi = max(lo, opts.Start), min(hi, opts.End)
+		}
+		if ok && lo <= hi {
+			scan := func(name string, start, end int64, fn func(tcore.TypedPoint) error) error {
+				return src.ScanValues(name, start, end, fn)
+			}
+			if err := ex.exportSpan(lo, hi, "part.parquet", 0, scan); err != nil {
+				return ex.result, err
+			}
+		}
+		return ex.result, nil
+	}
+
+	segs, err := ex.selectSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segs {
+		lo, hi := max(seg.MinTime, opts.Start), min(seg.MaxTime, opts.End)
+		if seg.Blocks > 0 && lo <= hi {
+			ids := []uint32{seg.ID}
+			scan := func(name string, start, end int64, fn func(tcore.TypedPoint) error) error {
+				return src.ScanSegmentValues(name, ids, start, end, fn)
+			}
+			if err := ex.exportSpan(lo, hi, fmt.Sprintf("seg-%08d.parquet", seg.ID), seg.ID, scan); err != nil {
+				return ex.result, err
+			}
+		}
+		ex.result.Segments = append(ex.result.Segments, seg.ID)
+	}
+	return ex.result, nil
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+// 固定列名；标签和它们重名时加 label_ 前缀。date 是 Hive 分区列
+var reservedColumns = map[string]bool{
+	"series": true, "metric": true, "type": true, "time": true, "value": true, "value_text": true, "date": true,
+}
+
+// writeBatch 攒够这么多行交给 Parquet Writer 一次
+const writeBatch = 1024
+
+type scanFunc func(name string, start, end int64, fn func(tcore.TypedPoint) error) error
+
+type seriesInfo struct {
+	name  string
+	typ   tcore.ValueType
+	stats tcore.SeriesStats
+	base  parquet.Row // 这条时间线每一行都相同的列，time/value/value_text 留给每个点填
+}
+
+type exporter struct {
+	src    Source
+	dir    string
+	opts   *Options
+	series []*seriesInfo
+	result *Result
+
+	schema    *parquet.Schema
+	writerOpt []parquet.WriterOption
+	width     int // 叶子列数
+	timeCol   int
+	valueCol  int
+	textCol   int
+	timeScale int64 // DB 时间戳 * timeScale = 文件里的时间戳
+}
+
+// buildSchema 根据所有时间线的标签并集确定列，并预先填好每条时间线的固定列
+func (ex *exporter) buildSchema(codec compress.Codec) {
+	var unit parquet.TimeUnit
+	switch u := ex.opts.TimeUnit; {
+	case u%time.Millisecond == 0:
+		unit, ex.timeScale = parquet.Millisecond, int64(u/time.Millisecond)
+	case u%time.Microsecond == 0:
+		unit, ex.timeScale = parquet.Microsecond, int64(u/time.Microsecond)
+	default:
+		unit, ex.timeScale = parquet.Nanosecond, int64(u)
+	}
+
+	dict := func() parquet.Node { return parquet.Encoded(parquet.String(), &parquet.RLEDictionary) }
+	group := parquet.Group{
+		"series":     dict(),
+		"metric":     dict(),
+		"type":       dict(),
+		"time":       parquet.Timestamp(unit),
+		"value":      parquet.Optional(parquet.Leaf(parquet.DoubleType)),
+		"value_text": parquet.Optional(parquet.String()),
+	}
+
+	labels := make([]map[string]string, len(ex.series))
+	metrics := make([]string, len(ex.series))
+	for i, s := range ex.series {
+		metrics[i], labels[i] = splitName(s.name)
+		for key := range labels[i] {
+			group[labelColumn(key)] = parquet.Optional(dict())
+		}
+	}
+
+	ex.schema = parquet.NewSchema("tcore", group)
+	ex.writerOpt = []parquet.WriterOption{ex.schema, parquet.Compression(codec), parquet.MaxRowsPerRowGroup(ex.opts.RowGroup)}
+	ex.width = len(ex.schema.Columns())
+	column := func(name string) int {
+		leaf, _ := ex.schema.Lookup(name)
+		return leaf.ColumnIndex
+	}
+	ex.timeCol, ex.valueCol, ex.textCol = column("time"), column("value"), column("value_text")
+
+	for i, s := range ex.series {
+		row := make(parquet.Row, ex.width)
+		for col := range row {
+			row[col] = parquet.Value{}.Level(0, 0, col) // 可空列默认为 null
+		}
+		set := func(name, value string, def int) {
+			col := column(name)
+			row[col] = parquet.ByteArrayValue([]byte(value)).Level(0, def, col)
+		}
+		set("series", s.name, 0)
+		set("metric", metrics[i], 0)
+		set("type", s.typ.String(), 0)
+		for key, value := range labels[i] {
+			set(labelColumn(key), value, 1)
+		}
+		s.base = row
+	}
+}
+
+// splitName 拆出 Prometheus 风格名字里的 metric 和标签；其它名字原样作为 metric
+func splitName(name string) (string, map[string]string) {
+	parsed, err := prom.ParseSeriesKey(name)
+	if err != nil {
+		return name, nil
+	}
+	metric := name
+	labels := make(map[string]string)
+	for _, l := range parsed {
+		if l.Name == "__name__" {
+			metric = l.Value
+		} else {
+			labels[l.Name] = l.Value
+		}
+	}
+	return metric, labels
+}
+
+func labelColumn(key string) string {
+	if reservedColumns[key] {
+		return "label_" + key
+	}
+	return key
+}
+
+// dataRange 所有时间线 (含热数据) 的时间跨度
+func (ex *exporter) dataRange() (int64, int64, bool) {
+	var lo, hi int64
+	found := false
+	for _, s := range ex.series {
+		st := s.stats
+		if st.Points == 0 && st.HotPoints == 0 {
+			continue
+		}
+		if !found || st.MinTime < lo {
+			lo = st.MinTime
+		}
+		if !found || st.MaxTime > hi {
+			hi = st.MaxTime
+		}
+		found = true
+	}
+	return lo, hi, found
+}
+
+// selectSegments 挑出要导出的已封存 Segment
+func (ex *exporter) selectSegments() ([]tcore.SealedSegment, error) {
+	all := ex.src.SealedSegments()
+	if len(ex.opts.Segments) == 0 {
+		return all, nil
+	}
+	byID := make(map[uint32]tcore.SealedSegment, len(all))
+	for _, seg := range all {
+		byID[seg.ID] = seg
+	}
+	var segs []tcore.SealedSegment
+	for _, id := range ex.opts.Segments {
+		seg, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("segment %d is not sealed or does not exist", id)
+		}
+		segs = append(segs, seg)
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i].ID < segs[j].ID })
+	return segs, nil
+}
+
+// exportSpan 把 [lo, hi] 按天切开，每天写一个名为 fileName 的文件
+func (ex *exporter) exportSpan(lo, hi int64, fileName string, segment uint32, scan scanFunc) error {
+	day := ex.dayOf(lo)
+	for {
+		next := day.AddDate(0, 0, 1)
+		nextTS := ex.toUnit(next)
+		start, end := max(ex.toUnit(day), lo), min(nextTS-1, hi)
+		if start <= end {
+			if err := ex.writeDay(day, start, end, fileName, segment, scan); err != nil {
+				return err
+			}
+		}
+		if nextTS > hi {
+			return nil
+		}
+		day = next
+	}
+}
+
+// writeDay 把一天内所有时间线的点写进一个文件；这一天没有数据时不产生文件
+func (ex *exporter) writeDay(day time.Time, start, end int64, fileName string, segment uint32, scan scanFunc) (err error) {
+	date := day.Format(time.DateOnly)
+	rel := filepath.Join("date="+date, fileName)
+	path := filepath.Join(ex.dir, rel)
+
+	var f *os.File
+	var w *parquet.Writer
+	defer func() {
+		if f != nil && err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	var rows int64
+	batch := make([]parquet.Row, 0, writeBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if w == nil {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			var err error
+			if f, err = os.Create(path + ".tmp"); err != nil {
+				return err
+			}
+			w = parquet.NewWriter(f, ex.writerOpt...)
+		}
+		if _, err := w.WriteRows(batch); err != nil {
+			return err
+		}
+		rows += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for _, s := range ex.series {
+		if st := s.stats; st.MaxTime < start || st.MinTime > end {
+			continue // Stats 覆盖全部数据，和这一天不相交就不用扫
+		}
+		err := scan(s.name, start, end, func(p tcore.TypedPoint) error {
+			batch = append(batch, ex.row(s, p))
+			if len(batch) == writeBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if w == nil {
+		return nil
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		f = nil
+		return err
+	}
+	f = nil
+	ex.result.Files = append(ex.result.Files, FileInfo{Path: rel, Day: date, Segment: segment, Rows: rows})
+	ex.result.Rows += rows
+	return nil
+}
+
+// row 一个点对应的一行
+func (ex *exporter) row(s *seriesInfo, p tcore.TypedPoint) parquet.Row {
+	row := append(parquet.Row(nil), s.base...)
+	row[ex.timeCol] = parquet.Int64Value(p.Time*ex.timeScale).Level(0, 0, ex.timeCol)
+
+	v := p.Value
+	switch v.Type {
+	case tcore.TypeFloat:
+		row[ex.valueCol] = parquet.DoubleValue(v.Float).Level(0, 1, ex.valueCol)
+	case tcore.TypeUint:
+		row[ex.valueCol] = parquet.DoubleValue(float64(v.Uint)).Level(0, 1, ex.valueCol)
+	case tcore.TypeBool:
+		f := 0.0
+		if v.Bool {
+			f = 1
+		}
+		row[ex.valueCol] = parquet.DoubleValue(f).Level(0, 1, ex.valueCol)
+	case tcore.TypeString:
+		row[ex.textCol] = parquet.ByteArrayValue([]byte(v.Str)).Level(0, 1, ex.textCol)
+	case tcore.TypeBytes:
+		text := base64.StdEncoding.EncodeToString(v.Bytes)
+		row[ex.textCol] = parquet.ByteArrayValue([]byte(text)).Level(0, 1, ex.textCol)
+	}
+	return row
+}
+
+// dayOf 时间戳所在自然日的零点
+func (ex *exporter) dayOf(ts int64) time.Time {
+	t := time.Unix(0, ts*int64(ex.opts.TimeUnit)).In(ex.opts.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, ex.opts.Location)
+}
+
+// toUnit 把时刻换算成 DB 的时间戳 (向下取整)
+func (ex *exporter) toUnit(t time.Time) int64 {
+	ns, unit := t.UnixNano(), int64(ex.opts.TimeUnit)
+	q := ns / unit
+	if ns%unit != 0 && ns < 0 {
+		q--
+	}
+	return q
+}
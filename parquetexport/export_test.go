@@ -0,0 +1,214 @@
+package parquetexport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/parquet-go/parquet-go"
+)
+
+type testRow struct {
+	Series string   `parquet:"series"`
+	Metric string   `parquet:"metric"`
+	Site   *string  `parquet:"site,optional"`
+	Label  *string  `parquet:"label_type,optional"`
+	Type   string   `parquet:"type"`
+	Time   int64    `parquet:"time"`
+	Value  *float64 `parquet:"value,optional"`
+	Text   *string  `parquet:"value_text,optional"`
+}
+
+// testDB 临时目录里的 DB：sealAndReopen 会换掉里面的实例，测试结束时关闭当前那个
+type testDB struct {
+	*tcore.DB
+	dir string
+}
+
+func openDB(t *testing.T) *testDB {
+	t.Helper()
+	d := &testDB{dir: t.TempDir()}
+	d.open(t)
+	t.Cleanup(func() {
+		if d.DB != nil {
+			d.Close()
+		}
+	})
+	return d
+}
+
+func (d *testDB) open(t *testing.T) {
+	t.Helper()
+	db, err := tcore.NewDB(d.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.DB = db
+}
+
+// sealAndReopen 关闭 DB，放一个空的下一号 .vlog 再打开：原来的活跃段就成了已封存的 Segment
+func (d *testDB) sealAndReopen(t *testing.T) {
+	t.Helper()
+	db, dir := d.DB, d.dir
+	d.DB = nil
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var last string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".vlog") {
+			last = e.Name() // ReadDir 按名字排序，ID 补零定长
+		}
+	}
+	base := strings.TrimSuffix(last, ".vlog")
+	digits := strings.TrimLeft(base, "abcdefghijklmnopqrstuvwxyz_-")
+	id, err := strconv.Atoi(digits)
+	if err != nil {
+		t.Fatalf("unexpected segment file %q", last)
+	}
+	next := fmt.Sprintf("%s%0*d.vlog", strings.TrimSuffix(base, digits), len(digits), id+1)
+	if err := os.WriteFile(filepath.Join(dir, next), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	d.open(t)
+}
+
+func readRows(t *testing.T, dir string, res *Result) map[string][]testRow {
+	t.Helper()
+	files := make(map[string][]testRow)
+	for _, fi := range res.Files {
+		rows, err := parquet.ReadFile[testRow](filepath.Join(dir, fi.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(rows)) != fi.Rows {
+			t.Fatalf("%s: %d rows, reported %d", fi.Path, len(rows), fi.Rows)
+		}
+		files[fi.Path] = rows
+	}
+	return files
+}
+
+func TestExport(t *testing.T) {
+	db := openDB(t)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ts := func(d int, h int) int64 { return day.Add(time.Duration(d*24+h) * time.Hour).UnixMilli() }
+
+	var temps []tcore.TypedPoint
+	for i := 0; i < 12; i++ {
+		temps = append(temps, tcore.TypedPoint{Time: ts(0, i*6), Value: tcore.FloatValue(float64(i))}) // 3 天
+	}
+	db.WriteBatch(`temp{site="a",type="pt100"}`, temps)
+	db.WriteBatch("state", []tcore.TypedPoint{
+		{Time: ts(0, 1), Value: tcore.StringValue("RUN")},
+		{Time: ts(1, 1), Value: tcore.StringValue("STOP")},
+	})
+	db.WriteBatch("pump.on", []tcore.TypedPoint{{Time: ts(2, 23), Value: tcore.BoolValue(true)}})
+	db.Write("hot", ts(2, 0), 7) // 只在内存里
+
+	out := t.TempDir()
+
+	res, err := Export(db.DB, out, WithTimeUnit(time.Millisecond), WithCompression("zstd"), WithRowGroupSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 16 || len(res.Files) != 3 {
+		t.Fatalf("result: %+v", res)
+	}
+	files := readRows(t, out, res)
+	first := files[filepath.Join("date=2024-03-01", "part.parquet")]
+	if len(first) != 5 {
+		t.Fatalf("day 1: %+v", first)
+	}
+	// 时间线按名字排序：state 在 temp 前面
+	if r := first[0]; r.Series != "state" || r.Metric != "state" || r.Site != nil || r.Value != nil || *r.Text != "RUN" || r.Type != "string" {
+		t.Fatalf("state row: %+v", r)
+	}
+	r := first[1]
+	if r.Series != `temp{site="a",type="pt100"}` || r.Metric != "temp" || *r.Site != "a" || *r.Label != "pt100" ||
+		r.Time != ts(0, 0) || *r.Value != 0 || r.Text != nil {
+		t.Fatalf("temp row: %+v", r)
+	}
+	third := files[filepath.Join("date=2024-03-03", "part.parquet")]
+	var series []string
+	for _, r := range third {
+		series = append(series, r.Series)
+	}
+	if want := []string{"hot", "pump.on", `temp{site="a",type="pt100"}`, `temp{site="a",type="pt100"}`, `temp{site="a",type="pt100"}`, `temp{site="a",type="pt100"}`}; !reflect.DeepEqual(series, want) {
+		t.Fatalf("day 3 series: %v", series)
+	}
+	if *third[1].Value != 1 || third[1].Time != ts(2, 23) {
+		t.Fatalf("bool row: %+v", third[1])
+	}
+
+	// 一天中的一部分，只选一条时间线；分区按上海时间切
+	sub := t.TempDir()
+	shanghai := time.FixedZone("CST", 8*3600)
+	res, err = Export(db.DB, sub, WithTimeUnit(time.Millisecond), WithSeries("state"), WithRange(ts(1, 0), ts(9, 0)), WithLocation(shanghai))
+	if err != nil || len(res.Files) != 1 || res.Files[0].Day != "2024-03-02" || res.Rows != 1 {
+		t.Fatalf("sub export: %+v %v", res, err)
+	}
+	if _, err := Export(db.DB, sub, WithSeries("nope")); !errors.Is(err, tcore.ErrSeriesNotFound) {
+		t.Fatalf("expected ErrSeriesNotFound, got %v", err)
+	}
+	if _, err := Export(db.DB, sub, WithCompression("rar")); !errors.Is(err, ErrUnknownCompression) {
+		t.Fatalf("expected ErrUnknownCompression, got %v", err)
+	}
+}
+
+func TestExportSealed(t *testing.T) {
+	db := openDB(t)
+	db.WriteBatch("a", []tcore.TypedPoint{{Time: 10, Value: tcore.UintValue(1)}, {Time: 20, Value: tcore.UintValue(2)}})
+	db.sealAndReopen(t)
+	db.WriteBatch("b", []tcore.TypedPoint{{Time: 15, Value: tcore.BytesValue([]byte{0xff})}})
+	db.sealAndReopen(t)
+	db.WriteBatch("a", []tcore.TypedPoint{{Time: 30, Value: tcore.UintValue(3)}}) // 活跃段，不导出
+
+	segs := db.SealedSegments()
+	var ids []uint32
+	for _, seg := range segs {
+		if seg.Blocks > 0 {
+			ids = append(ids, seg.ID)
+		}
+	}
+	if len(ids) != 2 {
+		t.Fatalf("sealed segments: %+v", segs)
+	}
+
+	out := t.TempDir()
+	res, err := Export(db.DB, out, WithSealedSegments())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 3 || len(res.Files) != 2 || len(res.Segments) != len(segs) {
+		t.Fatalf("result: %+v", res)
+	}
+	files := readRows(t, out, res)
+	rows := files[res.Files[1].Path]
+	if res.Files[1].Segment != ids[1] || len(rows) != 1 || *rows[0].Text != "/w==" || rows[0].Type != "bytes" {
+		t.Fatalf("segment %d: %+v", ids[1], rows)
+	}
+
+	// 只导出一个 Segment，重复导出覆盖同一个文件
+	for i := 0; i < 2; i++ {
+		res, err = Export(db.DB, out, WithSealedSegments(ids[0]))
+		if err != nil || res.Rows != 2 || len(res.Files) != 1 || res.Files[0].Path != filepath.Join("date=1970-01-01", fmt.Sprintf("seg-%08d.parquet", ids[0])) {
+			t.Fatalf("single segment: %+v %v", res, err)
+		}
+	}
+	entries, _ := os.ReadDir(filepath.Join(out, "date=1970-01-01"))
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(entries))
+	}
+	if _, err := Export(db.DB, out, WithSealedSegments(9999)); err == nil {
+		t.Fatal("expected an error for an unknown segment")
+	}
+}
@@ -0,0 +1,135 @@
+// Package parquetexport 把历史数据导出成按天分区的 Parquet 文件，给 pandas / DuckDB / Spark 做离线分析
+//
+// 目录布局是 Hive 风格的分区：
+//
+//	<dir>/date=2024-01-01/part.parquet        按时间范围导出
+//	<dir>/date=2024-01-01/seg-00000012.parquet 按已封存 Segment 导出，每个 Segment 一个文件
+//
+// DuckDB 里直接 read_parquet('<dir>/*/*.parquet', hive_partitioning = true) 即可。
+//
+// 每一行是一个点，列如下：
+//   - series：完整的时间线名
+//   - metric：Prometheus 风格名字 metric{k="v"} 里的 metric，其它名字等于 series
+//   - 每个标签一列 (字符串，可空)，和固定列重名时加 label_ 前缀
+//   - type：值类型 float/uint/bool/string/bytes
+//   - time：TIMESTAMP (UTC)
+//   - value：DOUBLE，数值类型的值 (bool 记为 0/1)，其它类型为空
+//   - value_text：string 类型的值，bytes 类型为 base64，其它类型为空
+//
+// 导出按 "天 × 时间线" 逐个流式读取，内存里同时只有一个 Block 和一个 Row Group
+package parquetexport
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+var ErrUnknownCompression = errors.New("unknown compression")
+
+// Source 导出的数据来源，*tcore.DB 满足这个接口
+type Source interface {
+	Keys() []string
+	SeriesType(name string) (tcore.ValueType, error)
+	Stats(name string) (tcore.SeriesStats, error)
+	SealedSegments() []tcore.SealedSegment
+	ScanValues(name string, start, end int64, fn func(tcore.TypedPoint) error) error
+	ScanSegmentValues(name string, segments []uint32, start, end int64, fn func(tcore.TypedPoint) error) error
+}
+
+// Options 导出配置
+type Options struct {
+	Series      []string       // 要导出的时间线，默认全部
+	Start, End  int64          // 时间范围 (DB 的时间单位)，默认全部
+	Sealed      bool           // 只导出已封存的 Segment，不含活跃段和热数据
+	Segments    []uint32       // Sealed 模式下只导出这些 Segment，默认全部已封存的
+	TimeUnit    time.Duration  // DB 里时间戳的单位，默认纳秒
+	Location    *time.Location // 按哪个时区切天，默认 UTC
+	Compression string         // 压缩算法：none/snappy/gzip/zstd/lz4，默认 snappy
+	RowGroup    int64          // 每个 Row Group 的行数，也是内存里最多缓冲的行数，默认 65536
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// DefaultOptions 默认配置
+func DefaultOptions() *Options {
+	return &Options{
+		Start:       math.MinInt64,
+		End:         math.MaxInt64,
+		TimeUnit:    time.Nanosecond,
+		Location:    time.UTC,
+		Compression: "snappy",
+		RowGroup:    64 * 1024,
+	}
+}
+
+// WithSeries 只导出这些时间线
+func WithSeries(names ...string) Option {
+	return func(opts *Options) {
+		opts.Series = names
+	}
+}
+
+// WithRange 只导出 [start, end] 内的点
+func WithRange(start, end int64) Option {
+	return func(opts *Options) {
+		opts.Start, opts.End = start, end
+	}
+}
+
+// WithSealedSegments 只导出已封存的 Segment；不给 ID 表示全部已封存的 Segment
+// 封存的 Segment 不会再变，调用方记下导出过的 ID 就能做增量导出。
+// 注意 Compaction 会把旧 Segment 合并成新 ID 的 Segment，合并后的数据需要重新导出
+func WithSealedSegments(ids ...uint32) Option {
+	return func(opts *Options) {
+		opts.Sealed = true
+		opts.Segments = ids
+	}
+}
+
+// WithTimeUnit 设置 DB 里时间戳的单位
+func WithTimeUnit(d time.Duration) Option {
+	return func(opts *Options) {
+		if d > 0 {
+			opts.TimeUnit = d
+		}
+	}
+}
+
+// WithLocation 按 loc 的自然日切分区，默认 UTC
+func WithLocation(loc *time.Location) Option {
+	return func(opts *Options) {
+		if loc != nil {
+			opts.Location = loc
+		}
+	}
+}
+
+// WithCompression 设置压缩算法：none/snappy/gzip/zstd/lz4
+func WithCompression(name string) Option {
+	return func(opts *Options) {
+		opts.Compression = name
+	}
+}
+
+// WithRowGroupSize 设置每个 Row Group 的行数
+func WithRowGroupSize(n int64) Option {
+	return func(opts *Options) {
+		if n > 0 {
+			opts.RowGroup = n
+		}
+	}
+}
+
+var codecs = map[string]compress.Codec{
+	"none":   &parquet.Uncompressed,
+	"snappy": &parquet.Snappy,
+	"gzip":   &parquet.Gzip,
+	"zstd":   &parquet.Zstd,
+	"lz4":    &parquet.Lz4Raw,
+}
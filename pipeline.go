@@ -0,0 +1,155 @@
+package tcore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrNilProcessor = errors.New("nil processor")
+
+// IngestPoint 写入流水线上的一个点
+type IngestPoint struct {
+	Series string
+	Time   int64
+	Value  Value
+}
+
+// Processor 写入流水线上的一个处理器：在点落盘之前改写它
+//
+// 返回的点代替输入的点继续往下走：返回空表示丢弃；改 Series 可以换时间线或加标签；
+// 返回多个点表示扇出 (比如同时写一份原始值和一份换算值)。
+// 不同时间线的写入会并发调用 Process，有状态的处理器要自己加锁
+type Processor interface {
+	Process(p IngestPoint) []IngestPoint
+}
+
+// ProcessorFunc 让普通函数满足 Processor
+type ProcessorFunc func(p IngestPoint) []IngestPoint
+
+func (f ProcessorFunc) Process(p IngestPoint) []IngestPoint {
+	return f(p)
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// AddProcessor 🔧 在写入流水线末尾加一个处理器，只处理 selector 匹配的时间线 ("" 表示全部)，其余的点原样通过
+// 处理器按添加顺序执行，前一个的输出是后一个的输入；Write、WriteValue、WriteBatch 都经过流水线，
+// 降采样和连续查询写出的结果不经过。流水线是运行时设置，不保存在数据目录里
+func (db *DB) AddProcessor(selector string, p Processor) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if p == nil {
+		return ErrNilProcessor
+	}
+	stage := &pipelineStage{proc: p}
+	if selector != "" {
+		sel, err := ParseSelector(selector)
+		if err != nil {
+			return err
+		}
+		stage.sel = sel
+	}
+
+	pl := db.pipeline
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	// 写入路径拿到的是旧切片的快照，这里总是换一个新切片
+	pl.stages = append(pl.stages[:len(pl.stages):len(pl.stages)], stage)
+	pl.active.Store(true)
+	return nil
+}
+
+// ClearProcessors 清空写入流水线，之后的写入原样落盘
+func (db *DB) ClearProcessors() {
+	pl := db.pipeline
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.stages = nil
+	pl.active.Store(false)
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+// pipeline 写入流水线
+type pipeline struct {
+	mu     sync.RWMutex
+	stages []*pipelineStage
+	active atomic.Bool // 有处理器；没有时写入路径不用拿锁
+}
+
+// pipelineStage 流水线上的一级：selector 为 nil 时处理全部时间线
+type pipelineStage struct {
+	sel   *Selector
+	proc  Processor
+	match sync.Map // 时间线名 -> 是否匹配，写入路径上避免反复解析名字
+}
+
+func (st *pipelineStage) matches(name string) bool {
+	if st.sel == nil {
+		return true
+	}
+	if ok, cached := st.match.Load(name); cached {
+		return ok.(bool)
+	}
+	ok := st.sel.Match(name)
+	st.match.Store(name, ok)
+	return ok
+}
+
+// run 让一组点依次经过每个处理器
+func (pl *pipeline) run(points []IngestPoint) []IngestPoint {
+	pl.mu.RLock()
+	stages := pl.stages
+	pl.mu.RUnlock()
+
+	for _, st := range stages {
+		next := make([]IngestPoint, 0, len(points))
+		for _, p := range points {
+			if !st.matches(p.Series) {
+				next = append(next, p)
+				continue
+			}
+			next = append(next, st.proc.Process(p)...)
+		}
+		points = next
+		if len(points) == 0 {
+			break
+		}
+	}
+	return points
+}
+
+// ingest 经过流水线后写入；batch 为 true 时 (WriteBatch) 按时间线分组批量写，
+// 否则逐点写。遇到第一个错误就停止，之前写入的点不会回滚
+func (db *DB) ingest(points []IngestPoint, batch bool) error {
+	points = db.pipeline.run(points)
+	if !batch {
+		for _, p := range points {
+			if err := db.writeValue(p.Series, p.Time, p.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var order []string
+	groups := make(map[string][]TypedPoint)
+	for _, p := range points {
+		if _, ok := groups[p.Series]; !ok {
+			order = append(order, p.Series)
+		}
+		groups[p.Series] = append(groups[p.Series], TypedPoint{Time: p.Time, Value: p.Value})
+	}
+	for _, name := range order {
+		if err := db.writeBatch(name, groups[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package tcore
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// 内置处理器只改 float 时间线上的普通值：其它类型、NaN 和陈旧标记原样通过
+
+// ==========================================
+// 📐 线性换算
+// ==========================================
+
+// Scale 线性换算 v*factor + offset：标定偏移、单位换算
+// 比如 Scale(1, -0.3) 修正 0.3 度的零点偏移，Scale(0.001, 0) 把 mV 换成 V
+func Scale(factor, offset float64) Processor {
+	return ProcessorFunc(func(p IngestPoint) []IngestPoint {
+		if plainFloat(p.Value) {
+			p.Value.Float = p.Value.Float*factor + offset
+		}
+		return []IngestPoint{p}
+	})
+}
+
+// ==========================================
+// 📏 范围限制
+// ==========================================
+
+// Clamp 把值限制在 [lo, hi] 内：超出量程的读数削到边界上，不丢点
+func Clamp(lo, hi float64) Processor {
+	return ProcessorFunc(func(p IngestPoint) []IngestPoint {
+		if plainFloat(p.Value) {
+			p.Value.Float = min(max(p.Value.Float, lo), hi)
+		}
+		return []IngestPoint{p}
+	})
+}
+
+// ==========================================
+// ⚡ 毛刺剔除
+// ==========================================
+
+// SpikeFilter 丢弃与同一时间线上一次接受的值相差超过 MaxDelta 的点
+// 连续丢了 MaxRejects 个点之后认为是真实的阶跃，接受当前值作为新的基准；MaxRejects 为 0 时一直丢
+type SpikeFilter struct {
+	MaxDelta   float64
+	MaxRejects int
+
+	mu     sync.Mutex
+	series map[string]*spikeState
+}
+
+// spikeState 一条时间线的基准值
+type spikeState struct {
+	last    float64
+	rejects int
+}
+
+// RejectSpikes 创建一个毛刺过滤器
+func RejectSpikes(maxDelta float64, maxRejects int) *SpikeFilter {
+	return &SpikeFilter{MaxDelta: maxDelta, MaxRejects: maxRejects}
+}
+
+func (f *SpikeFilter) Process(p IngestPoint) []IngestPoint {
+	if !plainFloat(p.Value) {
+		return []IngestPoint{p}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.series == nil {
+		f.series = make(map[string]*spikeState)
+	}
+	st := f.series[p.Series]
+	if st == nil {
+		// 第一个点没有可比较的基准，直接接受
+		f.series[p.Series] = &spikeState{last: p.Value.Float}
+		return []IngestPoint{p}
+	}
+	if math.Abs(p.Value.Float-st.last) > f.MaxDelta {
+		st.rejects++
+		if f.MaxRejects == 0 || st.rejects <= f.MaxRejects {
+			return nil
+		}
+	}
+	st.last, st.rejects = p.Value.Float, 0
+	return []IngestPoint{p}
+}
+
+// ==========================================
+// 🏷️ 补充标签
+// ==========================================
+
+// AddLabels 给时间线名加上标签，已有的同名标签被覆盖
+// 名字原来是 Prometheus 风格 (k="v") 或没有标签时写成 Prometheus 风格，行协议风格 (k=v) 的保持行协议风格
+func AddLabels(labels map[string]string) Processor {
+	extra := make(map[string]string, len(labels))
+	for k, v := range labels {
+		extra[k] = v
+	}
+	return ProcessorFunc(func(p IngestPoint) []IngestPoint {
+		metric, current := splitSeriesName(p.Series)
+		quoted := len(current) == 0 || strings.Contains(p.Series, `="`)
+		merged := make(map[string]string, len(current)+len(extra))
+		for k, v := range current {
+			merged[k] = v
+		}
+		for k, v := range extra {
+			merged[k] = v
+		}
+		p.Series = joinSeriesName(metric, merged, quoted)
+		return []IngestPoint{p}
+	})
+}
+
+// plainFloat float 时间线上可以换算的值
+func plainFloat(v Value) bool {
+	return v.Type == TypeFloat && !math.IsNaN(v.Float)
+}
@@ -0,0 +1,103 @@
+package tcore
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestIngestPipeline(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 华氏度换算成摄氏度，再把量程外的读数削到 [-40, 125]
+	steps := []struct {
+		selector string
+		proc     Processor
+	}{
+		{`temp{unit="F"}`, Scale(5.0/9, -160.0/9)},
+		{`temp{unit="F"}`, AddLabels(map[string]string{"unit": "C", "converted": "true"})},
+		{"temp", Clamp(-40, 125)},
+		{`pressure{line="a"}`, RejectSpikes(10, 2)},
+		// 扇出：原始值另存一份
+		{`pressure{line="a"}`, ProcessorFunc(func(p IngestPoint) []IngestPoint {
+			raw := p
+			raw.Series = "pressure_raw{line=a}"
+			return []IngestPoint{p, raw}
+		})},
+	}
+	for _, s := range steps {
+		if err := db.AddProcessor(s.selector, s.proc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.AddProcessor(`temp{`, Clamp(0, 1)); !errors.Is(err, ErrBadSelector) {
+		t.Fatalf("expected ErrBadSelector, got %v", err)
+	}
+	if err := db.AddProcessor("", nil); !errors.Is(err, ErrNilProcessor) {
+		t.Fatalf("expected ErrNilProcessor, got %v", err)
+	}
+
+	db.Write(`temp{unit="F"}`, 1, 212)
+	db.WriteValue(`temp{unit="F"}`, 2, FloatValue(1000))
+	db.Write("temp", 3, -100)
+	db.Write("temp", 4, StaleNaN)
+	const converted = `temp{converted="true",unit="C"}`
+	if keys := db.Keys(); len(keys) != 2 {
+		t.Fatalf("series: %v", keys)
+	}
+	if p, _ := db.QueryValues(converted, 0, 10); len(p) != 2 || math.Abs(p[0].Value.Float-100) > 1e-9 || p[1].Value.Float != 125 {
+		t.Fatalf("converted: %+v", p)
+	}
+	if p, _ := db.QueryValues("temp", 0, 10); len(p) != 2 || p[0].Value.Float != -40 || !isStale(p[1].Value) {
+		t.Fatalf("clamped: %+v", p)
+	}
+
+	// 毛刺：单个跳变被丢掉；连续 3 个跳变说明是真实的阶跃
+	db.WriteBatch(`pressure{line=a}`, []TypedPoint{
+		{Time: 1, Value: FloatValue(50)}, {Time: 2, Value: FloatValue(90)}, {Time: 3, Value: FloatValue(52)},
+		{Time: 4, Value: FloatValue(80)}, {Time: 5, Value: FloatValue(81)}, {Time: 6, Value: FloatValue(82)},
+	})
+	want := []float64{50, 52, 82}
+	for _, name := range []string{`pressure{line=a}`, "pressure_raw{line=a}"} {
+		p, _ := db.QueryValues(name, 0, 10)
+		if len(p) != len(want) {
+			t.Fatalf("%s: %+v", name, p)
+		}
+		for i := range want {
+			if p[i].Value.Float != want[i] {
+				t.Fatalf("%s: %+v", name, p)
+			}
+		}
+	}
+
+	// 字符串不做换算，但标签照加，落到 float 时间线上类型不符
+	if err := db.WriteValue(`temp{unit="F"}`, 5, StringValue("offline")); !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+	// 清空后原样落盘
+	db.ClearProcessors()
+	db.Write("temp", 10, 500)
+	if p, _ := db.QueryValues("temp", 10, 10); len(p) != 1 || p[0].Value.Float != 500 {
+		t.Fatalf("after clear: %+v", p)
+	}
+}
+
+func TestAddLabelsKeepsNameStyle(t *testing.T) {
+	add := AddLabels(map[string]string{"site": "plant 3"})
+	for in, want := range map[string]string{
+		"boiler":                  `boiler{site="plant 3"}`,
+		`boiler{line="B"}`:        `boiler{line="B",site="plant 3"}`,
+		`mem.used{host=a,site=x}`: `mem.used{host=a,site=plant 3}`,
+		`cpu{host=a\,b}`:          `cpu{host=a\,b,site=plant 3}`,
+	} {
+		if got := add.Process(IngestPoint{Series: in})[0].Series; got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
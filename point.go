@@ -1,5 +1,11 @@
 package tcore
 
+// Point 一个 float64 数据点：DB 内部的最小存储单位
+type Point struct {
+	Time  int64
+	Value float64
+}
+
 const (
 	maxLabelNameLen  = 256
 	maxLabelValueLen = 16 * 1024
@@ -0,0 +1,369 @@
+package prom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// 本文件手写了 remote_write / remote_read 用到的那一小部分 protobuf 消息 (prompb)，
+// 字段编号与 prometheus/prompb 的 remote.proto、types.proto 保持一致，
+// 不认识的字段 (metadata、hints、exemplars 等) 在解码时跳过。
+
+var ErrBadProto = errors.New("malformed protobuf message")
+
+// Label 一个标签
+type Label struct {
+	Name  string // 1
+	Value string // 2
+}
+
+// Sample 一个样本，时间戳单位是毫秒
+type Sample struct {
+	Value     float64 // 1
+	Timestamp int64   // 2
+}
+
+// TimeSeries 一条带标签的时间线
+type TimeSeries struct {
+	Labels  []Label  // 1
+	Samples []Sample // 2
+}
+
+// WriteRequest remote_write 的请求体
+type WriteRequest struct {
+	Timeseries []TimeSeries // 1
+}
+
+// MatchType 标签匹配方式
+type MatchType int32
+
+const (
+	MatchEqual     MatchType = 0
+	MatchNotEqual  MatchType = 1
+	MatchRegexp    MatchType = 2
+	MatchNotRegexp MatchType = 3
+)
+
+// LabelMatcher 标签匹配条件
+type LabelMatcher struct {
+	Type  MatchType // 1
+	Name  string    // 2
+	Value string    // 3
+}
+
+// Query remote_read 里的一个查询，时间范围单位是毫秒
+type Query struct {
+	StartTimestampMs int64          // 1
+	EndTimestampMs   int64          // 2
+	Matchers         []LabelMatcher // 3
+}
+
+// ResponseType remote_read 的响应格式
+const (
+	ResponseSamples           int32 = 0
+	ResponseStreamedXORChunks int32 = 1
+)
+
+// ReadRequest remote_read 的请求体
+type ReadRequest struct {
+	Queries               []Query // 1
+	AcceptedResponseTypes []int32 // 2
+}
+
+// QueryResult 一个查询的结果
+type QueryResult struct {
+	Timeseries []TimeSeries // 1
+}
+
+// ReadResponse remote_read 的响应体
+type ReadResponse struct {
+	Results []QueryResult // 1
+}
+
+// protobuf wire type
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ==========================================
+// 1. 编码
+// ==========================================
+
+// Marshal 编码 WriteRequest
+func (m *WriteRequest) Marshal() []byte {
+	var buf []byte
+	for i := range m.Timeseries {
+		buf = appendMessage(buf, 1, m.Timeseries[i].marshal())
+	}
+	return buf
+}
+
+// Marshal 编码 ReadRequest
+func (m *ReadRequest) Marshal() []byte {
+	var buf []byte
+	for _, q := range m.Queries {
+		var qb []byte
+		qb = appendVarintField(qb, 1, uint64(q.StartTimestampMs))
+		qb = appendVarintField(qb, 2, uint64(q.EndTimestampMs))
+		for _, lm := range q.Matchers {
+			var mb []byte
+			mb = appendVarintField(mb, 1, uint64(lm.Type))
+			mb = appendBytesField(mb, 2, lm.Name)
+			mb = appendBytesField(mb, 3, lm.Value)
+			qb = appendMessage(qb, 3, mb)
+		}
+		buf = appendMessage(buf, 1, qb)
+	}
+	for _, t := range m.AcceptedResponseTypes {
+		buf = appendVarintField(buf, 2, uint64(t))
+	}
+	return buf
+}
+
+// Marshal 编码 ReadResponse
+func (m *ReadResponse) Marshal() []byte {
+	var buf []byte
+	for _, r := range m.Results {
+		var rb []byte
+		for i := range r.Timeseries {
+			rb = appendMessage(rb, 1, r.Timeseries[i].marshal())
+		}
+		buf = appendMessage(buf, 1, rb)
+	}
+	return buf
+}
+
+func (ts *TimeSeries) marshal() []byte {
+	var buf []byte
+	for _, l := range ts.Labels {
+		var lb []byte
+		lb = appendBytesField(lb, 1, l.Name)
+		lb = appendBytesField(lb, 2, l.Value)
+		buf = appendMessage(buf, 1, lb)
+	}
+	for _, s := range ts.Samples {
+		var sb []byte
+		sb = binary.AppendUvarint(sb, 1<<3|wireFixed64)
+		sb = binary.LittleEndian.AppendUint64(sb, math.Float64bits(s.Value))
+		sb = appendVarintField(sb, 2, uint64(s.Timestamp))
+		buf = appendMessage(buf, 2, sb)
+	}
+	return buf
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendBytesField(buf []byte, field int, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendMessage(buf []byte, field int, msg []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field)<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(msg)))
+	return append(buf, msg...)
+}
+
+// ==========================================
+// 2. 解码
+// ==========================================
+
+// Unmarshal 解码 WriteRequest
+func (m *WriteRequest) Unmarshal(b []byte) error {
+	return eachField(b, func(field int, d fieldData) error {
+		if field != 1 {
+			return nil
+		}
+		var ts TimeSeries
+		if err := ts.unmarshal(d.bytes); err != nil {
+			return err
+		}
+		m.Timeseries = append(m.Timeseries, ts)
+		return nil
+	})
+}
+
+// Unmarshal 解码 ReadRequest
+func (m *ReadRequest) Unmarshal(b []byte) error {
+	return eachField(b, func(field int, d fieldData) error {
+		switch field {
+		case 1:
+			var q Query
+			if err := q.unmarshal(d.bytes); err != nil {
+				return err
+			}
+			m.Queries = append(m.Queries, q)
+		case 2:
+			// repeated enum 可能是 packed 编码
+			if d.wire == wireBytes {
+				for rest := d.bytes; len(rest) > 0; {
+					v, n := binary.Uvarint(rest)
+					if n <= 0 {
+						return ErrBadProto
+					}
+					m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, int32(v))
+					rest = rest[n:]
+				}
+			} else {
+				m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, int32(d.varint))
+			}
+		}
+		return nil
+	})
+}
+
+// Unmarshal 解码 ReadResponse
+func (m *ReadResponse) Unmarshal(b []byte) error {
+	return eachField(b, func(field int, d fieldData) error {
+		if field != 1 {
+			return nil
+		}
+		var r QueryResult
+		err := eachField(d.bytes, func(field int, d fieldData) error {
+			if field != 1 {
+				return nil
+			}
+			var ts TimeSeries
+			if err := ts.unmarshal(d.bytes); err != nil {
+				return err
+			}
+			r.Timeseries = append(r.Timeseries, ts)
+			return nil
+		})
+		m.Results = append(m.Results, r)
+		return err
+	})
+}
+
+func (ts *TimeSeries) unmarshal(b []byte) error {
+	return eachField(b, func(field int, d fieldData) error {
+		switch field {
+		case 1:
+			var l Label
+			err := eachField(d.bytes, func(field int, d fieldData) error {
+				switch field {
+				case 1:
+					l.Name = string(d.bytes)
+				case 2:
+					l.Value = string(d.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			var s Sample
+			err := eachField(d.bytes, func(field int, d fieldData) error {
+				switch field {
+				case 1:
+					s.Value = math.Float64frombits(d.varint) // fixed64 也放在 varint 里
+				case 2:
+					s.Timestamp = int64(d.varint)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+}
+
+func (q *Query) unmarshal(b []byte) error {
+	return eachField(b, func(field int, d fieldData) error {
+		switch field {
+		case 1:
+			q.StartTimestampMs = int64(d.varint)
+		case 2:
+			q.EndTimestampMs = int64(d.varint)
+		case 3:
+			var lm LabelMatcher
+			err := eachField(d.bytes, func(field int, d fieldData) error {
+				switch field {
+				case 1:
+					lm.Type = MatchType(d.varint)
+				case 2:
+					lm.Name = string(d.bytes)
+				case 3:
+					lm.Value = string(d.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			q.Matchers = append(q.Matchers, lm)
+		}
+		return nil
+	})
+}
+
+// fieldData 一个字段的值：varint / fixed64 / fixed32 放在 varint 里，length-delimited 放在 bytes 里
+type fieldData struct {
+	wire   int
+	varint uint64
+	bytes  []byte
+}
+
+// eachField 依次回调消息里的每个字段
+func eachField(b []byte, fn func(field int, d fieldData) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return ErrBadProto
+		}
+		b = b[n:]
+		field, wire := int(key>>3), int(key&7)
+		if field == 0 {
+			return ErrBadProto
+		}
+
+		d := fieldData{wire: wire}
+		switch wire {
+		case wireVarint:
+			d.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return ErrBadProto
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return ErrBadProto
+			}
+			d.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return ErrBadProto
+			}
+			d.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return ErrBadProto
+			}
+			d.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return ErrBadProto // group 早已废弃，prompb 里不会出现
+		}
+
+		if err := fn(field, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
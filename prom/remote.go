@@ -0,0 +1,355 @@
+// Package prom 让 Prometheus 把 tcore 当作远端长期存储：
+// remote_write 接收 snappy 压缩的 protobuf WriteRequest 写入 DB，
+// remote_read 按标签匹配条件从 DB 里查出时间线返回。
+//
+// 一组标签映射成一条时间线，名字采用 Prometheus 的文本格式 (见 SeriesKey)，
+// 因此用 HTTP /series 列出来的名字和 PromQL 里看到的一致。
+package prom
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/golang/snappy"
+)
+
+// MaxMessageBytes 请求体解压前后的最大字节数
+const MaxMessageBytes = 32 * 1024 * 1024
+
+var ErrBadSeriesKey = errors.New("not a prometheus series key")
+
+// Store 是 remote_write / remote_read 依赖的存储能力，*tcore.DB 天然满足
+type Store interface {
+	Write(sensorID string, timestamp int64, value float64) error
+	Query(sensorID string, start, end int64) ([]tcore.Point, error)
+	Keys() []string
+}
+
+// Handler remote_write / remote_read 的 HTTP 处理器
+type Handler struct {
+	db   Store
+	unit time.Duration // DB 里时间戳的单位；Prometheus 使用毫秒
+}
+
+// NewHandler 创建处理器；unit 为 DB 里时间戳的单位，例如 time.Millisecond
+func NewHandler(db Store, unit time.Duration) *Handler {
+	return &Handler{db: db, unit: unit}
+}
+
+// ==========================================
+// ✍️ remote_write
+// ==========================================
+
+// ServeWrite POST /api/v1/write
+// 4xx 让 Prometheus 丢弃这批数据，5xx 让它重试，所以只有引擎内部错误才返回 5xx
+func (h *Handler) ServeWrite(w http.ResponseWriter, r *http.Request) {
+	raw, err := readSnappy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req WriteRequest
+	if err := req.Unmarshal(raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, ts := range req.Timeseries {
+		key := SeriesKey(ts.Labels)
+		for _, s := range ts.Samples {
+			if err := h.db.Write(key, h.fromMillis(s.Timestamp), s.Value); err != nil {
+				code := http.StatusInternalServerError
+				if errors.Is(err, tcore.ErrTypeMismatch) {
+					code = http.StatusBadRequest
+				}
+				http.Error(w, fmt.Sprintf("%s: %v", key, err), code)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ==========================================
+// 🔍 remote_read
+// ==========================================
+
+// ServeRead POST /api/v1/read，只支持 SAMPLES 响应格式
+func (h *Handler) ServeRead(w http.ResponseWriter, r *http.Request) {
+	raw, err := readSnappy(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req ReadRequest
+	if err := req.Unmarshal(raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !acceptsSamples(req.AcceptedResponseTypes) {
+		http.Error(w, "only SAMPLES response type is supported", http.StatusBadRequest)
+		return
+	}
+
+	var resp ReadResponse
+	for _, q := range req.Queries {
+		result, err := h.query(q)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errBadMatcher) {
+				code = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	w.Write(snappy.Encode(nil, resp.Marshal()))
+}
+
+var errBadMatcher = errors.New("bad label matcher")
+
+func (h *Handler) query(q Query) (QueryResult, error) {
+	matchers, err := compileMatchers(q.Matchers)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	keys := h.db.Keys()
+	sort.Strings(keys) // 结果顺序稳定，便于比对
+
+	var result QueryResult
+	for _, key := range keys {
+		labels, err := ParseSeriesKey(key)
+		if err != nil {
+			continue // 不是 Prometheus 写进来的时间线
+		}
+		if !matchAll(matchers, labels) {
+			continue
+		}
+
+		points, err := h.db.Query(key, h.fromMillis(q.StartTimestampMs), h.fromMillis(q.EndTimestampMs))
+		if errors.Is(err, tcore.ErrTypeMismatch) {
+			continue // 非 float 时间线 Prometheus 无法表示
+		}
+		if err != nil {
+			return QueryResult{}, err
+		}
+		if len(points) == 0 {
+			continue
+		}
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+
+		ts := TimeSeries{Labels: labels, Samples: make([]Sample, len(points))}
+		for i, p := range points {
+			ts.Samples[i] = Sample{Value: p.Value, Timestamp: h.toMillis(p.Time)}
+		}
+		result.Timeseries = append(result.Timeseries, ts)
+	}
+	return result, nil
+}
+
+func acceptsSamples(types []int32) bool {
+	if len(types) == 0 {
+		return true // 老版本 Prometheus 不发这个字段，默认就是 SAMPLES
+	}
+	for _, t := range types {
+		if t == ResponseSamples {
+			return true
+		}
+	}
+	return false
+}
+
+// ==========================================
+// 🏷️ 标签 <-> 时间线名字
+// ==========================================
+
+// SeriesKey 把一组标签映射成时间线名字：metric{a="1",b="2"}
+// 标签按名字排序，值按 Go 字符串字面量转义；没有其他标签时只有 metric
+func SeriesKey(labels []Label) string {
+	sorted := append([]Label(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	var b strings.Builder
+	first := true
+	for _, l := range sorted {
+		if l.Name == "__name__" {
+			b.WriteString(l.Value)
+		}
+	}
+	for _, l := range sorted {
+		if l.Name == "__name__" || l.Value == "" {
+			continue // 空值标签在 Prometheus 里等同于不存在
+		}
+		if first {
+			b.WriteByte('{')
+			first = false
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l.Value))
+	}
+	if !first {
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+// ParseSeriesKey 是 SeriesKey 的逆过程
+func ParseSeriesKey(key string) ([]Label, error) {
+	var labels []Label
+	name, rest, hasLabels := strings.Cut(key, "{")
+	if name != "" {
+		if !validMetricName(name) {
+			return nil, ErrBadSeriesKey
+		}
+		labels = append(labels, Label{Name: "__name__", Value: name})
+	}
+	if !hasLabels {
+		if name == "" {
+			return nil, ErrBadSeriesKey
+		}
+		return labels, nil
+	}
+
+	for {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return nil, ErrBadSeriesKey
+		}
+		lname := rest[:eq]
+		quoted, err := strconv.QuotedPrefix(rest[eq+1:])
+		if err != nil {
+			return nil, ErrBadSeriesKey
+		}
+		value, _ := strconv.Unquote(quoted)
+		labels = append(labels, Label{Name: lname, Value: value})
+
+		rest = rest[eq+1+len(quoted):]
+		switch {
+		case rest == "}":
+			return labels, nil
+		case strings.HasPrefix(rest, ","):
+			rest = rest[1:]
+		default:
+			return nil, ErrBadSeriesKey
+		}
+	}
+}
+
+// validMetricName [a-zA-Z_:][a-zA-Z0-9_:]*
+// 行协议写进来的 "cpu.usage{host=a}" 这类名字因此不会被误认成 Prometheus 时间线
+func validMetricName(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// matcher 编译好的标签匹配条件
+type matcher struct {
+	LabelMatcher
+	re *regexp.Regexp
+}
+
+func compileMatchers(lms []LabelMatcher) ([]matcher, error) {
+	ms := make([]matcher, len(lms))
+	for i, lm := range lms {
+		ms[i].LabelMatcher = lm
+		switch lm.Type {
+		case MatchEqual, MatchNotEqual:
+		case MatchRegexp, MatchNotRegexp:
+			// Prometheus 的正则是全匹配
+			re, err := regexp.Compile("^(?:" + lm.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", errBadMatcher, err)
+			}
+			ms[i].re = re
+		default:
+			return nil, fmt.Errorf("%w: unknown type %d", errBadMatcher, lm.Type)
+		}
+	}
+	return ms, nil
+}
+
+// matchAll 所有条件都满足；不存在的标签按空字符串参与匹配，与 Prometheus 一致
+func matchAll(ms []matcher, labels []Label) bool {
+	for _, m := range ms {
+		value := ""
+		for _, l := range labels {
+			if l.Name == m.Name {
+				value = l.Value
+				break
+			}
+		}
+		var ok bool
+		switch m.Type {
+		case MatchEqual:
+			ok = value == m.Value
+		case MatchNotEqual:
+			ok = value != m.Value
+		case MatchRegexp:
+			ok = m.re.MatchString(value)
+		case MatchNotRegexp:
+			ok = !m.re.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ==========================================
+// 🔧 小工具
+// ==========================================
+
+// readSnappy 读取并解压 snappy block 格式的请求体
+func readSnappy(r *http.Request) ([]byte, error) {
+	compressed, err := io.ReadAll(io.LimitReader(r.Body, MaxMessageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) > MaxMessageBytes {
+		return nil, fmt.Errorf("request body exceeds %d bytes", MaxMessageBytes)
+	}
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if n > MaxMessageBytes {
+		return nil, fmt.Errorf("decoded body exceeds %d bytes", MaxMessageBytes)
+	}
+	return snappy.Decode(nil, compressed)
+}
+
+func (h *Handler) fromMillis(ms int64) int64 {
+	return convertUnit(ms, time.Millisecond, h.unit)
+}
+
+func (h *Handler) toMillis(ts int64) int64 {
+	return convertUnit(ts, h.unit, time.Millisecond)
+}
+
+func convertUnit(ts int64, from, to time.Duration) int64 {
+	if from >= to {
+		return ts * int64(from/to)
+	}
+	return ts / int64(to/from)
+}
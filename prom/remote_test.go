@@ -0,0 +1,138 @@
+package prom
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/golang/snappy"
+)
+
+func TestSeriesKey_RoundTrip(t *testing.T) {
+	labels := []Label{{"job", "node"}, {"__name__", "up"}, {"path", `C:\x "y"`}, {"empty", ""}}
+	key := SeriesKey(labels)
+	if key != `up{job="node",path="C:\\x \"y\""}` {
+		t.Fatalf("unexpected key %s", key)
+	}
+	parsed, err := ParseSeriesKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Label{{"__name__", "up"}, {"job", "node"}, {"path", `C:\x "y"`}}
+	if !reflect.DeepEqual(parsed, want) {
+		t.Fatalf("got %v, want %v", parsed, want)
+	}
+
+	for _, bad := range []string{"cpu.usage{host=a}", "cpu.usage", `up{job="x"`, "{}"} {
+		if _, err := ParseSeriesKey(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
+
+func TestRemoteWriteAndRead(t *testing.T) {
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	h := NewHandler(db, time.Millisecond)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/write", h.ServeWrite)
+	mux.HandleFunc("POST /api/v1/read", h.ServeRead)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	wr := WriteRequest{Timeseries: []TimeSeries{
+		{
+			Labels:  []Label{{"__name__", "node_temp"}, {"instance", "a"}},
+			Samples: []Sample{{Value: 40, Timestamp: 1000}, {Value: 41, Timestamp: 2000}},
+		},
+		{
+			Labels:  []Label{{"__name__", "node_temp"}, {"instance", "b"}},
+			Samples: []Sample{{Value: 50, Timestamp: 1000}},
+		},
+		{
+			Labels:  []Label{{"__name__", "node_load"}, {"instance", "a"}},
+			Samples: []Sample{{Value: 0.5, Timestamp: 1000}},
+		},
+	}}
+	resp := postSnappy(t, srv.URL+"/api/v1/write", wr.Marshal())
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("write: %d %s", resp.StatusCode, body)
+	}
+
+	rr := ReadRequest{
+		Queries: []Query{
+			{
+				StartTimestampMs: 0, EndTimestampMs: 1500,
+				Matchers: []LabelMatcher{{Type: MatchEqual, Name: "__name__", Value: "node_temp"}},
+			},
+			{
+				StartTimestampMs: 0, EndTimestampMs: 5000,
+				Matchers: []LabelMatcher{
+					{Type: MatchRegexp, Name: "__name__", Value: "node_.*"},
+					{Type: MatchNotEqual, Name: "instance", Value: "b"},
+				},
+			},
+		},
+		AcceptedResponseTypes: []int32{ResponseSamples},
+	}
+	resp = postSnappy(t, srv.URL+"/api/v1/read", rr.Marshal())
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("read: %d %s", resp.StatusCode, body)
+	}
+	compressed, _ := io.ReadAll(resp.Body)
+	raw, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out ReadResponse
+	if err := out.Unmarshal(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(out.Results))
+	}
+	first := out.Results[0].Timeseries
+	if len(first) != 2 || len(first[0].Samples) != 1 || first[1].Samples[0].Value != 50 {
+		t.Fatalf("query 1: unexpected %+v", first)
+	}
+	second := out.Results[1].Timeseries
+	if len(second) != 2 || SeriesKey(second[0].Labels) != `node_load{instance="a"}` || len(second[1].Samples) != 2 {
+		t.Fatalf("query 2: unexpected %+v", second)
+	}
+
+	// 只接受流式响应时明确拒绝
+	rr.AcceptedResponseTypes = []int32{ResponseStreamedXORChunks}
+	if resp := postSnappy(t, srv.URL+"/api/v1/read", rr.Marshal()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for streamed-only read, got %d", resp.StatusCode)
+	}
+	// 不是 snappy 的请求体
+	if resp, _ := http.Post(srv.URL+"/api/v1/write", "application/x-protobuf", bytes.NewReader([]byte("junk"))); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for junk body, got %d", resp.StatusCode)
+	}
+}
+
+func postSnappy(t *testing.T, url string, payload []byte) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(snappy.Encode(nil, payload)))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
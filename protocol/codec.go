@@ -0,0 +1,439 @@
+// Package protocol 定义客户端与服务端之间的 LTV 二进制协议
+//
+// 每一帧 (Frame) 的格式：
+//
+//	[Length: 4字节] [Type: 1字节] [Value: Length 字节]
+//
+// Length 只计算 Value 的长度，全部整数使用 BigEndian。
+// TCP 是字节流，一次 Read 可能只拿到半帧，也可能拿到多帧 (粘包)，
+// 所以读取一律用 io.ReadFull 按长度死等，绝不依赖 Read 的返回边界。
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MaxFrameSize 单帧 Value 的最大长度，防止恶意或错误的长度字段把内存撑爆
+const MaxFrameSize = 16 * 1024 * 1024
+
+// frameHeaderSize 4(Length) + 1(Type)
+const frameHeaderSize = 5
+
+// MaxPointsPerFrame 一个 Points 帧最多装得下的点数：[数量:4] + 每点 16 字节
+const MaxPointsPerFrame = (MaxFrameSize - 4) / 16
+
+// MaxNameSize Series 名字的最大字节数：名字前面的长度字段只有 2 字节
+const MaxNameSize = math.MaxUint16
+
+// MsgType 帧类型
+type MsgType uint8
+
+// 请求
+const (
+	TypePing       MsgType = 1 // 心跳，Value 为空
+	TypeWrite      MsgType = 2 // 写入一个点
+	TypeBatchWrite MsgType = 3 // 批量写入
+	TypeQuery      MsgType = 4 // 范围查询
+	TypeKeys       MsgType = 5 // 列出所有 Series
+	TypeStats      MsgType = 6 // 查看一条 Series 的概况
+)
+
+// 响应
+const (
+	TypePong        MsgType = 101 // 心跳回应
+	TypeOK          MsgType = 102 // 写入成功
+	TypePoints      MsgType = 103 // 查询结果
+	TypeKeyset      MsgType = 104 // Series 列表
+	TypeError       MsgType = 105 // 出错
+	TypeStatsResult MsgType = 106 // Series 概况
+	TypeRejected    MsgType = 107 // 批量写入里有点被拒绝，其余的点已经写入
+)
+
+// 错误码：让客户端能把服务端的错误还原成具体的错误类型
+const (
+	CodeInternal     uint8 = 1
+	CodeBadRequest   uint8 = 2
+	CodeNotFound     uint8 = 3
+	CodeTypeMismatch uint8 = 4
+	CodeInvalidRange uint8 = 5
+	CodeUnavailable  uint8 = 6 // 连接数已满或服务正在关闭
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame exceeds maximum size")
+	ErrBadPayload    = errors.New("malformed payload")
+	ErrNameTooLong   = errors.New("series name exceeds 65535 bytes")
+)
+
+// Frame 一个完整的 LTV 帧
+type Frame struct {
+	Type  MsgType
+	Value []byte
+}
+
+// Sample 写入请求里的一个点
+type Sample struct {
+	Series string
+	Time   int64
+	Value  float64
+}
+
+// Point 查询结果里的一个点
+type Point struct {
+	Time  int64
+	Value float64
+}
+
+// Stats 一条 Series 的概况，对应 tcore.SeriesStats
+type Stats struct {
+	Type      uint8
+	Blocks    uint32
+	Segments  uint32
+	Points    int64
+	HotPoints uint32
+	MinTime   int64
+	MaxTime   int64
+}
+
+// statsSize 1 + 4 + 4 + 8 + 4 + 8 + 8
+const statsSize = 37
+
+// ServerError 服务端返回的错误
+type ServerError struct {
+	Code    uint8
+	Message string
+}
+
+// Rejected 批量写入里被拒绝的点：Indices 是它们在批次里的下标，Code / Message 是第一个被拒绝的原因
+type Rejected struct {
+	Code    uint8
+	Message string
+	Indices []uint32
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error %d: %s", e.Code, e.Message)
+}
+
+// ==========================================
+// 1. 帧的读写
+// ==========================================
+
+// WriteFrame 写出一帧：头和 Value 合并成一次 Write，避免被拆成两个 TCP 包
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Value) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	buf := make([]byte, frameHeaderSize+len(f.Value))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(f.Value)))
+	buf[4] = byte(f.Type)
+	copy(buf[frameHeaderSize:], f.Value)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadFrame 读出一帧：不管底层一次给多少字节，都按长度读满为止
+// 在帧边界上遇到 EOF 返回 io.EOF；帧读到一半断开返回 io.ErrUnexpectedEOF
+func ReadFrame(r io.Reader) (Frame, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Frame{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > MaxFrameSize {
+		return Frame{}, ErrFrameTooLarge
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+	return Frame{Type: MsgType(header[4]), Value: value}, nil
+}
+
+// ==========================================
+// 2. Value 的编解码
+// ==========================================
+
+// EncodeWrite [名字长度:2][名字][时间:8][数值:8]
+func EncodeWrite(s Sample) ([]byte, error) {
+	buf := make([]byte, 0, 18+len(s.Series))
+	return appendSample(buf, s)
+}
+
+// DecodeWrite 解析 EncodeWrite 的结果
+func DecodeWrite(b []byte) (Sample, error) {
+	s, rest, err := readSample(b)
+	if err != nil {
+		return Sample{}, err
+	}
+	if len(rest) != 0 {
+		return Sample{}, ErrBadPayload
+	}
+	return s, nil
+}
+
+// EncodeBatch [数量:4] + 多个 Write 的 Value
+func EncodeBatch(samples []Sample) ([]byte, error) {
+	buf := make([]byte, 4, 4+len(samples)*32)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(samples)))
+	var err error
+	for _, s := range samples {
+		if buf, err = appendSample(buf, s); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// DecodeBatch 解析 EncodeBatch 的结果
+func DecodeBatch(b []byte) ([]Sample, error) {
+	if len(b) < 4 {
+		return nil, ErrBadPayload
+	}
+	n := binary.BigEndian.Uint32(b[0:4])
+	if uint64(n)*18 > uint64(len(b)) { // 每个点至少 18 字节
+		return nil, ErrBadPayload
+	}
+	b = b[4:]
+
+	samples := make([]Sample, 0, n)
+	for i := uint32(0); i < n; i++ {
+		s, rest, err := readSample(b)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+		b = rest
+	}
+	if len(b) != 0 {
+		return nil, ErrBadPayload
+	}
+	return samples, nil
+}
+
+// EncodeQuery [名字长度:2][名字][起始:8][结束:8]
+func EncodeQuery(series string, start, end int64) ([]byte, error) {
+	buf, err := appendString(make([]byte, 0, 18+len(series)), series)
+	if err != nil {
+		return nil, err
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(start))
+	return binary.BigEndian.AppendUint64(buf, uint64(end)), nil
+}
+
+// DecodeQuery 解析 EncodeQuery 的结果
+func DecodeQuery(b []byte) (series string, start, end int64, err error) {
+	series, rest, err := readString(b)
+	if err != nil || len(rest) != 16 {
+		return "", 0, 0, ErrBadPayload
+	}
+	start = int64(binary.BigEndian.Uint64(rest[0:8]))
+	end = int64(binary.BigEndian.Uint64(rest[8:16]))
+	return series, start, end, nil
+}
+
+// EncodePoints [数量:4] + 每个点 [时间:8][数值:8]
+func EncodePoints(points []Point) []byte {
+	buf := make([]byte, 4, 4+len(points)*16)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(points)))
+	for _, p := range points {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(p.Time))
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(p.Value))
+	}
+	return buf
+}
+
+// DecodePoints 解析 EncodePoints 的结果
+func DecodePoints(b []byte) ([]Point, error) {
+	if len(b) < 4 {
+		return nil, ErrBadPayload
+	}
+	n := binary.BigEndian.Uint32(b[0:4])
+	if uint64(len(b)-4) != uint64(n)*16 {
+		return nil, ErrBadPayload
+	}
+	points := make([]Point, n)
+	for i := range points {
+		off := 4 + i*16
+		points[i].Time = int64(binary.BigEndian.Uint64(b[off : off+8]))
+		points[i].Value = math.Float64frombits(binary.BigEndian.Uint64(b[off+8 : off+16]))
+	}
+	return points, nil
+}
+
+// EncodeKeys [数量:4] + 每个名字 [长度:2][内容]
+func EncodeKeys(keys []string) ([]byte, error) {
+	buf := make([]byte, 4, 64)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(keys)))
+	var err error
+	for _, k := range keys {
+		if buf, err = appendString(buf, k); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// DecodeKeys 解析 EncodeKeys 的结果
+func DecodeKeys(b []byte) ([]string, error) {
+	if len(b) < 4 {
+		return nil, ErrBadPayload
+	}
+	n := binary.BigEndian.Uint32(b[0:4])
+	if uint64(n)*2 > uint64(len(b)) {
+		return nil, ErrBadPayload
+	}
+	b = b[4:]
+
+	keys := make([]string, 0, n)
+	for i := uint32(0); i < n; i++ {
+		k, rest, err := readString(b)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+		b = rest
+	}
+	if len(b) != 0 {
+		return nil, ErrBadPayload
+	}
+	return keys, nil
+}
+
+// EncodeStatsQuery [名字长度:2][名字]
+func EncodeStatsQuery(series string) ([]byte, error) {
+	return appendString(make([]byte, 0, 2+len(series)), series)
+}
+
+// DecodeStatsQuery 解析 EncodeStatsQuery 的结果
+func DecodeStatsQuery(b []byte) (string, error) {
+	series, rest, err := readString(b)
+	if err != nil || len(rest) != 0 {
+		return "", ErrBadPayload
+	}
+	return series, nil
+}
+
+// EncodeStats [类型:1][Block 数:4][Segment 数:4][点数:8][热数据点数:4][最早:8][最晚:8]
+func EncodeStats(st Stats) []byte {
+	buf := make([]byte, 0, statsSize)
+	buf = append(buf, st.Type)
+	buf = binary.BigEndian.AppendUint32(buf, st.Blocks)
+	buf = binary.BigEndian.AppendUint32(buf, st.Segments)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(st.Points))
+	buf = binary.BigEndian.AppendUint32(buf, st.HotPoints)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(st.MinTime))
+	return binary.BigEndian.AppendUint64(buf, uint64(st.MaxTime))
+}
+
+// DecodeStats 解析 EncodeStats 的结果
+func DecodeStats(b []byte) (Stats, error) {
+	if len(b) != statsSize {
+		return Stats{}, ErrBadPayload
+	}
+	return Stats{
+		Type:      b[0],
+		Blocks:    binary.BigEndian.Uint32(b[1:5]),
+		Segments:  binary.BigEndian.Uint32(b[5:9]),
+		Points:    int64(binary.BigEndian.Uint64(b[9:17])),
+		HotPoints: binary.BigEndian.Uint32(b[17:21]),
+		MinTime:   int64(binary.BigEndian.Uint64(b[21:29])),
+		MaxTime:   int64(binary.BigEndian.Uint64(b[29:37])),
+	}, nil
+}
+
+// EncodeError [错误码:1][错误信息]
+func EncodeError(code uint8, msg string) []byte {
+	return append([]byte{code}, msg...)
+}
+
+// DecodeError 解析 EncodeError 的结果
+func DecodeError(b []byte) *ServerError {
+	if len(b) == 0 {
+		return &ServerError{Code: CodeInternal}
+	}
+	return &ServerError{Code: b[0], Message: string(b[1:])}
+}
+
+// EncodeRejected [错误码:1][数量:4][下标:4 × 数量][错误信息]
+func EncodeRejected(r Rejected) []byte {
+	buf := make([]byte, 5, 5+len(r.Indices)*4+len(r.Message))
+	buf[0] = r.Code
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(r.Indices)))
+	for _, i := range r.Indices {
+		buf = binary.BigEndian.AppendUint32(buf, i)
+	}
+	return append(buf, r.Message...)
+}
+
+// DecodeRejected 解析 EncodeRejected 的结果
+func DecodeRejected(b []byte) (Rejected, error) {
+	if len(b) < 5 {
+		return Rejected{}, ErrBadPayload
+	}
+	n := binary.BigEndian.Uint32(b[1:5])
+	if uint64(n)*4 > uint64(len(b)-5) {
+		return Rejected{}, ErrBadPayload
+	}
+	r := Rejected{Code: b[0], Indices: make([]uint32, n)}
+	for i := range r.Indices {
+		r.Indices[i] = binary.BigEndian.Uint32(b[5+4*i:])
+	}
+	r.Message = string(b[5+4*n:])
+	return r, nil
+}
+
+// ==========================================
+// 3. 底层小工具
+// ==========================================
+
+func appendSample(buf []byte, s Sample) ([]byte, error) {
+	buf, err := appendString(buf, s.Series)
+	if err != nil {
+		return nil, err
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(s.Time))
+	return binary.BigEndian.AppendUint64(buf, math.Float64bits(s.Value)), nil
+}
+
+func readSample(b []byte) (Sample, []byte, error) {
+	name, rest, err := readString(b)
+	if err != nil || len(rest) < 16 {
+		return Sample{}, nil, ErrBadPayload
+	}
+	return Sample{
+		Series: name,
+		Time:   int64(binary.BigEndian.Uint64(rest[0:8])),
+		Value:  math.Float64frombits(binary.BigEndian.Uint64(rest[8:16])),
+	}, rest[16:], nil
+}
+
+// appendString [长度:2][内容]；超过 2 字节能表示的长度时报错，而不是悄悄截断长度字段
+func appendString(buf []byte, s string) ([]byte, error) {
+	if len(s) > MaxNameSize {
+		return nil, ErrNameTooLong
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...), nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, ErrBadPayload
+	}
+	n := int(binary.BigEndian.Uint16(b[0:2]))
+	if len(b) < 2+n {
+		return "", nil, ErrBadPayload
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
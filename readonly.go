@@ -0,0 +1,122 @@
+package tcore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var ErrReadOnly = errors.New("database is opened read-only")
+
+// OpenReadOnly 🔍 以只读方式打开数据目录 (调试工具用)
+// 不创建、截断、升级任何文件，也不启动后台刷盘和 Compaction；
+// 只能看到已经落盘的数据，正在运行的服务内存里的热数据看不到。
+// 所有写操作返回 ErrReadOnly
+func OpenReadOnly(dirPath string) (*DB, error) {
+	if _, err := os.Stat(dirPath); err != nil {
+		return nil, err
+	}
+
+	// 1. 字典：只解析不修复，半截尾巴留给下一次读写方式打开时处理
+	data, err := os.ReadFile(filepath.Join(dirPath, catalogFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	records, report, _, err := ReadCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+	idx := NewIndex()
+	loadCatalog(records, idx)
+
+	// 2. Hint
+	if err := loadHintsFromDir(dirPath, idx); err != nil {
+		return nil, err
+	}
+
+	// 3. 墓碑
+	tombs := &tombstoneSet{
+		path:   filepath.Join(dirPath, tombstoneFileName),
+		ranges: make(map[uint32][]tombstone),
+		dirty:  make(map[uint32]bool),
+	}
+	if f, err := os.Open(tombs.path); err == nil {
+		err = tombs.load(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// 4. 段文件
+	mgr, err := openReadOnlyManager(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. 降采样进度：只读查询也能用上汇总数据，但不跑后台任务
+	rollups, err := openRollups(dirPath)
+	if err != nil {
+		mgr.close()
+		return nil, err
+	}
+
+	// 6. 连续查询：只读打开时可以查看，但不执行
+	cqs, err := openContinuousQueries(dirPath)
+	if err != nil {
+		mgr.close()
+		return nil, err
+	}
+
+	// 7. 告警：只读打开时可以查看规则和状态，但不求值
+	alerts, err := openAlerts(dirPath)
+	if err != nil {
+		mgr.close()
+		return nil, err
+	}
+
+	db := &DB{
+		manager:       mgr,
+		idx:           idx,
+		tombs:         tombs,
+		rollups:       rollups,
+		cqs:           cqs,
+		alerts:        alerts,
+		staleness:     loadLastWrites(dirPath, idx), // 8. 最近写入：只读打开时也能查沉默的时间线
+		subs:          newSubHub(),
+		pipeline:      &pipeline{},
+		catalogReport: report,
+		readOnly:      true,
+		stopCh:        make(chan struct{}),
+	}
+	db.applyTombstones()
+	return db, nil
+}
+
+// openReadOnlyManager 以只读句柄打开所有 .vlog，只服务读请求
+func openReadOnlyManager(dirPath string) (*Manager, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	mgr := &Manager{
+		dirPath:       dirPath,
+		olderSegments: make(map[uint32]*Segment),
+		readOnlyFiles: make(map[uint32]*os.File),
+	}
+	for _, e := range entries {
+		id, ok := segmentIDFromName(e.Name(), SegmentFileNameSuffix)
+		if !ok {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dirPath, e.Name()))
+		if err != nil {
+			mgr.close()
+			return nil, err
+		}
+		mgr.readOnlyFiles[id] = f
+	}
+	return mgr, nil
+}
@@ -0,0 +1,98 @@
+package tcore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := db.idx.getOrCreateSeries("boiler")
+	db.flushSeriesData(s, []Point{{Time: 10, Value: 1}, {Time: 20, Value: 2}})
+	db.flushSeriesData(s, []Point{{Time: 30, Value: 3}})
+	db.DeleteRange("boiler", 20, 20)
+	db.Write("boiler", 40, 4) // 热数据，只读打开时看不到
+	if err := db.WriteValue("state", 5, StringValue("RUN")); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := db.Stats("boiler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Blocks != 2 || st.Points != 3 || st.HotPoints != 1 || st.MinTime != 10 || st.MaxTime != 40 {
+		t.Fatalf("stats: %+v", st)
+	}
+	if _, err := db.Stats("nope"); !errors.Is(err, ErrSeriesNotFound) {
+		t.Fatalf("expected ErrSeriesNotFound, got %v", err)
+	}
+	db.Close()
+
+	before := dirSnapshot(t, dir)
+	ro, err := OpenReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, err := ro.Query("boiler", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].Time != 10 || points[1].Time != 30 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+	if typ, _ := ro.SeriesType("state"); typ != TypeString {
+		t.Fatalf("state type %s", typ)
+	}
+
+	for name, err := range map[string]error{
+		"Write":        ro.Write("boiler", 50, 5),
+		"WriteValue":   ro.WriteValue("state", 6, StringValue("STOP")),
+		"CreateSeries": ro.CreateSeries("new", TypeBool),
+		"DeleteRange":  ro.DeleteRange("boiler", 0, 100),
+		"Compact":      ro.Compact(),
+		"Flush":        ro.Flush(),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+	if err := ro.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	after := dirSnapshot(t, dir)
+	for name, size := range before {
+		if after[name] != size {
+			t.Errorf("%s changed: %d -> %d bytes", name, size, after[name])
+		}
+	}
+	if len(after) != len(before) {
+		t.Errorf("files changed: %v -> %v", before, after)
+	}
+
+	if _, err := OpenReadOnly(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+// dirSnapshot 文件名 -> 大小
+func dirSnapshot(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]int64)
+	for _, e := range entries {
+		info, _ := e.Info()
+		files[e.Name()] = info.Size()
+	}
+	return files
+}
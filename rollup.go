@@ -0,0 +1,1172 @@
+package tcore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RollupPrefix 汇总时间线的名字前缀：rollup:<step>:<agg>:<原时间线名>
+	RollupPrefix = "rollup:"
+
+	rollupConfigFileName = "rollups.json"
+	rollupStateFileName  = "rollups.state"
+
+	// rollupRetentionEvery 保留期清理的最小间隔：每次清理都会留下一条墓碑，不必每轮都做
+	rollupRetentionEvery = time.Hour
+)
+
+var ErrBadRollupConfig = errors.New("invalid rollup config")
+
+// rollupAggs 每一层汇总落盘的聚合值；avg 由 sum / count 得出，更粗的层也由这四个值逐层合并
+var rollupAggs = []string{"min", "max", "sum", "count"}
+
+// RollupTier 一层汇总：按 Step 宽度的窗口聚合，保留 Retention 这么久 (0 表示永久)
+type RollupTier struct {
+	Step      time.Duration
+	Retention time.Duration
+}
+
+// RollupRule 一条降采样规则
+type RollupRule struct {
+	Match        string        // path.Match 风格的时间线名模式，如 "boiler.*"；空表示全部
+	RawRetention time.Duration // 原始数据保留多久，0 表示永久
+	Tiers        []RollupTier  // 从细到粗，每层的 Step 必须是上一层的整数倍
+}
+
+// RollupConfig 降采样配置，保存在数据目录的 rollups.json 里，重启后自动生效
+type RollupConfig struct {
+	TimeUnit time.Duration // DB 里时间戳的单位，默认纳秒
+	Interval time.Duration // 后台任务的周期，默认 1 分钟
+	Delay    time.Duration // 窗口结束后再等这么久才汇总，少走一次迟到数据的重算
+	Rules    []RollupRule  // 时间线使用第一条匹配的规则
+}
+
+// RollupSeriesName 汇总时间线的名字，如 rollup:1m:max:boiler
+func RollupSeriesName(source string, step time.Duration, agg string) string {
+	return RollupPrefix + formatRollupDuration(step) + ":" + agg + ":" + source
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// SetRollupConfig 🗂️ 设置降采样规则并持久化
+// 已有时间线上 Step 不变的层继续沿用之前的进度，新增的层从现存数据开始补算
+func (db *DB) SetRollupConfig(cfg RollupConfig) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if err := cfg.normalize(); err != nil {
+		return err
+	}
+	return db.rollups.setConfig(cfg)
+}
+
+// RollupConfig 当前的降采样配置
+func (db *DB) RollupConfig() RollupConfig {
+	db.rollups.mu.Lock()
+	defer db.rollups.mu.Unlock()
+	return db.rollups.cfg.clone()
+}
+
+// RunRollups ⏬ 立即执行一轮降采样：补算到期的窗口、重算收到迟到数据的窗口、按保留期删除旧数据
+// 后台任务按 RollupConfig.Interval 周期调用它
+func (db *DB) RunRollups() error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	return db.rollups.run(db)
+}
+
+// QueryAggregate 📉 按 step 聚合查询 [start, end]，时间戳取窗口起点，窗口对齐到 step 的整数倍
+// 时间线配置了降采样时，自动选用 Step 能整除 step 的最粗一层；
+// 这一层还没算到、不完整覆盖或者因为迟到数据等待重算的窗口依次由更细的层和原始数据补齐，
+// 结果与直接聚合原始数据一致。
+// first / last 以及没有配置降采样的时间线直接聚合原始数据
+func (db *DB) QueryAggregate(name string, start, end, step int64, agg string) ([]TypedPoint, error) {
+	if !IsAggregate(agg) {
+		return nil, ErrUnknownAggregate
+	}
+	if step <= 0 || start > end {
+		return nil, ErrInvalidRange
+	}
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return nil, nil
+	}
+	if series.Type != TypeFloat && series.Type != TypeUint {
+		return nil, ErrTypeMismatch
+	}
+
+	plan := db.rollups.plan(name, step)
+	if len(plan) == 0 || agg == "first" || agg == "last" {
+		points, err := db.QueryValues(name, start, end)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+		return Aggregate(points, step, agg)
+	}
+
+	accs := make(map[int64]*rollupAcc)
+	if err := db.collectRollup(name, plan, len(plan)-1, start, end, step, accs); err != nil {
+		return nil, err
+	}
+	buckets := make([]int64, 0, len(accs))
+	for b := range accs {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	result := make([]TypedPoint, len(buckets))
+	for i, b := range buckets {
+		result[i] = TypedPoint{Time: b, Value: FloatValue(accs[b].value(agg))}
+	}
+	return result, nil
+}
+
+// ==========================================
+// 🔒 配置
+// ==========================================
+
+// normalize 填默认值并校验
+func (cfg *RollupConfig) normalize() error {
+	if cfg.TimeUnit <= 0 {
+		cfg.TimeUnit = time.Nanosecond
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Delay < 0 {
+		return fmt.Errorf("%w: negative delay", ErrBadRollupConfig)
+	}
+	for i, rule := range cfg.Rules {
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("%w: rule %d: bad pattern %q", ErrBadRollupConfig, i, rule.Match)
+		}
+		if rule.RawRetention < 0 {
+			return fmt.Errorf("%w: rule %d: negative retention", ErrBadRollupConfig, i)
+		}
+		var prev time.Duration
+		for j, tier := range rule.Tiers {
+			switch {
+			case tier.Step <= 0 || tier.Step%cfg.TimeUnit != 0:
+				return fmt.Errorf("%w: rule %d tier %d: step %v is not a positive multiple of %v", ErrBadRollupConfig, i, j, tier.Step, cfg.TimeUnit)
+			case prev > 0 && (tier.Step <= prev || tier.Step%prev != 0):
+				return fmt.Errorf("%w: rule %d tier %d: step %v is not a multiple of %v", ErrBadRollupConfig, i, j, tier.Step, prev)
+			case tier.Retention < 0:
+				return fmt.Errorf("%w: rule %d tier %d: negative retention", ErrBadRollupConfig, i, j)
+			}
+			prev = tier.Step
+		}
+	}
+	return nil
+}
+
+func (cfg RollupConfig) clone() RollupConfig {
+	rules := make([]RollupRule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		r.Tiers = append([]RollupTier(nil), r.Tiers...)
+		rules[i] = r
+	}
+	cfg.Rules = rules
+	return cfg
+}
+
+// match 时间线适用的规则；汇总时间线自己永远不匹配
+func (cfg *RollupConfig) match(name string) *RollupRule {
+	if strings.HasPrefix(name, RollupPrefix) {
+		return nil
+	}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Match == "" {
+			return rule
+		}
+		if ok, _ := path.Match(rule.Match, name); ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// rollupConfigFile rollups.json 的格式：时长写成 "1m"、"7d" 这样的字符串，方便手工编辑
+type rollupConfigFile struct {
+	TimeUnit string           `json:"time_unit"`
+	Interval string           `json:"interval"`
+	Delay    string           `json:"delay,omitempty"`
+	Rules    []rollupRuleFile `json:"rules"`
+}
+
+type rollupRuleFile struct {
+	Match        string           `json:"match,omitempty"`
+	RawRetention string           `json:"raw_retention,omitempty"`
+	Tiers        []rollupTierFile `json:"tiers"`
+}
+
+type rollupTierFile struct {
+	Step      string `json:"step"`
+	Retention string `json:"retention,omitempty"`
+}
+
+func encodeRollupConfig(cfg RollupConfig) ([]byte, error) {
+	optional := func(d time.Duration) string {
+		if d <= 0 {
+			return ""
+		}
+		return formatRollupDuration(d)
+	}
+	f := rollupConfigFile{
+		TimeUnit: formatRollupDuration(cfg.TimeUnit),
+		Interval: formatRollupDuration(cfg.Interval),
+		Delay:    optional(cfg.Delay),
+		Rules:    make([]rollupRuleFile, len(cfg.Rules)),
+	}
+	for i, rule := range cfg.Rules {
+		r := rollupRuleFile{Match: rule.Match, RawRetention: optional(rule.RawRetention)}
+		for _, tier := range rule.Tiers {
+			r.Tiers = append(r.Tiers, rollupTierFile{Step: formatRollupDuration(tier.Step), Retention: optional(tier.Retention)})
+		}
+		f.Rules[i] = r
+	}
+	return json.MarshalIndent(f, "", "  ")
+}
+
+func decodeRollupConfig(data []byte) (RollupConfig, error) {
+	var f rollupConfigFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return RollupConfig{}, fmt.Errorf("%w: %v", ErrBadRollupConfig, err)
+	}
+	var cfg RollupConfig
+	var err error
+	parse := func(s string) time.Duration {
+		if s == "" || err != nil {
+			return 0
+		}
+		var d time.Duration
+		d, err = ParseRollupDuration(s)
+		return d
+	}
+	cfg.TimeUnit = parse(f.TimeUnit)
+	cfg.Interval = parse(f.Interval)
+	cfg.Delay = parse(f.Delay)
+	for _, r := range f.Rules {
+		rule := RollupRule{Match: r.Match, RawRetention: parse(r.RawRetention)}
+		for _, t := range r.Tiers {
+			rule.Tiers = append(rule.Tiers, RollupTier{Step: parse(t.Step), Retention: parse(t.Retention)})
+		}
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+	if err != nil {
+		return RollupConfig{}, fmt.Errorf("%w: %v", ErrBadRollupConfig, err)
+	}
+	return cfg, cfg.normalize()
+}
+
+// ParseRollupDuration 解析时长，在 time.ParseDuration 的基础上支持天："7d"、"1d12h"
+func ParseRollupDuration(s string) (time.Duration, error) {
+	days, rest, ok := strings.Cut(s, "d")
+	if !ok {
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.ParseInt(days, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if rest != "" {
+		extra, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		d += extra
+	}
+	return d, nil
+}
+
+// formatRollupDuration 用最大的整单位表示时长：1m、1h、7d；除不尽时退回 time.Duration 的写法
+func formatRollupDuration(d time.Duration) string {
+	for _, u := range []struct {
+		d    time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}, {time.Millisecond, "ms"}, {time.Microsecond, "us"}} {
+		if d >= u.d && d%u.d == 0 {
+			return strconv.FormatInt(int64(d/u.d), 10) + u.name
+		}
+	}
+	return d.String()
+}
+
+// ==========================================
+// 🔒 进度状态
+// ==========================================
+
+// rollupRange 闭区间 [Lo, Hi]，两端都是窗口起点
+type rollupRange struct {
+	Lo int64 `json:"lo"`
+	Hi int64 `json:"hi"`
+}
+
+// rollupTierState 一条时间线在某一层上的进度
+type rollupTierState struct {
+	Step    int64         `json:"step"`    // 窗口宽度 (DB 时间单位)
+	Started bool          `json:"started"` // 见过数据之后才有 Next
+	Next    int64         `json:"next"`    // 水位线：Next 之前的窗口都已算好
+	Dirty   []rollupRange `json:"dirty,omitempty"`
+}
+
+// rollupSeriesState 一条时间线的降采样进度
+type rollupSeriesState struct {
+	RawCut int64              `json:"raw_cut"` // 原始数据已删到这里 (不含)，更早的迟到数据无法再汇总
+	Tiers  []*rollupTierState `json:"tiers"`
+}
+
+// markDirty 记下 [lo, hi] 内已经算好的窗口需要重算
+func (t *rollupTierState) markDirty(lo, hi int64) {
+	if !t.Started {
+		return // 还没开始算，首次计算自然会包含这些点
+	}
+	hi = min(hi, t.Next-1)
+	if lo > hi {
+		return
+	}
+	r := rollupRange{Lo: floorAlign(lo, t.Step), Hi: floorAlign(hi, t.Step)}
+
+	// 插入并合并相交或相邻的区间
+	merged := t.Dirty[:0:0]
+	for _, d := range t.Dirty {
+		if d.Hi+t.Step < r.Lo || r.Hi+t.Step < d.Lo {
+			merged = append(merged, d)
+			continue
+		}
+		r.Lo, r.Hi = min(r.Lo, d.Lo), max(r.Hi, d.Hi)
+	}
+	merged = append(merged, r)
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Lo < merged[j].Lo })
+	t.Dirty = merged
+}
+
+// ==========================================
+// 🔒 后台任务
+// ==========================================
+
+// rollupManager 降采样的配置、进度和后台任务
+type rollupManager struct {
+	dir string
+
+	mu     sync.Mutex // 保护 cfg 和 state
+	cfg    RollupConfig
+	state  map[string]*rollupSeriesState
+	pruned time.Time   // 上次按保留期清理的时间
+	active atomic.Bool // 配置了规则；没有规则时写入路径不用拿锁
+
+	runMu  sync.Mutex // 同一时刻只跑一轮
+	fileMu sync.Mutex // 保护 rollups.json / rollups.state 的读写，快照也要拿它
+	clock  func() time.Time
+}
+
+// openRollups 加载配置和进度；文件不存在表示没有配置降采样
+func openRollups(dir string) (*rollupManager, error) {
+	rm := &rollupManager{dir: dir, state: make(map[string]*rollupSeriesState), clock: time.Now}
+	rm.cfg.normalize()
+
+	data, err := os.ReadFile(filepath.Join(dir, rollupConfigFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if rm.cfg, err = decodeRollupConfig(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", rollupConfigFileName, err)
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, rollupStateFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &rm.state); err != nil {
+			// 进度丢了不影响正确性：各层从已有的汇总数据之后接着算
+			fmt.Printf("⚠️ %s 已损坏，降采样进度将重新推断: %v\n", rollupStateFileName, err)
+			rm.state = make(map[string]*rollupSeriesState)
+		}
+	}
+	rm.active.Store(len(rm.cfg.Rules) > 0)
+	return rm, nil
+}
+
+func (rm *rollupManager) setConfig(cfg RollupConfig) error {
+	data, err := encodeRollupConfig(cfg)
+	if err != nil {
+		return err
+	}
+	rm.fileMu.Lock()
+	err = writeFileAtomic(filepath.Join(rm.dir, rollupConfigFileName), data)
+	rm.fileMu.Unlock()
+	if err != nil {
+		return err
+	}
+	rm.mu.Lock()
+	rm.cfg = cfg.clone()
+	rm.active.Store(len(rm.cfg.Rules) > 0)
+	rm.mu.Unlock()
+	return nil
+}
+
+// startRollups 后台按配置的周期执行降采样
+func (db *DB) startRollups() {
+	db.wg.Add(1)
+	go func() {
+		defer db.wg.Done()
+		for {
+			db.rollups.mu.Lock()
+			interval, active := db.rollups.cfg.Interval, len(db.rollups.cfg.Rules) > 0
+			db.rollups.mu.Unlock()
+
+			timer := time.NewTimer(interval)
+			select {
+			case <-db.stopCh:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if !active {
+				continue
+			}
+			if err := db.RunRollups(); err != nil {
+				fmt.Printf("Error running rollups: %v\n", err)
+			}
+		}
+	}()
+}
+
+// noteWrite 写入 (或删除) 了 [lo, hi] 内的原始数据：已经汇总过的窗口标记为待重算
+func (rm *rollupManager) noteWrite(name string, lo, hi int64) {
+	if !rm.active.Load() {
+		return
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	st := rm.state[name]
+	if st == nil || len(st.Tiers) == 0 {
+		return
+	}
+	// 保留期之前的窗口，原始数据的邻居已经删掉了，重算只会得到错误的结果：这部分迟到数据不进汇总
+	st.Tiers[0].markDirty(max(lo, st.RawCut), hi)
+}
+
+// rollupJob 一轮里要处理的一条时间线
+type rollupJob struct {
+	name  string
+	rule  *RollupRule
+	state *rollupSeriesState
+}
+
+// rollupReplace 重算出来的窗口：先删掉旧值，再写入新值
+type rollupReplace struct {
+	job    *rollupJob
+	ranges []rollupRange
+	output *rollupOutput
+}
+
+func (rm *rollupManager) run(db *DB) error {
+	rm.runMu.Lock()
+	defer rm.runMu.Unlock()
+
+	rm.mu.Lock()
+	cfg := rm.cfg.clone()
+	rm.mu.Unlock()
+	unit := int64(cfg.TimeUnit)
+	now := rm.clock().UnixNano() / unit
+	closed := now - int64(cfg.Delay)/unit // 在这之前结束的窗口才算
+
+	// 1. 挑出有规则的数值型时间线，准备好它们的进度
+	var jobs []*rollupJob
+	live := make(map[string]bool)
+	levels := 0
+	for _, name := range db.Keys() {
+		rule := cfg.match(name)
+		if rule == nil || len(rule.Tiers) == 0 && rule.RawRetention == 0 {
+			continue
+		}
+		if typ, err := db.SeriesType(name); err != nil || typ != TypeFloat && typ != TypeUint {
+			continue
+		}
+		live[name] = true
+		jobs = append(jobs, &rollupJob{name: name, rule: rule, state: rm.prepare(db, name, rule, unit)})
+		levels = max(levels, len(rule.Tiers))
+	}
+	rm.mu.Lock()
+	for name := range rm.state {
+		if !live[name] {
+			delete(rm.state, name) // 时间线被删了，或者不再匹配任何规则
+		}
+	}
+	rm.mu.Unlock()
+
+	// 2. 逐层推进：第 k 层的来源是第 k-1 层，必须等上一层全部写完
+	// 要替换的旧汇总值都是这一轮开始前写下的，整轮共用第一次删除时的封存，不再反复轮转活跃段
+	// (保留期清理也沿用它：这一轮里才写进来的过期原始数据留给下一次清理)
+	var firstErr error
+	seal := uint32(noSeal)
+	for level := 0; level < levels; level++ {
+		var replaces []*rollupReplace
+		for _, job := range jobs {
+			if level >= len(job.rule.Tiers) {
+				continue
+			}
+			rep, err := rm.advance(db, job, level, closed)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %w", job.name, err)
+				}
+				continue
+			}
+			if rep != nil {
+				replaces = append(replaces, rep)
+			}
+		}
+		if err := rm.applyReplaces(db, level, replaces, &seal); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// 3. 保留期
+	if rm.clock().Sub(rm.pruned) >= rollupRetentionEvery {
+		if err := rm.enforceRetention(db, jobs, now, unit, &seal); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if firstErr == nil {
+			rm.pruned = rm.clock()
+		}
+	}
+
+	if err := rm.saveState(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// prepare 取出 (必要时新建或对齐) 一条时间线的进度
+// 沿用 Step 相同的层；进度落后于已有的汇总数据时 (进度文件丢失或没来得及保存) 跳到其后，避免重复写入
+func (rm *rollupManager) prepare(db *DB, name string, rule *RollupRule, unit int64) *rollupSeriesState {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	old := rm.state[name]
+	st := &rollupSeriesState{RawCut: math.MinInt64}
+	if old != nil {
+		st.RawCut = old.RawCut
+	}
+	for _, tier := range rule.Tiers {
+		step := int64(tier.Step) / unit
+		ts := &rollupTierState{Step: step}
+		if old != nil {
+			for _, o := range old.Tiers {
+				if o.Step == step {
+					ts = o
+				}
+			}
+		}
+		if derived, err := db.Stats(RollupSeriesName(name, tier.Step, "count")); err == nil && derived.Points+int64(derived.HotPoints) > 0 {
+			next := floorDiv(derived.MaxTime, step)*step + step
+			if !ts.Started || ts.Next < next {
+				ts.Started, ts.Next = true, next
+			}
+		}
+		st.Tiers = append(st.Tiers, ts)
+	}
+	rm.state[name] = st
+	return st
+}
+
+// advance 推进一条时间线的第 level 层：新窗口直接写入，待重算的窗口算好后交给 applyReplaces
+func (rm *rollupManager) advance(db *DB, job *rollupJob, level int, closed int64) (*rollupReplace, error) {
+	rm.mu.Lock()
+	ts := job.state.Tiers[level]
+	step := ts.Step
+	// 来源已经就绪的范围：原始数据看窗口是否结束，上一层看它的水位线
+	var srcEnd int64
+	if level == 0 {
+		srcEnd = closed
+	} else {
+		prev := job.state.Tiers[level-1]
+		if !prev.Started {
+			rm.mu.Unlock()
+			return nil, nil
+		}
+		srcEnd = prev.Next
+	}
+	started, next := ts.Started, ts.Next
+	dirty := ts.Dirty
+	ts.Dirty = nil
+	rm.mu.Unlock()
+
+	restore := func() {
+		rm.mu.Lock()
+		for _, d := range dirty {
+			ts.markDirty(d.Lo, d.Hi)
+		}
+		rm.mu.Unlock()
+	}
+
+	if !started {
+		src := job.name
+		if level > 0 {
+			src = RollupSeriesName(job.name, job.rule.Tiers[level-1].Step, "count")
+		}
+		st, err := db.Stats(src)
+		if err != nil || st.Points+int64(st.HotPoints) == 0 {
+			return nil, nil
+		}
+		started, next = true, floorDiv(st.MinTime, step)*step
+	}
+
+	// 1. 新窗口：[next, end)，分块计算、写入，内存里最多一块的结果
+	end := floorDiv(srcEnd, step) * step
+	for next < end {
+		chunkEnd := end
+		if (end-next)/step > compactBlockMaxPoints {
+			chunkEnd = next + compactBlockMaxPoints*step
+		}
+		out, err := db.computeRollup(job, level, next, chunkEnd-1)
+		if err == nil {
+			err = out.write(db, job, level)
+		}
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		next = chunkEnd
+		rm.advanceTo(ts, next)
+	}
+	if started {
+		rm.advanceTo(ts, next)
+	}
+
+	// 2. 待重算的窗口
+	if len(dirty) == 0 {
+		return nil, nil
+	}
+	out := newRollupOutput()
+	for _, d := range dirty {
+		part, err := db.computeRollup(job, level, d.Lo, d.Hi+step-1)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		out.append(part)
+	}
+	return &rollupReplace{job: job, ranges: dirty, output: out}, nil
+}
+
+// advanceTo 把水位线推进到 next
+func (rm *rollupManager) advanceTo(ts *rollupTierState, next int64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if !ts.Started || ts.Next < next {
+		ts.Started, ts.Next = true, next
+	}
+}
+
+// applyReplaces 替换一层里重算过的窗口：一次删掉全部旧值 (一次封存、一次 fsync)，再写新值
+// 删除前封存了活跃段，新值落在更新的段里，不会被这批墓碑盖住
+func (rm *rollupManager) applyReplaces(db *DB, level int, replaces []*rollupReplace, seal *uint32) error {
+	if len(replaces) == 0 {
+		return nil
+	}
+	var firstErr error
+	fail := func(rep *rollupReplace, err error) {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", rep.job.name, err)
+		}
+		// 放回去，下一轮再试
+		rm.mu.Lock()
+		for _, r := range rep.ranges {
+			rep.job.state.Tiers[level].markDirty(r.Lo, r.Hi)
+		}
+		rm.mu.Unlock()
+	}
+
+	var dels []rangeDelete
+	for _, rep := range replaces {
+		step := rep.job.rule.Tiers[level].Step
+		for _, agg := range rollupAggs {
+			name := RollupSeriesName(rep.job.name, step, agg)
+			for _, r := range rep.ranges {
+				dels = append(dels, rangeDelete{name: name, start: r.Lo, end: r.Hi + rep.job.state.Tiers[level].Step - 1})
+			}
+		}
+	}
+	s, err := db.deleteRanges(dels, *seal)
+	switch {
+	case err == nil:
+		*seal = s
+	case !errors.Is(err, ErrSeriesNotFound):
+		for _, rep := range replaces {
+			fail(rep, err)
+		}
+		return firstErr
+	}
+
+	for _, rep := range replaces {
+		if err := rep.output.write(db, rep.job, level); err != nil {
+			fail(rep, err)
+			continue
+		}
+		// 上一层变了，下一层对应的窗口也要重算
+		if level+1 < len(rep.job.state.Tiers) {
+			rm.mu.Lock()
+			for _, r := range rep.ranges {
+				rep.job.state.Tiers[level+1].markDirty(r.Lo, r.Hi+rep.job.state.Tiers[level].Step-1)
+			}
+			rm.mu.Unlock()
+		}
+	}
+	return firstErr
+}
+
+// enforceRetention 按保留期删除原始数据和各层汇总数据，所有删除一次提交
+// 还没汇总进下一层的数据不删：删除点不会越过下一层的水位线
+func (rm *rollupManager) enforceRetention(db *DB, jobs []*rollupJob, now, unit int64, seal *uint32) error {
+	var dels []rangeDelete
+	prune := func(name string, cut int64) {
+		st, err := db.Stats(name)
+		if err != nil || st.Points+int64(st.HotPoints) == 0 || st.MinTime >= cut {
+			return
+		}
+		dels = append(dels, rangeDelete{name: name, start: math.MinInt64, end: cut - 1})
+	}
+	limit := func(cut int64, next *rollupTierState) int64 {
+		if next == nil {
+			return cut
+		}
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
+		if !next.Started {
+			return math.MinInt64
+		}
+		return min(cut, next.Next)
+	}
+
+	for _, job := range jobs {
+		tiers := job.state.Tiers
+		if ret := job.rule.RawRetention; ret > 0 {
+			var first *rollupTierState
+			if len(tiers) > 0 {
+				first = tiers[0]
+			}
+			if cut := limit(now-int64(ret)/unit, first); cut > math.MinInt64 {
+				// 先挪保留线再删：删除触发的 noteWrite 落在保留线之前，不会被当成迟到数据
+				rm.mu.Lock()
+				job.state.RawCut = max(job.state.RawCut, cut)
+				rm.mu.Unlock()
+				prune(job.name, cut)
+			}
+		}
+		for k, tier := range job.rule.Tiers {
+			if tier.Retention <= 0 {
+				continue
+			}
+			var next *rollupTierState
+			if k+1 < len(tiers) {
+				next = tiers[k+1]
+			}
+			cut := limit(now-int64(tier.Retention)/unit, next)
+			if cut == math.MinInt64 {
+				continue
+			}
+			for _, agg := range rollupAggs {
+				prune(RollupSeriesName(job.name, tier.Step, agg), cut)
+			}
+		}
+	}
+	if len(dels) == 0 {
+		return nil
+	}
+	s, err := db.deleteRanges(dels, *seal)
+	switch {
+	case err == nil:
+		*seal = s
+	case !errors.Is(err, ErrSeriesNotFound):
+		return fmt.Errorf("retention: %w", err)
+	}
+	return nil
+}
+
+func (rm *rollupManager) saveState() error {
+	rm.mu.Lock()
+	data, err := json.Marshal(rm.state)
+	rm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	rm.fileMu.Lock()
+	defer rm.fileMu.Unlock()
+	return writeFileAtomic(filepath.Join(rm.dir, rollupStateFileName), data)
+}
+
+// renameState 时间线改名后把进度搬到新名字下；新名字不再匹配规则时下一轮自然会清掉
+func (rm *rollupManager) renameState(oldName, newName string) error {
+	rm.mu.Lock()
+	st, ok := rm.state[oldName]
+	if ok {
+		delete(rm.state, oldName)
+		rm.state[newName] = st
+	}
+	rm.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return rm.saveState()
+}
+
+// rollupRenames 源时间线改名时，它的汇总时间线要改成的名字：[旧名字, 新名字]
+func rollupRenames(keys []string, oldName, newName string) [][2]string {
+	var renames [][2]string
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, RollupPrefix)
+		if !ok {
+			continue
+		}
+		step, rest, _ := strings.Cut(rest, ":")
+		agg, source, _ := strings.Cut(rest, ":")
+		if source == oldName {
+			renames = append(renames, [2]string{key, RollupPrefix + step + ":" + agg + ":" + newName})
+		}
+	}
+	return renames
+}
+
+// snapshotFiles 快照用：配置和进度文件的当前内容
+func (rm *rollupManager) snapshotFiles() (map[string][]byte, error) {
+	rm.fileMu.Lock()
+	defer rm.fileMu.Unlock()
+	files := make(map[string][]byte)
+	for _, name := range []string{rollupConfigFileName, rollupStateFileName} {
+		data, err := os.ReadFile(filepath.Join(rm.dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// writeFileAtomic 写临时文件、fsync 后改名
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := writeFileSync(tmp, data); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// ==========================================
+// 🔒 计算
+// ==========================================
+
+// rollupAcc 一个窗口的部分聚合结果，可以继续合并
+type rollupAcc struct {
+	min, max, sum, count float64
+}
+
+func (a *rollupAcc) add(v float64) {
+	a.merge(rollupAcc{min: v, max: v, sum: v, count: 1})
+}
+
+func (a *rollupAcc) merge(o rollupAcc) {
+	if a.count == 0 {
+		*a = o
+		return
+	}
+	a.min = math.Min(a.min, o.min)
+	a.max = math.Max(a.max, o.max)
+	a.sum += o.sum
+	a.count += o.count
+}
+
+func (a *rollupAcc) value(agg string) float64 {
+	switch agg {
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	case "sum":
+		return a.sum
+	case "count":
+		return a.count
+	}
+	return a.sum / a.count
+}
+
+// rollupOutput 按窗口起点排好序的聚合结果
+type rollupOutput struct {
+	times []int64
+	accs  []rollupAcc
+}
+
+func newRollupOutput() *rollupOutput { return &rollupOutput{} }
+
+func (o *rollupOutput) append(other *rollupOutput) {
+	o.times = append(o.times, other.times...)
+	o.accs = append(o.accs, other.accs...)
+}
+
+// write 把结果写进 min/max/sum/count 四条汇总时间线
+func (o *rollupOutput) write(db *DB, job *rollupJob, level int) error {
+	if len(o.times) == 0 {
+		return nil
+	}
+	step := job.rule.Tiers[level].Step
+	for _, agg := range rollupAggs {
+		points := make([]TypedPoint, len(o.times))
+		for i, t := range o.times {
+			points[i] = TypedPoint{Time: t, Value: FloatValue(o.accs[i].value(agg))}
+		}
+		if err := db.writeBatch(RollupSeriesName(job.name, step, agg), points); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// computeRollup 算出第 level 层在 [lo, hi] 内的窗口
+func (db *DB) computeRollup(job *rollupJob, level int, lo, hi int64) (*rollupOutput, error) {
+	step := job.state.Tiers[level].Step
+	accs := make(map[int64]*rollupAcc)
+	get := func(t int64) *rollupAcc {
+		b := floorDiv(t, step) * step
+		a := accs[b]
+		if a == nil {
+			a = &rollupAcc{}
+			accs[b] = a
+		}
+		return a
+	}
+
+	if level == 0 {
+		err := db.ScanValues(job.name, lo, hi, func(p TypedPoint) error {
+			if !isStale(p.Value) {
+				get(p.Time).add(numeric(p.Value))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		parts, err := db.readRollup(job.name, job.rule.Tiers[level-1].Step, lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		for i, t := range parts.times {
+			get(t).merge(parts.accs[i])
+		}
+	}
+
+	out := &rollupOutput{times: make([]int64, 0, len(accs))}
+	for b := range accs {
+		out.times = append(out.times, b)
+	}
+	sort.Slice(out.times, func(i, j int) bool { return out.times[i] < out.times[j] })
+	out.accs = make([]rollupAcc, len(out.times))
+	for i, b := range out.times {
+		out.accs[i] = *accs[b]
+	}
+	return out, nil
+}
+
+// readRollup 读出一层汇总数据在 [lo, hi] 内的窗口
+func (db *DB) readRollup(name string, step time.Duration, lo, hi int64) (*rollupOutput, error) {
+	byTime := make(map[int64]*rollupAcc)
+	for _, agg := range rollupAggs {
+		points, err := db.QueryValues(RollupSeriesName(name, step, agg), lo, hi)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range points {
+			a := byTime[p.Time]
+			if a == nil {
+				a = &rollupAcc{}
+				byTime[p.Time] = a
+			}
+			switch agg {
+			case "min":
+				a.min = p.Value.Float
+			case "max":
+				a.max = p.Value.Float
+			case "sum":
+				a.sum = p.Value.Float
+			case "count":
+				a.count = p.Value.Float
+			}
+		}
+	}
+	out := &rollupOutput{}
+	for t, a := range byTime {
+		if a.count > 0 {
+			out.times = append(out.times, t)
+		}
+	}
+	sort.Slice(out.times, func(i, j int) bool { return out.times[i] < out.times[j] })
+	out.accs = make([]rollupAcc, len(out.times))
+	for i, t := range out.times {
+		out.accs[i] = *byTime[t]
+	}
+	return out, nil
+}
+
+// ==========================================
+// 🔒 查询
+// ==========================================
+
+// rollupLevel 查询时可用的一层
+type rollupLevel struct {
+	step     int64         // DB 时间单位
+	duration time.Duration // 用来拼汇总时间线的名字
+	next     int64         // 水位线
+	stale    []rollupRange // 按 Lo 排序的时间区间：这一层或更细的层上等待重算的窗口，这一层的汇总点不可信
+}
+
+// plan 从细到粗列出 Step 能整除 step 且已经开始计算的层
+// 更细的层上等待重算的窗口也要算进更粗的层：细层重算之后才会把粗层标脏
+func (rm *rollupManager) plan(name string, step int64) []rollupLevel {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	st := rm.state[name]
+	rule := rm.cfg.match(name)
+	if st == nil || rule == nil {
+		return nil
+	}
+	var levels []rollupLevel
+	var stale []rollupRange
+	for k, ts := range st.Tiers {
+		if k >= len(rule.Tiers) || !ts.Started || step%ts.Step != 0 {
+			break
+		}
+		for _, d := range ts.Dirty {
+			stale = append(stale, rollupRange{Lo: d.Lo, Hi: d.Hi + ts.Step - 1})
+		}
+		sort.Slice(stale, func(i, j int) bool { return stale[i].Lo < stale[j].Lo })
+		levels = append(levels, rollupLevel{
+			step:     ts.Step,
+			duration: rule.Tiers[k].Step,
+			next:     ts.Next,
+			stale:    append([]rollupRange(nil), stale...),
+		})
+	}
+	return levels
+}
+
+// collectRollup 用第 k 层 (k < 0 为原始数据) 把 [lo, hi] 聚合进 step 宽的窗口
+// 这一层只负责完整落在 [lo, hi] 内、已经算好且不等待重算的窗口，其余部分交给更细的一层
+func (db *DB) collectRollup(name string, plan []rollupLevel, k int, lo, hi, step int64, accs map[int64]*rollupAcc) error {
+	if lo > hi {
+		return nil
+	}
+	get := func(t int64) *rollupAcc {
+		b := floorDiv(t, step) * step
+		a := accs[b]
+		if a == nil {
+			a = &rollupAcc{}
+			accs[b] = a
+		}
+		return a
+	}
+	if k < 0 {
+		err := db.ScanValues(name, lo, hi, func(p TypedPoint) error {
+			if !isStale(p.Value) {
+				get(p.Time).add(numeric(p.Value))
+			}
+			return nil
+		})
+		if errors.Is(err, ErrSeriesNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	level := plan[k]
+	a := ceilAlign(lo, level.step)
+	b := level.next
+	if hi < math.MaxInt64 {
+		b = min(b, floorDiv(hi+1, level.step)*level.step)
+	}
+	if a >= b {
+		return db.collectRollup(name, plan, k-1, lo, hi, step, accs)
+	}
+	if err := db.collectRollup(name, plan, k-1, lo, a-1, step, accs); err != nil {
+		return err
+	}
+	read := func(lo, hi int64) error {
+		parts, err := db.readRollup(name, level.duration, lo, hi)
+		if err != nil {
+			return err
+		}
+		for i, t := range parts.times {
+			get(t).merge(parts.accs[i])
+		}
+		return nil
+	}
+	cur := a
+	for _, r := range level.stale {
+		// 对齐到这一层的窗口：只要窗口里有一部分等待重算，整个窗口都交给更细的一层
+		slo := max(floorAlign(r.Lo, level.step), cur)
+		shi := min(floorAlign(r.Hi, level.step)+level.step-1, b-1)
+		if slo > shi {
+			continue
+		}
+		if cur < slo {
+			if err := read(cur, slo-1); err != nil {
+				return err
+			}
+		}
+		if err := db.collectRollup(name, plan, k-1, slo, shi, step, accs); err != nil {
+			return err
+		}
+		cur = shi + 1
+	}
+	if cur < b {
+		if err := read(cur, b-1); err != nil {
+			return err
+		}
+	}
+	return db.collectRollup(name, plan, k-1, b, hi, step, accs)
+}
+
+// floorAlign 向下对齐到 step 的整数倍；math.MinInt64 附近饱和到能表示的最小倍数
+func floorAlign(t, step int64) int64 {
+	q := floorDiv(t, step)
+	if q < math.MinInt64/step {
+		q++
+	}
+	return q * step
+}
+
+// ceilAlign 向上对齐到 step 的整数倍 (正数一侧的溢出由调用方避开)
+func ceilAlign(t, step int64) int64 {
+	q := t / step // 向零取整：负数时就是向上取整
+	if t > 0 && t%step != 0 {
+		q++
+	}
+	return q * step
+}
@@ -0,0 +1,258 @@
+package tcore
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rollupTestConfig() RollupConfig {
+	return RollupConfig{
+		TimeUnit: time.Second,
+		Rules: []RollupRule{{
+			Match:        "boiler*",
+			RawRetention: 2 * time.Hour,
+			Tiers:        []RollupTier{{Step: time.Minute, Retention: 6 * time.Hour}, {Step: time.Hour}},
+		}},
+	}
+}
+
+func queryAgg(t *testing.T, db *DB, start, end, step int64, agg string) map[int64]float64 {
+	t.Helper()
+	points, err := db.QueryAggregate("boiler", start, end, step, agg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[int64]float64, len(points))
+	for i, p := range points {
+		if i > 0 && p.Time <= points[i-1].Time {
+			t.Fatalf("out of order: %+v", points)
+		}
+		m[p.Time] = p.Value.Float
+	}
+	return m
+}
+
+func TestRollups(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRollupConfig(rollupTestConfig()); err != nil {
+		t.Fatal(err)
+	}
+	now := int64(3*3600 + 30)
+	db.rollups.clock = func() time.Time { return time.Unix(now, 0) }
+
+	// 三小时的原始数据，每 10 秒一个点，值等于序号
+	var raw []TypedPoint
+	for ts := int64(0); ts < 3*3600; ts += 10 {
+		raw = append(raw, TypedPoint{Time: ts, Value: FloatValue(float64(ts / 10))})
+	}
+	db.WriteBatch("boiler", raw)
+	db.Write("other", 1, 1) // 不匹配规则
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 小时一层：每小时 360 个点
+	got := queryAgg(t, db, 0, 3*3600-1, 3600, "avg")
+	for h := int64(0); h < 3; h++ {
+		if want := float64(360*h) + 179.5; got[h*3600] != want {
+			t.Fatalf("hour %d avg %v, want %v", h, got[h*3600], want)
+		}
+	}
+	// 原始数据已按保留期删到 3630，但小时汇总还在
+	if st, _ := db.Stats("boiler"); st.MinTime != 0 {
+		if pts, _ := db.QueryValues("boiler", 0, 3629); len(pts) != 0 {
+			t.Fatalf("raw data before the retention cut is still visible: %d points", len(pts))
+		}
+	}
+	// 不对齐的范围：两头的零头来自原始数据，中间整分钟来自 1 分钟层
+	got = queryAgg(t, db, 7205, 7324, 120, "count")
+	if len(got) != 2 || got[7200] != 11 || got[7320] != 1 {
+		t.Fatalf("stitched count: %v", got)
+	}
+	got = queryAgg(t, db, 7200, 7319, 60, "max")
+	if got[7200] != 725 || got[7260] != 731 {
+		t.Fatalf("minute max: %v", got)
+	}
+	if _, err := db.QueryAggregate("boiler", 0, 10, 60, "median"); !errors.Is(err, ErrUnknownAggregate) {
+		t.Fatalf("expected ErrUnknownAggregate, got %v", err)
+	}
+
+	// 迟到的数据：已经算好的分钟和小时都要重算，而且不能留下重复的汇总点
+	db.WriteBatch("boiler", []TypedPoint{{Time: 7201, Value: FloatValue(100000)}})
+	db.Write("boiler", 100, 5000) // 早于原始数据的保留期，不再进汇总
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryAgg(t, db, 7200, 10799, 3600, "max"); got[7200] != 100000 || len(got) != 1 {
+		t.Fatalf("hour max after late data: %v", got)
+	}
+	if got := queryAgg(t, db, 0, 3599, 3600, "count"); got[0] != 360 {
+		t.Fatalf("hour 0 count changed: %v", got)
+	}
+	maxes, _ := db.QueryValues(RollupSeriesName("boiler", time.Minute, "max"), 7200, 7200)
+	hours, _ := db.QueryValues(RollupSeriesName("boiler", time.Hour, "count"), 7200, 7200)
+	if len(maxes) != 1 || maxes[0].Value.Float != 100000 || len(hours) != 1 || hours[0].Value.Float != 361 {
+		t.Fatalf("recomputed windows: %+v %+v", maxes, hours)
+	}
+	if _, err := db.Stats(RollupSeriesName("other", time.Minute, "avg")); !errors.Is(err, ErrSeriesNotFound) {
+		t.Fatal("unmatched series was rolled up")
+	}
+
+	// 重启：配置和进度都在数据目录里
+	db.Close()
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if cfg := db.RollupConfig(); len(cfg.Rules) != 1 || cfg.Rules[0].Tiers[1].Step != time.Hour || cfg.TimeUnit != time.Second {
+		t.Fatalf("config after reopen: %+v", cfg)
+	}
+	data, _ := os.ReadFile(dir + "/" + rollupConfigFileName)
+	if !strings.Contains(string(data), `"raw_retention": "2h"`) {
+		t.Fatalf("rollups.json: %s", data)
+	}
+	if got := queryAgg(t, db, 7200, 7319, 60, "max"); got[7200] != 100000 {
+		t.Fatalf("minute max after reopen: %v", got)
+	}
+
+	// 7 小时后：1 分钟层超过 6 小时的保留期被删掉，小时层永久保留
+	now = 3*3600 + 7*3600
+	db.rollups.clock = func() time.Time { return time.Unix(now, 0) }
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryAgg(t, db, 0, 3*3600-1, 60, "max"); len(got) != 0 {
+		t.Fatalf("minute tier and raw data should be gone, got %d windows", len(got))
+	}
+	if got := queryAgg(t, db, 0, 3*3600-1, 7200, "sum"); len(got) != 2 {
+		t.Fatalf("hour tier: %v", got)
+	}
+}
+
+func TestRollupLateDataSealsOncePerPass(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetRollupConfig(rollupTestConfig()); err != nil {
+		t.Fatal(err)
+	}
+	now := int64(3*3600 + 30)
+	db.rollups.clock = func() time.Time { return time.Unix(now, 0) }
+
+	names := []string{"boiler1", "boiler2", "boiler3", "boiler4"}
+	for _, name := range names {
+		var raw []TypedPoint
+		for ts := int64(0); ts < 3*3600; ts += 10 {
+			raw = append(raw, TypedPoint{Time: ts, Value: FloatValue(1)})
+		}
+		db.WriteBatch(name, raw)
+	}
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每条时间线都有迟到数据，两层都要替换：整轮只封存一次活跃段
+	for _, name := range names {
+		for ts := int64(4001); ts < 4600; ts += 120 {
+			db.Write(name, ts, 2)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	before := len(db.manager.sealedSegments())
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(db.manager.sealedSegments()) - before; n > 1 {
+		t.Fatalf("expected at most 1 new sealed segment per pass, got %d", n)
+	}
+	for _, name := range names {
+		points, _ := db.QueryValues(RollupSeriesName(name, time.Hour, "max"), 3600, 3600)
+		if len(points) != 1 || points[0].Value.Float != 2 {
+			t.Fatalf("%s: hour max after late data: %+v", name, points)
+		}
+	}
+}
+
+func TestRollupQueryBeforeRecompute(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.SetRollupConfig(rollupTestConfig()); err != nil {
+		t.Fatal(err)
+	}
+	db.rollups.clock = func() time.Time { return time.Unix(3*3600+30, 0) }
+
+	var raw []TypedPoint
+	for ts := int64(0); ts < 3*3600; ts += 10 {
+		raw = append(raw, TypedPoint{Time: ts, Value: FloatValue(1)})
+	}
+	db.WriteBatch("boiler", raw)
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 迟到数据只把 1 分钟层标脏，还没有重算：两层的汇总点都是旧的，查询要改用原始数据
+	db.Write("boiler", 7201, 9)
+	if got := queryAgg(t, db, 3600, 10799, 3600, "max"); got[3600] != 1 || got[7200] != 9 {
+		t.Fatalf("hour max before recompute: %v", got)
+	}
+	if got := queryAgg(t, db, 7200, 10799, 3600, "count"); got[7200] != 361 {
+		t.Fatalf("hour count before recompute: %v", got)
+	}
+	if got := queryAgg(t, db, 7140, 7319, 60, "sum"); got[7140] != 6 || got[7200] != 15 || got[7260] != 6 {
+		t.Fatalf("minute sum before recompute: %v", got)
+	}
+
+	// 重算之后结果不变
+	if err := db.RunRollups(); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryAgg(t, db, 7200, 10799, 3600, "count"); got[7200] != 361 {
+		t.Fatalf("hour count after recompute: %v", got)
+	}
+}
+
+func TestRollupConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bad := RollupConfig{Rules: []RollupRule{{Tiers: []RollupTier{{Step: time.Minute}, {Step: 90 * time.Second}}}}}
+	if err := db.SetRollupConfig(bad); !errors.Is(err, ErrBadRollupConfig) {
+		t.Fatalf("expected ErrBadRollupConfig, got %v", err)
+	}
+	bad = RollupConfig{TimeUnit: time.Second, Rules: []RollupRule{{Tiers: []RollupTier{{Step: 1500 * time.Millisecond}}}}}
+	if err := db.SetRollupConfig(bad); !errors.Is(err, ErrBadRollupConfig) {
+		t.Fatalf("expected ErrBadRollupConfig for a sub-unit step, got %v", err)
+	}
+	if d, err := ParseRollupDuration("1d12h"); err != nil || d != 36*time.Hour {
+		t.Fatalf("ParseRollupDuration: %v %v", d, err)
+	}
+
+	// 没有规则时直接聚合原始数据
+	db.Write("plain", 1, 1)
+	db.Write("plain", 2, 3)
+	db.Write("plain", 11, 5)
+	points, err := db.QueryAggregate("plain", 0, 20, 10, "avg")
+	if err != nil || len(points) != 2 || points[0].Value.Float != 2 || points[1].Value.Float != 5 {
+		t.Fatalf("raw aggregate: %+v %v", points, err)
+	}
+}
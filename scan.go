@@ -0,0 +1,158 @@
+package tcore
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ScanValues 🌊 流式查询：逐个 Block 读出 [start, end] 内的点交给 fn，内存里同时只有一个 Block
+// 适合导出这种一次要读完整条时间线的场景。fn 返回错误时立即停止并把错误原样返回。
+//
+// 顺序：冷数据按 Block 的 MinTime 依次输出，每个 Block 内部按时间排好序，热数据最后输出；
+// 乱序写入导致 Block 之间时间重叠时，整体不保证严格有序。
+// 扫描期间 Compaction 会等待，普通查询不受影响
+func (db *DB) ScanValues(name string, start, end int64, fn func(TypedPoint) error) error {
+	if start > end {
+		return ErrInvalidRange
+	}
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return ErrSeriesNotFound
+	}
+
+	// 挡住 Compaction：它会删除我们还没读到的 Block 所在的文件
+	db.scanMu.RLock()
+	defer db.scanMu.RUnlock()
+
+	if err := db.scanBlocks(series, series.findBlocks(start, end), start, end, fn); err != nil {
+		return err
+	}
+
+	var hot []TypedPoint
+	if series.Type == TypeFloat {
+		for _, p := range series.getHotData() {
+			hot = append(hot, TypedPoint{Time: p.Time, Value: FloatValue(p.Value)})
+		}
+	} else {
+		hot = series.getTypedHotData()
+	}
+	sort.SliceStable(hot, func(i, j int) bool { return hot[i].Time < hot[j].Time })
+	for _, p := range hot {
+		if p.Time < start || p.Time > end {
+			continue
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SealedSegment 一个已封存 Segment 的概况，全部来自内存里的索引
+type SealedSegment struct {
+	ID      uint32
+	Blocks  int   // 活着的时间线在这个 Segment 里的 Block 数
+	Points  int64 // 这些 Block 头里的点数之和
+	MinTime int64 // 没有任何 Block 时为 0
+	MaxTime int64
+}
+
+// SealedSegments 🧊 列出所有已封存 (不再写入) 的 Segment，按 ID 升序
+// 封存的 Segment 内容不会再变，适合按 Segment 增量地做离线导出
+func (db *DB) SealedSegments() []SealedSegment {
+	ids := db.manager.sealedIDs()
+	list := make([]SealedSegment, len(ids))
+	pos := make(map[uint32]int, len(ids))
+	for i, id := range ids {
+		list[i] = SealedSegment{ID: id, MinTime: math.MaxInt64, MaxTime: math.MinInt64}
+		pos[id] = i
+	}
+	for _, series := range db.idx.getAllSeries() {
+		series.mu.RLock()
+		for _, meta := range series.blocks {
+			i, ok := pos[meta.FileID]
+			if !ok {
+				continue
+			}
+			list[i].Blocks++
+			list[i].Points += int64(meta.Count)
+			list[i].MinTime = min(list[i].MinTime, meta.MinTime)
+			list[i].MaxTime = max(list[i].MaxTime, meta.MaxTime)
+		}
+		series.mu.RUnlock()
+	}
+	for i := range list {
+		if list[i].Blocks == 0 {
+			list[i].MinTime, list[i].MaxTime = 0, 0
+		}
+	}
+	return list
+}
+
+// ScanSegmentValues 和 ScanValues 一样流式读出 [start, end] 内的点，但只读落在 segments 里的 Block，
+// 不含热数据。segments 中不存在的 ID 被忽略
+func (db *DB) ScanSegmentValues(name string, segments []uint32, start, end int64, fn func(TypedPoint) error) error {
+	if start > end {
+		return ErrInvalidRange
+	}
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return ErrSeriesNotFound
+	}
+
+	db.scanMu.RLock()
+	defer db.scanMu.RUnlock()
+
+	fileIDs := make(map[uint32]bool, len(segments))
+	for _, id := range segments {
+		fileIDs[id] = true
+	}
+	var metas []*BlockMeta
+	for _, meta := range series.blocksIn(fileIDs) {
+		if meta.MaxTime >= start && meta.MinTime <= end {
+			metas = append(metas, meta)
+		}
+	}
+	return db.scanBlocks(series, metas, start, end, fn)
+}
+
+// scanBlocks 按 MinTime 依次读出 Block，把 [start, end] 内没被删除的点交给 fn
+// 调用方持有 scanMu 读锁
+func (db *DB) scanBlocks(series *Series, metas []*BlockMeta, start, end int64, fn func(TypedPoint) error) error {
+	sort.SliceStable(metas, func(i, j int) bool { return metas[i].MinTime < metas[j].MinTime })
+	tombs := db.tombs.rangesFor(series.ID)
+
+	for _, meta := range metas {
+		points, err := db.readBlockValues(series.Type, meta)
+		if err != nil {
+			return fmt.Errorf("read block failed: %v", err)
+		}
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+		for _, p := range points {
+			if p.Time < start || p.Time > end || isDeleted(tombs, meta.FileID, p.Time) {
+				continue
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readBlockValues 按时间线类型读出一个 Block 的全部点
+func (db *DB) readBlockValues(typ ValueType, meta *BlockMeta) ([]TypedPoint, error) {
+	if typ != TypeFloat {
+		return db.readTypedBlock(meta)
+	}
+	block, err := db.manager.readBlock(meta)
+	if err != nil {
+		return nil, err
+	}
+	points := make([]TypedPoint, len(block.Points))
+	for i, p := range block.Points {
+		points[i] = TypedPoint{Time: p.Time, Value: FloatValue(p.Value)}
+	}
+	return points, nil
+}
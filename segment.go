@@ -1,253 +1,160 @@
 package tcore
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
-	"sync/atomic"
 )
 
-/*
-l (分区列表)
-	│
-	├── head ──→ [Mutable chunk 1] ←── 最新分区（可写）
-	│              │ next
-	│              ↓
-	│           [Mutable chunk 2] ←── 次新分区（可写，用于乱序）
-	│              │ next
-	│              ↓
-	│           [Immutable chunk 1]   ←── 只读
-	│              │ next
-	│              ↓
-	│           [Immutable chunk 2]   ←── 只读
-	│              │ next
-	│              ↓
-	│           [Immutable chunk 3]   ←── 最旧分区
-	│              │ next = nil
-	│
-	└── tail ──→ [Immutable chunk 3]   ←── 尾指针
-*/
-
-type chunkList struct {
-	numChunks int64
-	head      *chunkNode
-	tail      *chunkNode
-	mu        sync.RWMutex
-}
+// Segment 文件：一对 .vlog (数据) + .hint (索引)，只追加写
+//
+//	.vlog: [Length: 4字节 BigEndian][Data: Length 字节] ...，BlockMeta.Offset 指向 Data
+//	.hint: 38 字节定长记录，见 hint.go
+//
+// 文件名、长度前缀的格式只在这里定义，Manager、Compaction、fsck、快照和只读打开都经由这里的函数
+const (
+	SegmentFileNamePrefix = "seg-"
+	SegmentFileNameSuffix = ".vlog"
+	hintFileNameSuffix    = ".hint"
+
+	// blockLenSize 每个 Block 前面的长度前缀
+	blockLenSize = 4
+)
 
-func newchunkList() *chunkList {
-	return &chunkList{}
-}
+// Segment 一个数据段
+type Segment struct {
+	ID       uint32
+	Gen      uint32   // 代数：数据的新旧顺序，见 hint.go 的 genSensorID
+	File     *os.File // .vlog
+	HintFile *os.File // .hint，只追加
 
-func (l *chunkList) getHead() chunk {
-	if l.count() <= 0 {
-		return nil
-	}
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	return l.head.chunk()
+	mu     sync.Mutex // 保护 length，保证一次写入 (长度前缀 + 数据) 不被打断
+	length int64      // .vlog 已写入的字节数
 }
 
-func (l *chunkList) insert(chunk chunk) {
-	node := &chunkNode{
-		c: chunk,
+// newSegment 打开 (不存在时创建) dirPath 下编号为 id 的 .vlog 和 .hint
+func newSegment(dirPath string, id uint32) (*Segment, error) {
+	f, err := os.OpenFile(segmentPath(dirPath, id, SegmentFileNameSuffix), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
 	}
-	l.mu.RLock()
-	head := l.head
-	l.mu.RUnlock()
-	if head != nil {
-		node.next = head
+	hint, err := os.OpenFile(segmentPath(dirPath, id, hintFileNameSuffix), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		f.Close()
+		return nil, err
 	}
-
-	l.setHead(node)
-	atomic.AddInt64(&l.numChunks, 1)
-}
-
-func (l *chunkList) remove(target chunk) error {
-	if l.count() <= 0 {
-		return fmt.Errorf("emchunkListty chunk")
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		hint.Close()
+		return nil, err
 	}
-
-	// 从头开始遍历自身。
-	var prev, next *chunkNode
-	iterator := l.newIterator()
-	for iterator.next() {
-		current := iterator.currentNode()
-		if !samechunks(current.chunk(), target) {
-			prev = current
-			continue
-		}
-
-		// 删除当前节点。
-
-		iterator.next()
-		next = iterator.currentNode()
-		switch {
-		case prev == nil:
-			// 删除头节点
-			l.setHead(next)
-		case next == nil:
-			// 删除尾节点
-			prev.setNext(nil)
-			l.setTail(prev)
-		default:
-			// 删除中间节点
-			prev.setNext(next)
-		}
-		atomic.AddInt64(&l.numChunks, -1)
-
-		if err := current.chunk().clean(); err != nil {
-			return fmt.Errorf("failed to clean resources managed by chunk to be removed: %w", err)
-		}
-		return nil
-	}
-
-	return fmt.Errorf("the given chunk was not found")
+	return &Segment{ID: id, Gen: readGen(hint, id), File: f, HintFile: hint, length: st.Size()}, nil
 }
 
-func (l *chunkList) swachunkList(old, new chunk) error {
-	if l.count() <= 0 {
-		return fmt.Errorf("emchunkListty chunk")
+// readGen 从 .hint 的第一条记录读出代数，没有代数记录时就是 ID
+func readGen(hint io.ReaderAt, id uint32) uint32 {
+	sensorID, meta, err := DecodeHint(io.NewSectionReader(hint, 0, hintRecordSize))
+	if err != nil || sensorID != genSensorID {
+		return id
 	}
-
-	// 从头开始遍历自身。
-	var chunkListrev, next *chunkNode
-	iterator := l.newIterator()
-	for iterator.next() {
-		current := iterator.currentNode()
-		if !samechunks(current.chunk(), old) {
-			chunkListrev = current
-			continue
-		}
-
-		// 交换当前节点。
-
-		newNode := &chunkNode{
-			c:    new,
-			next: current.getNext(),
-		}
-		iterator.next()
-		next = iterator.currentNode()
-		switch {
-		case chunkListrev == nil:
-			// 交换头节点
-			l.setHead(newNode)
-		case next == nil:
-			// 交换尾节点
-			chunkListrev.setNext(newNode)
-			l.setTail(newNode)
-		default:
-			// swachunkListchunkListing the middle node
-			chunkListrev.setNext(newNode)
-		}
-		return nil
-	}
-
-	return fmt.Errorf("the given chunk was not found")
+	return meta.FileID
 }
 
-func samechunks(x, y chunk) bool {
-	return x.minTimestamp() == y.minTimestamp()
+// segmentPath Segment 伴生文件的路径，例如 seg-000001.vlog / seg-000001.hint
+func segmentPath(dirPath string, id uint32, suffix string) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%s%06d%s", SegmentFileNamePrefix, id, suffix))
 }
 
-func (l *chunkList) count() int {
-	return int(atomic.LoadInt64(&l.numChunks))
-}
-
-func (l *chunkList) newIterator() *chunkIterator {
-	l.mu.RLock()
-	head := l.head
-	l.mu.RUnlock()
-	// chunkListut a dummy node so that it chunkListositions the head on the first next() call.
-	dummy := &chunkNode{
-		next: head,
+// segmentIDFromName 从 seg-000001.vlog 这样的文件名里解析出 Segment ID
+func segmentIDFromName(name, suffix string) (uint32, bool) {
+	if !strings.HasPrefix(name, SegmentFileNamePrefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
 	}
-	return &chunkIterator{
-		current: dummy,
+	id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, SegmentFileNamePrefix), suffix), 10, 32)
+	if err != nil {
+		return 0, false
 	}
+	return uint32(id), true
 }
 
-func (l *chunkList) setHead(node *chunkNode) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.head = node
-}
+// ==========================================
+// ✍️ 写入 / 读取
+// ==========================================
 
-func (l *chunkList) setTail(node *chunkNode) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.tail = node
-}
+// write 追加一个 Block，返回数据 (长度前缀之后) 的偏移
+func (s *Segment) write(data []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-func (l *chunkList) String() string {
-	b := &strings.Builder{}
-	iterator := l.newIterator()
-	for iterator.next() {
-		chunk := iterator.chunk()
-		if _, ok := chunk.(*mutablechunk); ok {
-			b.WriteString("[Memory chunk]")
-		} else if _, ok := chunk.(*immutablechunk); ok {
-			b.WriteString("[Disk chunk]")
-		} else {
-			b.WriteString("[Unknown chunk]")
-		}
-		b.WriteString("->")
+	buf := make([]byte, blockLenSize+len(data))
+	binary.BigEndian.PutUint32(buf[:blockLenSize], uint32(len(data)))
+	copy(buf[blockLenSize:], data)
+	if _, err := s.File.WriteAt(buf, s.length); err != nil {
+		return 0, err
 	}
-	return strings.TrimSuffix(b.String(), "->")
-}
-
-// chunkNode wrachunkLists a chunk to hold the chunkListointer to the next one.
-type chunkNode struct {
-	// chunk is immutable
-	c    chunk
-	next *chunkNode
-	mu   sync.RWMutex
+	offset := s.length + blockLenSize
+	s.length += int64(len(buf))
+	return offset, nil
 }
 
-// chunkue gives back the actual chunk of the node.
-func (node *chunkNode) chunk() chunk {
-	return node.c
+// readAt 读出一个 Block 的数据
+func (s *Segment) readAt(size uint32, offset int64) ([]byte, error) {
+	return readBlockAt(s.File, s.ID, size, offset)
 }
 
-func (node *chunkNode) setNext(nextNode *chunkNode) {
-	node.mu.Lock()
-	defer node.mu.Unlock()
-	node.next = nextNode
+// readBlockAt 从 .vlog 读出 [offset, offset+size) 的 Block 数据 (活跃段和只读句柄共用)
+func readBlockAt(r io.ReaderAt, id uint32, size uint32, offset int64) ([]byte, error) {
+	buf := make([]byte, size)
+	n, err := r.ReadAt(buf, offset)
+	if err == io.EOF && n == len(buf) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("segment %d: %v", id, err)
+	}
+	return buf, nil
 }
 
-func (node *chunkNode) getNext() *chunkNode {
-	node.mu.RLock()
-	defer node.mu.RUnlock()
-	return node.next
+// nextBlock 在整个 .vlog 的内容里切出 pos 处的下一个 Block，返回数据的起止位置
+// 剩下的字节不够一个完整的 Block 时 ok 为 false (文件结尾或写了一半的尾巴)；
+// 长度为 0 多半是崩溃时文件被预分配出来的一段零，同样视为结尾
+func nextBlock(data []byte, pos int) (start, end int, ok bool) {
+	if len(data)-pos < blockLenSize {
+		return 0, 0, false
+	}
+	n := int(binary.BigEndian.Uint32(data[pos : pos+blockLenSize]))
+	if n == 0 || n > len(data)-pos-blockLenSize {
+		return 0, 0, false
+	}
+	start = pos + blockLenSize
+	return start, start + n, true
 }
 
-// chunkIterator 表示分区列表的迭代器。基本用法如下：
-/*
-  for iterator.next() {
-    chunk, err := iterator.chunkue()
-    // 使用分区做些什么
-  }
-*/
-type chunkIterator struct {
-	current *chunkNode
+// size 当前 .vlog 的长度
+func (s *Segment) size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.length
 }
 
-func (i *chunkIterator) next() bool {
-	if i.current == nil {
-		return false
+// Sync 把 .vlog 和 .hint 一起刷盘
+func (s *Segment) Sync() error {
+	if err := s.File.Sync(); err != nil {
+		return err
 	}
-	next := i.current.getNext()
-	i.current = next
-	return i.current != nil
+	return s.HintFile.Sync()
 }
 
-func (i *chunkIterator) chunk() chunk {
-	if i.current == nil {
-		return nil
+func (s *Segment) close() error {
+	herr := s.HintFile.Close()
+	if err := s.File.Close(); err != nil {
+		return err
 	}
-	return i.current.chunk()
-}
-
-func (i *chunkIterator) currentNode() *chunkNode {
-	return i.current
+	return herr
 }
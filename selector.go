@@ -0,0 +1,249 @@
+package tcore
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrBadSelector = errors.New("invalid series selector")
+
+// Selector 按名字和标签挑选时间线，写法与 PromQL 的 series selector 一致：
+//
+//	temperature{site="plant-3"}     metric 为 temperature 且 site 为 plant-3
+//	{site=~"plant-.*",line!="B"}    任意 metric；支持 = != =~ !~，正则是全匹配
+//	boiler.*                        metric 部分按 path.Match 匹配
+//
+// 时间线名里 {} 中的标签可以是 Prometheus 风格 (k="v") 或行协议风格 (k=v)；
+// 名字不带 {} 时整个名字就是 metric。不存在的标签按空字符串参与匹配，与 Prometheus 一致
+type Selector struct {
+	raw      string
+	metric   string // path.Match 模式，空表示任意
+	matchers []labelMatcher
+}
+
+// labelMatcher 一个标签条件
+type labelMatcher struct {
+	name, op, value string
+	re              *regexp.Regexp
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// ParseSelector 解析时间线选择器
+func ParseSelector(s string) (*Selector, error) {
+	s = strings.TrimSpace(s)
+	metric, rest, hasLabels := strings.Cut(s, "{")
+	metric = strings.TrimSpace(metric)
+	if _, err := path.Match(metric, ""); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadSelector, s, err)
+	}
+	sel := &Selector{raw: s, metric: metric}
+	if !hasLabels {
+		if metric == "" {
+			return nil, fmt.Errorf("%w: empty", ErrBadSelector)
+		}
+		return sel, nil
+	}
+
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		if rest == "}" {
+			return sel, nil
+		}
+		m, tail, err := parseLabelMatcher(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrBadSelector, s, err)
+		}
+		sel.matchers = append(sel.matchers, m)
+
+		rest = strings.TrimLeft(tail, " ")
+		switch {
+		case rest == "}":
+			return sel, nil
+		case strings.HasPrefix(rest, ","):
+			rest = rest[1:]
+		default:
+			return nil, fmt.Errorf("%w: %q: expected , or }", ErrBadSelector, s)
+		}
+	}
+}
+
+func (sel *Selector) String() string {
+	return sel.raw
+}
+
+// Match 时间线名是否满足选择器
+func (sel *Selector) Match(name string) bool {
+	metric, labels := splitSeriesName(name)
+	if sel.metric != "" {
+		if ok, _ := path.Match(sel.metric, metric); !ok {
+			return false
+		}
+	}
+	for _, m := range sel.matchers {
+		value := labels[m.name]
+		var ok bool
+		switch m.op {
+		case "=":
+			ok = value == m.value
+		case "!=":
+			ok = value != m.value
+		case "=~":
+			ok = m.re.MatchString(value)
+		case "!~":
+			ok = !m.re.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ==========================================
+// 🔒 解析
+// ==========================================
+
+// parseLabelMatcher 解析 name op "value"，返回剩下的部分
+func parseLabelMatcher(s string) (labelMatcher, string, error) {
+	var m labelMatcher
+	i := strings.IndexAny(s, "=!")
+	if i <= 0 {
+		return m, "", errors.New("expected label name")
+	}
+	m.name = strings.TrimSpace(s[:i])
+	s = s[i:]
+	for _, op := range []string{"=~", "!~", "!=", "="} {
+		if strings.HasPrefix(s, op) {
+			m.op = op
+			break
+		}
+	}
+	if m.op == "" {
+		return m, "", errors.New("expected = != =~ or !~")
+	}
+	s = strings.TrimLeft(s[len(m.op):], " ")
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return m, "", fmt.Errorf("label %s: value must be quoted", m.name)
+	}
+	m.value, _ = strconv.Unquote(quoted)
+	if m.op == "=~" || m.op == "!~" {
+		if m.re, err = regexp.Compile("^(?:" + m.value + ")$"); err != nil {
+			return m, "", err
+		}
+	}
+	return m, s[len(quoted):], nil
+}
+
+// splitSeriesName 拆出时间线名的 metric 和标签
+// 认得 metric{k="v"} 和行协议的 measurement.field{k=v} (带反斜杠转义)；其它名字整个当作 metric
+func splitSeriesName(name string) (string, map[string]string) {
+	open := indexUnescapedByte(name, '{')
+	if open < 0 || !strings.HasSuffix(name, "}") {
+		return name, nil
+	}
+	metric, rest := name[:open], name[open+1:len(name)-1]
+	labels := make(map[string]string)
+	for rest != "" {
+		eq := indexUnescapedByte(rest, '=')
+		if eq <= 0 {
+			return name, nil
+		}
+		key := unescapeName(rest[:eq])
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return name, nil
+			}
+			value, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted):]
+		} else {
+			end := indexUnescapedByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = unescapeName(rest[:end]), rest[end:]
+		}
+		labels[key] = value
+
+		if rest != "" {
+			if rest[0] != ',' {
+				return name, nil
+			}
+			rest = rest[1:]
+		}
+	}
+	return metric, labels
+}
+
+// indexUnescapedByte 第一个前面不是反斜杠的 c
+func indexUnescapedByte(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeName(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// nameEscaper 行协议风格标签里需要转义的字符，与 lineproto 生成名字时一致
+var nameEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `=`, `\=`, `{`, `\{`, `}`, `\}`)
+
+// joinSeriesName 是 splitSeriesName 的逆过程：标签按名字排序，quoted 时写成 Prometheus 风格 (k="v")，
+// 否则写成行协议风格 (k=v)；没有标签时只有 metric
+func joinSeriesName(metric string, labels map[string]string, quoted bool) string {
+	if len(labels) == 0 {
+		return metric
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(metric)
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(nameEscaper.Replace(k))
+		b.WriteByte('=')
+		if quoted {
+			b.WriteString(strconv.Quote(labels[k]))
+		} else {
+			b.WriteString(nameEscaper.Replace(labels[k]))
+		}
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package tcore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSelector(t *testing.T) {
+	cases := []struct {
+		sel  string
+		name string
+		want bool
+	}{
+		{`temperature{site="plant-3"}`, `temperature{room="a",site="plant-3"}`, true},
+		{`temperature{site="plant-3"}`, `temperature{site="plant-1"}`, false},
+		{`temperature{site="plant-3"}`, `humidity{site="plant-3"}`, false},
+		{`{site=~"plant-[0-9]"}`, `humidity{site="plant-3"}`, true},
+		{`{site=~"plant"}`, `humidity{site="plant-3"}`, false}, // 正则是全匹配
+		{`{site!="plant-3"}`, `humidity`, true},                // 不存在的标签当作空字符串
+		{`{site!~".+"}`, `humidity{site="x"}`, false},
+		{`boiler.*`, `boiler.temp`, true},
+		{`boiler.*`, `pump.temp`, false},
+		{`cpu.usage{host="a b"}`, `cpu.usage{host=a\ b,region=eu}`, true}, // 行协议风格的名字
+		{`cpu.usage{ host = "a,b" , }`, `cpu.usage{host=a\,b}`, true},
+		{`weird`, `weird{not labels`, false},
+	}
+	for _, c := range cases {
+		sel, err := ParseSelector(c.sel)
+		if err != nil {
+			t.Fatalf("%s: %v", c.sel, err)
+		}
+		if got := sel.Match(c.name); got != c.want {
+			t.Errorf("%s on %s: got %v, want %v", c.sel, c.name, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"", `{site="a"`, `{site=a}`, `{="a"}`, `{site~"a"}`, `{site=~"("}`, `[a`} {
+		if _, err := ParseSelector(bad); !errors.Is(err, ErrBadSelector) {
+			t.Errorf("%q: expected ErrBadSelector, got %v", bad, err)
+		}
+	}
+}
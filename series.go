@@ -1,6 +1,7 @@
 package tcore
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -14,19 +15,36 @@ const (
 // Series 代表一个传感器的专属时间线
 type Series struct {
 	ID            uint32
+	Type          ValueType    // 数值类型：注册进字典时确定，之后不可更改
 	mu            sync.RWMutex // 读写锁：保护下方所有字段
-	activeBuffer  []Point      // 热数据：待落盘的点
+	activeBuffer  []Point      // 热数据：待落盘的点 (float64 时间线)
+	typedBuffer   []TypedPoint // 热数据：待落盘的点 (其它类型的时间线)
 	blocks        []*BlockMeta // 冷索引：已落盘的数据块目录
 	lastFlushTime time.Time    // 计时器：上次成功刷盘的时间
+	lastArrival   time.Time    // 最近一次写入到达的墙上时间，零值表示从没收到过
+	lastWritten   TypedPoint   // 最近一次写入的点 (按到达顺序，不一定是时间戳最大的)
+	staleMarked   bool         // 沉默后已经写过陈旧标记，收到新数据前不再写
+	latest        TypedPoint   // 缓存：时间戳最大的点 (不含陈旧标记)，LastPoint 直接返回它
+	hasLatest     bool         // latest 有效
+	latestDirty   bool         // 缓存不可信 (刚加载或删过数据)，需要从磁盘重算；期间 latest 只记录新写入的最大点
+	latestEpoch   uint64       // 每次作废缓存加一，重算期间发生了删除就不采用重算结果
 }
 
-func newSeries(id uint32) *Series {
-	return &Series{
+func newSeries(id uint32, typ ValueType) *Series {
+	s := &Series{
 		ID:            id,
-		activeBuffer:  make([]Point, 0, BlockMaxPoints), // 预分配容量，避免扩容开销
+		Type:          typ,
 		blocks:        make([]*BlockMeta, 0),
 		lastFlushTime: time.Now(),
+		latestDirty:   true, // 落盘的数据还没看过
 	}
+	// 预分配容量，避免扩容开销
+	if typ == TypeFloat {
+		s.activeBuffer = make([]Point, 0, BlockMaxPoints)
+	} else {
+		s.typedBuffer = make([]TypedPoint, 0, BlockMaxPoints)
+	}
+	return s
 }
 
 // ==========================================
@@ -39,6 +57,7 @@ func (s *Series) append(point Point) []Point {
 	defer s.mu.Unlock()
 
 	s.activeBuffer = append(s.activeBuffer, point)
+	s.noteArrivalLocked(TypedPoint{Time: point.Time, Value: FloatValue(point.Value)})
 
 	// ⚡️ 触发条件 A：数量满了
 	if len(s.activeBuffer) >= BlockMaxPoints {
@@ -47,6 +66,41 @@ func (s *Series) append(point Point) []Point {
 	return nil // 没满，返回 nil，外部无需执行写盘
 }
 
+// markStale 沉默超过 after 时追加一个陈旧标记：和 append 一样进热数据，但不算一次写入
+// 标记的时间戳是 now 换算成 unit 后的值，且一定晚于最后一个点；从没收到过写入的时间线不标记
+func (s *Series) markStale(now time.Time, after time.Duration, unit int64) (flush []Point, marked bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lastArrival.IsZero() || s.staleMarked || now.Sub(s.lastArrival) < after {
+		return nil, false
+	}
+	ts := max(now.UnixNano()/unit, s.lastWritten.Time+1)
+	s.activeBuffer = append(s.activeBuffer, Point{Time: ts, Value: StaleNaN})
+	s.staleMarked = true
+	if len(s.activeBuffer) >= BlockMaxPoints {
+		return s.stealLocked(), true
+	}
+	return nil, true
+}
+
+// noteArrival 记录一次写入 (WriteBatch 直接落盘，不经过 append)
+func (s *Series) noteArrival(p TypedPoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noteArrivalLocked(p)
+}
+
+// noteArrivalLocked 调用方必须持有写锁
+func (s *Series) noteArrivalLocked(p TypedPoint) {
+	s.lastArrival = time.Now()
+	s.lastWritten = p
+	s.staleMarked = false
+	if !isStale(p.Value) && (!s.hasLatest || p.Time >= s.latest.Time) {
+		s.latest, s.hasLatest = p, true
+	}
+}
+
 // checkForTicker 供后台 Ticker 调用，检查是否因为超时需要强制刷盘
 func (s *Series) checkForTicker() []Point {
 	s.mu.Lock()
@@ -71,6 +125,54 @@ func (s *Series) stealLocked() []Point {
 	return dataToSteal
 }
 
+// drain 取走全部热数据，不管是否达到阈值 (DB.Flush 使用)
+func (s *Series) drain() ([]Point, []TypedPoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var points []Point
+	var typed []TypedPoint
+	if len(s.activeBuffer) > 0 {
+		points = s.stealLocked()
+	}
+	if len(s.typedBuffer) > 0 {
+		typed = s.stealTypedLocked()
+	}
+	return points, typed
+}
+
+// appendTyped 与 append 相同，作用于非 float64 时间线
+func (s *Series) appendTyped(point TypedPoint) []TypedPoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.typedBuffer = append(s.typedBuffer, point)
+	s.noteArrivalLocked(point)
+	if len(s.typedBuffer) >= BlockMaxPoints {
+		return s.stealTypedLocked()
+	}
+	return nil
+}
+
+// checkTypedForTicker 与 checkForTicker 相同，作用于非 float64 时间线
+func (s *Series) checkTypedForTicker() []TypedPoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.typedBuffer) > 0 && time.Since(s.lastFlushTime) >= ForceFlushInterval {
+		return s.stealTypedLocked()
+	}
+	return nil
+}
+
+// stealTypedLocked 与 stealLocked 相同（调用方必须持有写锁）
+func (s *Series) stealTypedLocked() []TypedPoint {
+	dataToSteal := s.typedBuffer
+	s.typedBuffer = make([]TypedPoint, 0, BlockMaxPoints)
+	s.lastFlushTime = time.Now()
+	return dataToSteal
+}
+
 // addBlockMeta 数据成功落盘后，由外部调用此方法将元数据登记造册
 func (s *Series) addBlockMeta(meta *BlockMeta) {
 	s.mu.Lock()
@@ -93,6 +195,16 @@ func (s *Series) getHotData() []Point {
 	return result
 }
 
+// getTypedHotData 获取尚未落盘的 typed 热数据（安全拷贝）
+func (s *Series) getTypedHotData() []TypedPoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]TypedPoint, len(s.typedBuffer))
+	copy(result, s.typedBuffer)
+	return result
+}
+
 // findBlocks 查询冷数据索引：找出在指定时间范围内的所有 Block
 func (s *Series) findBlocks(start, end int64) []*BlockMeta {
 	s.mu.RLock()
@@ -109,3 +221,96 @@ func (s *Series) findBlocks(start, end int64) []*BlockMeta {
 	}
 	return result
 }
+
+// ==========================================
+// 🗑️ 删除路径 (Delete Path)
+// ==========================================
+
+// dropHotData 从热数据中剔除 [start, end] 内的点
+func (s *Series) dropHotData(start, end int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.activeBuffer[:0]
+	for _, p := range s.activeBuffer {
+		if p.Time < start || p.Time > end {
+			kept = append(kept, p)
+		}
+	}
+	s.activeBuffer = kept
+
+	keptTyped := s.typedBuffer[:0]
+	for _, p := range s.typedBuffer {
+		if p.Time < start || p.Time > end {
+			keptTyped = append(keptTyped, p)
+		}
+	}
+	s.typedBuffer = keptTyped
+
+	// 缓存的点被删了就作废；正在重算的结果也可能落在范围里，同样作废
+	if s.latestDirty || !s.hasLatest || (s.latest.Time >= start && s.latest.Time <= end) {
+		s.invalidateLatestLocked()
+	}
+}
+
+// fileIDs 列出与 [start, end] 有交集的 Block 所在的 Segment
+func (s *Series) fileIDs(start, end int64) []uint32 {
+	seen := make(map[uint32]bool)
+	var ids []uint32
+	for _, meta := range s.findBlocks(start, end) {
+		if !seen[meta.FileID] {
+			seen[meta.FileID] = true
+			ids = append(ids, meta.FileID)
+		}
+	}
+	return ids
+}
+
+// ==========================================
+// 🧹 整理路径 (Compaction Path)
+// ==========================================
+
+// blocksIn 找出落在指定 Segment 集合里的所有 Block
+func (s *Series) blocksIn(fileIDs map[uint32]bool) []*BlockMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*BlockMeta
+	for _, meta := range s.blocks {
+		if fileIDs[meta.FileID] {
+			result = append(result, meta)
+		}
+	}
+	return result
+}
+
+// replaceBlocks 原子地把旧 Segment 里的 Block 换成 Compaction 产出的新 Block
+// 期间新落盘的 Block 不在 fileIDs 中，会被原样保留
+func (s *Series) replaceBlocks(fileIDs map[uint32]bool, merged []*BlockMeta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := make([]*BlockMeta, 0, len(s.blocks)+len(merged))
+	for _, meta := range s.blocks {
+		if !fileIDs[meta.FileID] {
+			kept = append(kept, meta)
+		}
+	}
+	s.blocks = append(kept, merged...)
+	s.sortBlocksLocked()
+}
+
+// blockCount 返回已落盘 Block 的数量
+func (s *Series) blockCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.blocks)
+}
+
+// sortBlocksLocked 按 MinTime 排序冷索引（调用方必须持有写锁）
+// Compaction 产物的 FileID 比新数据大，不能再依赖文件顺序保证时间单调
+func (s *Series) sortBlocksLocked() {
+	sort.SliceStable(s.blocks, func(i, j int) bool {
+		return s.blocks[i].MinTime < s.blocks[j].MinTime
+	})
+}
@@ -0,0 +1,456 @@
+package tcore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 快照目录的布局与数据目录相同，外加一份清单：
+//
+//	seg-000001.vlog / seg-000001.hint ...   已封存的段：硬链接 (跨文件系统时复制)
+//	seg-000007.vlog / seg-000007.hint       活跃段：只复制快照那一刻的长度
+//	catalog.idx / tombstones.log            复制
+//	snapshot.json                           清单：每个文件的大小和 CRC，最后写入
+//
+// 清单存在 = 快照完整；RestoreSnapshot 先逐个核对清单，通过后才会落到数据目录
+
+const (
+	snapshotManifestName = "snapshot.json"
+	snapshotVersion      = 1
+)
+
+var (
+	ErrSnapshotExists    = errors.New("snapshot directory is not empty")
+	ErrSnapshotCorrupted = errors.New("snapshot is corrupted")
+)
+
+// SnapshotFile 清单里的一个文件
+type SnapshotFile struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	CRC32    uint32 `json:"crc32"`
+	FromBase bool   `json:"from_base,omitempty"` // 增量快照：直接沿用基准快照里的同一个文件
+}
+
+// SnapshotManifest 快照清单
+type SnapshotManifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"created_at"`
+	Base      string         `json:"base,omitempty"` // 增量快照的基准目录
+	Files     []SnapshotFile `json:"files"`
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Snapshot 📸 在线备份到 dir (不存在或为空)
+// 先把热数据落盘，再记下活跃段当前的长度；已封存的段不会再变，直接硬链接。
+// 写入只在记录长度的一瞬间被挡住，复制期间照常进行；Compaction 会等快照结束
+func (db *DB) Snapshot(dir string) (*SnapshotManifest, error) {
+	return db.snapshot(dir, "")
+}
+
+// IncrementalSnapshot 📸 增量备份：baseDir 是上一次的快照
+// 基准快照里已有、且大小没变的段直接从基准硬链接过来，只复制新增的段。
+// 产出的仍是一份完整、可以单独恢复的快照
+func (db *DB) IncrementalSnapshot(dir, baseDir string) (*SnapshotManifest, error) {
+	return db.snapshot(dir, baseDir)
+}
+
+// VerifySnapshot 🔍 校验快照：清单本身完整 (段文件成对、字典在)，清单里的文件逐个核对大小和 CRC
+// 只检查快照自己可能引入的问题：数据目录原有的、Fsck 能修复的问题原样带进快照，不影响校验，
+// 恢复之后照常用 Fsck 处理
+func VerifySnapshot(dir string) (*SnapshotManifest, error) {
+	manifest, err := readSnapshotManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSnapshotFiles(manifest.Files); err != nil {
+		return nil, err
+	}
+	for _, f := range manifest.Files {
+		size, crc, err := fileChecksum(filepath.Join(dir, f.Name))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupted, err)
+		}
+		if size != f.Size || crc != f.CRC32 {
+			return nil, fmt.Errorf("%w: %s has size %d crc %08x, manifest says %d %08x", ErrSnapshotCorrupted, f.Name, size, crc, f.Size, f.CRC32)
+		}
+	}
+	return manifest, nil
+}
+
+// RestoreSnapshot ♻️ 校验快照后把它恢复成数据目录 dataDir (不存在或为空)
+// 先复制到临时目录再整体 rename，中途失败不会留下半个数据目录；之后用 NewDB 打开即可
+func RestoreSnapshot(snapshotDir, dataDir string) error {
+	manifest, err := VerifySnapshot(snapshotDir)
+	if err != nil {
+		return err
+	}
+	if err := ensureEmptyDir(dataDir); err != nil {
+		return err
+	}
+	os.Remove(dataDir) // 空目录：让位给 rename
+
+	tmpDir := filepath.Clean(dataDir) + ".restore.tmp"
+	os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	for _, f := range manifest.Files {
+		if _, _, err := copyFile(filepath.Join(snapshotDir, f.Name), filepath.Join(tmpDir, f.Name), -1); err != nil {
+			os.RemoveAll(tmpDir)
+			return err
+		}
+	}
+	if err := syncDir(tmpDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Rename(tmpDir, dataDir); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	return syncDir(filepath.Dir(filepath.Clean(dataDir)))
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+func (db *DB) snapshot(dir, baseDir string) (*SnapshotManifest, error) {
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	var base map[string]SnapshotFile
+	if baseDir != "" {
+		bm, err := readSnapshotManifest(baseDir)
+		if err != nil {
+			return nil, err
+		}
+		base = make(map[string]SnapshotFile, len(bm.Files))
+		for _, f := range bm.Files {
+			base[f.Name] = f
+		}
+	}
+
+	if err := ensureEmptyDir(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// 1. 热数据落盘
+	if err := db.Flush(); err != nil {
+		return nil, err
+	}
+
+	// 2. 挡住 Compaction：已封存的段在复制完之前不能被删
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	// 3. 记下这一刻的文件集合和活跃段长度
+	state, err := db.manager.snapshotState()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &SnapshotManifest{Version: snapshotVersion, CreatedAt: time.Now().UTC(), Base: baseDir}
+	add := func(name string, limit int64, link bool) error {
+		f, err := snapshotSegmentFile(db.manager.dirPath, dir, baseDir, base, name, limit, link)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, f)
+		return nil
+	}
+
+	// 4. 段文件
+	for _, id := range state.sealed {
+		for _, suffix := range []string{SegmentFileNameSuffix, hintFileNameSuffix} {
+			if err := add(filepath.Base(segmentPath(dir, id, suffix)), -1, true); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := add(filepath.Base(segmentPath(dir, state.activeID, SegmentFileNameSuffix)), state.vlogLen, false); err != nil {
+		return nil, err
+	}
+	if err := add(filepath.Base(segmentPath(dir, state.activeID, hintFileNameSuffix)), state.hintLen, false); err != nil {
+		return nil, err
+	}
+
+	// 5. 字典和墓碑：在它们自己的锁里读，拿到的一定是完整的记录
+	// 字典晚于段文件复制，快照里每个 Block 的 SensorID 都能在字典里找到
+	db.idx.mu.RLock()
+	catalog, err := os.ReadFile(filepath.Join(db.manager.dirPath, catalogFileName))
+	db.idx.mu.RUnlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	db.tombs.mu.RLock()
+	tombs, err := os.ReadFile(db.tombs.path)
+	db.tombs.mu.RUnlock()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// 降采样配置和进度：进度只影响效率，和数据差一点没关系
+	files, err := db.rollups.snapshotFiles()
+	if err != nil {
+		return nil, err
+	}
+	files[catalogFileName], files[tombstoneFileName] = catalog, tombs
+	if cqs, err := db.cqs.snapshotFile(); err != nil {
+		return nil, err
+	} else if cqs != nil {
+		files[cqFileName] = cqs
+	}
+	if lastWrites, err := os.ReadFile(db.staleness.path); err == nil {
+		files[lastWriteFileName] = lastWrites // 原子改名写入的，读到的一定是完整的文件
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if alerts, err := db.alerts.snapshotFile(); err != nil {
+		return nil, err
+	} else if alerts != nil {
+		files[alertFileName] = alerts
+	}
+	for name, data := range files {
+		if err := writeFileSync(filepath.Join(dir, name), data); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, SnapshotFile{Name: name, Size: int64(len(data)), CRC32: crc32.ChecksumIEEE(data)})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Name < manifest.Files[j].Name })
+
+	// 6. 清单最后写：有清单的快照一定是完整的
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		return nil, err
+	}
+	if err := writeFileSync(filepath.Join(dir, snapshotManifestName+".tmp"), data); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(filepath.Join(dir, snapshotManifestName+".tmp"), filepath.Join(dir, snapshotManifestName)); err != nil {
+		return nil, err
+	}
+	return manifest, syncDir(dir)
+}
+
+// checkSnapshotFiles 核对清单的文件列表：文件名不能带路径、不能重复，
+// 每个段的 .vlog 和 .hint 成对出现，字典必须在
+func checkSnapshotFiles(files []SnapshotFile) error {
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		if f.Name == "" || f.Name != filepath.Base(f.Name) || f.Name == ".." || names[f.Name] {
+			return fmt.Errorf("%w: bad file name %q in manifest", ErrSnapshotCorrupted, f.Name)
+		}
+		names[f.Name] = true
+	}
+	pairs := [][2]string{{SegmentFileNameSuffix, hintFileNameSuffix}, {hintFileNameSuffix, SegmentFileNameSuffix}}
+	for name := range names {
+		for _, p := range pairs {
+			id, ok := segmentIDFromName(name, p[0])
+			if !ok {
+				continue
+			}
+			if other := filepath.Base(segmentPath("", id, p[1])); !names[other] {
+				return fmt.Errorf("%w: manifest lists %s without %s", ErrSnapshotCorrupted, name, other)
+			}
+		}
+	}
+	if !names[catalogFileName] {
+		return fmt.Errorf("%w: manifest does not list %s", ErrSnapshotCorrupted, catalogFileName)
+	}
+	return nil
+}
+
+// segmentSnapshotState 快照那一刻的段文件集合
+type segmentSnapshotState struct {
+	sealed   []uint32
+	activeID uint32
+	vlogLen  int64
+	hintLen  int64
+}
+
+// snapshotState 等进行中的写入全部完成，记下活跃段的 .vlog 和 .hint 长度
+// 之后的写入只会追加在这两个长度之后，按长度截取就是一份自洽的活跃段
+func (m *Manager) snapshotState() (*segmentSnapshotState, error) {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	m.mu.RLock()
+	active := m.activeSegment
+	state := &segmentSnapshotState{sealed: make([]uint32, 0, len(m.olderSegments))}
+	for id := range m.olderSegments {
+		state.sealed = append(state.sealed, id)
+	}
+	m.mu.RUnlock()
+	sort.Slice(state.sealed, func(i, j int) bool { return state.sealed[i] < state.sealed[j] })
+
+	state.activeID = active.ID
+	state.vlogLen = active.size()
+	st, err := os.Stat(segmentPath(m.dirPath, active.ID, hintFileNameSuffix))
+	if err != nil {
+		return nil, err
+	}
+	state.hintLen = st.Size()
+	return state, nil
+}
+
+// snapshotSegmentFile 把一个段文件放进快照
+// 基准快照里有同名同大小的文件就沿用 (段文件只追加，同样长度的前缀内容必然相同)；
+// 否则已封存的段硬链接，活跃段按 limit 复制
+func snapshotSegmentFile(srcDir, dir, baseDir string, base map[string]SnapshotFile, name string, limit int64, link bool) (SnapshotFile, error) {
+	dst := filepath.Join(dir, name)
+	src := filepath.Join(srcDir, name)
+
+	size := limit
+	if size < 0 {
+		st, err := os.Stat(src)
+		if err != nil {
+			return SnapshotFile{}, err
+		}
+		size = st.Size()
+	}
+	if prev, ok := base[name]; ok && prev.Size == size {
+		if err := linkOrCopy(filepath.Join(baseDir, name), dst); err != nil {
+			return SnapshotFile{}, err
+		}
+		prev.FromBase = true
+		return prev, nil
+	}
+
+	if link {
+		if err := linkOrCopy(src, dst); err != nil {
+			return SnapshotFile{}, err
+		}
+		size, crc, err := fileChecksum(dst)
+		if err != nil {
+			return SnapshotFile{}, err
+		}
+		return SnapshotFile{Name: name, Size: size, CRC32: crc}, nil
+	}
+
+	size, crc, err := copyFile(src, dst, limit)
+	if err != nil {
+		return SnapshotFile{}, err
+	}
+	return SnapshotFile{Name: name, Size: size, CRC32: crc}, nil
+}
+
+func readSnapshotManifest(dir string) (*SnapshotManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotManifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s is missing", ErrSnapshotCorrupted, snapshotManifestName)
+		}
+		return nil, err
+	}
+	manifest := &SnapshotManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupted, err)
+	}
+	if manifest.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrSnapshotCorrupted, manifest.Version)
+	}
+	return manifest, nil
+}
+
+// ensureEmptyDir 目录不存在或为空
+func ensureEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotExists, dir)
+	}
+	return nil
+}
+
+// linkOrCopy 优先硬链接，跨文件系统等失败情况退回复制
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	_, _, err := copyFile(src, dst, -1)
+	return err
+}
+
+// copyFile 复制 src 的前 limit 字节 (limit < 0 表示整个文件) 并 fsync，顺带算出 CRC
+func copyFile(src, dst string, limit int64) (int64, uint32, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	crc := crc32.NewIEEE()
+	var r io.Reader = in
+	if limit >= 0 {
+		r = io.LimitReader(in, limit)
+	}
+	n, err := io.Copy(io.MultiWriter(out, crc), r)
+	if err == nil && limit >= 0 && n != limit {
+		err = fmt.Errorf("%s: short read, got %d of %d bytes", src, n, limit)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return 0, 0, err
+	}
+	return n, crc.Sum32(), nil
+}
+
+func fileChecksum(path string) (int64, uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(crc, f)
+	return n, crc.Sum32(), err
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,214 @@
+package tcore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+
+	db, err := NewDB(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.manager.maxSize = 128 // 每个段只装得下一两个 Block，逼出轮转
+	for i := int64(0); i < 5; i++ {
+		db.Write("boiler", i, float64(i))
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.WriteValue("state", 1, StringValue("RUN"))
+	db.DeleteRange("boiler", 0, 0)
+	db.Write("boiler", 10, 10) // 热数据：快照会先把它落盘
+
+	snap1 := filepath.Join(root, "snap1")
+	m1, err := db.Snapshot(snap1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Snapshot(snap1); !errors.Is(err, ErrSnapshotExists) {
+		t.Fatalf("expected ErrSnapshotExists, got %v", err)
+	}
+
+	// 快照之后的写入不在快照里
+	for i := int64(20); i < 25; i++ {
+		db.Write("boiler", i, float64(i))
+		db.Flush()
+	}
+
+	snap2 := filepath.Join(root, "snap2")
+	m2, err := db.IncrementalSnapshot(snap2, snap1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reused, copied := 0, 0
+	for _, f := range m2.Files {
+		if f.FromBase {
+			reused++
+		} else if filepath.Ext(f.Name) == SegmentFileNameSuffix {
+			copied++
+		}
+	}
+	if reused == 0 || copied == 0 || len(m2.Files) <= len(m1.Files) {
+		t.Fatalf("incremental snapshot reused %d and copied %d of %d files", reused, copied, len(m2.Files))
+	}
+	db.Close()
+
+	check := func(snap string, want []int64) {
+		t.Helper()
+		restored := filepath.Join(root, "restored-"+filepath.Base(snap))
+		if err := RestoreSnapshot(snap, restored); err != nil {
+			t.Fatal(err)
+		}
+		rdb, err := NewDB(restored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rdb.Close()
+		points, _ := rdb.Query("boiler", 0, 100)
+		got := make(map[int64]bool)
+		for _, p := range points {
+			got[p.Time] = true
+		}
+		if len(points) != len(want) {
+			t.Fatalf("%s: got %+v, want times %v", snap, points, want)
+		}
+		for _, ts := range want {
+			if !got[ts] {
+				t.Fatalf("%s: missing %d in %+v", snap, ts, points)
+			}
+		}
+		if values, _ := rdb.QueryValues("state", 0, 10); len(values) != 1 {
+			t.Fatalf("%s: state %+v", snap, values)
+		}
+	}
+	check(snap1, []int64{1, 2, 3, 4, 10})
+	check(snap2, []int64{1, 2, 3, 4, 10, 20, 21, 22, 23, 24})
+
+	// 快照被损坏：校验失败，不会留下数据目录
+	var victim string
+	for _, f := range m1.Files {
+		if filepath.Ext(f.Name) == SegmentFileNameSuffix && f.Size > 0 {
+			victim = filepath.Join(snap1, f.Name)
+			break
+		}
+	}
+	os.Remove(victim) // 断开硬链接，别改到 snap2 和原数据目录
+	if err := os.WriteFile(victim, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySnapshot(snap1); !errors.Is(err, ErrSnapshotCorrupted) {
+		t.Fatalf("expected ErrSnapshotCorrupted, got %v", err)
+	}
+	target := filepath.Join(root, "never")
+	if err := RestoreSnapshot(snap1, target); !errors.Is(err, ErrSnapshotCorrupted) {
+		t.Fatalf("restore of a corrupted snapshot: %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatal("restore left a data directory behind")
+	}
+}
+
+func TestSnapshotWhileWriting(t *testing.T) {
+	root := t.TempDir()
+
+	db, err := NewDB(filepath.Join(root, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.manager.maxSize = 512
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			name := []string{"a", "b", "c", "d"}[w]
+			for i := int64(0); ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				db.Write(name, i, float64(i))
+				if i%3 == 0 {
+					db.Flush()
+				}
+			}
+		}(w)
+	}
+
+	for i := 0; i < 5; i++ {
+		snap := filepath.Join(root, "snap", string(rune('0'+i)))
+		if _, err := db.Snapshot(snap); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifySnapshot(snap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestVerifySnapshotIgnoresExistingFindings(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	db, err := NewDB(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("boiler", 1, 1)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// 数据目录里原本就有 Fsck 能修复的问题：一条孤儿 Hint
+	report, err := Fsck(dataDir, FsckOptions{})
+	if err != nil || len(report.Segments) == 0 {
+		t.Fatalf("fsck: %+v %v", report, err)
+	}
+	id := report.Segments[0].ID
+	appendBytes(t, segmentPath(dataDir, id, hintFileNameSuffix), EncodeHint(99, &BlockMeta{FileID: id, Offset: 1 << 20, Size: 8}))
+	if report, err := Fsck(dataDir, FsckOptions{}); err != nil || report.Clean() {
+		t.Fatalf("expected fsck findings, got %+v %v", report, err)
+	}
+
+	db, err = NewDB(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	snap := filepath.Join(root, "snap")
+	m, err := db.Snapshot(snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySnapshot(snap); err != nil {
+		t.Fatalf("snapshot of a directory with existing findings should verify: %v", err)
+	}
+	restored := filepath.Join(root, "restored")
+	if err := RestoreSnapshot(snap, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	// 清单里少了段文件的另一半：快照自己的问题
+	for i, f := range m.Files {
+		if filepath.Ext(f.Name) == hintFileNameSuffix {
+			m.Files = append(m.Files[:i], m.Files[i+1:]...)
+			break
+		}
+	}
+	if err := checkSnapshotFiles(m.Files); !errors.Is(err, ErrSnapshotCorrupted) {
+		t.Fatalf("expected ErrSnapshotCorrupted for an unpaired segment file, got %v", err)
+	}
+}
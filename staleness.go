@@ -0,0 +1,237 @@
+package tcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	lastWriteFileName = "last_writes.json"
+
+	// lastWriteSaveInterval 最近写入记录的保存周期；崩溃时最多丢这么久的记录，和没刷盘的热数据一样
+	lastWriteSaveInterval = 10 * time.Second
+
+	staleNaNBits = 0x7ff0000000000002
+)
+
+// StaleNaN 陈旧标记的值：一个特殊的 NaN，与 Prometheus 的 staleness marker 相同
+// 图表遇到它断开曲线；Aggregate、降采样和连续查询都会跳过它
+var StaleNaN = math.Float64frombits(staleNaNBits)
+
+// IsStaleMarker 判断一个 float 值是不是陈旧标记 (普通的 NaN 不是)
+func IsStaleMarker(v float64) bool {
+	return math.Float64bits(v) == staleNaNBits
+}
+
+// isStale 是不是 float 时间线上的陈旧标记
+func isStale(v Value) bool {
+	return v.Type == TypeFloat && IsStaleMarker(v.Float)
+}
+
+// LastWrite 一条时间线最近一次写入
+type LastWrite struct {
+	Name    string
+	Arrived time.Time // 写入到达的墙上时间；零值表示从没记录到写入 (比如开始记录之前就存在的时间线)
+	Time    int64     // 点的时间戳
+	Value   Value     // 点的值
+	Stale   bool      // 沉默后已经写过陈旧标记
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// LastWrite 📡 一条时间线最近一次写入的时间和值，不用扫描数据
+// 按到达顺序记录：迟到的旧数据也算一次写入，Time 不一定是最大的时间戳
+func (db *DB) LastWrite(name string) (LastWrite, error) {
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return LastWrite{}, ErrSeriesNotFound
+	}
+	return series.lastWrite(name), nil
+}
+
+// SilentSeries 🔕 超过 threshold 没有收到写入的时间线，沉默最久的在前
+// 从没记录到写入的时间线也算在内 (Arrived 为零值)，排在最前面
+func (db *DB) SilentSeries(threshold time.Duration) []LastWrite {
+	now := db.staleness.now()
+	var list []LastWrite
+	for _, name := range db.Keys() {
+		series := db.idx.getSeries(name)
+		if series == nil {
+			continue
+		}
+		lw := series.lastWrite(name)
+		if now.Sub(lw.Arrived) >= threshold {
+			list = append(list, lw)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Arrived.Equal(list[j].Arrived) {
+			return list[i].Arrived.Before(list[j].Arrived)
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// SetStaleMarkers 🏷️ 开启陈旧标记：float 时间线超过 after 没有新数据时，后台自动写入一个 StaleNaN 点，
+// 每次沉默只写一个。unit 是 DB 时间戳的单位，用来把当前时间换算成标记的时间戳。after <= 0 表示关闭
+// 这是运行时设置，不保存在数据目录里
+func (db *DB) SetStaleMarkers(after, unit time.Duration) {
+	if unit <= 0 {
+		unit = time.Nanosecond
+	}
+	db.staleness.mu.Lock()
+	defer db.staleness.mu.Unlock()
+	db.staleness.after, db.staleness.unit = after, unit
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+// stalenessTracker 陈旧标记的设置和最近写入记录的保存
+type stalenessTracker struct {
+	path string
+
+	mu    sync.Mutex
+	after time.Duration // 0 表示不写陈旧标记
+	unit  time.Duration
+	saved time.Time // 上次保存的时间
+	dirty bool      // 写过陈旧标记，需要保存
+	clock func() time.Time
+}
+
+func (st *stalenessTracker) now() time.Time {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.clock()
+}
+
+// lastWrite 调用方不持有锁
+func (s *Series) lastWrite(name string) LastWrite {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return LastWrite{Name: name, Arrived: s.lastArrival, Time: s.lastWritten.Time, Value: s.lastWritten.Value, Stale: s.staleMarked}
+}
+
+// lastWriteRecord last_writes.json 里的一条记录
+type lastWriteRecord struct {
+	Arrived   int64  `json:"arrived"` // UnixNano
+	Time      int64  `json:"time"`
+	Type      string `json:"type"`
+	FloatBits uint64 `json:"float_bits,omitempty"` // 按位保存，NaN 和 Inf 也能原样恢复
+	Uint      uint64 `json:"uint,omitempty"`
+	Bool      bool   `json:"bool,omitempty"`
+	Str       string `json:"str,omitempty"`
+	Bytes     []byte `json:"bytes,omitempty"`
+	Stale     bool   `json:"stale,omitempty"`
+}
+
+// loadLastWrites 开机时恢复最近写入记录；文件损坏只影响沉默检测，打印警告后忽略
+func loadLastWrites(dir string, idx *Index) *stalenessTracker {
+	st := &stalenessTracker{path: filepath.Join(dir, lastWriteFileName), unit: time.Nanosecond, saved: time.Now(), clock: time.Now}
+	data, err := os.ReadFile(st.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("⚠️ 读取 %s 失败: %v\n", lastWriteFileName, err)
+		}
+		return st
+	}
+	var records map[string]lastWriteRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		fmt.Printf("⚠️ %s 已损坏，忽略: %v\n", lastWriteFileName, err)
+		return st
+	}
+	for name, r := range records {
+		series := idx.getSeries(name)
+		typ, err := ParseValueType(r.Type)
+		if series == nil || err != nil || typ != series.Type {
+			continue
+		}
+		v := Value{Type: typ, Float: math.Float64frombits(r.FloatBits), Uint: r.Uint, Bool: r.Bool, Str: r.Str, Bytes: r.Bytes}
+		series.mu.Lock()
+		series.lastArrival = time.Unix(0, r.Arrived)
+		series.lastWritten = TypedPoint{Time: r.Time, Value: v}
+		series.staleMarked = r.Stale
+		series.mu.Unlock()
+	}
+	return st
+}
+
+// saveLastWrites 有新的写入或标记时保存最近写入记录
+func (db *DB) saveLastWrites() error {
+	st := db.staleness
+	st.mu.Lock()
+	saved, dirty := st.saved, st.dirty
+	st.mu.Unlock()
+
+	started := time.Now()
+	records := make(map[string]lastWriteRecord)
+	changed := dirty
+	for _, name := range db.Keys() {
+		series := db.idx.getSeries(name)
+		if series == nil {
+			continue
+		}
+		lw := series.lastWrite(name)
+		if lw.Arrived.IsZero() {
+			continue
+		}
+		changed = changed || !lw.Arrived.Before(saved)
+		records[name] = lastWriteRecord{
+			Arrived: lw.Arrived.UnixNano(), Time: lw.Time, Type: lw.Value.Type.String(),
+			FloatBits: math.Float64bits(lw.Value.Float), Uint: lw.Value.Uint, Bool: lw.Value.Bool,
+			Str: lw.Value.Str, Bytes: lw.Value.Bytes, Stale: lw.Stale,
+		}
+	}
+	if !changed {
+		return nil
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(st.path, data); err != nil {
+		return err
+	}
+	st.mu.Lock()
+	st.saved, st.dirty = started, false
+	st.mu.Unlock()
+	return nil
+}
+
+// checkStale 后台每秒调用：给沉默的 float 时间线写陈旧标记
+func (db *DB) checkStale() {
+	st := db.staleness
+	st.mu.Lock()
+	after, unit, now := st.after, int64(st.unit), st.clock()
+	st.mu.Unlock()
+	if after <= 0 {
+		return
+	}
+	for _, series := range db.idx.getAllSeries() {
+		if series.Type != TypeFloat {
+			continue
+		}
+		points, marked := series.markStale(now, after, unit)
+		if !marked {
+			continue
+		}
+		st.mu.Lock()
+		st.dirty = true
+		st.mu.Unlock()
+		if len(points) > 0 {
+			if err := db.flushSeriesData(series, points); err != nil {
+				fmt.Printf("Error flushing series %d: %v\n", series.ID, err)
+			}
+		}
+	}
+}
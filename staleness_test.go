@@ -0,0 +1,110 @@
+package tcore
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLastWriteAndSilentSeries(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	db.Write("a", 100, 1)
+	db.Write("a", 90, 2) // 迟到的旧点也算最近一次写入
+	db.WriteBatch("b", []TypedPoint{{Time: 300, Value: FloatValue(3)}, {Time: 200, Value: FloatValue(4)}})
+	db.WriteValue("c", 5, StringValue("on"))
+	db.Write("nan", 1, math.NaN())
+
+	lw, err := db.LastWrite("a")
+	if err != nil || lw.Time != 90 || lw.Value.Float != 2 || lw.Arrived.Before(before) || lw.Stale {
+		t.Fatalf("last write: %+v %v", lw, err)
+	}
+	if lw, _ := db.LastWrite("b"); lw.Time != 300 || lw.Value.Float != 3 {
+		t.Fatalf("batch last write: %+v", lw)
+	}
+	if _, err := db.LastWrite("nope"); !errors.Is(err, ErrSeriesNotFound) {
+		t.Fatalf("expected ErrSeriesNotFound, got %v", err)
+	}
+
+	// a 沉默了一小时
+	series := db.idx.getSeries("a")
+	series.mu.Lock()
+	series.lastArrival = time.Now().Add(-time.Hour)
+	series.mu.Unlock()
+	silent := db.SilentSeries(5 * time.Minute)
+	if len(silent) != 1 || silent[0].Name != "a" {
+		t.Fatalf("silent: %+v", silent)
+	}
+	if silent := db.SilentSeries(0); len(silent) != 4 || silent[0].Name != "a" {
+		t.Fatalf("all series: %+v", silent)
+	}
+
+	// 陈旧标记：十分钟后，float 时间线各写一个标记，string 时间线不写
+	now := time.Now().Add(10 * time.Minute)
+	db.staleness.mu.Lock()
+	db.staleness.clock = func() time.Time { return now }
+	db.staleness.mu.Unlock()
+	db.SetStaleMarkers(5*time.Minute, time.Second)
+	db.checkStale()
+	db.checkStale()
+	points, _ := db.QueryValues("b", 0, math.MaxInt64)
+	var markers int
+	for _, p := range points {
+		if isStale(p.Value) {
+			markers++
+			if p.Time != now.Unix() {
+				t.Fatalf("marker at %d, want %d", p.Time, now.Unix())
+			}
+		}
+	}
+	if markers != 1 || len(points) != 3 {
+		t.Fatalf("b after marking: %+v", points)
+	}
+	if lw, _ := db.LastWrite("b"); !lw.Stale || lw.Time != 300 {
+		t.Fatalf("b should be marked stale: %+v", lw)
+	}
+	if lw, _ := db.LastWrite("c"); lw.Stale {
+		t.Fatal("string series must not get a marker")
+	}
+	// 聚合跳过标记
+	agg, err := db.QueryAggregate("b", 0, math.MaxInt64/2, math.MaxInt64/2, "count")
+	if err != nil || len(agg) != 1 || agg[0].Value.Float != 2 {
+		t.Fatalf("count with marker: %+v %v", agg, err)
+	}
+	if IsStaleMarker(math.NaN()) || !math.IsNaN(StaleNaN) {
+		t.Fatal("StaleNaN must be a NaN distinct from math.NaN()")
+	}
+
+	// 新数据到来，标记状态清除
+	db.Write("b", 400, 5)
+	if lw, _ := db.LastWrite("b"); lw.Stale || lw.Value.Float != 5 {
+		t.Fatalf("b after new data: %+v", lw)
+	}
+	arrived, _ := db.LastWrite("b")
+	db.Close()
+
+	// 重启后记录还在，NaN 也能原样恢复
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if lw, _ := db.LastWrite("b"); !lw.Arrived.Equal(arrived.Arrived) || lw.Time != 400 || lw.Value.Float != 5 {
+		t.Fatalf("b after reopen: %+v", lw)
+	}
+	if lw, _ := db.LastWrite("a"); !lw.Stale {
+		t.Fatalf("a after reopen: %+v", lw)
+	}
+	if lw, _ := db.LastWrite("c"); lw.Value.Str != "on" || lw.Value.Type != TypeString {
+		t.Fatalf("c after reopen: %+v", lw)
+	}
+	if lw, _ := db.LastWrite("nan"); !math.IsNaN(lw.Value.Float) {
+		t.Fatalf("nan after reopen: %+v", lw)
+	}
+}
@@ -0,0 +1,59 @@
+package tcore
+
+import "math"
+
+// SeriesStats 一条时间线的概况，全部来自内存里的索引，不读盘
+// 点数是 Block 头里的计数，还没被 Compaction 清理的已删除点也算在内
+type SeriesStats struct {
+	Name      string
+	ID        uint32
+	Type      ValueType
+	Blocks    int   // 已落盘的 Block 数
+	Segments  int   // 这些 Block 分布在几个 Segment 里
+	Points    int64 // 已落盘的点数
+	HotPoints int   // 还在内存里等待落盘的点数
+	MinTime   int64 // 没有任何数据时为 0
+	MaxTime   int64
+}
+
+// Stats 📈 查看时间线的概况
+func (db *DB) Stats(name string) (SeriesStats, error) {
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return SeriesStats{}, ErrSeriesNotFound
+	}
+	return series.stats(name), nil
+}
+
+func (s *Series) stats(name string) SeriesStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := SeriesStats{Name: name, ID: s.ID, Type: s.Type, Blocks: len(s.blocks)}
+	minTime, maxTime := int64(math.MaxInt64), int64(math.MinInt64)
+	observe := func(lo, hi int64) {
+		minTime = min(minTime, lo)
+		maxTime = max(maxTime, hi)
+	}
+
+	files := make(map[uint32]bool)
+	for _, meta := range s.blocks {
+		files[meta.FileID] = true
+		st.Points += int64(meta.Count)
+		observe(meta.MinTime, meta.MaxTime)
+	}
+	st.Segments = len(files)
+
+	for _, p := range s.activeBuffer {
+		observe(p.Time, p.Time)
+	}
+	for _, p := range s.typedBuffer {
+		observe(p.Time, p.Time)
+	}
+	st.HotPoints = len(s.activeBuffer) + len(s.typedBuffer)
+
+	if minTime <= maxTime {
+		st.MinTime, st.MaxTime = minTime, maxTime
+	}
+	return st
+}
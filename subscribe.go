@@ -0,0 +1,227 @@
+package tcore
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscribeBuffer 每个订阅默认能积压的点数
+const DefaultSubscribeBuffer = 1024
+
+var (
+	ErrSlowConsumer = errors.New("subscriber too slow, disconnected")
+	ErrDBClosed     = errors.New("database closed")
+)
+
+// SlowConsumerPolicy 订阅者的缓冲满了 (读得比写得慢) 时怎么处理新来的点
+type SlowConsumerPolicy int
+
+const (
+	SlowConsumerDrop       SlowConsumerPolicy = iota // 丢弃新来的点，记在 Dropped 里，订阅继续
+	SlowConsumerDisconnect                           // 断开订阅，Err 返回 ErrSlowConsumer
+)
+
+// LivePoint 订阅推送的一个新写入的点
+type LivePoint struct {
+	Series string
+	Time   int64
+	Value  Value
+}
+
+// SubscribeOptions 订阅的可配置选项
+type SubscribeOptions struct {
+	// Buffer 能积压的点数，写入路径从不等待订阅者
+	Buffer int
+
+	// Policy 缓冲满了之后的处理方式
+	Policy SlowConsumerPolicy
+}
+
+// SubscribeOption 定义订阅选项的函数类型
+type SubscribeOption func(*SubscribeOptions)
+
+// WithSubscribeBuffer 设置订阅能积压的点数
+func WithSubscribeBuffer(n int) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.Buffer = n
+	}
+}
+
+// WithSlowConsumerPolicy 设置缓冲满了之后的处理方式
+func WithSlowConsumerPolicy(p SlowConsumerPolicy) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.Policy = p
+	}
+}
+
+// Subscription 一个实时订阅：从 C 读新写入的点，不用轮询
+// 订阅结束 (Close、被判定为慢消费者、DB 关闭) 时 C 被关闭，Err 说明原因
+type Subscription struct {
+	C <-chan LivePoint
+
+	ch      chan LivePoint
+	sel     *Selector
+	policy  SlowConsumerPolicy
+	hub     *subHub
+	dropped atomic.Uint64
+	err     error // C 关闭的原因，由 hub.mu 保护
+	done    bool  // 已经从 hub 摘掉，由 hub.mu 保护
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// Subscribe 📡 订阅选择器匹配的时间线：此后写入的每个点 (Write、WriteValue、WriteBatch，
+// 以及降采样和连续查询写出的结果) 都会推送到返回的 Subscription.C
+// 推送不阻塞写入：订阅者跟不上时按 SlowConsumerPolicy 丢点或断开。不推送历史数据和陈旧标记
+func (db *DB) Subscribe(selector string, options ...SubscribeOption) (*Subscription, error) {
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	sel, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	opts := SubscribeOptions{Buffer: DefaultSubscribeBuffer, Policy: SlowConsumerDrop}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultSubscribeBuffer
+	}
+
+	ch := make(chan LivePoint, opts.Buffer)
+	sub := &Subscription{C: ch, ch: ch, sel: sel, policy: opts.Policy, hub: db.subs}
+	if err := db.subs.add(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Close 取消订阅并关闭 C；可以重复调用，订阅已经结束时什么也不做
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.removeLocked(s, nil)
+}
+
+// Err 订阅结束的原因：主动 Close 为 nil，慢消费者为 ErrSlowConsumer，DB 关闭为 ErrDBClosed
+// C 关闭之后调用才有意义
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// Dropped 因为缓冲满了被丢弃的点数 (SlowConsumerDrop)
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+// subHub 所有订阅；推送和关闭 channel 都在 mu 下进行，不会向已关闭的 channel 发送
+type subHub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	match  map[string][]*Subscription // 时间线名 -> 匹配的订阅，订阅增减时清空
+	closed bool
+	active atomic.Bool // 有订阅；没有订阅时写入路径不用拿锁
+}
+
+func newSubHub() *subHub {
+	return &subHub{subs: make(map[*Subscription]struct{}), match: make(map[string][]*Subscription)}
+}
+
+func (h *subHub) add(sub *Subscription) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return ErrDBClosed
+	}
+	h.subs[sub] = struct{}{}
+	clear(h.match)
+	h.active.Store(true)
+	return nil
+}
+
+// removeLocked 摘掉订阅并关闭它的 channel；调用方持有 h.mu
+func (h *subHub) removeLocked(sub *Subscription, err error) {
+	if sub.done {
+		return
+	}
+	sub.done, sub.err = true, err
+	close(sub.ch)
+	delete(h.subs, sub)
+	clear(h.match)
+	h.active.Store(len(h.subs) > 0)
+}
+
+// subsFor 匹配这条时间线的订阅；调用方持有 h.mu
+func (h *subHub) subsFor(name string) []*Subscription {
+	subs, ok := h.match[name]
+	if !ok {
+		for sub := range h.subs {
+			if sub.sel.Match(name) {
+				subs = append(subs, sub)
+			}
+		}
+		h.match[name] = subs
+	}
+	return subs
+}
+
+// forget 时间线改名后作废这些名字的匹配缓存
+func (h *subHub) forget(names ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, name := range names {
+		delete(h.match, name)
+	}
+}
+
+// publish 写入路径上调用：把新写入的点推给匹配的订阅，从不阻塞
+func (h *subHub) publish(name string, points ...TypedPoint) {
+	if !h.active.Load() {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var slow []*Subscription
+	for _, sub := range h.subsFor(name) {
+		for _, p := range points {
+			if isStale(p.Value) {
+				continue
+			}
+			select {
+			case sub.ch <- LivePoint{Series: name, Time: p.Time, Value: p.Value}:
+				continue
+			default:
+			}
+			if sub.policy == SlowConsumerDisconnect {
+				slow = append(slow, sub)
+				break
+			}
+			sub.dropped.Add(1)
+		}
+	}
+	// 遍历的是 match 里的切片，摘除会清空 match，放到最后做
+	for _, sub := range slow {
+		h.removeLocked(sub, ErrSlowConsumer)
+	}
+}
+
+// close DB 关闭时结束所有订阅
+func (h *subHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		h.removeLocked(sub, ErrDBClosed)
+	}
+}
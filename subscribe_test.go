@@ -0,0 +1,69 @@
+package tcore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubscribe(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := db.Subscribe(`cpu{host="a"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Subscribe(`cpu{host=`); !errors.Is(err, ErrBadSelector) {
+		t.Fatalf("expected ErrBadSelector, got %v", err)
+	}
+
+	db.Write(`cpu{host="a"}`, 1, 0.5)
+	db.Write(`cpu{host="b"}`, 1, 0.9) // 不匹配
+	db.Write(`cpu{host="a"}`, 2, StaleNaN)
+	db.WriteBatch(`cpu{host="a"}`, []TypedPoint{{Time: 4, Value: FloatValue(0.7)}, {Time: 3, Value: FloatValue(0.6)}})
+	for _, want := range []int64{1, 3, 4} {
+		p := <-sub.C
+		if p.Series != `cpu{host="a"}` || p.Time != want {
+			t.Fatalf("got %+v, want time %d", p, want)
+		}
+	}
+	if len(sub.C) != 0 {
+		t.Fatalf("unexpected points: %d", len(sub.C))
+	}
+
+	// 慢消费者：丢点，订阅继续
+	dropper, _ := db.Subscribe("door", WithSubscribeBuffer(2))
+	// 慢消费者：断开
+	strict, _ := db.Subscribe("door", WithSubscribeBuffer(1), WithSlowConsumerPolicy(SlowConsumerDisconnect))
+	for i := int64(0); i < 5; i++ {
+		db.WriteValue("door", i, BoolValue(i%2 == 0))
+	}
+	if len(dropper.C) != 2 || dropper.Dropped() != 3 {
+		t.Fatalf("drop policy: buffered %d, dropped %d", len(dropper.C), dropper.Dropped())
+	}
+	if p := <-strict.C; p.Time != 0 || !p.Value.Bool {
+		t.Fatalf("strict first point: %+v", p)
+	}
+	if _, ok := <-strict.C; ok || !errors.Is(strict.Err(), ErrSlowConsumer) {
+		t.Fatalf("strict should be disconnected: %v", strict.Err())
+	}
+
+	// 主动取消：C 关闭，Err 为 nil，可以重复调用
+	sub.Close()
+	sub.Close()
+	db.Write(`cpu{host="a"}`, 5, 1)
+	if _, ok := <-sub.C; ok || sub.Err() != nil {
+		t.Fatalf("closed subscription: %v", sub.Err())
+	}
+
+	// DB 关闭结束剩下的订阅
+	db.Close()
+	<-dropper.C
+	<-dropper.C
+	if _, ok := <-dropper.C; ok || !errors.Is(dropper.Err(), ErrDBClosed) {
+		t.Fatalf("after db close: %v", dropper.Err())
+	}
+}
@@ -0,0 +1,175 @@
+package tcp
+
+import (
+	"errors"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/protocol"
+)
+
+// errResultTooLarge 查询结果一帧装不下，让客户端缩小时间范围分几次查
+var errResultTooLarge = errors.New("result too large, narrow the range")
+
+// Store 是 Handler 依赖的存储能力，*tcore.DB 天然满足
+type Store interface {
+	Write(sensorID string, timestamp int64, value float64) error
+	Query(sensorID string, start, end int64) ([]tcore.Point, error)
+	Keys() []string
+	Stats(name string) (tcore.SeriesStats, error)
+}
+
+// Handler 业务胶水：把协议帧翻译成 DB 调用，再把结果翻译回协议帧
+type Handler struct {
+	db Store
+}
+
+// NewHandler 创建 Handler
+func NewHandler(db Store) *Handler {
+	return &Handler{db: db}
+}
+
+// Handle 处理一个请求帧，返回要回给客户端的响应帧
+func (h *Handler) Handle(req protocol.Frame) protocol.Frame {
+	switch req.Type {
+	case protocol.TypePing:
+		return protocol.Frame{Type: protocol.TypePong}
+
+	case protocol.TypeWrite:
+		s, err := protocol.DecodeWrite(req.Value)
+		if err != nil {
+			return errorFrame(err)
+		}
+		if err := h.db.Write(s.Series, s.Time, s.Value); err != nil {
+			return errorFrame(err)
+		}
+		return protocol.Frame{Type: protocol.TypeOK}
+
+	case protocol.TypeBatchWrite:
+		samples, err := protocol.DecodeBatch(req.Value)
+		if err != nil {
+			return errorFrame(err)
+		}
+		return h.batchWrite(samples)
+
+	case protocol.TypeQuery:
+		series, start, end, err := protocol.DecodeQuery(req.Value)
+		if err != nil {
+			return errorFrame(err)
+		}
+		if start > end {
+			return errorFrame(tcore.ErrInvalidRange)
+		}
+		points, err := h.db.Query(series, start, end)
+		if err != nil {
+			return errorFrame(err)
+		}
+		if len(points) > protocol.MaxPointsPerFrame {
+			return errorFrame(errResultTooLarge)
+		}
+		result := make([]protocol.Point, len(points))
+		for i, p := range points {
+			result[i] = protocol.Point{Time: p.Time, Value: p.Value}
+		}
+		return protocol.Frame{Type: protocol.TypePoints, Value: protocol.EncodePoints(result)}
+
+	case protocol.TypeKeys:
+		value, err := protocol.EncodeKeys(h.db.Keys())
+		if err != nil {
+			return errorFrame(err)
+		}
+		return protocol.Frame{Type: protocol.TypeKeyset, Value: value}
+
+	case protocol.TypeStats:
+		series, err := protocol.DecodeStatsQuery(req.Value)
+		if err != nil {
+			return errorFrame(err)
+		}
+		st, err := h.db.Stats(series)
+		if err != nil {
+			return errorFrame(err)
+		}
+		return protocol.Frame{Type: protocol.TypeStatsResult, Value: protocol.EncodeStats(protocol.Stats{
+			Type:      uint8(st.Type),
+			Blocks:    uint32(st.Blocks),
+			Segments:  uint32(st.Segments),
+			Points:    st.Points,
+			HotPoints: uint32(st.HotPoints),
+			MinTime:   st.MinTime,
+			MaxTime:   st.MaxTime,
+		})}
+	}
+
+	return protocol.Frame{
+		Type:  protocol.TypeError,
+		Value: protocol.EncodeError(protocol.CodeBadRequest, "unknown message type"),
+	}
+}
+
+// batchWrite 先检查整批再写入：写不进去的点 (时间线已经注册成别的类型) 一个都不写，
+// 其余的点照常写入，回 Rejected 列出被拒绝的下标，客户端据此只丢弃这些点。
+// 写到一半遇到存储层错误 (磁盘、只读) 时回错误帧，客户端整批重发；已经写进去的点重复写一遍，
+// 时间戳相同，Compaction 时去重
+func (h *Handler) batchWrite(samples []protocol.Sample) protocol.Frame {
+	var rejected protocol.Rejected
+	reject := func(i int, err error) {
+		if len(rejected.Indices) == 0 {
+			f := errorFrame(err)
+			rejected.Code, rejected.Message = f.Value[0], string(f.Value[1:])
+		}
+		rejected.Indices = append(rejected.Indices, uint32(i))
+	}
+
+	valid := make([]bool, len(samples))
+	types := make(map[string]error) // 每条时间线只查一次
+	for i, s := range samples {
+		err, seen := types[s.Series]
+		if !seen {
+			st, serr := h.db.Stats(s.Series)
+			switch {
+			case serr == nil && st.Type != tcore.TypeFloat:
+				err = tcore.ErrTypeMismatch
+			case serr != nil && !errors.Is(serr, tcore.ErrSeriesNotFound):
+				return errorFrame(serr)
+			}
+			types[s.Series] = err
+		}
+		if err != nil {
+			reject(i, err)
+			continue
+		}
+		valid[i] = true
+	}
+
+	for i, s := range samples {
+		if !valid[i] {
+			continue
+		}
+		if err := h.db.Write(s.Series, s.Time, s.Value); err != nil {
+			if errors.Is(err, tcore.ErrTypeMismatch) {
+				reject(i, err) // 检查之后被别的连接抢先注册成了别的类型
+				continue
+			}
+			return errorFrame(err)
+		}
+	}
+	if len(rejected.Indices) > 0 {
+		return protocol.Frame{Type: protocol.TypeRejected, Value: protocol.EncodeRejected(rejected)}
+	}
+	return protocol.Frame{Type: protocol.TypeOK}
+}
+
+// errorFrame 把引擎错误映射成带错误码的响应帧
+func errorFrame(err error) protocol.Frame {
+	code := protocol.CodeInternal
+	switch {
+	case errors.Is(err, protocol.ErrBadPayload), errors.Is(err, errResultTooLarge):
+		code = protocol.CodeBadRequest
+	case errors.Is(err, tcore.ErrSeriesNotFound):
+		code = protocol.CodeNotFound
+	case errors.Is(err, tcore.ErrTypeMismatch):
+		code = protocol.CodeTypeMismatch
+	case errors.Is(err, tcore.ErrInvalidRange):
+		code = protocol.CodeInvalidRange
+	}
+	return protocol.Frame{Type: protocol.TypeError, Value: protocol.EncodeError(code, err.Error())}
+}
@@ -0,0 +1,277 @@
+// Package tcp 把 tcore.DB 包装成一个基于 LTV 协议的网络服务
+//
+// 连接模型：每个连接一个 goroutine，连接内的请求严格按顺序处理、按顺序应答，
+// 因此客户端可以连续发出多个请求 (pipelining)，再按顺序读取响应。
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Lwxjjr/tcore/protocol"
+)
+
+const (
+	// DefaultMaxConns 默认的最大并发连接数
+	DefaultMaxConns = 1024
+	// DefaultIdleTimeout 连接空闲多久没有请求就断开
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+// ErrServerClosed Shutdown 之后 Serve 返回的错误
+var ErrServerClosed = errors.New("tcp: server closed")
+
+// Options 服务端配置
+type Options struct {
+	MaxConns    int           // 最大并发连接数，超过后新连接会收到错误帧并被关闭
+	IdleTimeout time.Duration // 空闲超时
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// WithMaxConns 设置最大并发连接数
+func WithMaxConns(n int) Option {
+	return func(opts *Options) {
+		opts.MaxConns = n
+	}
+}
+
+// WithIdleTimeout 设置空闲超时
+func WithIdleTimeout(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.IdleTimeout = d
+	}
+}
+
+// Server TCP 服务端
+type Server struct {
+	handler *Handler
+	opts    Options
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{}
+	closing  bool
+
+	sem chan struct{}  // 连接数信号量
+	wg  sync.WaitGroup // 等待所有连接协程退出
+}
+
+// conn 一个客户端连接
+type conn struct {
+	net.Conn
+}
+
+// NewServer 创建服务端
+func NewServer(db Store, options ...Option) *Server {
+	opts := Options{
+		MaxConns:    DefaultMaxConns,
+		IdleTimeout: DefaultIdleTimeout,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return &Server{
+		handler: NewHandler(db),
+		opts:    opts,
+		conns:   make(map[*conn]struct{}),
+		sem:     make(chan struct{}, opts.MaxConns),
+	}
+}
+
+// ListenAndServe 监听地址并开始服务，直到 Shutdown 被调用
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在给定的 Listener 上接受连接
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		// 连接数已满：回一个错误帧再关掉，让客户端知道是服务端拒绝而不是网络故障
+		select {
+		case s.sem <- struct{}{}:
+		default:
+			c.SetWriteDeadline(time.Now().Add(time.Second))
+			protocol.WriteFrame(c, protocol.Frame{
+				Type:  protocol.TypeError,
+				Value: protocol.EncodeError(protocol.CodeUnavailable, "too many connections"),
+			})
+			c.Close()
+			continue
+		}
+
+		cc := &conn{Conn: c}
+		if !s.track(cc) {
+			<-s.sem
+			c.Close()
+			return ErrServerClosed
+		}
+		s.wg.Add(1)
+		go s.serveConn(cc)
+	}
+}
+
+// Addr 返回监听地址（测试中监听 :0 时很有用）
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Shutdown 优雅关闭：
+// 1. 停止接受新连接
+// 2. 空闲连接立即断开；正在处理的请求处理完、响应写完后再断开
+// 3. 等所有连接退出，或 ctx 到期后强制关闭剩余连接
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for c := range s.conns {
+		// 让阻塞在 Read 上的空闲连接立刻醒来；正在处理的请求不受读超时影响
+		c.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for c := range s.conns {
+			c.Close()
+		}
+		s.mu.Unlock()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// serveConn 单个连接的读-处理-写循环
+func (s *Server) serveConn(c *conn) {
+	defer func() {
+		c.Close()
+		s.untrack(c)
+		<-s.sem
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+
+	for {
+		if !s.armReadDeadline(c) {
+			w.Flush() // 把已经处理完的响应送出去再断开
+			return
+		}
+
+		req, err := protocol.ReadFrame(r)
+		if err != nil {
+			if errors.Is(err, protocol.ErrFrameTooLarge) {
+				protocol.WriteFrame(w, protocol.Frame{
+					Type:  protocol.TypeError,
+					Value: protocol.EncodeError(protocol.CodeBadRequest, err.Error()),
+				})
+			}
+			w.Flush() // pipelining 时前面请求的响应可能还攒在缓冲区里
+			return    // EOF、超时、半帧断开：都直接断开连接
+		}
+
+		// 请求已经完整读到：即使此时开始关闭，也要处理完并把响应写回去
+		resp := s.handler.Handle(req)
+		err = protocol.WriteFrame(w, resp)
+		if errors.Is(err, protocol.ErrFrameTooLarge) {
+			// 响应一帧装不下：回一个错误帧，连接照常可用
+			err = protocol.WriteFrame(w, protocol.Frame{
+				Type:  protocol.TypeError,
+				Value: protocol.EncodeError(protocol.CodeInternal, "response too large"),
+			})
+		}
+		// 客户端 pipelining 时缓冲区里还有请求，攒着一起 Flush 减少系统调用
+		if err == nil && r.Buffered() == 0 {
+			err = w.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// armReadDeadline 在读下一个请求之前设置空闲超时
+// 与 Shutdown 在同一把锁下操作 deadline，避免关闭信号被新的超时时间覆盖
+func (s *Server) armReadDeadline(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	if s.opts.IdleTimeout > 0 {
+		c.SetReadDeadline(time.Now().Add(s.opts.IdleTimeout))
+	} else {
+		c.SetReadDeadline(time.Time{})
+	}
+	return true
+}
+
+func (s *Server) track(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
@@ -0,0 +1,255 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+	"github.com/Lwxjjr/tcore/protocol"
+)
+
+// startServer 在回环地址上启动一个真实 DB 背后的服务端
+func startServer(t *testing.T, options ...Option) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(db, options...)
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Shutdown(context.Background()) })
+	return srv, l.Addr().String()
+}
+
+// mustEncode 测试里的名字都很短，编码不会失败
+func mustEncode(b []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func roundTrip(t *testing.T, c net.Conn, req protocol.Frame) protocol.Frame {
+	t.Helper()
+	if err := protocol.WriteFrame(c, req); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := protocol.ReadFrame(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServer_Commands(t *testing.T) {
+	_, addr := startServer(t)
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if resp := roundTrip(t, c, protocol.Frame{Type: protocol.TypePing}); resp.Type != protocol.TypePong {
+		t.Fatalf("expected pong, got %d", resp.Type)
+	}
+
+	resp := roundTrip(t, c, protocol.Frame{
+		Type:  protocol.TypeWrite,
+		Value: mustEncode(protocol.EncodeWrite(protocol.Sample{Series: "boiler", Time: 1, Value: 80.5})),
+	})
+	if resp.Type != protocol.TypeOK {
+		t.Fatalf("expected ok, got %v", protocol.DecodeError(resp.Value))
+	}
+
+	resp = roundTrip(t, c, protocol.Frame{
+		Type: protocol.TypeBatchWrite,
+		Value: mustEncode(protocol.EncodeBatch([]protocol.Sample{
+			{Series: "boiler", Time: 2, Value: 81},
+			{Series: "pump", Time: 2, Value: 3},
+		})),
+	})
+	if resp.Type != protocol.TypeOK {
+		t.Fatalf("expected ok, got %v", protocol.DecodeError(resp.Value))
+	}
+
+	resp = roundTrip(t, c, protocol.Frame{Type: protocol.TypeQuery, Value: mustEncode(protocol.EncodeQuery("boiler", 0, 10))})
+	points, err := protocol.DecodePoints(resp.Value)
+	if err != nil || len(points) != 2 || points[1].Value != 81 {
+		t.Fatalf("unexpected query result %v (%v)", points, err)
+	}
+
+	resp = roundTrip(t, c, protocol.Frame{Type: protocol.TypeQuery, Value: mustEncode(protocol.EncodeQuery("boiler", 10, 0))})
+	if resp.Type != protocol.TypeError || protocol.DecodeError(resp.Value).Code != protocol.CodeInvalidRange {
+		t.Fatalf("expected invalid range error, got %d", resp.Type)
+	}
+
+	resp = roundTrip(t, c, protocol.Frame{Type: protocol.TypeKeys})
+	keys, _ := protocol.DecodeKeys(resp.Value)
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %v", keys)
+	}
+}
+
+func TestServer_PartialFramesAndPipelining(t *testing.T) {
+	_, addr := startServer(t)
+	c, _ := net.Dial("tcp", addr)
+	defer c.Close()
+
+	// 两个请求拼在一起，再按单字节切碎发出去：服务端必须正确拆帧
+	var raw []byte
+	for _, f := range []protocol.Frame{
+		{Type: protocol.TypeWrite, Value: mustEncode(protocol.EncodeWrite(protocol.Sample{Series: "s", Time: 1, Value: 1}))},
+		{Type: protocol.TypePing},
+	} {
+		w := &sliceWriter{}
+		protocol.WriteFrame(w, f)
+		raw = append(raw, w.b...)
+	}
+	for _, b := range raw {
+		c.Write([]byte{b})
+	}
+
+	r := bufio.NewReader(c)
+	first, _ := protocol.ReadFrame(r)
+	second, _ := protocol.ReadFrame(r)
+	if first.Type != protocol.TypeOK || second.Type != protocol.TypePong {
+		t.Fatalf("expected ok+pong in order, got %d+%d", first.Type, second.Type)
+	}
+}
+
+func TestServer_ConnectionLimit(t *testing.T) {
+	_, addr := startServer(t, WithMaxConns(1))
+
+	c1, _ := net.Dial("tcp", addr)
+	defer c1.Close()
+	roundTrip(t, c1, protocol.Frame{Type: protocol.TypePing}) // 确保第一个连接已被接受
+
+	c2, _ := net.Dial("tcp", addr)
+	defer c2.Close()
+	resp, err := protocol.ReadFrame(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != protocol.TypeError || protocol.DecodeError(resp.Value).Code != protocol.CodeUnavailable {
+		t.Fatalf("expected unavailable error, got %d", resp.Type)
+	}
+}
+
+func TestServer_GracefulShutdown(t *testing.T) {
+	srv, addr := startServer(t)
+	c, _ := net.Dial("tcp", addr)
+	defer c.Close()
+	roundTrip(t, c, protocol.Frame{Type: protocol.TypePing})
+
+	// 空闲连接在关闭时应被立即断开，Shutdown 不应一直等到空闲超时
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown did not drain in time: %v", err)
+	}
+
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := protocol.ReadFrame(c); err != io.EOF {
+		t.Errorf("expected connection to be closed, got %v", err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("expected new connections to be refused after shutdown")
+	}
+}
+
+// bigStore 的 Query 返回一帧装不下的结果
+type bigStore struct{}
+
+func (bigStore) Write(string, int64, float64) error { return nil }
+func (bigStore) Keys() []string                     { return nil }
+func (bigStore) Stats(string) (tcore.SeriesStats, error) {
+	return tcore.SeriesStats{}, nil
+}
+func (bigStore) Query(string, int64, int64) ([]tcore.Point, error) {
+	return make([]tcore.Point, protocol.MaxPointsPerFrame+1), nil
+}
+
+func TestHandler_ResultTooLarge(t *testing.T) {
+	h := NewHandler(bigStore{})
+	resp := h.Handle(protocol.Frame{Type: protocol.TypeQuery, Value: mustEncode(protocol.EncodeQuery("boiler", 0, 10))})
+	if resp.Type != protocol.TypeError || protocol.DecodeError(resp.Value).Code != protocol.CodeBadRequest {
+		t.Fatalf("expected bad request error, got type %d", resp.Type)
+	}
+}
+
+func TestHandler_BatchWriteRejectsOnlyMismatchedPoints(t *testing.T) {
+	db, err := tcore.NewDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.WriteBatch("valve", []tcore.TypedPoint{{Time: 1, Value: tcore.BoolValue(true)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(db)
+	resp := h.Handle(protocol.Frame{
+		Type: protocol.TypeBatchWrite,
+		Value: mustEncode(protocol.EncodeBatch([]protocol.Sample{
+			{Series: "boiler", Time: 1, Value: 1},
+			{Series: "valve", Time: 2, Value: 0},
+			{Series: "boiler", Time: 2, Value: 2},
+			{Series: "valve", Time: 3, Value: 1},
+		})),
+	})
+	if resp.Type != protocol.TypeRejected {
+		t.Fatalf("expected rejected, got type %d", resp.Type)
+	}
+	rej, err := protocol.DecodeRejected(resp.Value)
+	if err != nil || rej.Code != protocol.CodeTypeMismatch || len(rej.Indices) != 2 || rej.Indices[0] != 1 || rej.Indices[1] != 3 {
+		t.Fatalf("unexpected rejection %+v (%v)", rej, err)
+	}
+	if points, _ := db.Query("boiler", 0, 10); len(points) != 2 {
+		t.Fatalf("expected the valid points to be written, got %v", points)
+	}
+	if points, _ := db.QueryValues("valve", 0, 10); len(points) != 1 {
+		t.Fatalf("expected the rejected points to be left out, got %v", points)
+	}
+}
+
+func TestServer_FlushesPendingResponsesOnClose(t *testing.T) {
+	_, addr := startServer(t)
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Ping 后面跟半个帧再关闭写端：服务端处理 Ping 时缓冲区里还有字节，不会马上 Flush，
+	// 随后读到半帧断开，断开之前必须把 Ping 的响应送出去
+	w := &sliceWriter{}
+	protocol.WriteFrame(w, protocol.Frame{Type: protocol.TypePing})
+	raw := append(w.b, 0, 0, 0, 9, byte(protocol.TypeWrite))
+	c.Write(raw)
+	c.(*net.TCPConn).CloseWrite()
+
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := protocol.ReadFrame(c)
+	if err != nil || resp.Type != protocol.TypePong {
+		t.Fatalf("expected pong before close, got %d (%v)", resp.Type, err)
+	}
+}
+
+type sliceWriter struct{ b []byte }
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
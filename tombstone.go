@@ -0,0 +1,472 @@
+package tcore
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// tombstoneFileName 墓碑日志：记录所有删除操作，保证删除在重启后依然生效
+	tombstoneFileName = "tombstones.log"
+
+	// tombstoneRecordSize 定长记录
+	// 1(Kind) + 4(SensorID) + 8(Start) + 8(End) + 4(SealedFileID) + 4(CRC) = 29 bytes
+	tombstoneRecordSize = 29
+)
+
+const (
+	tombstoneSeries byte = 1 // 整个 Series 被删除
+	tombstoneRange  byte = 2 // 删除一段时间范围
+)
+
+var ErrTombstoneCorrupted = errors.New("tombstone record is corrupted")
+
+// tombstone 一条删除记录
+// Seal 是删除发生时最后一个已封存段的 ID (见 Manager.sealActive)：只有 FileID <= Seal 的 Block
+// 里才可能有被删的点，删除之后的写入进入 ID 更大的段，不会被盖住；
+// Compaction 产出的新段 ID 也一定更大，且已经物理剔除了这些点
+type tombstone struct {
+	Kind     byte
+	SensorID uint32
+	Start    int64
+	End      int64
+	Seal     uint32
+}
+
+// covers 判断某个 Block 里的某个时间点是否已被删除
+func (t tombstone) covers(fileID uint32, ts int64) bool {
+	return fileID <= t.Seal && ts >= t.Start && ts <= t.End
+}
+
+// tombstoneSet 墓碑的内存视图 + 持久化日志
+type tombstoneSet struct {
+	mu     sync.RWMutex
+	path   string
+	fd     *os.File
+	ranges map[uint32][]tombstone // SensorID -> 时间范围墓碑
+	series []tombstone            // 整个 Series 的墓碑
+	dirty  map[uint32]bool        // 还残留着已删除数据、等待 Compaction 物理清理的 Segment
+}
+
+// openTombstones 打开（或创建）墓碑日志并加载全部记录
+func openTombstones(dirPath string) (*tombstoneSet, error) {
+	path := filepath.Join(dirPath, tombstoneFileName)
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &tombstoneSet{
+		path:   path,
+		fd:     fd,
+		ranges: make(map[uint32][]tombstone),
+		dirty:  make(map[uint32]bool),
+	}
+
+	if err := ts.load(fd); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return ts, nil
+}
+
+// load 读入日志里的全部墓碑
+func (ts *tombstoneSet) load(r io.Reader) error {
+	for {
+		t, err := decodeTombstone(r)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil // 末尾半截记录说明删除没有写完，视为没发生过
+			}
+			if err == ErrTombstoneCorrupted {
+				continue // 单条记录损坏不影响其它记录
+			}
+			return err
+		}
+		ts.addLocked(t)
+	}
+}
+
+// record 先落盘再生效：写入日志并 fsync 后才挂到内存视图上，一批墓碑只 fsync 一次
+func (ts *tombstoneSet) record(list ...tombstone) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	buf := make([]byte, 0, len(list)*tombstoneRecordSize)
+	for _, t := range list {
+		buf = append(buf, encodeTombstone(t)...)
+	}
+	if _, err := ts.fd.Write(buf); err != nil {
+		return err
+	}
+	if err := ts.fd.Sync(); err != nil {
+		return err
+	}
+	for _, t := range list {
+		ts.addLocked(t)
+	}
+	return nil
+}
+
+func (ts *tombstoneSet) addLocked(t tombstone) {
+	if t.Kind == tombstoneSeries {
+		ts.series = append(ts.series, t)
+		return
+	}
+	ts.ranges[t.SensorID] = append(ts.ranges[t.SensorID], t)
+}
+
+// rangesFor 返回某个 Series 的时间范围墓碑快照
+func (ts *tombstoneSet) rangesFor(sensorID uint32) []tombstone {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	list := ts.ranges[sensorID]
+	if len(list) == 0 {
+		return nil
+	}
+	result := make([]tombstone, len(list))
+	copy(result, list)
+	return result
+}
+
+// deletedSeries 返回所有被整体删除的 SensorID
+func (ts *tombstoneSet) deletedSeries() []uint32 {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	ids := make([]uint32, 0, len(ts.series))
+	for _, t := range ts.series {
+		ids = append(ids, t.SensorID)
+	}
+	return ids
+}
+
+// markDirty 登记还残留着已删除数据的 Segment
+func (ts *tombstoneSet) markDirty(fileIDs ...uint32) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, id := range fileIDs {
+		ts.dirty[id] = true
+	}
+}
+
+// isDirty 判断某个 Segment 是否需要物理清理
+func (ts *tombstoneSet) isDirty(fileID uint32) bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.dirty[fileID]
+}
+
+// clean 段文件被 Compaction 重写后，从待清理名单里移除
+func (ts *tombstoneSet) clean(fileIDs []uint32) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, id := range fileIDs {
+		delete(ts.dirty, id)
+	}
+}
+
+// pruneRanges 丢弃已经没有任何数据可遮盖的范围墓碑，并原子重写日志
+// stillNeeded 由调用方判断某条墓碑是否还遮盖着磁盘上的 Block
+func (ts *tombstoneSet) pruneRanges(stillNeeded func(t tombstone) bool) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	pruned := false
+	for id, list := range ts.ranges {
+		kept := list[:0]
+		for _, t := range list {
+			if stillNeeded(t) {
+				kept = append(kept, t)
+			} else {
+				pruned = true
+			}
+		}
+		if len(kept) == 0 {
+			delete(ts.ranges, id)
+		} else {
+			ts.ranges[id] = kept
+		}
+	}
+	if !pruned {
+		return nil
+	}
+	return ts.rewriteLocked()
+}
+
+// pruneSeries 回收已经从字典里彻底消失的 Series 的墓碑
+func (ts *tombstoneSet) pruneSeries(ids []uint32) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	drop := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	kept := ts.series[:0]
+	for _, t := range ts.series {
+		if !drop[t.SensorID] {
+			kept = append(kept, t)
+		}
+	}
+	ts.series = kept
+	for id := range drop {
+		delete(ts.ranges, id)
+	}
+	return ts.rewriteLocked()
+}
+
+// rewriteLocked 写临时文件 -> fsync -> rename，保证日志在任何时刻都是完整的
+func (ts *tombstoneSet) rewriteLocked() error {
+	tmpPath := ts.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	var all []tombstone
+	all = append(all, ts.series...)
+	for _, list := range ts.ranges {
+		all = append(all, list...)
+	}
+	for _, t := range all {
+		if _, err := tmp.Write(encodeTombstone(t)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, ts.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(ts.path)); err != nil {
+		return err
+	}
+
+	fd, err := os.OpenFile(ts.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	ts.fd.Close()
+	ts.fd = fd
+	return nil
+}
+
+func (ts *tombstoneSet) close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.fd == nil {
+		return nil // 只读打开
+	}
+	return ts.fd.Close()
+}
+
+// isDeleted 判断点是否被任意一条墓碑遮盖
+func isDeleted(tombs []tombstone, fileID uint32, ts int64) bool {
+	for _, t := range tombs {
+		if t.covers(fileID, ts) {
+			return true
+		}
+	}
+	return false
+}
+
+// ==========================================
+// 底层序列化协议 (定长 + CRC)
+// ==========================================
+
+func encodeTombstone(t tombstone) []byte {
+	buf := make([]byte, tombstoneRecordSize)
+	buf[0] = t.Kind
+	binary.BigEndian.PutUint32(buf[1:5], t.SensorID)
+	binary.BigEndian.PutUint64(buf[5:13], uint64(t.Start))
+	binary.BigEndian.PutUint64(buf[13:21], uint64(t.End))
+	binary.BigEndian.PutUint32(buf[21:25], t.Seal)
+	binary.BigEndian.PutUint32(buf[25:29], crc32.ChecksumIEEE(buf[:25]))
+	return buf
+}
+
+func decodeTombstone(r io.Reader) (tombstone, error) {
+	buf := make([]byte, tombstoneRecordSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return tombstone{}, err // 包含 io.EOF / io.ErrUnexpectedEOF
+	}
+	if crc32.ChecksumIEEE(buf[:25]) != binary.BigEndian.Uint32(buf[25:29]) {
+		return tombstone{}, ErrTombstoneCorrupted
+	}
+	return tombstone{
+		Kind:     buf[0],
+		SensorID: binary.BigEndian.Uint32(buf[1:5]),
+		Start:    int64(binary.BigEndian.Uint64(buf[5:13])),
+		End:      int64(binary.BigEndian.Uint64(buf[13:21])),
+		Seal:     binary.BigEndian.Uint32(buf[21:25]),
+	}, nil
+}
+
+// ==========================================
+// 🚀 对外 API (Public API)
+// ==========================================
+
+// DeleteSeries 🗑️ 删除整个传感器
+// 墓碑落盘后立即生效：Index 忘掉这个名字，磁盘上的数据留给 Compaction 物理清除
+func (db *DB) DeleteSeries(name string) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	// 和 Compaction 互斥：Compaction 只在开始时读一次墓碑，期间记下的删除会被漏掉，点随产物复活
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return ErrSeriesNotFound
+	}
+
+	seal, err := db.manager.sealActive(noSeal)
+	if err != nil {
+		return err
+	}
+	t := tombstone{
+		Kind:     tombstoneSeries,
+		SensorID: series.ID,
+		Start:    math.MinInt64,
+		End:      math.MaxInt64,
+		Seal:     seal,
+	}
+	if err := db.tombs.record(t); err != nil {
+		return err
+	}
+
+	db.idx.removeSeries(name)
+	series.dropHotData(t.Start, t.End)
+	db.tombs.markDirty(series.fileIDs(t.Start, t.End)...)
+	return nil
+}
+
+// DeleteRange 🗑️ 删除传感器在 [start, end] 内的数据
+// 查询立即看不到这些点；磁盘上的数据留给 Compaction 物理清除
+func (db *DB) DeleteRange(name string, start, end int64) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if start > end {
+		return ErrInvalidRange
+	}
+	_, err := db.deleteRanges([]rangeDelete{{name: name, start: start, end: end}}, noSeal)
+	return err
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+// rangeDelete 一条时间线上待删除的 [start, end]
+type rangeDelete struct {
+	name       string
+	start, end int64
+}
+
+// deleteRanges 批量删除：只封存一次活跃段、只 fsync 一次墓碑日志，返回这批墓碑的 Seal
+// 找不到的时间线跳过，一条都找不到时返回 ErrSeriesNotFound；since 见 Manager.sealActive
+func (db *DB) deleteRanges(dels []rangeDelete, since uint32) (uint32, error) {
+	// 和 Compaction 互斥：Compaction 只在开始时读一次墓碑，期间记下的删除会被漏掉，点随产物复活
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	var (
+		found []rangeDelete
+		owner []*Series
+	)
+	for _, d := range dels {
+		if series := db.idx.getSeries(d.name); series != nil {
+			found = append(found, d)
+			owner = append(owner, series)
+		}
+	}
+	if len(found) == 0 {
+		return 0, ErrSeriesNotFound
+	}
+
+	seal, err := db.manager.sealActive(since)
+	if err != nil {
+		return 0, err
+	}
+	tombs := make([]tombstone, len(found))
+	for i, d := range found {
+		tombs[i] = tombstone{
+			Kind:     tombstoneRange,
+			SensorID: owner[i].ID,
+			Start:    d.start,
+			End:      d.end,
+			Seal:     seal,
+		}
+	}
+	if err := db.tombs.record(tombs...); err != nil {
+		return 0, err
+	}
+
+	for i, d := range found {
+		owner[i].dropHotData(d.start, d.end)
+		db.tombs.markDirty(owner[i].fileIDs(d.start, d.end)...)
+		db.rollups.noteWrite(d.name, d.start, d.end)
+	}
+	return seal, nil
+}
+
+// applyTombstones 开机时把墓碑重新作用到内存索引上（必须在 Catalog 和 Hint 加载之后调用）
+func (db *DB) applyTombstones() {
+	// 1. 被整体删除的 Series：Catalog 里还有它的名字，这里让 Index 再忘一次
+	for _, id := range db.tombs.deletedSeries() {
+		db.idx.removeSeriesByID(id)
+	}
+	for _, series := range db.idx.getDeadSeries() {
+		db.tombs.markDirty(series.fileIDs(math.MinInt64, math.MaxInt64)...)
+	}
+
+	// 2. 时间范围墓碑：找出仍残留着被删数据的 Segment
+	for _, series := range db.idx.getAllSeries() {
+		for _, t := range db.tombs.rangesFor(series.ID) {
+			for _, id := range series.fileIDs(t.Start, t.End) {
+				if id <= t.Seal {
+					db.tombs.markDirty(id)
+				}
+			}
+		}
+	}
+}
+
+// pruneTombstones Compaction 之后清理已经没有数据可遮盖的范围墓碑
+func (db *DB) pruneTombstones() error {
+	return db.tombs.pruneRanges(func(t tombstone) bool {
+		name, ok := db.idx.nameOf(t.SensorID)
+		if !ok {
+			return false // Series 已经不在了，范围墓碑没有意义
+		}
+		series := db.idx.getSeries(name)
+		if series == nil {
+			return false
+		}
+		for _, id := range series.fileIDs(t.Start, t.End) {
+			if id <= t.Seal {
+				return true
+			}
+		}
+		return false
+	})
+}
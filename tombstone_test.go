@@ -0,0 +1,158 @@
+package tcore
+
+import (
+	"testing"
+)
+
+func TestDB_DeleteRange(t *testing.T) {
+	dir := t.TempDir()
+
+	db, _ := NewDB(dir)
+	s := db.idx.getOrCreateSeries("probe")
+	for i := int64(0); i < 10; i++ {
+		db.flushSeriesData(s, []Point{{Time: i, Value: float64(i)}})
+	}
+	db.Write("probe", 10, 10) // 热数据
+
+	if err := db.DeleteRange("probe", 3, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRange("missing", 0, 1); err != ErrSeriesNotFound {
+		t.Errorf("expected ErrSeriesNotFound, got %v", err)
+	}
+
+	points, _ := db.Query("probe", 0, 100)
+	if len(points) != 3 {
+		t.Fatalf("expected 3 points after delete, got %d", len(points))
+	}
+
+	// 重启后删除依然生效
+	db.Close()
+	db, _ = NewDB(dir)
+	defer db.Close()
+	points, _ = db.Query("probe", 0, 100)
+	if len(points) != 3 {
+		t.Fatalf("expected 3 points after reload, got %d", len(points))
+	}
+
+	// Compaction 之后数据被物理清除，墓碑也随之回收
+	sealActive(t, db)
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	s = db.idx.getSeries("probe")
+	if len(s.blocks) != 1 || s.blocks[0].Count != 3 {
+		t.Errorf("expected 1 block with 3 points after compaction, got %d blocks", len(s.blocks))
+	}
+	if len(db.tombs.rangesFor(s.ID)) != 0 {
+		t.Error("expected range tombstone to be pruned after compaction")
+	}
+}
+
+func TestDB_DeleteSeries(t *testing.T) {
+	dir := t.TempDir()
+
+	db, _ := NewDB(dir)
+	db.flushSeriesData(db.idx.getOrCreateSeries("old"), []Point{{Time: 1, Value: 1}})
+	db.Write("keep", 1, 1)
+
+	if err := db.DeleteSeries("old"); err != nil {
+		t.Fatal(err)
+	}
+	if keys := db.Keys(); len(keys) != 1 || keys[0] != "keep" {
+		t.Errorf("expected only 'keep' left, got %v", keys)
+	}
+	if points, _ := db.Query("old", 0, 100); len(points) != 0 {
+		t.Errorf("expected no points for deleted series, got %d", len(points))
+	}
+
+	db.Close()
+	db, _ = NewDB(dir)
+	defer db.Close()
+	if db.idx.getSeries("old") != nil {
+		t.Error("expected deleted series to stay deleted after reload")
+	}
+}
+
+func TestDB_DeleteRangeThenRewrite(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Write("probe", 5, 1)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRange("probe", 0, 10); err != nil {
+		t.Fatal(err)
+	}
+	// 删除之后重写同一个时间戳：新值落在删除前的活跃段之后，不能被墓碑盖住
+	db.Write("probe", 5, 2)
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	points, _ := db.Query("probe", 0, 100)
+	if len(points) != 1 || points[0] != (Point{Time: 5, Value: 2}) {
+		t.Fatalf("expected [{5 2}], got %v", points)
+	}
+
+	// Compaction 产物的 ID 比活跃段大，之后的删除同样要盖住它们
+	sealActive(t, db)
+	for ts := int64(6); ts <= 7; ts++ {
+		db.Write("probe", ts, 3)
+		if err := db.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sealActive(t, db)
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DeleteRange("probe", 6, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	points, _ = db.Query("probe", 0, 100)
+	if len(points) != 2 || points[0] != (Point{Time: 5, Value: 2}) || points[1] != (Point{Time: 7, Value: 3}) {
+		t.Fatalf("expected [{5 2} {7 3}] after reload, got %v", points)
+	}
+}
+
+func TestDB_DeleteRangeDuringCompaction(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	s := db.idx.getOrCreateSeries("probe")
+	for i := int64(0); i < 200; i++ {
+		db.flushSeriesData(s, []Point{{Time: i, Value: float64(i)}})
+	}
+	sealActive(t, db)
+
+	done := make(chan error, 1)
+	go func() { done <- db.Compact() }()
+	if err := db.DeleteRange("probe", 0, 99); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	points, _ := db.Query("probe", 0, 1000)
+	if len(points) != 100 || points[0].Time != 100 {
+		t.Fatalf("expected 100 points starting at 100, got %d", len(points))
+	}
+}
@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+const (
+	minTime = math.MinInt64
+	maxTime = math.MaxInt64
+)
+
+// timeCodec 文件里的时间 <-> DB 里的时间戳
+type timeCodec struct {
+	fileUnit time.Duration // 整数时间戳的单位；为 0 时按 layout 解析
+	layout   string
+	store    time.Duration
+}
+
+func newTimeCodec(format string, store time.Duration) timeCodec {
+	c := timeCodec{store: store}
+	switch format {
+	case "", "ns":
+		c.fileUnit = time.Nanosecond
+	case "us":
+		c.fileUnit = time.Microsecond
+	case "ms":
+		c.fileUnit = time.Millisecond
+	case "s":
+		c.fileUnit = time.Second
+	case "rfc3339":
+		c.layout = time.RFC3339Nano
+	default:
+		c.layout = format
+	}
+	return c
+}
+
+// integer 文件里的时间是否为整数
+func (c timeCodec) integer() bool {
+	return c.fileUnit != 0
+}
+
+func (c timeCodec) format(ts int64) string {
+	if c.integer() {
+		return strconv.FormatInt(convert(ts, c.store, c.fileUnit), 10)
+	}
+	return time.Unix(0, ts*int64(c.store)).UTC().Format(c.layout)
+}
+
+func (c timeCodec) parse(s string) (int64, error) {
+	if c.integer() {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad time %q", s)
+		}
+		return convert(n, c.fileUnit, c.store), nil
+	}
+	t, err := time.Parse(c.layout, s)
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q", s)
+	}
+	return t.UnixNano() / int64(c.store), nil
+}
+
+// convert 在两种时间单位之间换算
+func convert(ts int64, from, to time.Duration) int64 {
+	if from == to {
+		return ts
+	}
+	if from > to {
+		return ts * int64(from/to)
+	}
+	return ts / int64(to/from)
+}
+
+// formatValue 文本形式：float 用最短表示，bytes 用 base64
+func formatValue(v tcore.Value) string {
+	switch v.Type {
+	case tcore.TypeFloat:
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case tcore.TypeBytes:
+		return base64.StdEncoding.EncodeToString(v.Bytes)
+	}
+	return v.String()
+}
+
+// parseValue formatValue 的逆过程
+func parseValue(typ tcore.ValueType, s string) (tcore.Value, error) {
+	switch typ {
+	case tcore.TypeFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return tcore.Value{}, fmt.Errorf("bad float %q", s)
+		}
+		return tcore.FloatValue(f), nil
+	case tcore.TypeUint:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return tcore.Value{}, fmt.Errorf("bad uint %q", s)
+		}
+		return tcore.UintValue(u), nil
+	case tcore.TypeBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return tcore.Value{}, fmt.Errorf("bad bool %q", s)
+		}
+		return tcore.BoolValue(b), nil
+	case tcore.TypeString:
+		return tcore.StringValue(s), nil
+	case tcore.TypeBytes:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return tcore.Value{}, fmt.Errorf("bad base64 %q", s)
+		}
+		return tcore.BytesValue(b), nil
+	}
+	return tcore.Value{}, tcore.ErrUnknownType
+}
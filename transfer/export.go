@@ -0,0 +1,116 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// Export 📤 把若干条时间线导出到 w，返回导出的点数
+// 逐条时间线流式读取，任何时刻内存里只有一个 Block
+func Export(w io.Writer, src Source, series []string, options ...Option) (int64, error) {
+	opts := DefaultOptions()
+	for _, o := range options {
+		o(opts)
+	}
+	tc := newTimeCodec(opts.TimeFormat, opts.TimeUnit)
+	cols := opts.Columns
+
+	bw := bufio.NewWriter(w)
+	var cw *csv.Writer
+	var emit func(name string, typ tcore.ValueType, p tcore.TypedPoint) error
+
+	switch opts.Format {
+	case CSV:
+		cw = csv.NewWriter(bw)
+		if err := cw.Write([]string{cols.Series, cols.Time, cols.Value, cols.Type}); err != nil {
+			return 0, err
+		}
+		row := make([]string, 4)
+		emit = func(name string, typ tcore.ValueType, p tcore.TypedPoint) error {
+			row[0], row[1], row[2], row[3] = name, tc.format(p.Time), formatValue(p.Value), typ.String()
+			return cw.Write(row)
+		}
+	case NDJSON:
+		keys := make([][]byte, 4)
+		for i, k := range []string{cols.Series, cols.Time, cols.Value, cols.Type} {
+			keys[i], _ = json.Marshal(k)
+		}
+		var line []byte
+		emit = func(name string, typ tcore.ValueType, p tcore.TypedPoint) error {
+			line = append(line[:0], '{')
+			line = appendField(line, keys[0], jsonString(name))
+			line = append(line, ',')
+			if tc.integer() {
+				line = appendField(line, keys[1], []byte(tc.format(p.Time)))
+			} else {
+				line = appendField(line, keys[1], jsonString(tc.format(p.Time)))
+			}
+			line = append(line, ',')
+			line = appendField(line, keys[2], jsonValue(p.Value))
+			line = append(line, ',')
+			line = appendField(line, keys[3], jsonString(typ.String()))
+			line = append(line, '}', '\n')
+			_, err := bw.Write(line)
+			return err
+		}
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, opts.Format)
+	}
+
+	var n int64
+	for _, name := range series {
+		typ, err := src.SeriesType(name)
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", name, err)
+		}
+		err = src.ScanValues(name, opts.Start, opts.End, func(p tcore.TypedPoint) error {
+			n++
+			return emit(name, typ, p)
+		})
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+func appendField(line, key, value []byte) []byte {
+	line = append(line, key...)
+	line = append(line, ':')
+	return append(line, value...)
+}
+
+func jsonString(s string) []byte {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// jsonValue 值按 JSON 类型输出；NaN 和 ±Inf 在 JSON 里没有数字表示，输出成字符串
+func jsonValue(v tcore.Value) []byte {
+	switch v.Type {
+	case tcore.TypeFloat:
+		if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+			return jsonString(formatValue(v))
+		}
+		return strconv.AppendFloat(nil, v.Float, 'g', -1, 64)
+	case tcore.TypeUint:
+		return strconv.AppendUint(nil, v.Uint, 10)
+	case tcore.TypeBool:
+		return strconv.AppendBool(nil, v.Bool)
+	}
+	return jsonString(formatValue(v))
+}
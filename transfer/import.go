@@ -0,0 +1,296 @@
+package transfer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// ImportResult 一次导入的统计
+type ImportResult struct {
+	Records int // 读到的数据行数
+	Points  int // 写入的点数
+	Skipped int // 值为空被跳过的单元格
+	Series  int // 涉及的时间线数
+}
+
+// LineError 某一行 (NDJSON 为第几个对象) 导入失败
+type LineError struct {
+	Line int // 从 1 开始
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+// Import 📥 从 r 导入数据，返回统计
+// 点先按时间线攒在内存里，攒够 BatchSize 个就排序后用 WriteBatch 写成大 Block。
+// 遇到坏行立即停止：之前已经写入的批次不会回滚，当前这一批被丢弃
+func Import(r io.Reader, sink Sink, options ...Option) (ImportResult, error) {
+	opts := DefaultOptions()
+	for _, o := range options {
+		o(opts)
+	}
+	im := &importer{
+		sink:    sink,
+		opts:    opts,
+		tc:      newTimeCodec(opts.TimeFormat, opts.TimeUnit),
+		types:   make(map[string]tcore.ValueType),
+		pending: make(map[string][]tcore.TypedPoint),
+	}
+
+	var err error
+	switch opts.Format {
+	case CSV:
+		err = im.readCSV(r)
+	case NDJSON:
+		err = im.readNDJSON(r)
+	default:
+		err = fmt.Errorf("%w: %q", ErrUnknownFormat, opts.Format)
+	}
+	if err == nil {
+		err = im.flush()
+	}
+	im.result.Series = len(im.types)
+	return im.result, err
+}
+
+// ==========================================
+// 🔒 内部实现
+// ==========================================
+
+type importer struct {
+	sink    Sink
+	opts    *Options
+	tc      timeCodec
+	types   map[string]tcore.ValueType // 每条时间线的类型，第一次见到时确定
+	pending map[string][]tcore.TypedPoint
+	count   int // pending 里的点数
+	result  ImportResult
+}
+
+// add 收下一个单元格；值为空的跳过
+func (im *importer) add(name, rawTime, rawValue, rawType string) error {
+	if rawValue == "" {
+		im.result.Skipped++
+		return nil
+	}
+	if im.opts.Series != "" {
+		name = im.opts.Series
+	}
+	if name == "" {
+		return errors.New("missing series name")
+	}
+	ts, err := im.tc.parse(rawTime)
+	if err != nil {
+		return err
+	}
+	typ, err := im.typeOf(name, rawType)
+	if err != nil {
+		return err
+	}
+	v, err := parseValue(typ, rawValue)
+	if err != nil {
+		return err
+	}
+
+	im.pending[name] = append(im.pending[name], tcore.TypedPoint{Time: ts, Value: v})
+	if im.count++; im.count >= im.opts.BatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// typeOf 时间线的类型：已注册的 > 类型列 > Options.Type
+func (im *importer) typeOf(name, rawType string) (tcore.ValueType, error) {
+	typ, ok := im.types[name]
+	if !ok {
+		if registered, err := im.sink.SeriesType(name); err == nil {
+			typ = registered
+		} else if rawType != "" {
+			if typ, err = tcore.ParseValueType(rawType); err != nil {
+				return 0, err
+			}
+		} else {
+			typ = im.opts.Type
+		}
+		im.types[name] = typ
+	}
+	if rawType != "" && rawType != typ.String() {
+		return 0, fmt.Errorf("%w: %s is %s, got %s", tcore.ErrTypeMismatch, name, typ, rawType)
+	}
+	return typ, nil
+}
+
+// flush 把攒下的点按时间线写出去
+func (im *importer) flush() error {
+	names := make([]string, 0, len(im.pending))
+	for name := range im.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		points := im.pending[name]
+		if err := im.sink.WriteBatch(name, points); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		im.result.Points += len(points)
+		delete(im.pending, name)
+	}
+	im.count = 0
+	return nil
+}
+
+func (im *importer) readCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	var header map[string]int
+	if !im.opts.NoHeader {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header = make(map[string]int, len(rec))
+		for i, name := range rec {
+			header[strings.TrimSpace(name)] = i
+		}
+	}
+	column := func(ref string, required bool) (int, error) {
+		if n, ok := strings.CutPrefix(ref, "#"); ok {
+			if i, err := strconv.Atoi(n); err == nil && i > 0 {
+				return i - 1, nil
+			}
+		} else if i, ok := header[ref]; ok {
+			return i, nil
+		}
+		if required {
+			return -1, fmt.Errorf("no %q column", ref)
+		}
+		return -1, nil
+	}
+
+	cols := im.opts.Columns
+	timeCol, err := column(cols.Time, true)
+	if err != nil {
+		return err
+	}
+
+	// 宽表：每一列一条时间线
+	type valueColumn struct {
+		index  int
+		series string
+	}
+	var values []valueColumn
+	if len(im.opts.ValueColumns) > 0 {
+		for ref, series := range im.opts.ValueColumns {
+			i, err := column(ref, true)
+			if err != nil {
+				return err
+			}
+			values = append(values, valueColumn{index: i, series: series})
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i].index < values[j].index })
+	}
+
+	var seriesCol, valueCol, typeCol int
+	if values == nil {
+		if seriesCol, err = column(cols.Series, im.opts.Series == ""); err != nil {
+			return err
+		}
+		if valueCol, err = column(cols.Value, true); err != nil {
+			return err
+		}
+		if typeCol, err = column(cols.Type, false); err != nil {
+			return err
+		}
+	}
+
+	field := func(rec []string, i int) string {
+		if i < 0 || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err // csv.ParseError 自带行号
+		}
+		line, _ := cr.FieldPos(0)
+		im.result.Records++
+
+		ts := field(rec, timeCol)
+		if values != nil {
+			for _, vc := range values {
+				if err := im.add(vc.series, ts, field(rec, vc.index), ""); err != nil {
+					return &LineError{Line: line, Err: err}
+				}
+			}
+			continue
+		}
+		if err := im.add(field(rec, seriesCol), ts, field(rec, valueCol), field(rec, typeCol)); err != nil {
+			return &LineError{Line: line, Err: err}
+		}
+	}
+}
+
+func (im *importer) readNDJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	cols := im.opts.Columns
+
+	for line := 1; ; line++ {
+		var obj map[string]any
+		if err := dec.Decode(&obj); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return &LineError{Line: line, Err: err}
+		}
+		im.result.Records++
+
+		var fields [4]string
+		for i, key := range []string{cols.Series, cols.Time, cols.Value, cols.Type} {
+			s, err := jsonText(obj[key])
+			if err != nil {
+				return &LineError{Line: line, Err: fmt.Errorf("%s: %v", key, err)}
+			}
+			fields[i] = s
+		}
+		if err := im.add(fields[0], fields[1], fields[2], fields[3]); err != nil {
+			return &LineError{Line: line, Err: err}
+		}
+	}
+}
+
+// jsonText 把 JSON 标量还原成文本，交给和 CSV 相同的解析逻辑；null 和缺失视为空
+func jsonText(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("unsupported JSON value %v", v)
+}
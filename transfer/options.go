@@ -0,0 +1,183 @@
+// Package transfer 时间线数据的批量导入导出
+//
+// 支持两种格式：
+//   - CSV：第一行是表头，默认列名 sensor,time,value,type (与 httpapi 的 CSV 写入一致)
+//   - NDJSON：每行一个 JSON 对象，默认字段名同上
+//
+// 导出走 DB.ScanValues 流式读取，导入攒批后走 DB.WriteBatch 直接写成大 Block
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+// Format 文件格式
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// ParseFormat 解析格式名，jsonl 视为 ndjson
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "csv":
+		return CSV, nil
+	case "ndjson", "jsonl":
+		return NDJSON, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+}
+
+// Source 导出的数据来源，*tcore.DB 满足这个接口
+type Source interface {
+	SeriesType(name string) (tcore.ValueType, error)
+	ScanValues(name string, start, end int64, fn func(tcore.TypedPoint) error) error
+}
+
+// Sink 导入的目的地，*tcore.DB 满足这个接口
+type Sink interface {
+	SeriesType(name string) (tcore.ValueType, error)
+	WriteBatch(name string, points []tcore.TypedPoint) error
+}
+
+// Columns 列名 (CSV 表头) 或字段名 (NDJSON)
+// 没有表头的 CSV 用 "#1"、"#2" 这样的写法按位置 (从 1 开始) 指定列
+type Columns struct {
+	Series string
+	Time   string
+	Value  string
+	Type   string // 可选：导入时缺少这一列就用已注册的类型或 Options.Type
+}
+
+// DefaultColumns 默认列名
+func DefaultColumns() Columns {
+	return Columns{Series: "sensor", Time: "time", Value: "value", Type: "type"}
+}
+
+// Options 导入导出配置
+type Options struct {
+	Format     Format
+	TimeFormat string        // ns/us/ms/s 表示整数时间戳；rfc3339；其它按 Go 的时间布局解析。默认 ns
+	TimeUnit   time.Duration // DB 里时间戳的单位，默认纳秒
+	Columns    Columns
+
+	// 导出
+	Start, End int64 // 时间范围 (DB 的时间单位)，默认全部
+
+	// 导入
+	Series       string            // 所有数据写进这条时间线，忽略文件里的时间线列
+	ValueColumns map[string]string // 宽表 (仅 CSV)：列 -> 时间线名，每行的每一列是一个点
+	Type         tcore.ValueType   // 新时间线又没有类型列时使用的类型，默认 float
+	NoHeader     bool              // CSV 没有表头，列只能按位置指定
+	BatchSize    int               // 攒够这么多点就写一批，默认 100000
+}
+
+// Option 定义配置选项的函数类型
+type Option func(*Options)
+
+// DefaultOptions 默认配置
+func DefaultOptions() *Options {
+	return &Options{
+		Format:     CSV,
+		TimeFormat: "ns",
+		TimeUnit:   time.Nanosecond,
+		Columns:    DefaultColumns(),
+		Start:      minTime,
+		End:        maxTime,
+		Type:       tcore.TypeFloat,
+		BatchSize:  100000,
+	}
+}
+
+// WithFormat 设置文件格式，默认 CSV
+func WithFormat(f Format) Option {
+	return func(opts *Options) {
+		opts.Format = f
+	}
+}
+
+// WithTimeFormat 设置文件里时间戳的格式
+func WithTimeFormat(layout string) Option {
+	return func(opts *Options) {
+		opts.TimeFormat = layout
+	}
+}
+
+// WithTimeUnit 设置 DB 里时间戳的单位
+func WithTimeUnit(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.TimeUnit = d
+	}
+}
+
+// WithColumns 设置列名；留空的字段保持默认
+func WithColumns(c Columns) Option {
+	return func(opts *Options) {
+		def := DefaultColumns()
+		if c.Series == "" {
+			c.Series = def.Series
+		}
+		if c.Time == "" {
+			c.Time = def.Time
+		}
+		if c.Value == "" {
+			c.Value = def.Value
+		}
+		if c.Type == "" {
+			c.Type = def.Type
+		}
+		opts.Columns = c
+	}
+}
+
+// WithRange 导出时只导出 [start, end] 内的点
+func WithRange(start, end int64) Option {
+	return func(opts *Options) {
+		opts.Start, opts.End = start, end
+	}
+}
+
+// WithSeries 导入时所有数据写进同一条时间线
+func WithSeries(name string) Option {
+	return func(opts *Options) {
+		opts.Series = name
+	}
+}
+
+// WithValueColumns 导入宽表：每一列对应一条时间线
+func WithValueColumns(columns map[string]string) Option {
+	return func(opts *Options) {
+		opts.ValueColumns = columns
+	}
+}
+
+// WithType 设置新时间线的默认类型
+func WithType(t tcore.ValueType) Option {
+	return func(opts *Options) {
+		opts.Type = t
+	}
+}
+
+// WithNoHeader CSV 没有表头
+func WithNoHeader() Option {
+	return func(opts *Options) {
+		opts.NoHeader = true
+	}
+}
+
+// WithBatchSize 设置导入时每批的点数
+func WithBatchSize(n int) Option {
+	return func(opts *Options) {
+		if n > 0 {
+			opts.BatchSize = n
+		}
+	}
+}
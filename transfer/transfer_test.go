@@ -0,0 +1,175 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lwxjjr/tcore"
+)
+
+func openDB(t *testing.T) *tcore.DB {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := tcore.NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func scanAll(t *testing.T, db *tcore.DB, name string) []tcore.TypedPoint {
+	t.Helper()
+	var points []tcore.TypedPoint
+	if err := db.ScanValues(name, math.MinInt64, math.MaxInt64, func(p tcore.TypedPoint) error {
+		points = append(points, p)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return points
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := openDB(t)
+	ms := int64(time.Millisecond)
+	src.WriteBatch("boiler", []tcore.TypedPoint{
+		{Time: 3000 * ms, Value: tcore.FloatValue(3.5)},
+		{Time: 1000 * ms, Value: tcore.FloatValue(math.Inf(1))},
+		{Time: 2000 * ms, Value: tcore.FloatValue(-2)},
+	})
+	src.Write("boiler", 4000*ms, 4) // 热数据也要导出
+	src.WriteBatch("count", []tcore.TypedPoint{{Time: 1000 * ms, Value: tcore.UintValue(math.MaxUint64)}})
+	src.WriteValue("raw", 1000*ms, tcore.BytesValue([]byte{0, 1, 0xff}))
+	src.WriteValue("state", 2500*ms, tcore.StringValue("say \"hi\", ok"))
+	series := []string{"boiler", "count", "raw", "state"}
+
+	for _, tc := range []struct {
+		format     Format
+		timeFormat string
+	}{
+		{CSV, "ms"},
+		{CSV, "rfc3339"},
+		{NDJSON, "ns"},
+		{NDJSON, "2006-01-02T15:04:05.000Z"},
+	} {
+		t.Run(fmt.Sprintf("%s-%s", tc.format, tc.timeFormat), func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := Export(&buf, src, series, WithFormat(tc.format), WithTimeFormat(tc.timeFormat))
+			if err != nil || n != 7 {
+				t.Fatalf("export: %d %v", n, err)
+			}
+
+			dst := openDB(t)
+			res, err := Import(&buf, dst, WithFormat(tc.format), WithTimeFormat(tc.timeFormat))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Records != 7 || res.Points != 7 || res.Series != 4 {
+				t.Fatalf("import: %+v", res)
+			}
+			for _, name := range series {
+				want, got := scanAll(t, src, name), scanAll(t, dst, name)
+				if !reflect.DeepEqual(want, got) {
+					t.Errorf("%s: want %+v, got %+v", name, want, got)
+				}
+				wt, _ := src.SeriesType(name)
+				if gt, _ := dst.SeriesType(name); gt != wt {
+					t.Errorf("%s: type %s, want %s", name, gt, wt)
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	Export(&buf, src, []string{"count"}, WithTimeFormat("s"), WithColumns(Columns{Series: "name"}))
+	if buf.String() != "name,time,value,type\ncount,1,18446744073709551615,uint\n" {
+		t.Fatalf("csv: %q", buf.String())
+	}
+	buf.Reset()
+	Export(&buf, src, []string{"boiler"}, WithFormat(NDJSON), WithRange(2000*ms, 3000*ms))
+	if want := `{"sensor":"boiler","time":2000000000,"value":-2,"type":"float"}` + "\n" +
+		`{"sensor":"boiler","time":3000000000,"value":3.5,"type":"float"}` + "\n"; buf.String() != want {
+		t.Fatalf("ndjson: %q", buf.String())
+	}
+	if _, err := Export(&buf, src, []string{"nope"}); !errors.Is(err, tcore.ErrSeriesNotFound) {
+		t.Fatalf("expected ErrSeriesNotFound, got %v", err)
+	}
+}
+
+func TestImportWideCSV(t *testing.T) {
+	db := openDB(t)
+
+	var in strings.Builder
+	in.WriteString("Timestamp,Temp,Humidity,Note\n")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5000; i++ {
+		hum := fmt.Sprint(40 + i%10)
+		if i%100 == 0 {
+			hum = "" // 空单元格跳过
+		}
+		fmt.Fprintf(&in, "%s,%d.5,%s,x\n", start.Add(time.Duration(4999-i)*time.Second).Format("2006-01-02 15:04:05"), i, hum)
+	}
+
+	res, err := Import(strings.NewReader(in.String()), db,
+		WithTimeFormat("2006-01-02 15:04:05"),
+		WithTimeUnit(time.Second),
+		WithColumns(Columns{Time: "Timestamp"}),
+		WithValueColumns(map[string]string{"Temp": "room.temp", "#3": "room.humidity"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Records != 5000 || res.Points != 9950 || res.Skipped != 50 || res.Series != 2 {
+		t.Fatalf("import: %+v", res)
+	}
+
+	// 倒序的输入被排好序写成一个大 Block，而不是几十个小 Block
+	st, err := db.Stats("room.temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Blocks != 1 || st.Points != 5000 || st.HotPoints != 0 || st.MinTime != start.Unix() {
+		t.Fatalf("stats: %+v", st)
+	}
+	temps := scanAll(t, db, "room.temp")
+	if temps[0].Value.Float != 4999.5 || temps[4999].Time != start.Unix()+4999 {
+		t.Fatalf("temps: %+v ... %+v", temps[0], temps[4999])
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	db := openDB(t)
+	db.WriteValue("state", 1, tcore.StringValue("RUN"))
+
+	in := "sensor,time,value\nboiler,1,1.5\nboiler,x,2\n"
+	_, err := Import(strings.NewReader(in), db)
+	var lineErr *LineError
+	if !errors.As(err, &lineErr) || lineErr.Line != 3 {
+		t.Fatalf("expected a line 3 error, got %v", err)
+	}
+
+	in = `{"sensor":"state","time":2,"value":"STOP"}` + "\n" + `{"sensor":"state","time":3,"value":1,"type":"float"}` + "\n"
+	if _, err := Import(strings.NewReader(in), db, WithFormat(NDJSON)); !errors.Is(err, tcore.ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch, got %v", err)
+	}
+
+	if _, err := Import(strings.NewReader("when,v\n1,2\n"), db); err == nil || !strings.Contains(err.Error(), `"time"`) {
+		t.Fatalf("expected a missing column error, got %v", err)
+	}
+
+	// 没有表头，按位置取列，写进固定的时间线
+	res, err := Import(strings.NewReader("1,true\n2,false\n"), db, WithNoHeader(), WithSeries("pump.on"), WithType(tcore.TypeBool),
+		WithColumns(Columns{Time: "#1", Value: "#2"}))
+	if err != nil || res.Points != 2 {
+		t.Fatalf("headerless: %+v %v", res, err)
+	}
+	if typ, _ := db.SeriesType("pump.on"); typ != tcore.TypeBool {
+		t.Fatalf("pump.on type %s", typ)
+	}
+}
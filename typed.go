@@ -0,0 +1,150 @@
+package tcore
+
+import "fmt"
+
+// ==========================================
+// 🚀 带类型的对外 API (Typed Public API)
+// ==========================================
+
+// CreateSeries 🆕 预先注册一条指定类型的时间线
+// 类型随注册记录写进 catalog.idx，之后不可更改；同名同类型重复注册视为成功
+func (db *DB) CreateSeries(name string, typ ValueType) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if !typ.valid() {
+		return ErrUnknownType
+	}
+	series := db.idx.getOrCreateTypedSeries(name, typ)
+	if series.Type != typ {
+		return ErrSeriesExists
+	}
+	return nil
+}
+
+// SeriesType 查询时间线的数值类型
+func (db *DB) SeriesType(name string) (ValueType, error) {
+	series := db.idx.getSeries(name)
+	if series == nil {
+		return 0, ErrSeriesNotFound
+	}
+	return series.Type, nil
+}
+
+// WriteValue ✍️ 写入带类型的数据
+// 时间线不存在时按 v.Type 自动注册；类型与已注册的不一致时返回 ErrTypeMismatch
+func (db *DB) WriteValue(sensorID string, timestamp int64, v Value) error {
+	if db.pipeline.active.Load() {
+		return db.ingest([]IngestPoint{{Series: sensorID, Time: timestamp, Value: v}}, false)
+	}
+	return db.writeValue(sensorID, timestamp, v)
+}
+
+// writeValue 不经过写入流水线的 WriteValue
+func (db *DB) writeValue(sensorID string, timestamp int64, v Value) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	if !v.Type.valid() {
+		return ErrUnknownType
+	}
+	if v.Type == TypeFloat {
+		return db.write(sensorID, timestamp, v.Float)
+	}
+
+	series := db.idx.getOrCreateTypedSeries(sensorID, v.Type)
+	if series.Type != v.Type {
+		return ErrTypeMismatch
+	}
+
+	v = v.clone()
+	pointsToFlush := series.appendTyped(TypedPoint{Time: timestamp, Value: v})
+	db.rollups.noteWrite(sensorID, timestamp, timestamp)
+	if v.Type == TypeUint {
+		db.alerts.observe(sensorID, timestamp, numeric(v))
+	}
+	db.subs.publish(sensorID, TypedPoint{Time: timestamp, Value: v})
+	if len(pointsToFlush) > 0 {
+		return db.flushTypedSeriesData(series, pointsToFlush)
+	}
+	return nil
+}
+
+// QueryValues 🔍 查询带类型的数据，适用于任何类型的时间线
+func (db *DB) QueryValues(sensorID string, start, end int64) ([]TypedPoint, error) {
+	series := db.idx.getSeries(sensorID)
+	if series == nil {
+		return nil, nil
+	}
+
+	// float64 时间线直接复用原有查询路径
+	if series.Type == TypeFloat {
+		points, err := db.Query(sensorID, start, end)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]TypedPoint, len(points))
+		for i, p := range points {
+			result[i] = TypedPoint{Time: p.Time, Value: FloatValue(p.Value)}
+		}
+		return result, nil
+	}
+
+	db.readMu.RLock()
+	defer db.readMu.RUnlock()
+
+	var result []TypedPoint
+	tombs := db.tombs.rangesFor(series.ID)
+
+	// 1. 查磁盘 (冷数据)
+	for _, meta := range series.findBlocks(start, end) {
+		points, err := db.readTypedBlock(meta)
+		if err != nil {
+			return nil, fmt.Errorf("read block failed: %v", err)
+		}
+		for _, p := range points {
+			if p.Time >= start && p.Time <= end && !isDeleted(tombs, meta.FileID, p.Time) {
+				result = append(result, p)
+			}
+		}
+	}
+
+	// 2. 查内存 (热数据)
+	for _, p := range series.getTypedHotData() {
+		if p.Time >= start && p.Time <= end {
+			result = append(result, p)
+		}
+	}
+
+	return result, nil
+}
+
+// ==========================================
+// 🔒 内部胶水逻辑 (Internal Glue)
+// ==========================================
+
+// flushTypedSeriesData 与 flushSeriesData 相同，使用按类型选择的 Block 编码
+func (db *DB) flushTypedSeriesData(series *Series, points []TypedPoint) error {
+	data, err := encodeTypedBlock(series.ID, series.Type, points)
+	if err != nil {
+		return err
+	}
+
+	meta, err := db.manager.writeRaw(series.ID, data, typedMeta(points))
+	if err != nil {
+		return err
+	}
+
+	series.addBlockMeta(meta)
+	return nil
+}
+
+// readTypedBlock 读取并解码一个 typed Block
+func (db *DB) readTypedBlock(meta *BlockMeta) ([]TypedPoint, error) {
+	data, err := db.manager.readRaw(meta)
+	if err != nil {
+		return nil, err
+	}
+	_, _, points, err := decodeTypedBlock(data)
+	return points, err
+}
@@ -0,0 +1,256 @@
+package tcore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sort"
+)
+
+var ErrTypedBlockCorrupted = errors.New("typed block is corrupted")
+
+// 非 float64 时间线的 Block 编码（float64 时间线继续使用原有的 Block 编码）
+//
+//	[Type: 1字节] [SensorID: 4字节] [Count: 4字节]
+//	[Timestamps: 首个时间戳 varint + 后续差值 varint]
+//	[Values: 按类型选择的编码]
+//
+// 数值编码：
+//   - uint:   首个值 uvarint + 后续差值 zigzag varint (计数器单调递增，差值很小)
+//   - bool:   按位打包，8 个点占 1 字节
+//   - string: 字典编码，[字典大小][字典项...] + 每个点一个字典下标
+//   - bytes:  每个点 [长度 uvarint][内容]
+//   - float:  每个点 8 字节 IEEE754
+func encodeTypedBlock(sensorID uint32, typ ValueType, points []TypedPoint) ([]byte, error) {
+	if !typ.valid() {
+		return nil, ErrUnknownType
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, 9+len(points)*4))
+	var header [9]byte
+	header[0] = byte(typ)
+	binary.BigEndian.PutUint32(header[1:5], sensorID)
+	binary.BigEndian.PutUint32(header[5:9], uint32(len(points)))
+	buf.Write(header[:])
+
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putVarint := func(v int64) { buf.Write(tmp[:binary.PutVarint(tmp, v)]) }
+	putUvarint := func(v uint64) { buf.Write(tmp[:binary.PutUvarint(tmp, v)]) }
+
+	// 1. 时间戳：差值编码
+	prev := int64(0)
+	for i, p := range points {
+		if i == 0 {
+			putVarint(p.Time)
+		} else {
+			putVarint(p.Time - prev)
+		}
+		prev = p.Time
+	}
+
+	// 2. 数值：按类型编码
+	for _, p := range points {
+		if p.Value.Type != typ {
+			return nil, ErrTypeMismatch
+		}
+	}
+	switch typ {
+	case TypeFloat:
+		for _, p := range points {
+			binary.BigEndian.PutUint64(tmp[:8], math.Float64bits(p.Value.Float))
+			buf.Write(tmp[:8])
+		}
+	case TypeUint:
+		last := uint64(0)
+		for i, p := range points {
+			if i == 0 {
+				putUvarint(p.Value.Uint)
+			} else {
+				putVarint(int64(p.Value.Uint - last))
+			}
+			last = p.Value.Uint
+		}
+	case TypeBool:
+		packed := make([]byte, (len(points)+7)/8)
+		for i, p := range points {
+			if p.Value.Bool {
+				packed[i/8] |= 1 << (uint(i) % 8)
+			}
+		}
+		buf.Write(packed)
+	case TypeString:
+		dict := make(map[string]uint64)
+		var words []string
+		for _, p := range points {
+			if _, ok := dict[p.Value.Str]; !ok {
+				dict[p.Value.Str] = uint64(len(words))
+				words = append(words, p.Value.Str)
+			}
+		}
+		putUvarint(uint64(len(words)))
+		for _, w := range words {
+			putUvarint(uint64(len(w)))
+			buf.WriteString(w)
+		}
+		for _, p := range points {
+			putUvarint(dict[p.Value.Str])
+		}
+	case TypeBytes:
+		for _, p := range points {
+			putUvarint(uint64(len(p.Value.Bytes)))
+			buf.Write(p.Value.Bytes)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeTypedBlock 解码 encodeTypedBlock 产出的字节
+func decodeTypedBlock(data []byte) (uint32, ValueType, []TypedPoint, error) {
+	if len(data) < 9 {
+		return 0, 0, nil, ErrTypedBlockCorrupted
+	}
+	typ := ValueType(data[0])
+	if !typ.valid() {
+		return 0, 0, nil, ErrTypedBlockCorrupted
+	}
+	sensorID := binary.BigEndian.Uint32(data[1:5])
+	count := int(binary.BigEndian.Uint32(data[5:9]))
+	if count > len(data) {
+		return 0, 0, nil, ErrTypedBlockCorrupted // 每个点至少占 1 字节时间戳
+	}
+
+	r := bytes.NewReader(data[9:])
+	points := make([]TypedPoint, count)
+
+	// 1. 时间戳
+	prev := int64(0)
+	for i := range points {
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			return 0, 0, nil, ErrTypedBlockCorrupted
+		}
+		if i > 0 {
+			v += prev
+		}
+		points[i].Time = v
+		prev = v
+	}
+
+	// 2. 数值
+	for i := range points {
+		points[i].Value.Type = typ
+	}
+	switch typ {
+	case TypeFloat:
+		raw := make([]byte, 8)
+		for i := range points {
+			if _, err := io.ReadFull(r, raw); err != nil {
+				return 0, 0, nil, ErrTypedBlockCorrupted
+			}
+			points[i].Value.Float = math.Float64frombits(binary.BigEndian.Uint64(raw))
+		}
+	case TypeUint:
+		last := uint64(0)
+		for i := range points {
+			if i == 0 {
+				v, err := binary.ReadUvarint(r)
+				if err != nil {
+					return 0, 0, nil, ErrTypedBlockCorrupted
+				}
+				last = v
+			} else {
+				d, err := binary.ReadVarint(r)
+				if err != nil {
+					return 0, 0, nil, ErrTypedBlockCorrupted
+				}
+				last += uint64(d)
+			}
+			points[i].Value.Uint = last
+		}
+	case TypeBool:
+		packed := make([]byte, (count+7)/8)
+		if _, err := io.ReadFull(r, packed); err != nil {
+			return 0, 0, nil, ErrTypedBlockCorrupted
+		}
+		for i := range points {
+			points[i].Value.Bool = packed[i/8]&(1<<(uint(i)%8)) != 0
+		}
+	case TypeString:
+		n, err := binary.ReadUvarint(r)
+		if err != nil || n > uint64(r.Len()) {
+			return 0, 0, nil, ErrTypedBlockCorrupted
+		}
+		words := make([]string, n)
+		for i := range words {
+			b, err := readLenPrefixed(r)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			words[i] = string(b)
+		}
+		for i := range points {
+			k, err := binary.ReadUvarint(r)
+			if err != nil || k >= n {
+				return 0, 0, nil, ErrTypedBlockCorrupted
+			}
+			points[i].Value.Str = words[k]
+		}
+	case TypeBytes:
+		for i := range points {
+			b, err := readLenPrefixed(r)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			points[i].Value.Bytes = b
+		}
+	}
+
+	return sensorID, typ, points, nil
+}
+
+// readLenPrefixed 读取 [长度 uvarint][内容]
+func readLenPrefixed(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, ErrTypedBlockCorrupted
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrTypedBlockCorrupted
+	}
+	return b, nil
+}
+
+// typedMeta 为 typed Block 生成元数据（与 Block.toMeta 对应）
+func typedMeta(points []TypedPoint) func(fileID uint32, offset int64, size uint32) *BlockMeta {
+	return func(fileID uint32, offset int64, size uint32) *BlockMeta {
+		meta := &BlockMeta{FileID: fileID, Offset: offset, Size: size, Count: uint16(len(points))}
+		for i, p := range points {
+			if i == 0 || p.Time < meta.MinTime {
+				meta.MinTime = p.Time
+			}
+			if i == 0 || p.Time > meta.MaxTime {
+				meta.MaxTime = p.Time
+			}
+		}
+		return meta
+	}
+}
+
+// sortAndDedupTyped 与 sortAndDedup 相同，作用于 typed 点
+func sortAndDedupTyped(points []TypedPoint) []TypedPoint {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+
+	out := points[:0]
+	for _, p := range points {
+		if len(out) > 0 && out[len(out)-1].Time == p.Time {
+			out[len(out)-1] = p
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
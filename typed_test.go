@@ -0,0 +1,135 @@
+package tcore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTypedBlock_RoundTrip(t *testing.T) {
+	cases := map[ValueType][]TypedPoint{
+		TypeUint: {{1, UintValue(100)}, {2, UintValue(105)}, {4, UintValue(3)}},
+		TypeBool: {{1, BoolValue(true)}, {2, BoolValue(false)}, {3, BoolValue(true)}},
+		TypeString: {
+			{10, StringValue("RUNNING")}, {20, StringValue("FAULT")}, {30, StringValue("RUNNING")},
+		},
+		TypeBytes: {{5, BytesValue([]byte{0xCA, 0xFE})}, {6, BytesValue(nil)}},
+		TypeFloat: {{-3, FloatValue(1.5)}},
+	}
+
+	for typ, points := range cases {
+		data, err := encodeTypedBlock(42, typ, points)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		id, gotType, got, err := decodeTypedBlock(data)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		if id != 42 || gotType != typ || len(got) != len(points) {
+			t.Fatalf("%s: header mismatch", typ)
+		}
+		for i := range points {
+			want, have := points[i], got[i]
+			if want.Time != have.Time || want.Value.String() != have.Value.String() || !bytes.Equal(want.Value.Bytes, have.Value.Bytes) {
+				t.Errorf("%s[%d]: expected %v, got %v", typ, i, want, have)
+			}
+		}
+	}
+}
+
+func TestDB_TypedSeries(t *testing.T) {
+	dir := t.TempDir()
+
+	db, _ := NewDB(dir)
+	if err := db.CreateSeries("pump.state", TypeString); err != nil {
+		t.Fatal(err)
+	}
+	db.WriteValue("pump.state", 1, StringValue("RUNNING"))
+	db.WriteValue("pump.state", 2, StringValue("FAULT"))
+	db.WriteValue("pump.cycles", 1, UintValue(7))
+
+	if err := db.Write("pump.state", 3, 1.0); err != ErrTypeMismatch {
+		t.Errorf("expected ErrTypeMismatch for float write, got %v", err)
+	}
+	if err := db.WriteValue("pump.cycles", 2, BoolValue(true)); err != ErrTypeMismatch {
+		t.Errorf("expected ErrTypeMismatch for bool write, got %v", err)
+	}
+
+	// 热数据落盘，重启后类型和数据都还在
+	s := db.idx.getSeries("pump.state")
+	db.flushTypedSeriesData(s, s.stealTypedLocked())
+	db.Close()
+
+	db, _ = NewDB(dir)
+	defer db.Close()
+
+	if typ, _ := db.SeriesType("pump.state"); typ != TypeString {
+		t.Fatalf("expected string series after reload, got %s", typ)
+	}
+	points, err := db.QueryValues("pump.state", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[1].Value.Str != "FAULT" {
+		t.Errorf("unexpected points: %v", points)
+	}
+	if _, err := db.Query("pump.state", 0, 10); err != ErrTypeMismatch {
+		t.Errorf("expected ErrTypeMismatch for float query, got %v", err)
+	}
+}
+
+func TestFlush_DrainsHotData(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("temp", 1, 21.5)
+	db.WriteValue("state", 2, StringValue("RUN"))
+	if err := db.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"temp", "state"} {
+		st, _ := db.Stats(name)
+		if st.Blocks != 1 || st.HotPoints != 0 {
+			t.Fatalf("%s: %+v", name, st)
+		}
+	}
+	db.Close()
+
+	// 没有 Flush 的话，热数据在 Close 之后就丢了
+	db, err = NewDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if points, _ := db.QueryValues("state", 0, 10); len(points) != 1 || points[0].Value.Str != "RUN" {
+		t.Fatalf("unexpected points %+v", points)
+	}
+}
+
+func TestWriteValue_CopiesBytes(t *testing.T) {
+	db, err := NewDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 调用方写完之后复用缓冲区，DB 里的值不能跟着变
+	buf := []byte{1, 2, 3}
+	db.WriteValue("frame", 1, BytesValue(buf))
+	db.WriteBatch("batch", []TypedPoint{{Time: 1, Value: BytesValue(buf)}})
+	buf[0] = 9
+
+	if points, _ := db.QueryValues("frame", 0, 10); len(points) != 1 || points[0].Value.Bytes[0] != 1 {
+		t.Fatalf("hot data aliases the caller's buffer: %+v", points)
+	}
+	last, err := db.LastPoints("batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := last["batch"]; p.Value.Bytes[0] != 1 {
+		t.Fatalf("latest point aliases the caller's buffer: %+v", p)
+	}
+}
@@ -0,0 +1,110 @@
+package tcore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ValueType 时间线的数值类型，在 Series 注册进字典时确定，之后不可更改
+type ValueType uint8
+
+const (
+	TypeFloat  ValueType = iota // float64 (默认，沿用原有的 Block 编码)
+	TypeUint                    // uint64 计数器
+	TypeBool                    // 开关量
+	TypeString                  // 枚举字符串，例如 "RUNNING" / "FAULT"
+	TypeBytes                   // 原始字节负载
+)
+
+var (
+	ErrTypeMismatch = errors.New("value type does not match series type")
+	ErrUnknownType  = errors.New("unknown value type")
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case TypeFloat:
+		return "float"
+	case TypeUint:
+		return "uint"
+	case TypeBool:
+		return "bool"
+	case TypeString:
+		return "string"
+	case TypeBytes:
+		return "bytes"
+	}
+	return fmt.Sprintf("ValueType(%d)", uint8(t))
+}
+
+// ParseValueType 把 "float" / "uint" / "bool" / "string" / "bytes" 解析为 ValueType
+func ParseValueType(s string) (ValueType, error) {
+	for t := TypeFloat; t <= TypeBytes; t++ {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownType, s)
+}
+
+// valid 是否为已知类型
+func (t ValueType) valid() bool {
+	return t <= TypeBytes
+}
+
+// Value 带类型的数值，只有与 Type 对应的字段有意义
+type Value struct {
+	Type  ValueType
+	Float float64
+	Uint  uint64
+	Bool  bool
+	Str   string
+	Bytes []byte
+}
+
+// FloatValue 构造 float64 数值
+func FloatValue(v float64) Value { return Value{Type: TypeFloat, Float: v} }
+
+// UintValue 构造 uint64 计数器数值
+func UintValue(v uint64) Value { return Value{Type: TypeUint, Uint: v} }
+
+// BoolValue 构造开关量数值
+func BoolValue(v bool) Value { return Value{Type: TypeBool, Bool: v} }
+
+// StringValue 构造枚举字符串数值
+func StringValue(v string) Value { return Value{Type: TypeString, Str: v} }
+
+// BytesValue 构造原始字节数值；写入时 DB 会复制一份，之后调用方可以复用 v
+func BytesValue(v []byte) Value { return Value{Type: TypeBytes, Bytes: v} }
+
+// clone 复制 Bytes：写入路径留在内存里的值 (热数据、最近一次写入、推给订阅者的点) 不能和调用方共用底层数组
+func (v Value) clone() Value {
+	if v.Bytes != nil {
+		v.Bytes = bytes.Clone(v.Bytes)
+	}
+	return v
+}
+
+// String 便于日志和调试输出
+func (v Value) String() string {
+	switch v.Type {
+	case TypeFloat:
+		return fmt.Sprintf("%g", v.Float)
+	case TypeUint:
+		return fmt.Sprintf("%d", v.Uint)
+	case TypeBool:
+		return fmt.Sprintf("%t", v.Bool)
+	case TypeString:
+		return v.Str
+	case TypeBytes:
+		return fmt.Sprintf("%x", v.Bytes)
+	}
+	return "<invalid>"
+}
+
+// TypedPoint 带类型的数据点
+type TypedPoint struct {
+	Time  int64
+	Value Value
+}